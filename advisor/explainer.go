@@ -18,19 +18,19 @@ package advisor
 
 import (
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 
 	"github.com/XiaoMi/soar/common"
 	"github.com/XiaoMi/soar/database"
 )
 
-var explainRuleID int
-
-// [EXP.XXX]Rule
-var explainRules map[string]Rule
-
-// [table_name]"suggest text"
-var tablesSuggests map[string][]string
+// explainContext 单条 SQL 的 EXPLAIN 分析上下文，使 ExplainAdvisor 可以被并发调用
+type explainContext struct {
+	// [table_name]"suggest text"
+	tablesSuggests map[string][]string
+}
 
 // explain建议的形式
 // Item: EXP.XXX
@@ -39,7 +39,7 @@ var tablesSuggests map[string][]string
 // Content: XX TABLE xxx
 
 // checkExplainSelectType
-func checkExplainSelectType(exp *database.ExplainInfo) {
+func (ctx *explainContext) checkExplainSelectType(exp *database.ExplainInfo) {
 	// 判断是否跳过不检查
 	if len(common.Config.ExplainWarnSelectType) == 1 {
 		if common.Config.ExplainWarnSelectType[0] == "" {
@@ -57,14 +57,14 @@ func checkExplainSelectType(exp *database.ExplainInfo) {
 	for _, v := range common.Config.ExplainWarnSelectType {
 		for _, row := range exp.ExplainRows {
 			if row.SelectType == v && v != "" {
-				tablesSuggests[row.TableName] = append(tablesSuggests[row.TableName], fmt.Sprintf("SelectType:%s", row.SelectType))
+				ctx.tablesSuggests[row.TableName] = append(ctx.tablesSuggests[row.TableName], fmt.Sprintf("SelectType:%s", row.SelectType))
 			}
 		}
 	}
 }
 
 // checkExplainAccessType 用户可以设置AccessType的建议级别，匹配到的查询会给出建议
-func checkExplainAccessType(exp *database.ExplainInfo) {
+func (ctx *explainContext) checkExplainAccessType(exp *database.ExplainInfo) {
 	// 判断是否跳过不检查
 	if len(common.Config.ExplainWarnAccessType) == 1 {
 		if common.Config.ExplainWarnAccessType[0] == "" {
@@ -82,7 +82,7 @@ func checkExplainAccessType(exp *database.ExplainInfo) {
 	for _, v := range common.Config.ExplainWarnAccessType {
 		for _, row := range rows {
 			if row.AccessType == v && v != "" {
-				tablesSuggests[row.TableName] = append(tablesSuggests[row.TableName], fmt.Sprintf("Scalability:%s", row.Scalability))
+				ctx.tablesSuggests[row.TableName] = append(ctx.tablesSuggests[row.TableName], fmt.Sprintf("Scalability:%s", row.Scalability))
 			}
 		}
 	}
@@ -110,7 +110,7 @@ func checkExplainExtra(exp *database.ExplainInfo) {
 */
 
 // checkExplainRef ...
-func checkExplainRef(exp *database.ExplainInfo) {
+func (ctx *explainContext) checkExplainRef(exp *database.ExplainInfo) {
 	rows := exp.ExplainRows
 	if exp.ExplainFormat == database.JSONFormatExplain {
 		// JSON形式遍历分析不方便，转成Row格式统一处理
@@ -121,13 +121,13 @@ func checkExplainRef(exp *database.ExplainInfo) {
 			if i == 0 && len(rows) > 1 {
 				continue
 			}
-			tablesSuggests[row.TableName] = append(tablesSuggests[row.TableName], fmt.Sprintf("Ref:null"))
+			ctx.tablesSuggests[row.TableName] = append(ctx.tablesSuggests[row.TableName], fmt.Sprintf("Ref:null"))
 		}
 	}
 }
 
 // checkExplainRows ...
-func checkExplainRows(exp *database.ExplainInfo) {
+func (ctx *explainContext) checkExplainRows(exp *database.ExplainInfo) {
 	// 判断是否跳过不检查
 	if common.Config.ExplainMaxRows <= 0 {
 		return
@@ -141,13 +141,13 @@ func checkExplainRows(exp *database.ExplainInfo) {
 
 	for _, row := range rows {
 		if row.Rows >= common.Config.ExplainMaxRows {
-			tablesSuggests[row.TableName] = append(tablesSuggests[row.TableName], fmt.Sprintf("Rows:%d", row.Rows))
+			ctx.tablesSuggests[row.TableName] = append(ctx.tablesSuggests[row.TableName], fmt.Sprintf("Rows:%d", row.Rows))
 		}
 	}
 }
 
 // checkExplainFiltered ...
-func checkExplainFiltered(exp *database.ExplainInfo) {
+func (ctx *explainContext) checkExplainFiltered(exp *database.ExplainInfo) {
 	// 判断是否跳过不检查
 	if common.Config.ExplainMaxFiltered <= 0.001 {
 		return
@@ -163,27 +163,196 @@ func checkExplainFiltered(exp *database.ExplainInfo) {
 			continue
 		}
 		if row.Filtered >= common.Config.ExplainMaxFiltered {
-			tablesSuggests[row.TableName] = append(tablesSuggests[row.TableName], fmt.Sprintf("Filtered:%.2f%s", row.Filtered, "%"))
+			ctx.tablesSuggests[row.TableName] = append(ctx.tablesSuggests[row.TableName], fmt.Sprintf("Filtered:%.2f%s", row.Filtered, "%"))
+		}
+	}
+}
+
+// formatExplainNumber 去掉执行计划中数值多余的小数位
+func formatExplainNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// checkExplainTree 基于 EXPLAIN ANALYZE 的实际执行信息给出建议
+// EXP.001 预估行数与实际行数偏差过大，EXP.002 嵌套循环中的迭代器执行次数过多，EXP.003 最耗时的迭代器
+func checkExplainTree(exp *database.ExplainInfo) map[string]Rule {
+	rules := make(map[string]Rule)
+	if exp.ExplainFormat != database.AnalyzeFormatExplain || len(exp.ExplainTree) == 0 {
+		return rules
+	}
+
+	var misestimates, loops []string
+	var expensive *database.ExplainTreeNode
+	var total float64
+	database.WalkExplainTree(exp.ExplainTree, func(node, parent *database.ExplainTreeNode) {
+		if !node.Analyzed || node.NeverExecuted || node.Loops == 0 {
+			return
+		}
+		if parent == nil {
+			total += node.TotalTime()
+		}
+
+		// 行数较少时偏差的倍数没有意义，不足 1 行的按 1 行计算
+		estimated, actual := math.Max(node.EstimatedRows, 1), math.Max(node.ActualRows, 1)
+		if common.Config.ExplainMaxMisestimate > 0 && node.EstimatedRows > 0 &&
+			math.Max(estimated, actual)/math.Min(estimated, actual) >= common.Config.ExplainMaxMisestimate {
+			misestimates = append(misestimates, fmt.Sprintf("%s 预估%s行，实际%s行",
+				node.Operation, formatExplainNumber(node.EstimatedRows), formatExplainNumber(node.ActualRows)))
+		}
+
+		if common.Config.ExplainMaxLoops > 0 && node.Loops >= common.Config.ExplainMaxLoops &&
+			parent != nil && strings.HasPrefix(parent.Operation, "Nested loop") {
+			loops = append(loops, fmt.Sprintf("%s 执行了%d次，累计耗时%.3fms", node.Operation, node.Loops, node.TotalTime()))
+		}
+
+		if expensive == nil || node.SelfTime() > expensive.SelfTime() {
+			expensive = node
+		}
+	})
+
+	if len(misestimates) > 0 && !IsIgnoreRule("EXP.001") {
+		rules["EXP.001"] = Rule{
+			Item:     "EXP.001",
+			Severity: "L3",
+			Summary:  "预估行数与实际行数偏差过大",
+			Content:  strings.Join(misestimates, "; "),
+			Case:     "统计信息不准确时优化器可能选择错误的执行计划，建议执行ANALYZE TABLE更新统计信息，对非索引列的条件可以通过ANALYZE TABLE ... UPDATE HISTOGRAM创建直方图。",
 		}
 	}
+	if len(loops) > 0 && !IsIgnoreRule("EXP.002") {
+		rules["EXP.002"] = Rule{
+			Item:     "EXP.002",
+			Severity: "L3",
+			Summary:  "嵌套循环中的迭代器执行次数过多",
+			Content:  strings.Join(loops, "; "),
+			Case:     "驱动表返回的行数过多时嵌套循环连接的代价很高，建议为被驱动表的连接列添加索引，或通过更严格的过滤条件减少驱动表返回的行数。",
+		}
+	}
+	if expensive != nil && total > 0 && !IsIgnoreRule("EXP.003") {
+		rules["EXP.003"] = Rule{
+			Item:     "EXP.003",
+			Severity: "L1",
+			Summary:  "最耗时的迭代器",
+			Content: fmt.Sprintf("%s 自身耗时%.3fms，占总耗时%.3fms的%.1f%%",
+				expensive.Operation, expensive.SelfTime(), total, math.Min(expensive.SelfTime()/total*100, 100)),
+		}
+	}
+	return rules
+}
+
+// checkExplainJSON 基于 JSON 格式执行计划中特有的代价、索引使用及过滤条件信息给出建议
+// EXP.004 复合索引只使用了部分索引列，EXP.005 代价最高的表，EXP.006 全表或全索引扫描时的过滤条件，EXP.007 子查询物化为临时表
+func checkExplainJSON(exp *database.ExplainInfo) map[string]Rule {
+	rules := make(map[string]Rule)
+	if exp.ExplainFormat != database.JSONFormatExplain || exp.ExplainJSON == nil {
+		return rules
+	}
+
+	tables := database.ExplainJSONTables(exp.ExplainJSON)
+	var partial, scans, materialized []string
+	var expensive *database.ExplainJSONTable
+	var total float64
+	for _, table := range tables {
+		// 复合索引只用到了前缀部分的列，需要有索引定义才能判断
+		// explain-digest 直接分析粘贴的 EXPLAIN 文本，没有数据库连接，IndexColumns 为空，不会给出 EXP.004
+		if columns, ok := exp.IndexColumns[database.IndexColumnsKey(table.TableName, table.Key)]; ok &&
+			len(table.UsedKeyParts) > 0 && len(table.UsedKeyParts) < len(columns) {
+			partial = append(partial, fmt.Sprintf("表 %s 使用索引 %s(%s) 时只用到了 %s",
+				table.TableName, table.Key, strings.Join(columns, ","), strings.Join(table.UsedKeyParts, ",")))
+		}
+
+		if (table.AccessType == "ALL" || table.AccessType == "index") && table.AttachedCondition != "" {
+			scans = append(scans, fmt.Sprintf("表 %s (%s): %s", table.TableName, table.AccessType, table.AttachedCondition))
+		}
+
+		if table.MaterializedFromSubquery.UsingTemporaryTable {
+			content := fmt.Sprintf("%s 物化为临时表", table.TableName)
+			if table.MaterializedFromSubquery.Dependent {
+				content += "，且依赖外层查询，每次外层取值都需要重新物化"
+			}
+			materialized = append(materialized, content)
+		}
+
+		cost := database.JSONTableCost(table)
+		total += cost
+		if expensive == nil || cost > database.JSONTableCost(expensive) {
+			expensive = table
+		}
+	}
+	if queryCost := database.ParseJSONCost(exp.ExplainJSON.QueryBlock.CostInfo.QueryCost); queryCost > total {
+		total = queryCost
+	}
+
+	if len(partial) > 0 && !IsIgnoreRule("EXP.004") {
+		rules["EXP.004"] = Rule{
+			Item:     "EXP.004",
+			Severity: "L2",
+			Summary:  "复合索引只使用了部分索引列",
+			Content:  strings.Join(partial, "; "),
+			Case:     "复合索引遵循最左前缀原则，遇到范围查询或索引列上缺少等值条件时后续的索引列无法用于过滤。可以检查查询条件是否覆盖了索引中的列，或调整索引列的顺序将等值条件列放在范围条件列之前。",
+		}
+	}
+	if len(tables) > 1 && expensive != nil && total > 0 && !IsIgnoreRule("EXP.005") {
+		cost := database.JSONTableCost(expensive)
+		rules["EXP.005"] = Rule{
+			Item:     "EXP.005",
+			Severity: "L1",
+			Summary:  "查询代价最高的表",
+			Content: fmt.Sprintf("表 %s 的代价为%s(read_cost: %s, eval_cost: %s)，占查询总代价%s的%.1f%%",
+				expensive.TableName, formatExplainNumber(cost), expensive.CostInfo.ReadCost, expensive.CostInfo.EvalCost,
+				formatExplainNumber(total), math.Min(cost/total*100, 100)),
+		}
+	}
+	if len(scans) > 0 && !IsIgnoreRule("EXP.006") {
+		rules["EXP.006"] = Rule{
+			Item:     "EXP.006",
+			Severity: "L2",
+			Summary:  "全表或全索引扫描时的过滤条件",
+			Content:  strings.Join(scans, "; "),
+			Case:     "以下条件没能使用索引，只能在扫描数据后逐行过滤。可以检查条件中的列是否有索引，以及是否对索引列使用了函数、隐式类型转换等导致索引失效的写法。",
+		}
+	}
+	if len(materialized) > 0 && !IsIgnoreRule("EXP.007") {
+		rules["EXP.007"] = Rule{
+			Item:     "EXP.007",
+			Severity: "L2",
+			Summary:  "子查询被物化为临时表",
+			Content:  strings.Join(materialized, "; "),
+			Case:     "派生表或子查询的结果会先写入临时表，临时表上没有索引且较大时会写入磁盘。可以尝试将子查询改写为 JOIN，或在子查询中尽早过滤数据。",
+		}
+	}
+	return rules
 }
 
 // ExplainAdvisor 基于explain信息给出建议
 func ExplainAdvisor(exp *database.ExplainInfo) map[string]Rule {
 	common.Log.Debug("ExplainAdvisor SQL: %v", exp.SQL)
-	explainRuleID = 0
-	explainRules = make(map[string]Rule)
-	tablesSuggests = make(map[string][]string)
+	explainRules := make(map[string]Rule)
+	ctx := &explainContext{
+		tablesSuggests: make(map[string][]string),
+	}
 
-	checkExplainSelectType(exp)
-	checkExplainAccessType(exp)
-	checkExplainFiltered(exp)
-	checkExplainRef(exp)
-	checkExplainRows(exp)
+	ctx.checkExplainSelectType(exp)
+	ctx.checkExplainAccessType(exp)
+	ctx.checkExplainFiltered(exp)
+	ctx.checkExplainRef(exp)
+	ctx.checkExplainRows(exp)
 
 	// 打印explain table
 	content := database.PrintMarkdownExplainTable(exp)
 
+	// 以树形展示执行计划，便于查看子查询、派生表、UNION 的嵌套关系
+	if common.Config.ExplainPlanFormat != "" && content != "" {
+		if plan := database.PrintMarkdownExplainPlan(exp, common.Config.ExplainPlanFormat); plan != "" {
+			content += "\n" + plan
+		}
+	}
+
+	// 内嵌 TiDB 的执行计划与 MySQL 不同，需要提示用户
+	if exp.TiDB && content != "" {
+		content = "以下 EXPLAIN 信息来自内嵌 TiDB 测试环境，执行计划为 TiDB 优化器的语义，与 MySQL 的执行计划可能不一致，仅供参考。\n\n" + content
+	}
+
 	if common.Config.ShowWarnings {
 		content += "\n" + database.MySQLExplainWarnings(exp)
 	}
@@ -206,28 +375,62 @@ func ExplainAdvisor(exp *database.ExplainInfo) map[string]Rule {
 			Func:     (*Query4Audit).RuleOK,
 		}
 	}
+	for item, rule := range checkExplainTree(exp) {
+		explainRules[item] = rule
+	}
+	for item, rule := range checkExplainJSON(exp) {
+		explainRules[item] = rule
+	}
 	// TODO: 检查explain对应的表是否需要跳过，如dual,空表等
 	return explainRules
 }
 
 // DigestExplainText 分析用户输入的EXPLAIN信息
+// 输入中可以包含多段 EXPLAIN 输出，每段分别给出分析结果，能找到对应 SQL 时同时给出启发式建议
 func DigestExplainText(text string) {
 	// explain信息就不要显示完美了，美不美自己看吧。
 	common.Config.IgnoreRules = append(common.Config.IgnoreRules, "OK")
 
-	if !IsIgnoreRule("EXP.") {
-		explainInfo, err := database.ParseExplainText(text)
+	if IsIgnoreRule("EXP.") {
+		return
+	}
+	blocks := database.SplitExplainText(text)
+	if len(blocks) == 0 {
+		// 无法识别的格式仍按单段 EXPLAIN 解析，由 ParseExplainText 给出错误信息
+		blocks = []database.ExplainBlock{{Text: text}}
+	}
+
+	var outputs []string
+	for i, block := range blocks {
+		explainInfo, err := database.ParseExplainText(block.Text)
 		if err != nil {
 			common.Log.Error("main ParseExplainText Error: %v", err)
-			return
+			continue
+		}
+		explainInfo.SQL = block.SQL
+		suggests := []map[string]Rule{ExplainAdvisor(explainInfo)}
+		if block.SQL != "" {
+			if q, err := NewQuery4Audit(block.SQL); err == nil {
+				suggests = append(suggests, q.HeuristicCheck())
+			} else {
+				common.Log.Warning("DigestExplainText syntax error, SQL: %s, Error: %v", block.SQL, err)
+			}
 		}
-		expSuggest := ExplainAdvisor(explainInfo)
-		_, output := FormatSuggest("", "", common.Config.ReportType, expSuggest)
-		if common.Config.ReportType == "html" {
-			fmt.Println(common.MarkdownHTMLHeader())
-			fmt.Println(common.Markdown2HTML(output))
-		} else {
-			fmt.Println(output)
+		_, output := FormatSuggest(block.SQL, "", common.Config.ReportType, suggests...)
+		// 多段 EXPLAIN 中没有对应 SQL 的段落用序号区分
+		if block.SQL == "" && len(blocks) > 1 {
+			output = fmt.Sprintf("# EXPLAIN %d\n\n", i+1) + output
 		}
+		outputs = append(outputs, output)
+	}
+	if len(outputs) == 0 {
+		return
+	}
+	output := strings.Join(outputs, "\n")
+	if common.Config.ReportType == "html" {
+		fmt.Println(common.MarkdownHTMLHeader())
+		fmt.Println(common.Markdown2HTML(output))
+	} else {
+		fmt.Println(output)
 	}
 }
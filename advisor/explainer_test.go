@@ -17,9 +17,11 @@
 package advisor
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/XiaoMi/soar/common"
+	"github.com/XiaoMi/soar/database"
 )
 
 func TestDigestExplainText(t *testing.T) {
@@ -43,3 +45,145 @@ func TestDigestExplainText(t *testing.T) {
 	}
 	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
 }
+
+func TestDigestExplainTextMultiBlocks(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	var text = `mysql> explain select * from film where title like '%ACE%';
++----+-------------+-------+------+---------------+------+---------+------+------+----------+-------------+
+| id | select_type | table | type | possible_keys | key  | key_len | ref  | rows | filtered | Extra       |
++----+-------------+-------+------+---------------+------+---------+------+------+----------+-------------+
+|  1 | SIMPLE      | film  | ALL  | NULL          | NULL | NULL    | NULL | 1000 |    11.11 | Using where |
++----+-------------+-------+------+---------------+------+---------+------+------+----------+-------------+
+1 row in set, 1 warning (0.00 sec)
+
+下面这个没有 SQL:
+*************************** 1. row ***************************
+           id: 1
+  select_type: SIMPLE
+        table: city
+   partitions: NULL
+         type: const
+possible_keys: PRIMARY
+          key: PRIMARY
+      key_len: 2
+          ref: const
+         rows: 1
+     filtered: 100.00
+        Extra: NULL
+1 row in set, 1 warning (0.00 sec)`
+	orgReportType := common.Config.ReportType
+	orgIgnoreRules := common.Config.IgnoreRules
+	common.Config.ReportType = "explain-digest"
+	err := common.GoldenDiff(func() {
+		DigestExplainText(text)
+	}, t.Name(), update)
+	if nil != err {
+		t.Fatal(err)
+	}
+	common.Config.ReportType = orgReportType
+	common.Config.IgnoreRules = orgIgnoreRules
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestExplainAdvisorAnalyze(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	var text = `EXPLAIN: -> Nested loop inner join  (cost=2350 rows=100) (actual time=0.112..95.3 rows=5000 loops=1)
+    -> Table scan on c  (cost=105 rows=100) (actual time=0.041..1.3 rows=5000 loops=1)
+    -> Index lookup on a using idx_city_id (city_id=c.city_id)  (cost=0.25 rows=1) (actual time=0.015..0.018 rows=1 loops=5000)`
+	exp, err := database.ParseExplainText(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := ExplainAdvisor(exp)
+	if rule, ok := rules["EXP.001"]; !ok || !strings.Contains(rule.Content, "Table scan on c 预估100行，实际5000行") {
+		t.Errorf("EXP.001 got %+v", rule)
+	}
+	if rule, ok := rules["EXP.002"]; !ok || !strings.HasPrefix(rule.Content, "Index lookup on a using idx_city_id (city_id=c.city_id) 执行了5000次") {
+		t.Errorf("EXP.002 got %+v", rule)
+	}
+	// 95.3 - 1.3 - 0.018 * 5000
+	if rule, ok := rules["EXP.003"]; !ok || !strings.HasPrefix(rule.Content, "Index lookup on a") {
+		t.Errorf("EXP.003 got %+v", rule)
+	}
+
+	orgIgnoreRules := common.Config.IgnoreRules
+	common.Config.IgnoreRules = []string{"EXP.002"}
+	if _, ok := ExplainAdvisor(exp)["EXP.002"]; ok {
+		t.Error("EXP.002 should be ignored")
+	}
+	common.Config.IgnoreRules = orgIgnoreRules
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestExplainAdvisorJSON(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	var text = `{
+  "query_block": {
+    "select_id": 1,
+    "cost_info": {
+      "query_cost": "1230.00"
+    },
+    "nested_loop": [
+      {
+        "table": {
+          "table_name": "c",
+          "access_type": "ALL",
+          "rows_examined_per_scan": 1000,
+          "rows_produced_per_join": 100,
+          "filtered": "10.00",
+          "cost_info": {
+            "read_cost": "180.00",
+            "eval_cost": "20.00",
+            "prefix_cost": "200.00",
+            "data_read_per_join": "23K"
+          },
+          "used_columns": ["city_id", "city", "country_id"],
+          "attached_condition": "(lower(c.city) = 'beijing')"
+        }
+      },
+      {
+        "table": {
+          "table_name": "a",
+          "access_type": "ref",
+          "possible_keys": ["idx_city_id_phone"],
+          "key": "idx_city_id_phone",
+          "used_key_parts": ["city_id"],
+          "key_length": "2",
+          "ref": ["sakila.c.city_id"],
+          "rows_examined_per_scan": 5,
+          "rows_produced_per_join": 500,
+          "filtered": "100.00",
+          "cost_info": {
+            "read_cost": "930.00",
+            "eval_cost": "100.00",
+            "prefix_cost": "1230.00",
+            "data_read_per_join": "10K"
+          },
+          "used_columns": ["address_id", "city_id", "phone"]
+        }
+      }
+    ]
+  }
+}`
+	exp, err := database.ParseExplainText(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.IndexColumns = map[string][]string{
+		database.IndexColumnsKey("a", "idx_city_id_phone"): {"city_id", "phone"},
+	}
+	rules := ExplainAdvisor(exp)
+	if rule := rules["EXP.004"]; rule.Content != "表 a 使用索引 idx_city_id_phone(city_id,phone) 时只用到了 city_id" {
+		t.Errorf("EXP.004 got %s", rule.Content)
+	}
+	if rule := rules["EXP.005"]; rule.Content != "表 a 的代价为1030(read_cost: 930.00, eval_cost: 100.00)，占查询总代价1230的83.7%" {
+		t.Errorf("EXP.005 got %s", rule.Content)
+	}
+	if rule := rules["EXP.006"]; rule.Content != "表 c (ALL): (lower(c.city) = 'beijing')" {
+		t.Errorf("EXP.006 got %s", rule.Content)
+	}
+	if _, ok := rules["EXP.007"]; ok {
+		t.Errorf("EXP.007 should not be given")
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
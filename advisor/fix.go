@@ -0,0 +1,99 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package advisor
+
+import (
+	"github.com/XiaoMi/soar/ast"
+	"github.com/XiaoMi/soar/common"
+)
+
+// isFixRule 检查 name 是否为可单条 SQL 执行的重写规则
+func isFixRule(name string) bool {
+	for _, r := range ast.RewriteRules {
+		if r.Name == name && r.Func != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnsafeFix 检查修复规则是否可能改变查询结果，这类规则需要 -fix-unsafe 才会自动执行
+func isUnsafeFix(name string) bool {
+	for _, r := range ast.RewriteRules {
+		if r.Name == name {
+			return r.Unsafe
+		}
+	}
+	return false
+}
+
+// Fix 对 SQL 执行命中的启发式建议中声明的修复规则，返回修复后的 SQL，以及已修复和无法修复的建议
+// columns 为 star2columns, insertcolumns 等规则依赖的表结构信息，未配置测试环境时可以为 nil
+// 修复后会重新执行规则检查，修复规则未生效或修复后依然命中的建议视为无法修复
+// 可能改变查询结果的修复规则在未开启 -fix-unsafe 时不执行，对应的建议只作为无法修复的建议列出
+// 修复后的 SQL 无法重新解析时放弃修复，返回原始 SQL，所有建议均视为无法修复
+func Fix(sql string, suggest map[string]Rule, columns common.TableColumns) (string, []Rule, []Rule) {
+	var fixed, unfixed []Rule
+	var names []string
+	for _, item := range common.SortedKey(suggest) {
+		fix := suggest[item].Fix
+		if fix == "" {
+			fix = HeuristicRules[item].Fix
+		}
+		if fix != "" && (common.Config.FixUnsafe || !isUnsafeFix(fix)) {
+			names = append(names, fix)
+		}
+	}
+
+	newSQL := sql
+	applied := make(map[string]bool)
+	if rw := ast.NewRewrite(sql); rw != nil && len(names) > 0 {
+		rw.Columns = columns
+		for _, name := range rw.RewriteByName(names...) {
+			applied[name] = true
+		}
+		if len(applied) > 0 {
+			newSQL = rw.NewSQL
+		}
+	}
+
+	q, err := NewQuery4Audit(newSQL)
+	if len(applied) > 0 && (err != nil || q.Stmt == nil) {
+		common.Log.Warning("Fix rewritten SQL syntax error, SQL: %s, Error: %v", newSQL, err)
+		newSQL = sql
+		applied = make(map[string]bool)
+	}
+	for _, item := range common.SortedKey(suggest) {
+		if item == "OK" {
+			continue
+		}
+		rule := suggest[item]
+		if rule.Fix == "" {
+			rule.Fix = HeuristicRules[item].Fix
+		}
+		if !applied[rule.Fix] {
+			unfixed = append(unfixed, rule)
+			continue
+		}
+		if f := HeuristicRules[item].Func; f != nil && f(q).Item == item {
+			unfixed = append(unfixed, rule)
+			continue
+		}
+		fixed = append(fixed, rule)
+	}
+	return newSQL, fixed, unfixed
+}
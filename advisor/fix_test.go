@@ -0,0 +1,93 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package advisor
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+func TestFix(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	cases := []struct {
+		sql     string
+		unsafe  bool
+		newSQL  string
+		fixed   []string
+		unfixed []string
+	}{
+		{
+			sql:     "SELECT col FROM tbl WHERE c IN (1, NULL) GROUP BY col",
+			unsafe:  true,
+			newSQL:  "select col from tbl where (c in (1) or c is null) group by col order by null",
+			fixed:   []string{"ARG.004", "CLA.008"},
+			unfixed: []string{},
+		},
+		{
+			// innull 会改变查询结果，默认只作为建议列出
+			sql:     "SELECT col FROM tbl WHERE c IN (1, NULL) GROUP BY col",
+			newSQL:  "select col from tbl where c in (1, null) group by col order by null",
+			fixed:   []string{"CLA.008"},
+			unfixed: []string{"ARG.004"},
+		},
+		{
+			// 未提供表结构信息时 star2columns 无法生效
+			sql:     "SELECT * FROM tbl WHERE c NOT IN (NULL)",
+			newSQL:  "SELECT * FROM tbl WHERE c NOT IN (NULL)",
+			fixed:   []string{},
+			unfixed: []string{"ARG.004", "COL.001"},
+		},
+	}
+	orgUnsafe := common.Config.FixUnsafe
+	defer func() { common.Config.FixUnsafe = orgUnsafe }()
+	for _, c := range cases {
+		common.Config.FixUnsafe = c.unsafe
+		q, err := NewQuery4Audit(c.sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		suggest := make(map[string]Rule)
+		for item, rule := range q.HeuristicCheck() {
+			for _, i := range append(c.fixed, c.unfixed...) {
+				if i == item {
+					suggest[item] = rule
+				}
+			}
+		}
+		newSQL, fixed, unfixed := Fix(c.sql, suggest, nil)
+		if newSQL != c.newSQL {
+			t.Errorf("want: %s\ngot: %s", c.newSQL, newSQL)
+		}
+		if len(fixed) != len(c.fixed) || len(unfixed) != len(c.unfixed) {
+			t.Errorf("SQL: %s, want fixed: %v, unfixed: %v, got fixed: %v, unfixed: %v",
+				c.sql, c.fixed, c.unfixed, fixed, unfixed)
+			continue
+		}
+		for i, r := range fixed {
+			if r.Item != c.fixed[i] {
+				t.Errorf("want fixed: %s, got: %s", c.fixed[i], r.Item)
+			}
+		}
+		for i, r := range unfixed {
+			if r.Item != c.unfixed[i] {
+				t.Errorf("want unfixed: %s, got: %s", c.unfixed[i], r.Item)
+			}
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
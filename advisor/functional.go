@@ -0,0 +1,225 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package advisor
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/XiaoMi/soar/ast"
+	"github.com/XiaoMi/soar/common"
+)
+
+// functionalIndexSupported MySQL 8.0.13 开始支持函数索引，MariaDB 的版本号从 10 开始，不支持该语法
+func functionalIndexSupported(version int) bool {
+	return version >= 80013 && version < 100000
+}
+
+// generatedColumnSupported MySQL 5.7.8 开始支持为虚拟生成列添加索引，优化器会将与生成列定义相同的表达式替换为生成列
+func generatedColumnSupported(version int) bool {
+	return version >= 50708 && version < 100000
+}
+
+// generatedColumnTypes 生成列的数据类型，key 为函数名，值为空时与参数中的列类型一致
+var generatedColumnTypes = map[string]string{
+	"date":       "date",
+	"year":       "int",
+	"month":      "int",
+	"day":        "int",
+	"dayofmonth": "int",
+	"dayofweek":  "int",
+	"dayofyear":  "int",
+	"hour":       "int",
+	"minute":     "int",
+	"quarter":    "int",
+	"week":       "int",
+	"lower":      "",
+	"upper":      "",
+	"lcase":      "",
+	"ucase":      "",
+	"trim":       "",
+	"ltrim":      "",
+	"rtrim":      "",
+	"left":       "",
+	"right":      "",
+	"substring":  "",
+	"substr":     "",
+	"reverse":    "",
+}
+
+// jsonPathExp 用于从 JSON 表达式中提取路径，生成索引名称
+var jsonPathExp = regexp.MustCompile(`'\$\.?([^']*)'`)
+
+// nameUnsafeExp 索引名称中不便使用的字符
+var nameUnsafeExp = regexp.MustCompile(`[^0-9A-Za-z]+`)
+
+// buildFunctionalIndex 为 WHERE 及 JOIN 条件中无法使用普通索引的函数表达式给出索引建议
+// MySQL 8.0.13 及以上版本使用函数索引，JSON 表达式及低版本使用虚拟生成列加索引
+func (idxAdv *IndexAdvisor) buildFunctionalIndex() []IndexInfo {
+	version := common.Config.OnlineDSN.Version
+	if len(idxAdv.functional) == 0 || envDisabled(idxAdv.vEnv) || !generatedColumnSupported(version) {
+		return nil
+	}
+
+	var indexes []IndexInfo
+	for _, f := range idxAdv.functional {
+		cols := idxAdv.completeColumnsInfo(f.Columns)
+		db, tb := cols[0].DB, cols[0].Table
+		if db == "" || tb == "" {
+			common.Log.Warn("can not get the meta info of expression '%s'", f.Expr)
+			continue
+		}
+		realDB := idxAdv.vEnv.RealDB(db)
+		if idxAdv.hasFunctionalIndex(realDB, tb, f.Expr) {
+			common.Log.Debug("functional index %s already exists on `%s`.`%s`", f.Expr, realDB, tb)
+			continue
+		}
+
+		name := functionalName(f)
+		idx := IndexInfo{
+			Name:          truncateIndexName(common.Config.IdxPrefix + name),
+			Database:      realDB,
+			Table:         tb,
+			ColumnDetails: cols,
+			Expression:    f.Expr,
+		}
+		switch {
+		case functionalIndexSupported(version) && !f.IsJSON():
+			idx.DDL = idx.addIndexSQL(fmt.Sprintf("`%s`.`%s`", realDB, tb))
+		default:
+			// JSON 表达式的返回值无法直接添加索引，需要通过生成列转换为字符串
+			expr, dataType := f.Expr, "varchar(255)"
+			if f.IsJSON() {
+				if f.FuncName != "->>" && f.FuncName != "json_unquote" {
+					expr = fmt.Sprintf("json_unquote(%s)", f.Expr)
+				}
+			} else {
+				dataType = generatedColumnType(f.FuncName, cols[0])
+				if dataType == "" {
+					common.Log.Debug("can not infer generated column type of expression '%s'", f.Expr)
+					continue
+				}
+			}
+			idx.Generated = truncateIndexName("gc_" + name)
+			idx.Name = truncateIndexName(common.Config.IdxPrefix + idx.Generated)
+			idx.generatedDef = fmt.Sprintf("%s generated always as (%s) virtual", dataType, expr)
+			idx.DDL = idx.addIndexSQL(fmt.Sprintf("`%s`.`%s`", realDB, tb))
+		}
+		indexes = append(indexes, idx)
+	}
+	return indexes
+}
+
+// hasFunctionalIndex 检查表中是否已经存在相同表达式的函数索引
+func (idxAdv *IndexAdvisor) hasFunctionalIndex(db, tb, expr string) bool {
+	tmpDB := *idxAdv.vEnv
+	tmpDB.Database = idxAdv.vEnv.DBHash(db)
+	idxInfo, err := tmpDB.ShowIndex(tb)
+	if err != nil || idxInfo == nil {
+		return false
+	}
+	for _, row := range idxInfo.Rows {
+		if len(row.Expression) > 0 && normalizeExpression(string(row.Expression)) == normalizeExpression(expr) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeExpression 去掉表达式中的反引号及空白字符，便于比较
+func normalizeExpression(expr string) string {
+	expr = strings.ToLower(strings.Replace(expr, "`", "", -1))
+	return strings.Join(strings.Fields(expr), "")
+}
+
+// functionalName 根据函数名、列名及 JSON 路径生成索引名称
+func functionalName(f ast.FunctionalExpr) string {
+	fn := f.FuncName
+	if fn == "->" || fn == "->>" {
+		fn = "json"
+	}
+	parts := []string{fn}
+	for _, col := range f.Columns {
+		parts = append(parts, col.Name)
+	}
+	if f.IsJSON() {
+		if m := jsonPathExp.FindStringSubmatch(f.Expr); len(m) > 1 {
+			path := strings.Trim(nameUnsafeExp.ReplaceAllString(m[1], "_"), "_")
+			if path != "" {
+				parts = append(parts, path)
+			}
+		}
+	}
+	return strings.ToLower(strings.Join(parts, "_"))
+}
+
+// truncateIndexName 索引及列名称最大长度64
+func truncateIndexName(name string) string {
+	if len(name) > IndexNameMaxLength {
+		common.Log.Warn("index '%s' name large than IndexNameMaxLength", name)
+		name = strings.TrimRight(name[:IndexNameMaxLength], "_")
+	}
+	return name
+}
+
+// generatedColumnType 推断生成列的数据类型，无法推断时返回空
+func generatedColumnType(fn string, col *common.Column) string {
+	dataType, ok := generatedColumnTypes[fn]
+	if !ok {
+		return ""
+	}
+	if dataType == "" {
+		return col.DataType
+	}
+	return dataType
+}
+
+// formatFunctionalIndex 输出函数索引建议的说明
+func formatFunctionalIndex(advise IndexInfo) string {
+	if advise.Generated == "" {
+		return fmt.Sprintf("为表达式%s添加函数索引，该表达式在查询条件中无法使用普通索引(FUN.001)", advise.Expression)
+	}
+	content := fmt.Sprintf("为表达式%s添加虚拟生成列%s并为其添加索引，该表达式在查询条件中无法使用普通索引(FUN.001)", advise.Expression, advise.Generated)
+	// 生成列的定义与查询条件中的表达式不一致时，优化器无法自动使用生成列上的索引
+	if unquoted := fmt.Sprintf("json_unquote(%s)", advise.Expression); strings.Contains(advise.DDL, "("+unquoted+") virtual") {
+		content += fmt.Sprintf("，查询条件需要改写为%s或直接使用生成列%s才能使用该索引", unquoted, advise.Generated)
+	}
+	return content
+}
+
+// LinkFunctionalIndex 将 FUN.001 启发式建议与对应的函数索引建议关联起来
+func LinkFunctionalIndex(heuristicSuggest, idxSuggest map[string]Rule) {
+	fun, ok := heuristicSuggest["FUN.001"]
+	if !ok {
+		return
+	}
+	var items []string
+	for item, rule := range idxSuggest {
+		if strings.HasPrefix(item, "IDX.") && strings.Contains(rule.Content, "(FUN.001)") {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		return
+	}
+	sort.Strings(items)
+	// FUN.001 的内容为英文，追加的说明使用相同的语言
+	fun.Content += fmt.Sprintf("These expressions can use an index through a functional index or an index on a virtual generated column, see %s.", strings.Join(items, ", "))
+	heuristicSuggest["FUN.001"] = fun
+}
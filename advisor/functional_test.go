@@ -0,0 +1,103 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package advisor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+func TestIndexAdviseFunctional(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	orgVersion := common.Config.OnlineDSN.Version
+	defer func() {
+		common.Config.OnlineDSN.Version = orgVersion
+	}()
+
+	offline := newOfflineEnv(t, "CREATE TABLE orders (id int primary key, created_at datetime, email varchar(64), doc json, amount int)")
+
+	sql := "select * from orders where DATE(created_at) = '2020-01-01' and lower(email) = 'a' and JSON_EXTRACT(doc, '$.k') = 1 and md5(email) = 'b'"
+	cases := map[int][]string{
+		80023: {
+			"alter table `sakila`.`orders` add index `idx_date_created_at` ((DATE(created_at)))",
+			"alter table `sakila`.`orders` add index `idx_lower_email` ((lower(email)))",
+			"alter table `sakila`.`orders` add column `gc_json_extract_doc_k` varchar(255) generated always as (json_unquote(JSON_EXTRACT(doc, '$.k'))) virtual, add index `idx_gc_json_extract_doc_k` (`gc_json_extract_doc_k`)",
+			"alter table `sakila`.`orders` add index `idx_md5_email` ((md5(email)))",
+		},
+		// 低版本使用生成列，无法推断类型的表达式不给出建议
+		50730: {
+			"alter table `sakila`.`orders` add column `gc_date_created_at` date generated always as (DATE(created_at)) virtual, add index `idx_gc_date_created_at` (`gc_date_created_at`)",
+			"alter table `sakila`.`orders` add column `gc_lower_email` varchar(64) generated always as (lower(email)) virtual, add index `idx_gc_lower_email` (`gc_lower_email`)",
+			"alter table `sakila`.`orders` add column `gc_json_extract_doc_k` varchar(255) generated always as (json_unquote(JSON_EXTRACT(doc, '$.k'))) virtual, add index `idx_gc_json_extract_doc_k` (`gc_json_extract_doc_k`)",
+		},
+		50640: nil,
+	}
+	for version, want := range cases {
+		common.Config.OnlineDSN.Version = version
+		stmt, err := sqlparser.Parse(sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := &Query4Audit{Query: sql, Stmt: stmt}
+		if !offline.BuildVirtualEnv(rEnv, q.Query) {
+			t.Fatalf("BuildVirtualEnv failed, SQL: %s", sql)
+		}
+		idxAdvisor, err := NewAdvisor(offline, *rEnv, *q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, idx := range idxAdvisor.IndexAdvise() {
+			if idx.Expression != "" {
+				got = append(got, idx.DDL)
+			}
+		}
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("version %d want:\n%s\ngot:\n%s", version, strings.Join(want, "\n"), strings.Join(got, "\n"))
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestLinkFunctionalIndex(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	advises := IndexAdvises{
+		{
+			Database:   "sakila",
+			Table:      "orders",
+			Name:       "idx_gc_json_doc_k",
+			Expression: "JSON_EXTRACT(doc, '$.k')",
+			Generated:  "gc_json_doc_k",
+			DDL:        "alter table `sakila`.`orders` add column `gc_json_doc_k` varchar(255) generated always as (json_unquote(JSON_EXTRACT(doc, '$.k'))) virtual, add index `idx_gc_json_doc_k` (`gc_json_doc_k`)",
+		},
+	}
+	idxSuggest := advises.Format()
+	if !strings.Contains(idxSuggest["IDX.001"].Content, "查询条件需要改写为json_unquote(JSON_EXTRACT(doc, '$.k'))") {
+		t.Errorf("IDX.001 got %s", idxSuggest["IDX.001"].Content)
+	}
+
+	heuristicSuggest := map[string]Rule{"FUN.001": HeuristicRules["FUN.001"]}
+	LinkFunctionalIndex(heuristicSuggest, idxSuggest)
+	if !strings.HasSuffix(heuristicSuggest["FUN.001"].Content, "see IDX.001.") {
+		t.Errorf("FUN.001 got %s", heuristicSuggest["FUN.001"].Content)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
@@ -170,7 +170,7 @@ func (idxAdv *IndexAdvisor) RuleImplicitConversion() Rule {
 	 */
 	rule := HeuristicRules["OK"]
 	// 未开启测试环境不进行检查
-	if common.Config.TestDSN.Disable {
+	if testDSNDisabled(idxAdv.vEnv) {
 		return rule
 	}
 
@@ -232,7 +232,7 @@ func (idxAdv *IndexAdvisor) RuleImplicitConversion() Rule {
 			}
 
 			// 补全列信息
-			colList = CompleteColumnsInfo(idxAdv.Ast, colList, idxAdv.vEnv)
+			colList = idxAdv.completeColumnsInfo(colList)
 
 			// 列与列比较
 			if len(colList) == 2 {
@@ -1451,8 +1451,8 @@ func (q *Query4Audit) RuleMultiCompare() Rule {
 // RuleCreateOnUpdate RES.010
 func (q *Query4Audit) RuleCreateOnUpdate() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateTableStmt:
@@ -1495,7 +1495,7 @@ func (q *Query4Audit) RuleCreateOnUpdate() Rule {
 func (idxAdv *IndexAdvisor) RuleUpdateOnUpdate() Rule {
 	rule := HeuristicRules["OK"]
 	// 未开启测试环境不进行检查
-	if common.Config.TestDSN.Disable {
+	if testDSNDisabled(idxAdv.vEnv) {
 		return rule
 	}
 	err := sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
@@ -1541,8 +1541,8 @@ func (q *Query4Audit) RuleStandardINEQ() Rule {
 // RuleUseKeyWord KWR.002
 func (q *Query4Audit) RuleUseKeyWord() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		if q.TiStmt == nil {
 			common.Log.Error("TiStmt is nil, SQL: %s", q.Query)
 			return rule
@@ -1583,8 +1583,8 @@ func (q *Query4Audit) RuleUseKeyWord() Rule {
 // Reference: https://en.wikipedia.org/wiki/English_plurals
 func (q *Query4Audit) RulePluralWord() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		if q.TiStmt == nil {
 			common.Log.Error("TiStmt is nil, SQL: %s", q.Query)
 			return rule
@@ -1822,8 +1822,8 @@ func (q *Query4Audit) RuleAddDelimiter() Rule {
 // RuleRecursiveDependency KEY.003
 func (q *Query4Audit) RuleRecursiveDependency() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateTableStmt:
@@ -1920,8 +1920,8 @@ func (q *Query4Audit) RuleImpreciseDataType() Rule {
 // RuleValuesInDefinition COL.010
 func (q *Query4Audit) RuleValuesInDefinition() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateTableStmt:
@@ -1958,8 +1958,8 @@ func (q *Query4Audit) RuleValuesInDefinition() Rule {
 // RuleIndexAttributeOrder KEY.004
 func (q *Query4Audit) RuleIndexAttributeOrder() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateIndexStmt:
@@ -2281,7 +2281,7 @@ func (idxAdv *IndexAdvisor) RuleUpdatePrimaryKey() Rule {
 			return true, nil
 		}, node)
 		common.LogIfError(err, "")
-		setColumns = idxAdv.calcCardinality(CompleteColumnsInfo(idxAdv.Ast, setColumns, idxAdv.vEnv))
+		setColumns = idxAdv.calcCardinality(idxAdv.completeColumnsInfo(setColumns))
 		for _, col := range setColumns {
 			idxMeta := idxAdv.IndexMeta[idxAdv.vEnv.DBHash(col.DB)][col.Table]
 			if idxMeta == nil {
@@ -2512,8 +2512,8 @@ func (q *Query4Audit) RuleDistinctJoinUsage() Rule {
 // RuleReadablePasswords SEC.002
 func (q *Query4Audit) RuleReadablePasswords() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		re := regexp.MustCompile(`(?i)(password)|(password)|(pwd)`)
 		for _, tiStmt := range q.TiStmt {
 			// create table stmt
@@ -2727,8 +2727,8 @@ func (q *Query4Audit) RuleIsNullIsNotNull() Rule {
 // RuleVarcharVSChar COL.008
 func (q *Query4Audit) RuleVarcharVSChar() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateTableStmt:
@@ -2781,8 +2781,8 @@ func (q *Query4Audit) RuleCreateDualTable() Rule {
 // RuleAlterCharset ALT.001
 func (q *Query4Audit) RuleAlterCharset() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.AlterTableStmt:
@@ -2817,8 +2817,8 @@ func (q *Query4Audit) RuleAlterCharset() Rule {
 // RuleAlterDropColumn ALT.003
 func (q *Query4Audit) RuleAlterDropColumn() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.AlterTableStmt:
@@ -2844,8 +2844,8 @@ func (q *Query4Audit) RuleAlterDropColumn() Rule {
 // RuleAlterDropKey ALT.004
 func (q *Query4Audit) RuleAlterDropKey() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.AlterTableStmt:
@@ -2866,8 +2866,8 @@ func (q *Query4Audit) RuleAlterDropKey() Rule {
 // RuleBLOBNotNull COL.012
 func (q *Query4Audit) RuleBLOBNotNull() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateTableStmt:
@@ -2924,8 +2924,8 @@ func (q *Query4Audit) RuleBLOBNotNull() Rule {
 // RuleTooManyKeys KEY.005
 func (q *Query4Audit) RuleTooManyKeys() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateTableStmt:
@@ -2941,8 +2941,8 @@ func (q *Query4Audit) RuleTooManyKeys() Rule {
 // RuleTooManyKeyParts KEY.006
 func (q *Query4Audit) RuleTooManyKeyParts() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateTableStmt:
@@ -3052,8 +3052,8 @@ func (q *Query4Audit) RuleOrderByMultiDirection() Rule {
 // TODO: 目前只是给建议，期望能够实现自动检查
 func (q *Query4Audit) RuleUniqueKeyDup() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateIndexStmt:
@@ -3105,8 +3105,8 @@ func (q *Query4Audit) RuleFulltextIndex() Rule {
 		}
 	}
 	*/
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 	default:
 		return rule
 	}
@@ -3127,8 +3127,8 @@ func (q *Query4Audit) RuleFulltextIndex() Rule {
 // RuleTimestampDefault COL.013
 func (q *Query4Audit) RuleTimestampDefault() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateTableStmt:
@@ -3204,8 +3204,8 @@ func (q *Query4Audit) RuleTimestampDefault() Rule {
 // RuleAutoIncrementInitNotZero TBL.004
 func (q *Query4Audit) RuleAutoIncrementInitNotZero() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateTableStmt:
@@ -3235,8 +3235,8 @@ func (q *Query4Audit) RuleColumnWithCharset() Rule {
 			}
 		}
 	}
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateTableStmt:
@@ -3296,8 +3296,8 @@ func (q *Query4Audit) RuleTableCharsetCheck() Rule {
 	var allow bool
 	var hasCharset bool
 
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL, *sqlparser.DBDDL:
+	switch {
+	case q.isDDL(), q.isDBDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateTableStmt:
@@ -3411,8 +3411,8 @@ func (q *Query4Audit) RuleTableCollateCheck() Rule {
 	var allow bool
 	var hasCollate bool
 
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL, *sqlparser.DBDDL:
+	switch {
+	case q.isDDL(), q.isDBDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateTableStmt:
@@ -3472,8 +3472,8 @@ func (q *Query4Audit) RuleTableCollateCheck() Rule {
 // RuleBlobDefaultValue COL.015
 func (q *Query4Audit) RuleBlobDefaultValue() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateTableStmt:
@@ -3521,8 +3521,8 @@ func (q *Query4Audit) RuleBlobDefaultValue() Rule {
 // RuleIntPrecision COL.016
 func (q *Query4Audit) RuleIntPrecision() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateTableStmt:
@@ -3578,8 +3578,8 @@ func (q *Query4Audit) RuleIntPrecision() Rule {
 // RuleVarcharLength COL.017
 func (q *Query4Audit) RuleVarcharLength() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateTableStmt:
@@ -3656,8 +3656,8 @@ func (q *Query4Audit) RuleColumnNotAllowType() Rule {
 func (q *Query4Audit) RuleTimePrecision() Rule {
 	var rule = q.RuleOK()
 
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateTableStmt:
@@ -3718,8 +3718,8 @@ func (q *Query4Audit) RuleNoOSCKey() Rule {
 // RuleTooManyFields COL.006
 func (q *Query4Audit) RuleTooManyFields() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateTableStmt:
@@ -3736,8 +3736,8 @@ func (q *Query4Audit) RuleTooManyFields() Rule {
 func (q *Query4Audit) RuleMaxTextColsCount() Rule {
 	var textColsCount int
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateTableStmt:
@@ -3764,7 +3764,7 @@ func (q *Query4Audit) RuleMaxTextColsCount() Rule {
 func (idxAdv *IndexAdvisor) RuleMaxTextColsCount() Rule {
 	rule := HeuristicRules["OK"]
 	// 未开启测试环境不进行检查
-	if common.Config.TestDSN.Disable {
+	if testDSNDisabled(idxAdv.vEnv) {
 		return rule
 	}
 
@@ -3805,8 +3805,8 @@ func (q *Query4Audit) RuleAllowEngine() Rule {
 	var rule = q.RuleOK()
 	var hasDefaultEngine bool
 	var allowedEngine bool
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateTableStmt:
@@ -3861,8 +3861,8 @@ func (q *Query4Audit) RuleAllowEngine() Rule {
 // RulePartitionNotAllowed TBL.001
 func (q *Query4Audit) RulePartitionNotAllowed() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateTableStmt:
@@ -3886,8 +3886,8 @@ func (q *Query4Audit) RulePartitionNotAllowed() Rule {
 // RuleAutoIncUnsigned COL.003:
 func (q *Query4Audit) RuleAutoIncUnsigned() Rule {
 	var rule = q.RuleOK()
-	switch q.Stmt.(type) {
-	case *sqlparser.DDL:
+	switch {
+	case q.isDDL(), q.isTiDDL():
 		for _, tiStmt := range q.TiStmt {
 			switch node := tiStmt.(type) {
 			case *tidb.CreateTableStmt:
@@ -4064,6 +4064,15 @@ func MergeConflictHeuristicRules(rules map[string]Rule) map[string]Rule {
 	if _, ok := rules["JOI.008"]; ok {
 		delete(rules, "JOI.007")
 	}
+
+	// 通过 RegisterConflict 注册的冲突关系
+	for item, overrides := range registeredConflicts {
+		if _, ok := rules[item]; ok {
+			for _, o := range overrides {
+				delete(rules, o)
+			}
+		}
+	}
 	return rules
 }
 
@@ -0,0 +1,438 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package advisor
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/XiaoMi/soar/ast"
+	"github.com/XiaoMi/soar/common"
+
+	tidb "github.com/pingcap/parser/ast"
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// 本文件为 Vitess 无法解析的 SQL（CTE，窗口函数，部分 DDL 等）提供基于 TiDB AST 的启发式规则实现
+// 这些函数通过 Rule.TiFunc 注册，仅在 Query4Audit.StmtErr 不为空时由 HeuristicCheck 调用
+
+// RuleUnevaluated ERR.004
+// Vitess 解析失败，列出未能评审的启发式规则
+func RuleUnevaluated(err error, items []string) Rule {
+	sort.Strings(items)
+	return Rule{
+		Item:     "ERR.004",
+		Severity: "L0",
+		Summary:  "Some heuristic rules can not be evaluated, build-in vitess parser failed",
+		Content:  fmt.Sprintf("%s. Rules not evaluated: %s", err.Error(), strings.Join(items, ", ")),
+	}
+}
+
+// isDDL 判断 Vitess 解析出的语句是否为 DDL
+func (q *Query4Audit) isDDL() bool {
+	_, ok := q.Stmt.(*sqlparser.DDL)
+	return ok
+}
+
+// isDBDDL 判断 Vitess 解析出的语句是否为 CREATE/DROP DATABASE 等库级 DDL
+func (q *Query4Audit) isDBDDL() bool {
+	_, ok := q.Stmt.(*sqlparser.DBDDL)
+	return ok
+}
+
+// isTiDDL Vitess 解析失败时根据 TiDB AST 判断是否为 DDL 语句
+func (q *Query4Audit) isTiDDL() bool {
+	if q.Stmt != nil {
+		return false
+	}
+	for _, node := range q.TiStmt {
+		if _, ok := node.(tidb.DDLNode); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// tiWalk 遍历所有 TiStmt，visit 返回 false 时不再遍历该节点的子节点
+func (q *Query4Audit) tiWalk(visit func(node tidb.Node) bool) {
+	for _, node := range q.TiStmt {
+		ast.TiWalk(visit, node)
+	}
+}
+
+// TiRuleNoWhere CLA.001 & CLA.014 & CLA.015
+func (q *Query4Audit) TiRuleNoWhere() Rule {
+	var rule = q.RuleOK()
+	q.tiWalk(func(node tidb.Node) bool {
+		switch n := node.(type) {
+		case *tidb.SelectStmt:
+			if n.From == nil {
+				// select 1, 没有 from 子句与 from dual 相同
+				return true
+			}
+			if n.From.TableRefs != nil && n.From.TableRefs.Right != nil {
+				return false
+			}
+			if n.Where == nil {
+				rule = HeuristicRules["CLA.001"]
+				return false
+			}
+		case *tidb.DeleteStmt:
+			if n.Where == nil {
+				rule = HeuristicRules["CLA.014"]
+				return false
+			}
+		case *tidb.UpdateStmt:
+			if n.Where == nil {
+				rule = HeuristicRules["CLA.015"]
+				return false
+			}
+		}
+		return true
+	})
+	return rule
+}
+
+// TiRuleOrderByRand CLA.002
+func (q *Query4Audit) TiRuleOrderByRand() Rule {
+	var rule = q.RuleOK()
+	q.tiWalk(func(node tidb.Node) bool {
+		switch n := node.(type) {
+		case *tidb.OrderByClause:
+			for _, item := range n.Items {
+				if f, ok := item.Expr.(*tidb.FuncCallExpr); ok && f.FnName.L == "rand" {
+					rule = HeuristicRules["CLA.002"]
+					return false
+				}
+			}
+		}
+		return true
+	})
+	return rule
+}
+
+// TiRuleOffsetLimit CLA.003
+func (q *Query4Audit) TiRuleOffsetLimit() Rule {
+	var rule = q.RuleOK()
+	q.tiWalk(func(node tidb.Node) bool {
+		switch n := node.(type) {
+		case *tidb.Limit:
+			if v, ok := n.Offset.(tidb.ValueExpr); ok {
+				offset, err := strconv.Atoi(fmt.Sprint(v.GetValue()))
+				if err == nil && offset > 1000 {
+					rule = HeuristicRules["CLA.003"]
+					return false
+				}
+			}
+		}
+		return true
+	})
+	return rule
+}
+
+// TiRuleExplicitOrderBy CLA.008
+func (q *Query4Audit) TiRuleExplicitOrderBy() Rule {
+	var rule = q.RuleOK()
+	q.tiWalk(func(node tidb.Node) bool {
+		switch n := node.(type) {
+		case *tidb.SelectStmt:
+			// 有group by，但没有order by
+			if n.GroupBy != nil && n.OrderBy == nil {
+				rule = HeuristicRules["CLA.008"]
+				return false
+			}
+		}
+		return true
+	})
+	return rule
+}
+
+// TiRulePrefixLike ARG.001
+func (q *Query4Audit) TiRulePrefixLike() Rule {
+	var rule = q.RuleOK()
+	q.tiWalk(func(node tidb.Node) bool {
+		switch n := node.(type) {
+		case *tidb.PatternLikeExpr:
+			if n.Not {
+				break
+			}
+			// prefix like with '%', '_'
+			if v, ok := n.Pattern.(tidb.ValueExpr); ok {
+				if s, ok := v.GetValue().(string); ok && (strings.HasPrefix(s, "%") || strings.HasPrefix(s, "_")) {
+					rule = HeuristicRules["ARG.001"]
+					return false
+				}
+			}
+		}
+		return true
+	})
+	return rule
+}
+
+// TiRuleEqualLike ARG.002
+func (q *Query4Audit) TiRuleEqualLike() Rule {
+	var rule = q.RuleOK()
+	q.tiWalk(func(node tidb.Node) bool {
+		switch n := node.(type) {
+		case *tidb.PatternLikeExpr:
+			if n.Not {
+				break
+			}
+			// 1. string that not contain '%', '_'
+			// 2. int, bit, float without wildcard
+			if v, ok := n.Pattern.(tidb.ValueExpr); ok {
+				if s, ok := v.GetValue().(string); !ok || !strings.ContainsAny(s, "%_") {
+					rule = HeuristicRules["ARG.002"]
+					return false
+				}
+			}
+		}
+		return true
+	})
+	return rule
+}
+
+// TiRuleIsNullIsNotNull ARG.006
+func (q *Query4Audit) TiRuleIsNullIsNotNull() Rule {
+	var rule = q.RuleOK()
+	for _, node := range q.TiStmt {
+		switch node.(type) {
+		case *tidb.SelectStmt, *tidb.SetOprStmt:
+			re := regexp.MustCompile(`(?i)is\s*(not)?\s+null\b`)
+			if re.FindString(q.Query) != "" {
+				rule = HeuristicRules["ARG.006"]
+			}
+		}
+	}
+	return rule
+}
+
+// TiRuleInSubquery SUB.001
+func (q *Query4Audit) TiRuleInSubquery() Rule {
+	var rule = q.RuleOK()
+	for _, node := range q.TiStmt {
+		if ast.TiGetSubqueryDepth(node) > 1 {
+			rule = HeuristicRules["SUB.001"]
+		}
+	}
+	return rule
+}
+
+// TiRuleSubqueryDepth SUB.004
+func (q *Query4Audit) TiRuleSubqueryDepth() Rule {
+	var rule = q.RuleOK()
+	for _, node := range q.TiStmt {
+		if ast.TiGetSubqueryDepth(node) > common.Config.MaxSubqueryDepth {
+			rule = HeuristicRules["SUB.004"]
+		}
+	}
+	return rule
+}
+
+// TiRuleMixOrderBy CLA.007
+func (q *Query4Audit) TiRuleMixOrderBy() Rule {
+	var rule = q.RuleOK()
+	q.tiWalk(func(node tidb.Node) bool {
+		switch n := node.(type) {
+		case *tidb.WindowSpec:
+			// 窗口函数中的排序不使用索引，不检查
+			return false
+		case *tidb.OrderByClause:
+			// 每个 ORDER BY 子句单独比较，子查询与外层查询的排序方向互不影响
+			var direction *bool
+			for _, item := range n.Items {
+				// 比较相邻两个order by列的方向
+				if direction != nil && item.Desc != *direction {
+					rule = HeuristicRules["CLA.007"]
+					return false
+				}
+				desc := item.Desc
+				direction = &desc
+			}
+		}
+		return true
+	})
+	return rule
+}
+
+// TiRuleNoDeterministicGroupby RES.001
+// 与 Vitess 版本只检查最后遍历到的 SELECT 不同，这里逐个检查带 GROUP BY 的 SELECT，CTE 和子查询不会覆盖外层查询的结果
+func (q *Query4Audit) TiRuleNoDeterministicGroupby() Rule {
+	var rule = q.RuleOK()
+	q.tiWalk(func(node tidb.Node) bool {
+		n, ok := node.(*tidb.SelectStmt)
+		if !ok || n.Fields == nil || n.GroupBy == nil {
+			return true
+		}
+		// 过滤group by列，group by中只有函数等表达式时不检查
+		groupbyCols := ast.TiFindColumn(n.GroupBy)
+		if len(groupbyCols) == 0 {
+			return true
+		}
+		for _, field := range n.Fields.Fields {
+			// `select *`, but not `select count(*)`
+			if field.WildCard != nil {
+				rule = HeuristicRules["RES.001"]
+				return false
+			}
+		}
+		// TODO：暂时只检查了列名，未对库表名进行检查，也未处理AS
+		for _, s := range ast.TiFindColumn(n.Fields) {
+			found := false
+			for _, g := range groupbyCols {
+				if g.Name == s.Name {
+					found = true
+				}
+			}
+			if !found {
+				rule = HeuristicRules["RES.001"]
+				return false
+			}
+		}
+		return true
+	})
+	return rule
+}
+
+// TiRuleNoDeterministicLimit RES.002
+func (q *Query4Audit) TiRuleNoDeterministicLimit() Rule {
+	var rule = q.RuleOK()
+	q.tiWalk(func(node tidb.Node) bool {
+		switch n := node.(type) {
+		case *tidb.SelectStmt:
+			if n.Limit != nil && n.OrderBy == nil {
+				rule = HeuristicRules["RES.002"]
+				return false
+			}
+		}
+		return true
+	})
+	return rule
+}
+
+// TiRuleUpdateDeleteWithLimit RES.003
+func (q *Query4Audit) TiRuleUpdateDeleteWithLimit() Rule {
+	var rule = q.RuleOK()
+	for _, node := range q.TiStmt {
+		switch n := node.(type) {
+		case *tidb.UpdateStmt:
+			if n.Limit != nil {
+				rule = HeuristicRules["RES.003"]
+			}
+		}
+	}
+	return rule
+}
+
+// TiRuleUpdateDeleteWithOrderby RES.004
+func (q *Query4Audit) TiRuleUpdateDeleteWithOrderby() Rule {
+	var rule = q.RuleOK()
+	for _, node := range q.TiStmt {
+		switch n := node.(type) {
+		case *tidb.UpdateStmt:
+			if n.Order != nil {
+				rule = HeuristicRules["RES.004"]
+			}
+		}
+	}
+	return rule
+}
+
+// TiRuleTruncateTable SEC.001
+func (q *Query4Audit) TiRuleTruncateTable() Rule {
+	var rule = q.RuleOK()
+	for _, node := range q.TiStmt {
+		switch node.(type) {
+		case *tidb.TruncateTableStmt:
+			rule = HeuristicRules["SEC.001"]
+		}
+	}
+	return rule
+}
+
+// TiRuleDataDrop SEC.003
+func (q *Query4Audit) TiRuleDataDrop() Rule {
+	var rule = q.RuleOK()
+	for _, node := range q.TiStmt {
+		switch node.(type) {
+		case *tidb.DropDatabaseStmt, *tidb.DropTableStmt, *tidb.TruncateTableStmt, *tidb.DeleteStmt:
+			rule = HeuristicRules["SEC.003"]
+		}
+	}
+	return rule
+}
+
+// TiRuleCountStar FUN.002
+func (q *Query4Audit) TiRuleCountStar() Rule {
+	var rule = q.RuleOK()
+	for _, node := range q.TiStmt {
+		switch n := node.(type) {
+		case *tidb.SelectStmt:
+			// count(N), count(col), count(*)
+			re := regexp.MustCompile(`(?i)(count\(\s*[*0-9a-z_` + "`" + `]*\s*\))`)
+			if re.FindString(q.Query) != "" && n.Where != nil {
+				rule = HeuristicRules["FUN.002"]
+			}
+		}
+	}
+	return rule
+}
+
+// TiRuleInsertColDef COL.002
+func (q *Query4Audit) TiRuleInsertColDef() Rule {
+	var rule = q.RuleOK()
+	for _, node := range q.TiStmt {
+		switch n := node.(type) {
+		case *tidb.InsertStmt:
+			if n.Columns == nil && n.Setlist == nil {
+				rule = HeuristicRules["COL.002"]
+			}
+		}
+	}
+	return rule
+}
+
+// TiRuleInsertSelect LCK.001
+func (q *Query4Audit) TiRuleInsertSelect() Rule {
+	var rule = q.RuleOK()
+	for _, node := range q.TiStmt {
+		switch n := node.(type) {
+		case *tidb.InsertStmt:
+			if n.Select != nil {
+				rule = HeuristicRules["LCK.001"]
+			}
+		}
+	}
+	return rule
+}
+
+// TiRuleInsertOnDup LCK.002
+func (q *Query4Audit) TiRuleInsertOnDup() Rule {
+	var rule = q.RuleOK()
+	for _, node := range q.TiStmt {
+		switch n := node.(type) {
+		case *tidb.InsertStmt:
+			if n.OnDuplicate != nil {
+				rule = HeuristicRules["LCK.002"]
+			}
+		}
+	}
+	return rule
+}
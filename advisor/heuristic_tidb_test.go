@@ -0,0 +1,191 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package advisor
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+// TiFunc 与 Func 对同一条 SQL 应给出相同的建议
+func TestTiFuncConsistency(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	sqls := map[string][]string{
+		"ARG.001": {"select c1 from tbl where name like '%foo'", "select c1 from tbl where name like 'foo%'"},
+		"ARG.002": {"select c1 from tbl where name like 'foo'", "select c1 from tbl where name like 'f_o'"},
+		"ARG.006": {"select c1 from tbl where col is null", "select c1 from tbl where col = 1"},
+		"CLA.001": {"select c1 from tbl", "select 1", "select c1 from tbl where id = 1", "select * from a join b on a.id = b.id"},
+		"CLA.002": {"select c1 from tbl order by rand() limit 1", "select c1 from tbl order by c1"},
+		"CLA.003": {"select c1 from tbl where id = 1 limit 10000, 10", "select c1 from tbl where id = 1 limit 100, 10"},
+		"CLA.007": {"select c1 from tbl where id = 1 order by c2 desc, c3 asc", "select c1 from tbl where id = 1 order by c2 desc, c3 desc"},
+		"CLA.008": {"select c1 from tbl where id = 1 group by c1", "select c1 from tbl where id = 1 group by c1 order by c1"},
+		"CLA.014": {"delete from tbl", "delete from tbl where id = 1"},
+		"CLA.015": {"update tbl set c1 = 1", "update tbl set c1 = 1 where id = 1"},
+		"COL.002": {"insert into tbl values (1)", "insert into tbl (c1) values (1)", "insert into tbl set c1 = 1"},
+		"FUN.002": {"select count(*) from tbl where id > 1", "select count(*) from tbl"},
+		"LCK.001": {"insert into tbl (c1) select c1 from tb2", "insert into tbl (c1) values (1)"},
+		"LCK.002": {"insert into tbl (c1) values (1) on duplicate key update c1 = 2", "insert into tbl (c1) values (1)"},
+		"RES.001": {"select c1, c2 from tbl where id = 1 group by c1", "select * from tbl where id = 1 group by c1", "select c1, count(c2) from tbl where id = 1 group by c1", "select c1, c2 from tbl where id = 1"},
+		"RES.002": {"select c1 from tbl where id = 1 limit 1", "select c1 from tbl where id = 1 order by c1 limit 1"},
+		"RES.003": {"update tbl set c1 = 1 where id > 1 limit 1", "update tbl set c1 = 1 where id > 1"},
+		"RES.004": {"update tbl set c1 = 1 where id > 1 order by id", "update tbl set c1 = 1 where id > 1"},
+		"SEC.001": {"truncate table tbl", "drop table tbl"},
+		"SEC.003": {"drop table tbl", "delete from tbl where id = 1", "select 1"},
+		"SUB.001": {"select c1 from tbl where id in (select id from tb2)", "select c1 from tbl where id in (1, 2)"},
+		"SUB.004": {"select c1 from tbl where id in (select id from (select id from (select id from (select id from (select id from tb2) a) b) c) d)", "select c1 from tbl where id in (select id from tb2)"},
+	}
+	for item, cases := range sqls {
+		rule := HeuristicRules[item]
+		if rule.TiFunc == nil {
+			t.Errorf("%s TiFunc is nil", item)
+			continue
+		}
+		for _, sql := range cases {
+			q, err := NewQuery4Audit(sql)
+			if err != nil || q.Stmt == nil {
+				t.Fatalf("SQL: %s, error: %v", sql, err)
+			}
+			if want, got := rule.Func(q).Item == item, rule.TiFunc(q).Item == item; want != got {
+				t.Errorf("%s SQL: %s, Func: %v, TiFunc: %v", item, sql, want, got)
+			}
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestHeuristicCheckTiDB(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	sqls := map[string][]string{
+		"with t as (select c1 from tbl) select c1 from t":                                              {"CLA.001", "ERR.004"},
+		"with t as (select c1 from tbl where id = 1) select c1 from t where c1 like '%a'":              {"ARG.001", "ERR.004"},
+		"select c1, row_number() over (order by c2) from tbl where id = 1 limit 1":                     {"RES.002", "ERR.004"},
+		"with t as (select c1, c2 from tbl where id = 1) select c1, c2 from t group by c1 order by c1": {"RES.001", "ERR.004"},
+		"select c1 from tbl where id = 1":                                                              {},
+	}
+	for sql, items := range sqls {
+		q, err := NewQuery4Audit(sql)
+		if err != nil {
+			t.Fatalf("SQL: %s, error: %v", sql, err)
+		}
+		if (len(items) > 0) != (q.StmtErr != nil) {
+			t.Fatalf("SQL: %s, vitess error: %v", sql, q.StmtErr)
+		}
+		suggest := q.HeuristicCheck()
+		for _, item := range items {
+			if _, ok := suggest[item]; !ok {
+				t.Errorf("SQL: %s, %s not found", sql, item)
+			}
+		}
+		if len(items) == 0 {
+			if _, ok := suggest["ERR.004"]; ok {
+				t.Errorf("SQL: %s, unexpected ERR.004", sql)
+			}
+			continue
+		}
+		// ERR.004 中列出未能评审的规则，已有 TiDB 实现的规则不应出现
+		content := suggest["ERR.004"].Content
+		if !strings.Contains(content, "JOI.002") || strings.Contains(content, "CLA.001") {
+			t.Errorf("SQL: %s, ERR.004 content: %s", sql, content)
+		}
+	}
+
+	// 忽略 ERR.004
+	orgIgnoreRules := common.Config.IgnoreRules
+	common.Config.IgnoreRules = []string{"ERR.004"}
+	q, _ := NewQuery4Audit("with t as (select c1 from tbl) select c1 from t")
+	if _, ok := q.HeuristicCheck()["ERR.004"]; ok {
+		t.Error("ERR.004 should be ignored")
+	}
+	common.Config.IgnoreRules = orgIgnoreRules
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestTiRuleMixOrderBy(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	sqls := map[string]bool{
+		"with t as (select c1, c2 from tbl where id = 1) select c1 from t order by c1 desc, c2 asc":   true,
+		"select c1 from (select c1 from tbl where id = 1 order by c1 limit 10) t order by c1 desc":    false,
+		"with t as (select c1 from tbl order by c1 limit 10) select c1 from t order by c1 desc":       false,
+		"select c1, row_number() over (order by c2 desc, c3 asc) from tbl where id = 1":               false,
+		"select c1, rank() over (partition by c2 order by c3 desc) from tbl where id = 1 order by c1": false,
+		"select c1, rank() over (order by c3 asc) from tbl where id = 1 order by c1 desc, c2 asc":     true,
+	}
+	for sql, want := range sqls {
+		q, err := NewQuery4Audit(sql)
+		if err != nil {
+			t.Fatalf("SQL: %s, error: %v", sql, err)
+		}
+		if got := q.TiRuleMixOrderBy().Item == "CLA.007"; got != want {
+			t.Errorf("SQL: %s, want CLA.007: %v, got: %v", sql, want, got)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestTiSafeRules(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	// Vitess 解析失败时 Stmt 为 nil，标记 TiSafe 的规则仍会调用 Func，不能因此 panic
+	q, err := NewQuery4Audit("with t as (select c1 from tbl) select c1 from t")
+	if err != nil || q.StmtErr == nil {
+		t.Fatalf("vitess should fail to parse CTE, err: %v", err)
+	}
+	for item, rule := range HeuristicRules {
+		if rule.TiFunc != nil && rule.TiSafe {
+			t.Errorf("%s has TiFunc, should not be TiSafe", item)
+		}
+		if rule.Func == nil || !rule.TiSafe {
+			continue
+		}
+		func() {
+			defer func() {
+				if err := recover(); err != nil {
+					t.Errorf("%s panic with nil Stmt, implement TiFunc or remove TiSafe: %v", item, err)
+				}
+			}()
+			rule.Func(q)
+		}()
+	}
+
+	// 既没有 TiFunc 也没有标记 TiSafe 的规则默认跳过，通过 ERR.004 列出
+	suggest := q.HeuristicCheck()
+	if !strings.Contains(suggest["ERR.004"].Content, "FUN.001") {
+		t.Errorf("FUN.001 should be listed in ERR.004, got: %s", suggest["ERR.004"].Content)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+// Vitess 解析失败的 DDL 仍能通过 TiDB AST 评审
+func TestRuleDDLWithTiDB(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	sql := "create table tbl (id int unsigned auto_increment, primary key (id)) engine = memory"
+	q, err := NewQuery4Audit(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 模拟 Vitess 解析失败
+	q.Stmt, q.StmtErr = nil, errors.New("vitess syntax error")
+	if q.isDDL() || !q.isTiDDL() {
+		t.Errorf("SQL: %s, should be DDL", sql)
+	}
+	if rule := q.RuleAllowEngine(); rule.Item != "TBL.002" {
+		t.Error("Rule not match:", rule.Item, "Expect : TBL.002")
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
@@ -19,6 +19,7 @@ package advisor
 import (
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/XiaoMi/soar/ast"
@@ -27,6 +28,7 @@ import (
 	"github.com/XiaoMi/soar/env"
 
 	"github.com/dchest/uniuri"
+	tidb "github.com/pingcap/parser/ast"
 	"vitess.io/vitess/go/vt/sqlparser"
 )
 
@@ -37,16 +39,30 @@ const (
 
 // IndexAdvisor 索引建议需要使用到的所有信息
 type IndexAdvisor struct {
-	vEnv      *env.VirtualEnv     // 线下虚拟测试环境（测试环境）
-	rEnv      database.Connector  // 线上真实环境
-	Ast       sqlparser.Statement // Vitess Parser生成的抽象语法树
-	where     []*common.Column    // 所有where条件中用到的列
-	whereEQ   []*common.Column    // where条件中可以加索引的等值条件列
-	whereINEQ []*common.Column    // where条件中可以加索引的非等值条件列
-	groupBy   []*common.Column    // group by可以加索引列
-	orderBy   []*common.Column    // order by可以加索引列
-	joinCond  [][]*common.Column  // 由于join condition跨层级间索引不可共用，需要多一个维度用来维护层级关系
-	IndexMeta map[string]map[string]*database.TableIndexInfo
+	vEnv       *env.VirtualEnv      // 线下虚拟测试环境（测试环境）
+	rEnv       database.Connector   // 线上真实环境
+	Ast        sqlparser.Statement  // Vitess Parser生成的抽象语法树
+	TiAst      tidb.StmtNode        // Vitess 无法解析时 TiDB Parser 生成的抽象语法树，此时 Ast 为空
+	where      []*common.Column     // 所有where条件中用到的列
+	whereEQ    []*common.Column     // where条件中可以加索引的等值条件列
+	whereINEQ  []*common.Column     // where条件中可以加索引的非等值条件列
+	groupBy    []*common.Column     // group by可以加索引列
+	orderBy    []*common.Column     // order by可以加索引列
+	joinCond   [][]*common.Column   // 由于join condition跨层级间索引不可共用，需要多一个维度用来维护层级关系
+	selected   []*common.Column     // SELECT 列表中用到的列，用于覆盖索引建议
+	functional []ast.FunctionalExpr // WHERE 及 JOIN 条件中作用在列上的函数表达式，用于函数索引建议
+	coverable  bool                 // SELECT 列表中的列是否可以全部确定，含有 * 时无法给出覆盖索引建议
+	IndexMeta  map[string]map[string]*database.TableIndexInfo
+}
+
+// testDSNDisabled 测试环境不可用且未通过 -schema 加载离线数据字典，无法获取库表结构
+func testDSNDisabled(vEnv *env.VirtualEnv) bool {
+	return common.Config.TestDSN.Disable && !vEnv.Offline()
+}
+
+// envDisabled 线上或测试环境不可用时只给出单列索引建议，离线数据字典可以同时代替两者
+func envDisabled(vEnv *env.VirtualEnv) bool {
+	return !vEnv.Offline() && (common.Config.TestDSN.Disable || common.Config.OnlineDSN.Disable)
 }
 
 // IndexInfo 创建一条索引需要的信息
@@ -56,6 +72,17 @@ type IndexInfo struct {
 	Table         string           `json:"table"`          // 表名
 	DDL           string           `json:"ddl"`            // ALTER, CREATE 等类型的 DDL 语句
 	ColumnDetails []*common.Column `json:"column_details"` // 列详情
+	Covering      bool             `json:"covering"`       // 是否为可选的覆盖索引
+	CoveringBytes int              `json:"covering_bytes"` // 覆盖索引中追加的列使每条索引记录额外增加的字节数
+	CoveringSize  int64            `json:"covering_size"`  // 按表行数估算覆盖索引额外占用的空间，无法获取行数时为 0
+	Validation    *IndexValidation `json:"validation"`     // 开启 -validate-index 时添加索引前后的执行计划对比
+	Prefixes      []PrefixAdvise   `json:"prefixes"`       // 开启数据采样时超长字符串列的前缀长度建议
+	Expression    string           `json:"expression"`     // 函数索引建议对应的查询条件中的表达式
+	Generated     string           `json:"generated"`      // 使用虚拟生成列代替函数索引时生成列的名称
+	OrderBy       string           `json:"order_by"`       // 用于消除排序的索引建议对应的 ORDER BY 列及排序方向
+	Drop          bool             `json:"drop"`           // 是否为删除冗余索引的建议
+
+	generatedDef string // 虚拟生成列的定义，如 varchar(255) generated always as (expr) virtual
 }
 
 // IndexAdvises IndexAdvises列表
@@ -88,7 +115,7 @@ func mergeAdvices(dst []IndexInfo, src ...IndexInfo) IndexAdvises {
 // 获取 condition 中的等值条件、非等值条件，以及group by 、 order by信息
 func NewAdvisor(env *env.VirtualEnv, rEnv database.Connector, q Query4Audit) (*IndexAdvisor, error) {
 	common.Log.Debug("Enter: NewAdvisor(), Caller: %s", common.Caller())
-	if common.Config.TestDSN.Disable {
+	if testDSNDisabled(env) {
 		return nil, fmt.Errorf("TestDSN is Disabled: %s", common.Config.TestDSN.Addr)
 	}
 	// DDL 检测
@@ -103,12 +130,8 @@ func NewAdvisor(env *env.VirtualEnv, rEnv database.Connector, q Query4Audit) (*I
 			}
 
 			// DDL 在 Env 初始化的时候已经执行过了
-			if _, ok := env.TableMap[dbRef]; !ok {
-				env.TableMap[dbRef] = make(map[string]string)
-			}
-
 			for _, tb := range sqlMeta[db].Table {
-				env.TableMap[dbRef][tb.TableName] = tb.TableName
+				env.AddTableMap(dbRef, tb.TableName)
 			}
 		}
 
@@ -128,6 +151,27 @@ func NewAdvisor(env *env.VirtualEnv, rEnv database.Connector, q Query4Audit) (*I
 		return nil, nil
 	}
 
+	// Vitess 无法解析的查询（CTE，窗口函数等）使用 TiDB AST 获取需要加索引的列
+	if q.Stmt == nil && len(q.TiStmt) == 1 {
+		switch stmt := q.TiStmt[0].(type) {
+		case *tidb.SelectStmt, *tidb.SetOprStmt, *tidb.UpdateStmt, *tidb.DeleteStmt:
+			return &IndexAdvisor{
+				vEnv:  env,
+				rEnv:  rEnv,
+				TiAst: stmt,
+
+				joinCond:  ast.TiFindJoinCols(stmt),
+				whereEQ:   ast.TiFindEQColsInWhere(stmt),
+				whereINEQ: ast.TiFindINEQColsInWhere(stmt),
+				groupBy:   ast.TiFindGroupByCols(stmt),
+				orderBy:   ast.TiFindOrderByCols(stmt),
+				where:     ast.TiFindWhereCols(stmt),
+				IndexMeta: make(map[string]map[string]*database.TableIndexInfo),
+			}, nil
+		}
+	}
+
+	selected, coverable := ast.FindSelectCols(q.Stmt)
 	return &IndexAdvisor{
 		vEnv: env,
 		rEnv: rEnv,
@@ -135,13 +179,16 @@ func NewAdvisor(env *env.VirtualEnv, rEnv database.Connector, q Query4Audit) (*I
 
 		// 所有的FindXXXXCols尽最大可能先排除不需要加索引的列，但由于元数据在此阶段尚未补齐，给出的列有可能也无法添加索引
 		// 后续需要通过CompleteColumnsInfo + calcCardinality补全后再进一步判断
-		joinCond:  ast.FindJoinCols(q.Stmt),
-		whereEQ:   ast.FindWhereEQ(q.Stmt),
-		whereINEQ: ast.FindWhereINEQ(q.Stmt),
-		groupBy:   ast.FindGroupByCols(q.Stmt),
-		orderBy:   ast.FindOrderByCols(q.Stmt),
-		where:     ast.FindAllCols(q.Stmt, ast.WhereExpression),
-		IndexMeta: make(map[string]map[string]*database.TableIndexInfo),
+		joinCond:   ast.FindJoinCols(q.Stmt),
+		whereEQ:    ast.FindWhereEQ(q.Stmt),
+		whereINEQ:  ast.FindWhereINEQ(q.Stmt),
+		groupBy:    ast.FindGroupByCols(q.Stmt),
+		orderBy:    ast.FindOrderByCols(q.Stmt),
+		where:      ast.FindAllCols(q.Stmt, ast.WhereExpression),
+		selected:   selected,
+		coverable:  coverable,
+		functional: ast.FindFunctionalExprs(q.Stmt),
+		IndexMeta:  make(map[string]map[string]*database.TableIndexInfo),
 	}, nil
 }
 
@@ -181,7 +228,7 @@ columns at the end. Now the index contains all the columns required for an index
 // TODO 索引顺序该如何确定
 func (idxAdv *IndexAdvisor) IndexAdvise() IndexAdvises {
 	// 支持不依赖DB的索引建议分析
-	if common.Config.TestDSN.Disable {
+	if testDSNDisabled(idxAdv.vEnv) {
 		// 未开启Env原数据依赖，信息不全的情况下可能会给予错误的索引建议，请人工进行核查。
 		common.Log.Warn("TestDSN.Disable = true")
 	}
@@ -211,18 +258,18 @@ func (idxAdv *IndexAdvisor) IndexAdvise() IndexAdvises {
 	// 为用到的每一列填充库名，表名等信息
 	var joinCond [][]*common.Column
 	for _, joinCols := range idxAdv.joinCond {
-		joinCond = append(joinCond, CompleteColumnsInfo(idxAdv.Ast, joinCols, idxAdv.vEnv))
+		joinCond = append(joinCond, idxAdv.completeColumnsInfo(joinCols))
 	}
 	idxAdv.joinCond = joinCond
 
-	idxAdv.where = CompleteColumnsInfo(idxAdv.Ast, idxAdv.where, idxAdv.vEnv)
-	idxAdv.whereEQ = CompleteColumnsInfo(idxAdv.Ast, idxAdv.whereEQ, idxAdv.vEnv)
-	idxAdv.whereINEQ = CompleteColumnsInfo(idxAdv.Ast, idxAdv.whereINEQ, idxAdv.vEnv)
-	idxAdv.groupBy = CompleteColumnsInfo(idxAdv.Ast, idxAdv.groupBy, idxAdv.vEnv)
-	idxAdv.orderBy = CompleteColumnsInfo(idxAdv.Ast, idxAdv.orderBy, idxAdv.vEnv)
+	idxAdv.where = idxAdv.completeColumnsInfo(idxAdv.where)
+	idxAdv.whereEQ = idxAdv.completeColumnsInfo(idxAdv.whereEQ)
+	idxAdv.whereINEQ = idxAdv.completeColumnsInfo(idxAdv.whereINEQ)
+	idxAdv.groupBy = idxAdv.completeColumnsInfo(idxAdv.groupBy)
+	idxAdv.orderBy = idxAdv.completeColumnsInfo(idxAdv.orderBy)
 
 	// 只要在开启使用env元数据的时候才会计算散粒度
-	if !common.Config.TestDSN.Disable {
+	if !testDSNDisabled(idxAdv.vEnv) {
 		// 计算joinCond, whereEQ, whereINEQ用到的每一列的散粒度，并排序，方便后续添加复合索引
 		// groupBy, orderBy列按书写顺序给索引建议，不需要按散粒度排序
 		idxAdv.calcCardinality(idxAdv.whereEQ)
@@ -246,19 +293,7 @@ func (idxAdv *IndexAdvisor) IndexAdvise() IndexAdvises {
 	}
 
 	// 是否指定Where条件，打标签
-	hasWhere := false
-	err := sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
-		switch where := node.(type) {
-		case *sqlparser.Subquery:
-			return false, nil
-		case *sqlparser.Where:
-			if where != nil {
-				hasWhere = true
-			}
-		}
-		return true, nil
-	}, idxAdv.Ast)
-	common.LogIfError(err, "")
+	hasWhere := idxAdv.hasWhere()
 	// 获取哪些列被忽略
 	var ignore []*common.Column
 	usedCols := append(idxAdv.whereINEQ, idxAdv.whereEQ...)
@@ -327,7 +362,7 @@ func (idxAdv *IndexAdvisor) IndexAdvise() IndexAdvises {
 	// 为join添加索引
 	// 获取 join condition 中需要加索引的表有哪些
 	defaultDB := ""
-	if !common.Config.TestDSN.Disable {
+	if !testDSNDisabled(idxAdv.vEnv) {
 		defaultDB = idxAdv.vEnv.RealDB(idxAdv.vEnv.Database)
 	}
 	if !common.Config.OnlineDSN.Disable {
@@ -338,7 +373,7 @@ func (idxAdv *IndexAdvisor) IndexAdvise() IndexAdvises {
 	joinTableMeta := ast.FindJoinTable(idxAdv.Ast, nil).SetDefault(idxAdv.rEnv.Database).SetDefault(defaultDB)
 	indexes = mergeAdvices(indexes, idxAdv.buildJoinIndex(joinTableMeta)...)
 
-	if common.Config.TestDSN.Disable || common.Config.OnlineDSN.Disable {
+	if envDisabled(idxAdv.vEnv) {
 		// 无 env 环境下只提供单列索引，无法确定 table 时不给予优化建议
 		// 仅有 table 信息时给出的建议不包含 DB 信息
 		indexes = mergeAdvices(indexes, idxAdv.buildIndexWithNoEnv(indexList)...)
@@ -347,20 +382,179 @@ func (idxAdv *IndexAdvisor) IndexAdvise() IndexAdvises {
 		indexes = mergeAdvices(indexes, idxAdv.buildIndex(indexList)...)
 	}
 
-	indexes = mergeAdvices(indexes, subQueryAdvises...)
+	// 分页查询中用于消除排序的索引包含了普通索引建议的列时，普通索引建议是多余的
+	ordered := idxAdv.buildOrderByIndex()
+	indexes = rmOrderByDupIndex(indexes, ordered)
+
+	// 覆盖索引是可选的建议，需要与普通索引分开检查，避免去重时替换掉普通索引
+	// 函数索引及消除排序的索引的 DDL 无法由列信息重建，同样不参与后续的类型检查及去重
+	var covering, subCovering []IndexInfo
+	if common.Config.CoveringIndex && !envDisabled(idxAdv.vEnv) {
+		covering = idxAdv.buildCoveringIndex(indexes)
+	}
+	for _, idx := range subQueryAdvises {
+		if idx.Covering || idx.Expression != "" || idx.OrderBy != "" {
+			subCovering = append(subCovering, idx)
+		} else {
+			indexes = mergeAdvices(indexes, idx)
+		}
+	}
 
 	// 在开启 env 的情况下，检查数据库版本，字段类型，索引总长度
 	indexes = idxAdv.idxColsTypeCheck(indexes)
 
 	// 在开启 env 的情况下，会对索引进行检查，对全索引进行过滤
 	// 在前几步都不会对 idx 生成 DDL 语句，DDL语句在这里生成
-	return idxAdv.mergeIndexes(indexes)
+	advises := mergeAdvices(idxAdv.mergeIndexes(indexes), idxAdv.checkCoveringIndex(covering)...)
+	advises = mergeAdvices(advises, ordered...)
+	advises = mergeAdvices(advises, idxAdv.buildFunctionalIndex()...)
+	return mergeAdvices(advises, subCovering...)
+}
+
+// buildCoveringIndex 将 SQL 中使用到的其他列追加到索引末尾，生成可选的覆盖索引，查询时无需回表
+// 追加列后超出 MaxIdxColsCount, MaxIdxBytes, MaxIdxBytesPerColumn 限制的无法完整覆盖，不给出建议
+func (idxAdv *IndexAdvisor) buildCoveringIndex(indexes []IndexInfo) []IndexInfo {
+	if !idxAdv.coverable {
+		return nil
+	}
+
+	// 当前层级查询中使用到的所有列，子查询中的列在子查询的索引建议中处理
+	used := idxAdv.completeColumnsInfo(idxAdv.selected)
+	used = common.MergeColumn(used, idxAdv.where...)
+	used = common.MergeColumn(used, idxAdv.groupBy...)
+	used = common.MergeColumn(used, idxAdv.orderBy...)
+	for _, joinCols := range idxAdv.joinCond {
+		used = common.MergeColumn(used, joinCols...)
+	}
+
+	var covering []IndexInfo
+	for _, idx := range indexes {
+		if len(idx.ColumnDetails) == 0 {
+			continue
+		}
+		db := idx.ColumnDetails[0].DB
+		pk := idxAdv.primaryKeyCols(db, idx.Table)
+
+		cols := append([]*common.Column{}, idx.ColumnDetails...)
+		for _, col := range used {
+			// InnoDB 二级索引中隐含主键列，无需追加
+			if !strings.EqualFold(col.DB, db) || !strings.EqualFold(col.Table, idx.Table) || pk[strings.ToLower(col.Name)] {
+				continue
+			}
+			has := false
+			for _, c := range cols {
+				if strings.EqualFold(c.Name, col.Name) {
+					has = true
+					break
+				}
+			}
+			if !has {
+				cols = append(cols, col)
+			}
+		}
+		if len(cols) == len(idx.ColumnDetails) {
+			// 普通索引已经是覆盖索引
+			continue
+		}
+		if len(cols) > common.Config.MaxIdxColsCount {
+			common.Log.Debug("covering index of `%s`.`%s` has %d columns, more than MaxIdxColsCount", idx.Database, idx.Table, len(cols))
+			continue
+		}
+
+		// 覆盖索引中不能使用前缀索引
+		total, extra := 0, 0
+		for i, col := range cols {
+			bytes := col.GetDataBytes(common.Config.OnlineDSN.Version)
+			if bytes < 0 || bytes > common.Config.MaxIdxBytesPerColumn {
+				total = -1
+				break
+			}
+			total += bytes
+			if i >= len(idx.ColumnDetails) {
+				extra += bytes
+			}
+		}
+		if total < 0 || total > common.Config.MaxIdxBytes {
+			common.Log.Debug("covering index of `%s`.`%s` is too long", idx.Database, idx.Table)
+			continue
+		}
+
+		covering = append(covering, IndexInfo{
+			Database:      idx.Database,
+			Table:         idx.Table,
+			ColumnDetails: cols,
+			Covering:      true,
+			CoveringBytes: extra,
+		})
+	}
+	return covering
+}
+
+// checkCoveringIndex 生成覆盖索引的 DDL，过滤已存在的索引，并按表行数估算额外占用的空间
+func (idxAdv *IndexAdvisor) checkCoveringIndex(covering []IndexInfo) []IndexInfo {
+	if len(covering) == 0 {
+		return nil
+	}
+	var indexes []IndexInfo
+	for _, idx := range idxAdv.mergeIndexes(idxAdv.idxColsTypeCheck(covering)) {
+		// mergeIndexes 可能会给出删除索引的建议，这里只保留覆盖索引
+		if !idx.Covering {
+			continue
+		}
+		if rows := idxAdv.tableRows(idx.Database, idx.Table); rows > 0 {
+			idx.CoveringSize = rows * int64(idx.CoveringBytes)
+		}
+		indexes = append(indexes, idx)
+	}
+	return indexes
+}
+
+// primaryKeyCols 获取表的主键列，列名统一为小写
+func (idxAdv *IndexAdvisor) primaryKeyCols(db, tb string) map[string]bool {
+	pk := make(map[string]bool)
+	realDB := idxAdv.vEnv.DBHash(db)
+	if idxAdv.IndexMeta[realDB] == nil {
+		idxAdv.IndexMeta[realDB] = make(map[string]*database.TableIndexInfo)
+	}
+	if idxAdv.IndexMeta[realDB][tb] == nil {
+		tmpDB := *idxAdv.vEnv
+		tmpDB.Database = realDB
+		indexInfo, err := tmpDB.ShowIndex(tb)
+		if err != nil {
+			common.Log.Warn("primaryKeyCols error: %v", err)
+			return pk
+		}
+		idxAdv.IndexMeta[realDB][tb] = indexInfo
+	}
+	for _, index := range idxAdv.IndexMeta[realDB][tb].FindIndex(database.IndexKeyName, "PRIMARY") {
+		pk[strings.ToLower(index.ColumnName)] = true
+	}
+	return pk
+}
+
+// tableRows 从线上环境获取表的行数，无法获取时返回 0
+func (idxAdv *IndexAdvisor) tableRows(db, tb string) int64 {
+	if common.Config.OnlineDSN.Disable {
+		return 0
+	}
+	tmpDB := idxAdv.rEnv
+	tmpDB.Database = db
+	status, err := tmpDB.ShowTableStatus(tb)
+	if err != nil || len(status.Rows) == 0 {
+		common.Log.Debug("tableRows error: %v", err)
+		return 0
+	}
+	rows, err := strconv.ParseInt(string(status.Rows[0].Rows), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return rows
 }
 
 // idxColsTypeCheck 对超长的字段添加前缀索引，剔除无法添索引字段的列
 // TODO: 暂不支持 fulltext 索引，
 func (idxAdv *IndexAdvisor) idxColsTypeCheck(idxList []IndexInfo) []IndexInfo {
-	if common.Config.TestDSN.Disable {
+	if testDSNDisabled(idxAdv.vEnv) {
 		return rmSelfDupIndex(idxList)
 	}
 
@@ -369,6 +563,7 @@ func (idxAdv *IndexAdvisor) idxColsTypeCheck(idxList []IndexInfo) []IndexInfo {
 	for _, idx := range idxList {
 		var newCols []*common.Column
 		var newColInfo []string
+		var prefixes []PrefixAdvise
 		// 索引总长度
 		idxBytesTotal := 0
 		isOverFlow := false
@@ -417,7 +612,23 @@ func (idxAdv *IndexAdvisor) idxColsTypeCheck(idxList []IndexInfo) []IndexInfo {
 
 				// 保留两个字节的安全余量
 				length := (common.Config.MaxIdxBytesPerColumn - 2) / v
-				if isOverFlow {
+				maxLength := length
+				if remain := (common.Config.MaxIdxBytes - idxBytesTotal - 2) / v; isOverFlow && remain < maxLength {
+					maxLength = remain
+				}
+
+				if prefix := idxAdv.prefixAdvise(idx.Database, col, maxLength); prefix != nil {
+					// 根据采样数据的选择性推荐最短的前缀长度，索引长度按前缀重新计算
+					common.Log.Debug("prefix index advise: %s.%s(%d)", col.Table, col.Name, prefix.Length)
+					if !isOverFlow {
+						idxBytesTotal -= bytes
+					}
+					idxBytesTotal += prefix.Length * v
+					isOverFlow = false
+					tmpCol += fmt.Sprintf("_OPR_SPLIT_(%d)", prefix.Length)
+					col = prefixColumn(col, prefix.Length)
+					prefixes = append(prefixes, *prefix)
+				} else if isOverFlow {
 					// 在索引中添加该列会导致索引长度过长，建议根据需求转换为合理的前缀索引
 					// _OPR_SPLIT_ 是自定的用于后续处理的特殊分隔符
 					common.Log.Warning("adding index '%s(%s)' to table '%s' causes the index to be too long, overflow is %d",
@@ -428,6 +639,7 @@ func (idxAdv *IndexAdvisor) idxColsTypeCheck(idxList []IndexInfo) []IndexInfo {
 					common.Log.Warning("index column too large: %s.%s --> %s.%s(%d), data type: %s",
 						col.Table, col.Name, col.Table, tmpCol, length, col.DataType)
 					tmpCol += fmt.Sprintf("_OPR_SPLIT_(%d)", length)
+					col = prefixColumn(col, length)
 				}
 
 			}
@@ -467,28 +679,49 @@ func (idxAdv *IndexAdvisor) idxColsTypeCheck(idxList []IndexInfo) []IndexInfo {
 			idx.Table, idxName, idxCols)
 
 		// 将筛选改造后的索引信息信息加入到新的索引列表中
+		idx.Name = idxName
 		idx.ColumnDetails = newCols
 		idx.DDL = newDDL
+		idx.Prefixes = prefixes
 		indexes = append(indexes, idx)
 	}
 
 	return indexes
 }
 
+// prefixColumn 复制一份列信息并记录前缀索引长度，ColumnDetails 中的列可能被多个索引建议共用，不能直接修改
+func prefixColumn(col *common.Column, length int) *common.Column {
+	c := *col
+	c.SubPart = length
+	return &c
+}
+
+// indexColumn 已存在索引中的列，包含前缀长度及排序方向
+func indexColumn(row database.TableIndexRow, db, tb string) *common.Column {
+	col := &common.Column{
+		Name:  row.ColumnName,
+		Table: tb,
+		DB:    db,
+		Desc:  row.Collation == "D",
+	}
+	// 整列索引的 Sub_part 为 NULL，离线数据字典中为 -1
+	if row.SubPart > 0 {
+		col.SubPart = row.SubPart
+	}
+	return col
+}
+
 // mergeIndexes 与线上环境对比，将给出的索引建议进行去重
 func (idxAdv *IndexAdvisor) mergeIndexes(idxList []IndexInfo) []IndexInfo {
 	// TODO 暂不支持前缀索引去重
-	if common.Config.TestDSN.Disable {
+	if testDSNDisabled(idxAdv.vEnv) {
 		return rmSelfDupIndex(idxList)
 	}
 
 	var indexes []IndexInfo
 	for _, idx := range idxList {
 		// 将 DB 替换成 vEnv 中的数据库名称
-		dbInVEnv := idx.Database
-		if _, ok := idxAdv.vEnv.DBRef[idx.Database]; ok {
-			dbInVEnv = idxAdv.vEnv.DBRef[idx.Database]
-		}
+		dbInVEnv := idxAdv.vEnv.DBHash(idx.Database)
 
 		// 检测索引添加的表是否是视图
 		if idxAdv.vEnv.IsView(idx.Table) {
@@ -516,11 +749,7 @@ func (idxAdv *IndexAdvisor) mergeIndexes(idxList []IndexInfo) []IndexInfo {
 				// 把已经存在的 key 摘出来遍历一遍对比是否是包含关系
 				for _, col := range indexMeta.FindIndex(database.IndexKeyName, existedIdx.KeyName) {
 					cols = append(cols, col.ColumnName)
-					colsDetail = append(colsDetail, &common.Column{
-						Name:  col.ColumnName,
-						Table: idx.Table,
-						DB:    idx.ColumnDetails[0].DB,
-					})
+					colsDetail = append(colsDetail, indexColumn(col, idx.ColumnDetails[0].DB, idx.Table))
 				}
 
 				// 判断已存在的索引是否属于约束条件(唯一索引、主键)
@@ -552,6 +781,7 @@ func (idxAdv *IndexAdvisor) mergeIndexes(idxList []IndexInfo) []IndexInfo {
 								Table:         idx.Table,
 								DDL:           alterSQL,
 								ColumnDetails: colsDetail,
+								Drop:          true,
 							})
 						} else {
 							common.Log.Warning("In table `%s`, the new index of column `%s` contains index `%s`,"+
@@ -631,7 +861,7 @@ func (idxAdv *IndexAdvisor) buildJoinIndex(meta common.Meta) []IndexInfo {
 			idxAdv.mergeIndex(indexColsList, col)
 		}
 
-		if common.Config.TestDSN.Disable || common.Config.OnlineDSN.Disable {
+		if envDisabled(idxAdv.vEnv) {
 			indexes = mergeAdvices(indexes, idxAdv.buildIndexWithNoEnv(indexColsList)...)
 			continue
 		}
@@ -723,8 +953,9 @@ func (idxAdv *IndexAdvisor) buildIndexWithNoEnv(indexList map[string]map[string]
 
 // mergeIndex 将索引用到的列去重后合并到一起
 func (idxAdv *IndexAdvisor) mergeIndex(idxList map[string]map[string][]*common.Column, column *common.Column) {
-	// 散粒度低于阈值将不会添加索引
-	if common.Config.MinCardinality/100 > column.Cardinality {
+	// 散粒度低于阈值将不会添加索引，合成数据中假定的散粒度不作为依据
+	if common.Config.MinCardinality/100 > column.Cardinality &&
+		!database.SyntheticGuessed(idxAdv.vEnv.RealDB(column.DB), column.Table, column.Name) {
 		return
 	}
 
@@ -746,10 +977,7 @@ func (idxAdv *IndexAdvisor) mergeIndex(idxList map[string]map[string][]*common.C
 	}
 
 	// 将 DB 替换成 vEnv 中的数据库名称
-	dbInVEnv := db
-	if _, ok := idxAdv.vEnv.DBRef[db]; ok {
-		dbInVEnv = idxAdv.vEnv.DBRef[db]
-	}
+	dbInVEnv := idxAdv.vEnv.DBHash(db)
 	indexMeta := idxAdv.IndexMeta[dbInVEnv][tb]
 	// 主键列不需要追加
 	pr := indexMeta.FindIndex(database.IndexKeyName, "PRIMARY")
@@ -764,6 +992,65 @@ func (idxAdv *IndexAdvisor) mergeIndex(idxList map[string]map[string][]*common.C
 	}
 }
 
+// IndexColumns 索引建议可能用到的列，包括 WHERE, JOIN, GROUP BY, ORDER BY 中的列，这些列的散粒度会影响索引建议
+func (idxAdv *IndexAdvisor) IndexColumns() []*common.Column {
+	cols := append([]*common.Column{}, idxAdv.where...)
+	for _, join := range idxAdv.joinCond {
+		cols = append(cols, join...)
+	}
+	cols = append(cols, idxAdv.groupBy...)
+	return append(cols, idxAdv.orderBy...)
+}
+
+// hasWhere 当前层级的查询是否指定了 WHERE 条件，子查询中的 WHERE 条件不计算在内
+func (idxAdv *IndexAdvisor) hasWhere() bool {
+	hasWhere := false
+	if idxAdv.Ast == nil {
+		ast.TiWalk(func(node tidb.Node) bool {
+			switch n := node.(type) {
+			case *tidb.SubqueryExpr:
+				return false
+			case *tidb.TableSource:
+				if _, ok := n.Source.(*tidb.TableName); !ok {
+					return false
+				}
+			case *tidb.SelectStmt:
+				hasWhere = hasWhere || n.Where != nil
+			case *tidb.UpdateStmt:
+				hasWhere = hasWhere || n.Where != nil
+			case *tidb.DeleteStmt:
+				hasWhere = hasWhere || n.Where != nil
+			}
+			return true
+		}, idxAdv.TiAst)
+		return hasWhere
+	}
+	err := sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		switch where := node.(type) {
+		case *sqlparser.Subquery:
+			return false, nil
+		case *sqlparser.Where:
+			if where != nil {
+				hasWhere = true
+			}
+		}
+		return true, nil
+	}, idxAdv.Ast)
+	common.LogIfError(err, "")
+	return hasWhere
+}
+
+// completeColumnsInfo 补全列的库表信息，Vitess 无法解析时库表信息从 TiDB AST 中获取
+func (idxAdv *IndexAdvisor) completeColumnsInfo(cols []*common.Column) []*common.Column {
+	if len(cols) == 0 {
+		return cols
+	}
+	if idxAdv.Ast == nil && idxAdv.TiAst != nil {
+		return completeColumns(ast.TiGetMeta(idxAdv.TiAst, nil), cols, idxAdv.vEnv)
+	}
+	return completeColumns(ast.GetMeta(idxAdv.Ast, nil), cols, idxAdv.vEnv)
+}
+
 // CompleteColumnsInfo 补全索引可能会用到列的所属库名、表名等信息
 func CompleteColumnsInfo(stmt sqlparser.Statement, cols []*common.Column, env *env.VirtualEnv) []*common.Column {
 	// 如果传过来的列是空的，没必要跑逻辑
@@ -772,7 +1059,11 @@ func CompleteColumnsInfo(stmt sqlparser.Statement, cols []*common.Column, env *e
 	}
 
 	// 从 Ast 中拿到 DBStructure，包含所有表的相关信息
-	dbs := ast.GetMeta(stmt, nil)
+	return completeColumns(ast.GetMeta(stmt, nil), cols, env)
+}
+
+// completeColumns 根据 SQL 中使用到的库表 dbs 补全列信息
+func completeColumns(dbs common.Meta, cols []*common.Column, env *env.VirtualEnv) []*common.Column {
 
 	// 此处生成的 meta 信息中不应该含有""db的信息，若 DB 为空则认为是已传入的 db 为默认 db 并进行信息补全
 	// BUG Fix:
@@ -812,7 +1103,7 @@ func CompleteColumnsInfo(stmt sqlparser.Statement, cols []*common.Column, env *e
 			}
 
 			// 如果不依赖env环境，利用ast中包含的信息推理列的库表信息
-			if common.Config.TestDSN.Disable {
+			if testDSNDisabled(env) {
 				if tableCount == 1 {
 					for _, tb := range dbs[db].Table {
 						col.Table = tb.TableName
@@ -897,13 +1188,18 @@ func CompleteColumnsInfo(stmt sqlparser.Statement, cols []*common.Column, env *e
 	}
 
 	// 如果不依赖env环境，将可能存在的列也加入到索引预处理列表中
-	if common.Config.TestDSN.Disable {
+	if testDSNDisabled(env) {
 		cols = append(cols, noEnvTmp...)
 	}
 
 	return cols
 }
 
+// cardinalityAvailable 开启数据采样、数据合成、导入测试数据或使用线上环境快照时散粒度才有参考价值
+func cardinalityAvailable() bool {
+	return common.Config.Sampling || common.Config.Synthetic || env.FixtureEnabled() || common.Config.OnlineSnapshot != ""
+}
+
 // calcCardinality 计算每一列的散粒度
 // 这个函数需要在补全列的库表信息之后再调用，否则无法确定要计算列的归属
 func (idxAdv *IndexAdvisor) calcCardinality(cols []*common.Column) []*common.Column {
@@ -953,7 +1249,8 @@ func (idxAdv *IndexAdvisor) calcCardinality(cols []*common.Column) []*common.Col
 
 		// 给非 PRIMARY、UNIQUE 的列计算散粒度
 		if col.Cardinality != 1 {
-			col.Cardinality = idxAdv.vEnv.ColumnCardinality(col.Table, col.Name)
+			tmpDB.Database = realDB
+			col.Cardinality = tmpDB.ColumnCardinality(col.Table, col.Name)
 		}
 	}
 
@@ -966,15 +1263,38 @@ func (idxAdvs IndexAdvises) Format() map[string]Rule {
 	number := 1
 	rules := make(map[string]*Rule)
 	sqls := make(map[string][]string)
+	plans := make(map[string][]string)
+	prefixes := make(map[string][]string)
 
 	for _, advise := range idxAdvs {
 		advKey := advise.Database + advise.Table
+		if advise.Covering {
+			// 覆盖索引是可选的建议，与普通索引分开输出
+			advKey += ".covering"
+		}
 
 		if _, ok := sqls[advKey]; !ok {
 			sqls[advKey] = make([]string, 0)
 		}
 
 		sqls[advKey] = append(sqls[advKey], advise.DDL)
+		if advise.Validation != nil {
+			plans[advKey] = append(plans[advKey], formatIndexValidation(advise.Name, advise.Validation))
+		}
+		for _, p := range advise.Prefixes {
+			prefixes[advKey] = append(prefixes[advKey], formatPrefixAdvise(p))
+		}
+
+		if advise.Covering {
+			if _, ok := rules[advKey]; !ok {
+				rules[advKey] = &Rule{
+					Summary:  fmt.Sprintf("可选：为%s库的%s表添加覆盖索引", advise.Database, advise.Table),
+					Severity: "L1",
+				}
+			}
+			rules[advKey].Content += formatCoveringIndex(advise)
+			continue
+		}
 
 		if _, ok := rules[advKey]; !ok {
 			summary := fmt.Sprintf("为%s库的%s表添加索引", advise.Database, advise.Table)
@@ -989,20 +1309,36 @@ func (idxAdvs IndexAdvises) Format() map[string]Rule {
 			}
 		}
 
+		if advise.Expression != "" || advise.OrderBy != "" {
+			if c := rules[advKey].Content; c != "" && !strings.HasSuffix(c, "。") {
+				rules[advKey].Content += "; "
+			}
+			if advise.Expression != "" {
+				rules[advKey].Content += formatFunctionalIndex(advise)
+			} else {
+				rules[advKey].Content += formatOrderByIndex(advise)
+			}
+			continue
+		}
+
+		guessed := false
 		for _, col := range advise.ColumnDetails {
 			// 为了更好地显示效果
-			if common.Config.Sampling {
+			if cardinalityAvailable() && !database.SyntheticGuessed(advise.Database, advise.Table, col.Name) {
 				cardinal := fmt.Sprintf("%0.2f", col.Cardinality*100)
 				if cardinal != "0.00" {
 					rules[advKey].Content += fmt.Sprintf("为列%s添加索引，散粒度为: %s%%; ",
 						col.Name, cardinal)
 				}
 			} else {
+				guessed = guessed || cardinalityAvailable()
 				rules[advKey].Content += fmt.Sprintf("为列%s添加索引;", col.Name)
 			}
 		}
-		if !common.Config.Sampling && len(rules[advKey].Content) > 5 {
+		if !cardinalityAvailable() && len(rules[advKey].Content) > 5 {
 			rules[advKey].Content += " 由于未开启数据采样，各列在索引中的顺序需要自行调整。"
+		} else if guessed {
+			rules[advKey].Content += " 合成数据时部分列没有散粒度信息，各列在索引中的顺序需要自行调整。"
 		}
 		// 清理多余的标点
 		rules[advKey].Content = strings.Trim(rules[advKey].Content, common.Config.Delimiter)
@@ -1022,6 +1358,16 @@ func (idxAdvs IndexAdvises) Format() map[string]Rule {
 			rules[adv].Case = v
 		}
 
+		// 附加前缀索引长度与选择性的关系
+		for _, prefix := range prefixes[adv] {
+			rules[adv].Content += "\n\n" + prefix
+		}
+
+		// 附加添加索引前后的执行计划对比
+		for _, plan := range plans[adv] {
+			rules[adv].Content += "\n\n" + plan
+		}
+
 		// set item
 		rules[adv].Item = key
 
@@ -1033,25 +1379,36 @@ func (idxAdvs IndexAdvises) Format() map[string]Rule {
 	return rulesMap
 }
 
+// formatCoveringIndex 覆盖索引建议的说明，包含追加的列及额外占用的空间
+func formatCoveringIndex(advise IndexInfo) string {
+	var cols []string
+	for _, col := range advise.ColumnDetails {
+		cols = append(cols, col.Name)
+	}
+	content := fmt.Sprintf("索引(%s)包含查询用到的所有列，查询时无需回表，每条索引记录额外增加约 %d 字节",
+		strings.Join(cols, ","), advise.CoveringBytes)
+	if advise.CoveringSize > 0 {
+		content += fmt.Sprintf("，按表行数估算索引额外增加约 %.2f MB", float64(advise.CoveringSize)/1024/1024)
+	}
+	return content + "。"
+}
+
 // HeuristicCheck 依赖数据字典的启发式检查
 // IndexAdvisor会构建测试环境和数据字典，所以放在这里实现
 func (idxAdv *IndexAdvisor) HeuristicCheck(q Query4Audit) map[string]Rule {
 	var rule Rule
 	heuristicSuggest := make(map[string]Rule)
-	if common.Config.OnlineDSN.Disable && common.Config.TestDSN.Disable {
+	if common.Config.OnlineDSN.Disable && testDSNDisabled(idxAdv.vEnv) {
 		return heuristicSuggest
 	}
 
-	ruleFuncs := []func(*IndexAdvisor) Rule{
-		(*IndexAdvisor).RuleMaxTextColsCount,   // COL.007
-		(*IndexAdvisor).RuleImplicitConversion, // ARG.003
-		(*IndexAdvisor).RuleGroupByConst,       // CLA.004
-		(*IndexAdvisor).RuleOrderByConst,       // CLA.005
-		(*IndexAdvisor).RuleUpdatePrimaryKey,   // CLA.016
-		// (*IndexAdvisor).RuleImpossibleOuterJoin, // TODO: JOI.003, JOI.004
-	}
-
-	for _, f := range ruleFuncs {
+	// 内置规则与通过 RegisterRule 注册的规则均以 IndexFunc 的形式挂在 HeuristicRules 上
+	// TODO: (*IndexAdvisor).RuleImpossibleOuterJoin, JOI.003, JOI.004
+	for _, item := range common.SortedKey(HeuristicRules) {
+		f := HeuristicRules[item].IndexFunc
+		if f == nil || IsIgnoreRule(item) {
+			continue
+		}
 		rule = f(idxAdv)
 		if rule.Item != "OK" {
 			heuristicSuggest[rule.Item] = rule
@@ -1116,11 +1473,7 @@ func DuplicateKeyChecker(conn *database.Connector, databases ...string) map[stri
 				if _, ok := idxMap[idx.KeyName]; !ok {
 					idxMap[idx.KeyName] = make([]*common.Column, 0)
 					for _, col := range idxInfo.FindIndex(database.IndexKeyName, idx.KeyName) {
-						idxMap[idx.KeyName] = append(idxMap[idx.KeyName], &common.Column{
-							Name:  col.ColumnName,
-							Table: tb,
-							DB:    db,
-						})
+						idxMap[idx.KeyName] = append(idxMap[idx.KeyName], indexColumn(col, db, tb))
 					}
 				}
 			}
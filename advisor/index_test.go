@@ -66,6 +66,18 @@ func TestMain(m *testing.M) {
 	vEnv.CleanUp()
 }
 
+// newOfflineEnv 使用离线数据字典构建 sakila 库的测试环境，不依赖测试环境中的表结构
+func newOfflineEnv(t *testing.T, ddl ...string) *env.VirtualEnv {
+	t.Helper()
+	offline := env.NewVirtualEnv(vEnv.Connector)
+	offline.Database = "sakila"
+	offline.Catalog = env.NewCatalog("sakila")
+	for _, sql := range ddl {
+		offline.Catalog.Load(sql)
+	}
+	return offline
+}
+
 // ARG.003
 func TestRuleImplicitConversion(t *testing.T) {
 	common.Log.Debug("Entering function: %s", common.GetFunctionName())
@@ -428,6 +440,136 @@ func TestIndexAdviseNoEnv(t *testing.T) {
 	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
 }
 
+func TestIndexAdviseCovering(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	orgCoveringIndex := common.Config.CoveringIndex
+	orgMaxIdxColsCount := common.Config.MaxIdxColsCount
+	common.Config.CoveringIndex = true
+	common.Config.MaxIdxColsCount = 5
+	defer func() {
+		common.Config.CoveringIndex = orgCoveringIndex
+		common.Config.MaxIdxColsCount = orgMaxIdxColsCount
+	}()
+
+	offline := newOfflineEnv(t, "CREATE TABLE film (film_id int primary key, title varchar(255), "+
+		"release_year int, language_id int, description text)")
+
+	sqls := map[string]string{
+		"select title, release_year from film where language_id = 1":                "language_id,title,release_year",
+		"select film_id, title from film where language_id = 1":                     "language_id,title",
+		"select language_id from film where language_id = 1":                        "",
+		"select description from film where language_id = 1":                        "",
+		"select * from film where language_id = 1":                                  "",
+		"select count(title) from film where language_id = 1 group by release_year": "language_id,release_year,title",
+	}
+	for sql, want := range sqls {
+		stmt, err := sqlparser.Parse(sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := &Query4Audit{Query: sql, Stmt: stmt}
+		if !offline.BuildVirtualEnv(rEnv, q.Query) {
+			t.Fatalf("BuildVirtualEnv failed, SQL: %s", sql)
+		}
+		idxAdvisor, err := NewAdvisor(offline, *rEnv, *q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		for _, idx := range idxAdvisor.IndexAdvise() {
+			if idx.Covering {
+				got = common.JoinColumnsName(idx.ColumnDetails, ",")
+			}
+		}
+		if got != want {
+			t.Errorf("%s want covering index (%s), got (%s)", sql, want, got)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestIndexAdviseTiDB(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	orgMaxIdxColsCount := common.Config.MaxIdxColsCount
+	common.Config.MaxIdxColsCount = 5
+	defer func() {
+		common.Config.MaxIdxColsCount = orgMaxIdxColsCount
+	}()
+
+	offline := newOfflineEnv(t,
+		"CREATE TABLE film (film_id int primary key, title varchar(255), release_year int, language_id int, length int)",
+		"CREATE TABLE film_actor (actor_id int, film_id int, primary key (actor_id, film_id))")
+
+	// Vitess 无法解析 CTE 及窗口函数，索引建议使用 TiDB AST 中的列
+	sqls := map[string][]string{
+		"with f as (select film_id from film_actor where actor_id = 1) select * from film join f on film.film_id = f.film_id where film.language_id = 1 and film.length > 60": {
+			"alter table `sakila`.`film` add index `idx_language_id_length` (`language_id`,`length`)",
+		},
+		"select title, rank() over (partition by language_id order by length desc) from film where release_year = 2006": {
+			"alter table `sakila`.`film` add index `idx_release_year` (`release_year`)",
+		},
+	}
+	for sql, want := range sqls {
+		q, err := NewQuery4Audit(sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.Stmt != nil {
+			t.Fatalf("vitess should not parse SQL: %s", sql)
+		}
+		if !offline.BuildVirtualEnv(rEnv, q.Query) {
+			t.Fatalf("BuildVirtualEnv failed, SQL: %s", sql)
+		}
+		idxAdvisor, err := NewAdvisor(offline, *rEnv, *q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, idx := range idxAdvisor.IndexAdvise() {
+			got = append(got, idx.DDL)
+		}
+		if strings.Join(got, ";") != strings.Join(want, ";") {
+			t.Errorf("SQL: %s\nwant: %v\ngot: %v", sql, want, got)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestIndexAdvisesFormatSynthetic(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	orgSynthetic := common.Config.Synthetic
+	common.Config.Synthetic = true
+	defer func() {
+		common.Config.Synthetic = orgSynthetic
+	}()
+
+	// 快照中 film.language_id 没有散粒度信息，合成数据时使用假定值
+	s, err := database.LoadSnapshot(filepath.Join("..", "database", "testdata", "snapshot.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := &database.Connector{Addr: s.Addr, Database: s.Database, Snapshot: s}
+	if _, err = conn.SyntheticPlan("film", 100, make(map[string]*database.SyntheticTable)); err != nil {
+		t.Fatal(err)
+	}
+
+	advises := IndexAdvises{{
+		Database: "test",
+		Table:    "film",
+		DDL:      "alter table `test`.`film` add index `idx_language_id_rating` (`language_id`,`rating`)",
+		ColumnDetails: []*common.Column{
+			{Name: "language_id", DB: "test", Table: "film", Cardinality: 0.1},
+			{Name: "rating", DB: "test", Table: "film", Cardinality: 0.5},
+		},
+	}}
+	content := advises.Format()["IDX.001"].Content
+	if !strings.Contains(content, "为列language_id添加索引;") || strings.Contains(content, "language_id添加索引，散粒度") ||
+		!strings.Contains(content, "为列rating添加索引，散粒度为: 50.00%") || !strings.Contains(content, "没有散粒度信息") {
+		t.Errorf("got: %s", content)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
 func TestDuplicateKeyChecker(t *testing.T) {
 	common.Log.Debug("Entering function: %s", common.GetFunctionName())
 	rule := DuplicateKeyChecker(rEnv, "sakila")
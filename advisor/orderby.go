@@ -0,0 +1,272 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package advisor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/XiaoMi/soar/ast"
+	"github.com/XiaoMi/soar/common"
+	"github.com/XiaoMi/soar/database"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// descIndexSupported MySQL 8.0 开始支持降序索引，之前的版本会忽略索引定义中的 DESC，MariaDB 的版本号从 10 开始
+func descIndexSupported(version int) bool {
+	return version >= 80000 && version < 100000
+}
+
+// buildOrderByIndex 为单表的 ORDER BY ... LIMIT 分页查询给出可以消除排序(Using filesort)的索引建议
+// 索引由等值条件列及按书写顺序排列的 ORDER BY 列组成，MySQL 8.0 及以上版本使用降序索引支持混合的排序方向，方向一致时不使用降序索引
+// 前缀索引无法用于排序，列类型无法添加完整索引时不给出建议
+func (idxAdv *IndexAdvisor) buildOrderByIndex() []IndexInfo {
+	sel, ok := idxAdv.Ast.(*sqlparser.Select)
+	if !ok || sel.Limit == nil || len(sel.GroupBy) > 0 || len(sel.From) != 1 || envDisabled(idxAdv.vEnv) {
+		return nil
+	}
+	if tb, ok := sel.From[0].(*sqlparser.AliasedTableExpr); !ok {
+		return nil
+	} else if _, ok := tb.Expr.(sqlparser.TableName); !ok {
+		return nil
+	}
+
+	parts := ast.FindOrderByKeyParts(sel)
+	if len(parts) == 0 {
+		return nil
+	}
+	var orderCols []*common.Column
+	for _, p := range parts {
+		orderCols = append(orderCols, p.Column)
+	}
+	orderCols = idxAdv.completeColumnsInfo(orderCols)
+	db, tb := orderCols[0].DB, orderCols[0].Table
+	if db == "" || tb == "" {
+		common.Log.Warn("can not get the meta info of ORDER BY column '%s'", orderCols[0].Name)
+		return nil
+	}
+
+	// 等值条件列在结果集中是常量，放在索引最前面，出现在 ORDER BY 中时不影响排序
+	var cols []*common.Column
+	for _, col := range idxAdv.whereEQ {
+		if col.DB == db && col.Table == tb && !hasColumn(cols, col.Name) {
+			cols = append(cols, col)
+		}
+	}
+	eqCount := len(cols)
+	var keyParts []ast.OrderByKeyPart
+	for i, col := range orderCols {
+		if hasColumn(cols, col.Name) {
+			continue
+		}
+		cols = append(cols, col)
+		keyParts = append(keyParts, ast.OrderByKeyPart{Column: col, Desc: parts[i].Desc})
+	}
+	if len(keyParts) == 0 {
+		return nil
+	}
+
+	// 方向一致时正向、反向扫描索引都可以满足排序，只有混合的排序方向才需要降序索引，低版本中无法消除排序
+	mixed := false
+	for _, p := range keyParts[1:] {
+		if p.Desc != keyParts[0].Desc {
+			mixed = true
+		}
+	}
+	version := common.Config.OnlineDSN.Version
+	if mixed && !descIndexSupported(version) {
+		common.Log.Debug("mixed ORDER BY directions need descending index, version: %d", version)
+		return nil
+	}
+
+	if len(cols) > common.Config.MaxIdxColsCount {
+		common.Log.Debug("ORDER BY index of `%s`.`%s` has %d columns, more than MaxIdxColsCount", db, tb, len(cols))
+		return nil
+	}
+	total := 0
+	for _, col := range cols {
+		bytes := col.GetDataBytes(version)
+		if bytes < 0 || bytes > common.Config.MaxIdxBytesPerColumn {
+			common.Log.Debug("column %s.%s(%s) can not be fully indexed for ORDER BY", col.Table, col.Name, col.DataType)
+			return nil
+		}
+		total += bytes
+	}
+	if total > common.Config.MaxIdxBytes {
+		common.Log.Debug("ORDER BY index of `%s`.`%s` is too long: %d bytes", db, tb, total)
+		return nil
+	}
+
+	// 已存在可以消除排序的索引时无需添加
+	realDB := idxAdv.vEnv.RealDB(db)
+	tmpDB := *idxAdv.vEnv
+	tmpDB.Database = idxAdv.vEnv.DBHash(realDB)
+	idxInfo, err := tmpDB.ShowIndex(tb)
+	if err != nil {
+		common.Log.Warn("buildOrderByIndex ShowIndex `%s`.`%s` Error: %v", realDB, tb, err)
+		idxInfo = database.NewTableIndexInfo(tb)
+	}
+	if name := satisfyOrderBy(idxInfo.Rows, cols[:eqCount], keyParts); name != "" {
+		common.Log.Info("`%s`.`%s` index `%s` already avoids filesort for ORDER BY", realDB, tb, name)
+		return nil
+	}
+
+	var names, defs, orders []string
+	for _, col := range cols {
+		names = append(names, col.Name)
+		defs = append(defs, fmt.Sprintf("`%s`", col.Name))
+	}
+	for i, p := range keyParts {
+		order := p.Column.Name
+		if p.Desc {
+			order += " DESC"
+			if mixed {
+				defs[eqCount+i] += " DESC"
+				// 列信息可能与其他索引建议共用，复制后再记录排序方向
+				desc := *cols[eqCount+i]
+				desc.Desc = true
+				cols[eqCount+i] = &desc
+			}
+		}
+		orders = append(orders, order)
+	}
+
+	idxName := truncateIndexName(common.Config.IdxPrefix + strings.Join(names, "_"))
+	if len(idxInfo.FindIndex(database.IndexKeyName, idxName)) > 0 {
+		idxSuffix := getRandomIndexSuffix()
+		newName := idxName + idxSuffix
+		if len(newName) > IndexNameMaxLength {
+			newName = idxName[:IndexNameMaxLength-len(idxSuffix)] + idxSuffix
+		}
+		common.Log.Warning("duplicate index name '%s', new name is '%s'", idxName, newName)
+		idxName = newName
+	}
+	return []IndexInfo{{
+		Name:          idxName,
+		Database:      realDB,
+		Table:         tb,
+		DDL:           fmt.Sprintf("alter table `%s`.`%s` add index `%s` (%s)", realDB, tb, idxName, strings.Join(defs, ",")),
+		ColumnDetails: cols,
+		OrderBy:       strings.Join(orders, ", "),
+	}}
+}
+
+// hasColumn 判断列名是否已在列表中
+func hasColumn(cols []*common.Column, name string) bool {
+	for _, col := range cols {
+		if strings.EqualFold(col.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// satisfyOrderBy 查找可以消除排序的已有索引：以任意顺序的等值条件列开头，紧接着是方向全部相同或全部相反的 ORDER BY 列
+func satisfyOrderBy(rows []database.TableIndexRow, eq []*common.Column, keyParts []ast.OrderByKeyPart) string {
+	var keys []string
+	indexes := make(map[string][]database.TableIndexRow)
+	for _, row := range rows {
+		if _, ok := indexes[row.KeyName]; !ok {
+			keys = append(keys, row.KeyName)
+		}
+		indexes[row.KeyName] = append(indexes[row.KeyName], row)
+	}
+
+	for _, key := range keys {
+		idx := indexes[key]
+		if len(idx) < len(eq)+len(keyParts) {
+			continue
+		}
+		matched := true
+		for _, row := range idx[:len(eq)] {
+			if !hasColumn(eq, row.ColumnName) || row.SubPart > 0 {
+				matched = false
+				break
+			}
+		}
+		forward, backward := true, true
+		for i, p := range keyParts {
+			row := idx[len(eq)+i]
+			if !strings.EqualFold(row.ColumnName, p.Column.Name) || row.SubPart > 0 {
+				matched = false
+				break
+			}
+			if (row.Collation == "D") == p.Desc {
+				backward = false
+			} else {
+				forward = false
+			}
+		}
+		if matched && (forward || backward) {
+			return key
+		}
+	}
+	return ""
+}
+
+// rmOrderByDupIndex ORDER BY 索引的前若干列包含了同一张表的普通索引建议中的全部列时，普通索引建议是多余的
+func rmOrderByDupIndex(indexes []IndexInfo, ordered []IndexInfo) []IndexInfo {
+	if len(ordered) == 0 {
+		return indexes
+	}
+	var result []IndexInfo
+	for _, idx := range indexes {
+		dup := false
+		for _, o := range ordered {
+			if idx.Database != o.Database || idx.Table != o.Table || len(idx.ColumnDetails) > len(o.ColumnDetails) {
+				continue
+			}
+			dup = true
+			for _, col := range idx.ColumnDetails {
+				if !hasColumn(o.ColumnDetails[:len(idx.ColumnDetails)], col.Name) {
+					dup = false
+					break
+				}
+			}
+			if dup {
+				common.Log.Debug("remove index %s, ORDER BY index %s contains it", idx.Name, o.Name)
+				break
+			}
+		}
+		if !dup {
+			result = append(result, idx)
+		}
+	}
+	return result
+}
+
+// formatOrderByIndex 输出消除排序的索引建议的说明，开启 -validate-index 时附带 EXPLAIN 中 Using filesort 的变化
+func formatOrderByIndex(advise IndexInfo) string {
+	var cols []string
+	for _, col := range advise.ColumnDetails {
+		cols = append(cols, col.Name)
+	}
+	content := fmt.Sprintf("为列%s添加索引，等值条件列在前，ORDER BY %s的列按书写顺序在后，分页查询时可以利用索引的有序性消除排序(Using filesort)",
+		strings.Join(cols, ", "), advise.OrderBy)
+	if advise.Validation != nil {
+		before := strings.Contains(advise.Validation.Before.Extra, "Using filesort")
+		after := strings.Contains(advise.Validation.After.Extra, "Using filesort")
+		switch {
+		case after:
+			content += "，但测试环境中添加索引后执行计划仍然出现Using filesort"
+		case before:
+			content += "，测试环境中添加索引后执行计划不再出现Using filesort"
+		}
+	}
+	return content
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package advisor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/XiaoMi/soar/ast"
+	"github.com/XiaoMi/soar/common"
+	"github.com/XiaoMi/soar/database"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+func TestIndexAdviseOrderBy(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	orgVersion := common.Config.OnlineDSN.Version
+	orgColsCount := common.Config.MaxIdxColsCount
+	common.Config.MaxIdxColsCount = 5
+	defer func() {
+		common.Config.OnlineDSN.Version = orgVersion
+		common.Config.MaxIdxColsCount = orgColsCount
+	}()
+
+	offline := newOfflineEnv(t,
+		"CREATE TABLE orders (id int primary key, user_id int, status int, created_at datetime, note text, key idx_status_created_at (status, created_at))",
+		"CREATE TABLE logs (id int primary key, status int, created_at datetime)")
+
+	cases := []struct {
+		sql     string
+		version int
+		want    string
+	}{
+		{
+			"select * from orders where user_id = 1 order by created_at desc, id asc limit 20", 80023,
+			"alter table `sakila`.`orders` add index `idx_user_id_created_at_id` (`user_id`,`created_at` DESC,`id`)",
+		},
+		// 排序方向一致时反向扫描索引即可消除排序，无需降序索引
+		{
+			"select * from logs where status = 1 order by created_at desc limit 20", 80023,
+			"alter table `sakila`.`logs` add index `idx_status_created_at` (`status`,`created_at`)",
+		},
+		// 低版本不支持降序索引，排序方向不一致时无法消除排序
+		{
+			"select * from orders where user_id = 1 order by created_at desc, id asc limit 20", 50730,
+			"alter table `sakila`.`orders` add index `idx_user_id` (`user_id`)",
+		},
+		{
+			"select * from orders where user_id = 1 order by created_at desc limit 20", 50730,
+			"alter table `sakila`.`orders` add index `idx_user_id_created_at` (`user_id`,`created_at`)",
+		},
+		// 范围条件列之后的列无法用于排序，消除排序的索引中不包含范围条件列；等值条件列出现在 ORDER BY 中不影响排序
+		{
+			"select * from orders where user_id = 1 and status > 1 order by user_id, created_at limit 20", 80023,
+			"alter table `sakila`.`orders` add index `idx_user_id_status_created_at` (`user_id`,`status`,`created_at`)\nalter table `sakila`.`orders` add index `idx_user_id_created_at` (`user_id`,`created_at`)",
+		},
+		// 已存在可以消除排序的索引
+		{
+			"select * from orders where status = 1 order by created_at desc limit 20", 80023,
+			"",
+		},
+		// 无 LIMIT 或 ORDER BY 中含有无法完整索引的列
+		{"select * from orders where user_id = 1 order by created_at", 80023, "alter table `sakila`.`orders` add index `idx_user_id_created_at` (`user_id`,`created_at`)"},
+		{"select * from orders where user_id = 1 order by note limit 1", 80023, "alter table `sakila`.`orders` add index `idx_user_id_note` (`user_id`,`note`(191))"},
+	}
+	for _, c := range cases {
+		common.Config.OnlineDSN.Version = c.version
+		stmt, err := sqlparser.Parse(c.sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := &Query4Audit{Query: c.sql, Stmt: stmt}
+		if !offline.BuildVirtualEnv(rEnv, q.Query) {
+			t.Fatalf("BuildVirtualEnv failed, SQL: %s", c.sql)
+		}
+		idxAdvisor, err := NewAdvisor(offline, *rEnv, *q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, idx := range idxAdvisor.IndexAdvise() {
+			if !idx.Covering {
+				got = append(got, idx.DDL)
+			}
+			// 降序列的排序方向记录在列信息中
+			if strings.Contains(idx.DDL, "` DESC") != hasDescColumn(idx.ColumnDetails) {
+				t.Errorf("%s index %s column direction mismatch", c.sql, idx.Name)
+			}
+		}
+		if strings.Join(got, "\n") != c.want {
+			t.Errorf("%s version %d want:\n%s\ngot:\n%s", c.sql, c.version, c.want, strings.Join(got, "\n"))
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestSatisfyOrderBy(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	rows := []database.TableIndexRow{
+		{KeyName: "idx_a_b_c", SeqInIndex: 1, ColumnName: "a", Collation: "A"},
+		{KeyName: "idx_a_b_c", SeqInIndex: 2, ColumnName: "b", Collation: "A"},
+		{KeyName: "idx_a_b_c", SeqInIndex: 3, ColumnName: "c", Collation: "A"},
+		{KeyName: "idx_a_b_desc", SeqInIndex: 1, ColumnName: "a", Collation: "A"},
+		{KeyName: "idx_a_b_desc", SeqInIndex: 2, ColumnName: "b", Collation: "D"},
+		{KeyName: "idx_a_b_desc", SeqInIndex: 3, ColumnName: "c", Collation: "A"},
+	}
+	eq := []*common.Column{{Name: "a"}}
+	part := func(name string, desc bool) ast.OrderByKeyPart {
+		return ast.OrderByKeyPart{Column: &common.Column{Name: name}, Desc: desc}
+	}
+
+	cases := []struct {
+		parts []ast.OrderByKeyPart
+		want  string
+	}{
+		{[]ast.OrderByKeyPart{part("b", true), part("c", true)}, "idx_a_b_c"},
+		{[]ast.OrderByKeyPart{part("b", true), part("c", false)}, "idx_a_b_desc"},
+		{[]ast.OrderByKeyPart{part("b", false), part("c", true)}, "idx_a_b_desc"},
+		{[]ast.OrderByKeyPart{part("c", false)}, ""},
+	}
+	for _, c := range cases {
+		if got := satisfyOrderBy(rows, eq, c.parts); got != c.want {
+			t.Errorf("%v want %s, got %s", c.parts, c.want, got)
+		}
+	}
+
+	advise := IndexInfo{
+		ColumnDetails: []*common.Column{{Name: "a"}, {Name: "b"}},
+		OrderBy:       "b DESC",
+		Validation: &IndexValidation{
+			Before: database.ExplainRow{Extra: "Using where; Using filesort"},
+			After:  database.ExplainRow{Extra: "Using where"},
+		},
+	}
+	if content := formatOrderByIndex(advise); !strings.HasSuffix(content, "不再出现Using filesort") {
+		t.Errorf("formatOrderByIndex got %s", content)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+// hasDescColumn 索引中是否含有降序列
+func hasDescColumn(cols []*common.Column) bool {
+	for _, col := range cols {
+		if col.Desc {
+			return true
+		}
+	}
+	return false
+}
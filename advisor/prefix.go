@@ -0,0 +1,125 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package advisor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/XiaoMi/soar/common"
+	"github.com/XiaoMi/soar/database"
+)
+
+// PrefixSelectivity 某一长度前缀的选择性
+type PrefixSelectivity struct {
+	Length      int     `json:"length"`      // 前缀长度（字符数）
+	Selectivity float64 `json:"selectivity"` // count(distinct left(col, length)) / count(*)
+}
+
+// PrefixAdvise 超长字符串列的前缀索引长度建议
+type PrefixAdvise struct {
+	Column      string              `json:"column"`      // 列名
+	Length      int                 `json:"length"`      // 建议的前缀长度
+	Selectivity float64             `json:"selectivity"` // 整列的选择性
+	Curve       []PrefixSelectivity `json:"curve"`       // 各长度前缀的选择性
+}
+
+// prefixCandidates 前缀索引长度的候选值
+var prefixCandidates = []int{4, 8, 12, 16, 20, 24, 32, 48, 64, 96, 128, 192, 255, 384, 512}
+
+// prefixLengths 获取不超过 maxLength 的候选前缀长度，maxLength 本身总是最后一个候选值
+func prefixLengths(maxLength int) []int {
+	var lengths []int
+	for _, n := range prefixCandidates {
+		if n >= maxLength {
+			break
+		}
+		lengths = append(lengths, n)
+	}
+	return append(lengths, maxLength)
+}
+
+// prefixAdvise 对测试环境中采样得到的数据计算各长度前缀的选择性，给出前缀索引长度建议
+// 未开启数据采样、列在采样时被 fake 以外的策略脱敏或无法计算时返回 nil，由调用方使用原有的处理方式
+func (idxAdv *IndexAdvisor) prefixAdvise(db string, col *common.Column, maxLength int) *PrefixAdvise {
+	if !common.Config.Sampling || idxAdv.vEnv.Offline() || maxLength <= 0 {
+		return nil
+	}
+
+	// 只有字符串类型的列才能使用前缀索引
+	switch strings.ToLower(common.GetDataTypeBase(col.DataType)) {
+	case "char", "varchar", "binary", "varbinary",
+		"tinytext", "text", "mediumtext", "longtext",
+		"tinyblob", "blob", "mediumblob", "longblob":
+	default:
+		return nil
+	}
+
+	// hash 按整个值计算摘要，null, truncate 丢失了原值，只有 fake 逐字符替换后前缀的选择性与原数据一致
+	if strategy := database.MaskedColumnStrategy(db, col.Table, col.Name); strategy != "" && strategy != "fake" {
+		common.Log.Warn("prefixAdvise %s.%s is masked by %s when sampling, prefix selectivity is unreliable", col.Table, col.Name, strategy)
+		return nil
+	}
+
+	tmpDB := *idxAdv.vEnv
+	tmpDB.Database = idxAdv.vEnv.DBHash(db)
+	lengths := prefixLengths(maxLength)
+	full, selectivity, err := tmpDB.PrefixSelectivity(col.Table, col.Name, lengths)
+	if err != nil {
+		common.Log.Warn("prefixAdvise %s.%s Error: %v", col.Table, col.Name, err)
+		return nil
+	}
+
+	advise := &PrefixAdvise{
+		Column:      col.Name,
+		Selectivity: full,
+	}
+	for i, n := range lengths {
+		advise.Curve = append(advise.Curve, PrefixSelectivity{Length: n, Selectivity: selectivity[i]})
+	}
+	advise.Length = choosePrefixLength(full, advise.Curve, common.Config.PrefixTolerance)
+	return advise
+}
+
+// choosePrefixLength 选择与整列选择性相差不超过 tolerance 比例的最短前缀，都不满足时使用最长的前缀
+func choosePrefixLength(full float64, curve []PrefixSelectivity, tolerance float64) int {
+	for _, c := range curve {
+		if c.Selectivity >= full*(1-tolerance) {
+			return c.Length
+		}
+	}
+	return curve[len(curve)-1].Length
+}
+
+// formatPrefixAdvise 以表格形式输出前缀长度与选择性的关系
+func formatPrefixAdvise(p PrefixAdvise) string {
+	buf := []string{
+		fmt.Sprintf("列%s超过单列索引长度限制，建议使用前缀索引%s(%d)，各前缀长度的选择性：", p.Column, p.Column, p.Length),
+		"",
+		"| 前缀长度 | 选择性 |",
+		"|---|---|",
+	}
+	for _, c := range p.Curve {
+		length := fmt.Sprint(c.Length)
+		if c.Length == p.Length {
+			length += " (建议)"
+		}
+		buf = append(buf, fmt.Sprintf("| %s | %.2f%% |", length, c.Selectivity*100))
+	}
+	buf = append(buf, fmt.Sprintf("| 整列 | %.2f%% |", p.Selectivity*100))
+	return strings.Join(buf, "\n")
+}
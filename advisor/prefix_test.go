@@ -0,0 +1,68 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package advisor
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+func TestPrefixLengths(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	cases := map[int]string{
+		191: "[4 8 12 16 20 24 32 48 64 96 128 191]",
+		16:  "[4 8 12 16]",
+		3:   "[3]",
+	}
+	for maxLength, want := range cases {
+		if got := fmt.Sprint(prefixLengths(maxLength)); got != want {
+			t.Errorf("prefixLengths(%d) want %s, got %s", maxLength, want, got)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestChoosePrefixLength(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	curve := []PrefixSelectivity{
+		{Length: 4, Selectivity: 0.2},
+		{Length: 8, Selectivity: 0.85},
+		{Length: 12, Selectivity: 0.995},
+		{Length: 191, Selectivity: 1},
+	}
+	if n := choosePrefixLength(1, curve, 0.01); n != 12 {
+		t.Errorf("tolerance 0.01 want 12, got %d", n)
+	}
+	if n := choosePrefixLength(1, curve, 0.2); n != 8 {
+		t.Errorf("tolerance 0.2 want 8, got %d", n)
+	}
+	// 最长的前缀也达不到要求时使用最长的前缀
+	if n := choosePrefixLength(1, curve[:2], 0); n != 8 {
+		t.Errorf("want longest prefix 8, got %d", n)
+	}
+
+	content := formatPrefixAdvise(PrefixAdvise{Column: "email", Length: 12, Selectivity: 1, Curve: curve})
+	if !strings.Contains(content, "建议使用前缀索引email(12)") ||
+		!strings.Contains(content, "| 12 (建议) | 99.50% |") ||
+		!strings.Contains(content, "| 整列 | 100.00% |") {
+		t.Errorf("formatPrefixAdvise got %s", content)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package advisor
+
+import (
+	"fmt"
+
+	"github.com/XiaoMi/soar/common"
+	"github.com/XiaoMi/soar/database"
+)
+
+// ProfilingAdvisor 基于 performance_schema 中的语句计数器给出建议，content 为 PRO.001 中展示的 Profiling 结果
+// PRO.002 使用了磁盘临时表，PRO.003 排序时发生了磁盘归并，PRO.004 扫描行数远大于返回行数，
+// PRO.005 锁等待时间过长，PRO.006 连接时被驱动表没有使用索引
+func ProfilingAdvisor(p *database.PSProfile, content string) map[string]Rule {
+	rules := map[string]Rule{
+		"PRO.001": {
+			Item:     "PRO.001",
+			Severity: "L0",
+			Content:  content,
+		},
+	}
+	if p == nil {
+		return rules
+	}
+	s := p.Statement
+
+	if s.CreatedTmpDiskTables > 0 && !IsIgnoreRule("PRO.002") {
+		rules["PRO.002"] = Rule{
+			Item:     "PRO.002",
+			Severity: "L2",
+			Summary:  "使用了磁盘临时表",
+			Content:  fmt.Sprintf("共创建了%d个临时表，其中%d个为磁盘临时表", s.CreatedTmpTables, s.CreatedTmpDiskTables),
+			Case:     "内存临时表超过tmp_table_size或max_heap_table_size，或包含BLOB、TEXT列时会转为磁盘临时表。建议为GROUP BY、DISTINCT、UNION涉及的列添加索引，避免查询不需要的大字段。",
+		}
+	}
+	if s.SortMergePasses > 0 && !IsIgnoreRule("PRO.003") {
+		rules["PRO.003"] = Rule{
+			Item:     "PRO.003",
+			Severity: "L2",
+			Summary:  "排序时发生了磁盘归并",
+			Content:  fmt.Sprintf("排序%d行，发生了%d次归并", s.SortRows, s.SortMergePasses),
+			Case:     "排序数据超过sort_buffer_size时需要借助磁盘文件做归并排序。建议通过索引消除排序，或减少参与排序的行数及列数。",
+		}
+	}
+
+	// 没有返回或影响任何行时按 1 行计算
+	returned := s.RowsSent + s.RowsAffected
+	if returned == 0 {
+		returned = 1
+	}
+	if common.Config.ProfilingMaxExamined > 0 && s.RowsExamined > 0 &&
+		float64(s.RowsExamined)/float64(returned) >= common.Config.ProfilingMaxExamined && !IsIgnoreRule("PRO.004") {
+		rules["PRO.004"] = Rule{
+			Item:     "PRO.004",
+			Severity: "L2",
+			Summary:  "扫描行数远大于返回行数",
+			Content:  fmt.Sprintf("扫描%d行，返回%d行，影响%d行", s.RowsExamined, s.RowsSent, s.RowsAffected),
+			Case:     "大部分被扫描的行都被过滤掉了，建议为过滤条件中区分度较高的列添加索引。",
+		}
+	}
+	if common.Config.ProfilingMaxLockTime > 0 && s.LockTime >= common.Config.ProfilingMaxLockTime && !IsIgnoreRule("PRO.005") {
+		rules["PRO.005"] = Rule{
+			Item:     "PRO.005",
+			Severity: "L2",
+			Summary:  "锁等待时间过长",
+			Content:  fmt.Sprintf("锁等待%.3fms，总耗时%.3fms", s.LockTime, s.Duration),
+			Case:     "测试环境中存在并发的事务持有相关的锁，或表级锁等待时间较长，线上执行时可能阻塞或被阻塞。",
+		}
+	}
+	if s.SelectFullJoin > 0 && !IsIgnoreRule("PRO.006") {
+		rules["PRO.006"] = Rule{
+			Item:     "PRO.006",
+			Severity: "L3",
+			Summary:  "连接时被驱动表没有使用索引",
+			Content:  fmt.Sprintf("Select_full_join: %d", s.SelectFullJoin),
+			Case:     "被驱动表每次都需要全表扫描，建议为连接条件中被驱动表的列添加索引。",
+		}
+	}
+	return rules
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package advisor
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+	"github.com/XiaoMi/soar/database"
+)
+
+func TestProfilingAdvisor(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	p := &database.PSProfile{
+		Statement: database.PSStatement{
+			Duration:             250.5,
+			LockTime:             120,
+			RowsExamined:         100000,
+			RowsSent:             10,
+			CreatedTmpTables:     1,
+			CreatedTmpDiskTables: 1,
+			SortMergePasses:      3,
+			SortRows:             100000,
+			SelectFullJoin:       1,
+		},
+	}
+	rules := ProfilingAdvisor(p, "content")
+	for _, item := range []string{"PRO.001", "PRO.002", "PRO.003", "PRO.004", "PRO.005", "PRO.006"} {
+		if _, ok := rules[item]; !ok {
+			t.Errorf("%s not found", item)
+		}
+	}
+	if rules["PRO.001"].Content != "content" {
+		t.Errorf("PRO.001 got %+v", rules["PRO.001"])
+	}
+	if rules["PRO.004"].Content != "扫描100000行，返回10行，影响0行" {
+		t.Errorf("PRO.004 got %+v", rules["PRO.004"])
+	}
+
+	p.Statement = database.PSStatement{RowsExamined: 10, RowsSent: 10, LockTime: 0.01}
+	if rules = ProfilingAdvisor(p, "content"); len(rules) != 1 {
+		t.Errorf("want only PRO.001, got %+v", rules)
+	}
+
+	// SHOW PROFILE 没有语句计数器
+	if rules = ProfilingAdvisor(nil, "content"); len(rules) != 1 {
+		t.Errorf("want only PRO.001, got %+v", rules)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package advisor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// registeredRules 通过 RegisterRule 注册的规则，InitHeuristicRules 重建规则列表时会重新合并到 HeuristicRules 中
+var registeredRules = make(map[string]Rule)
+
+// registeredConflicts 通过 RegisterConflict 注册的冲突关系，key 中的规则命中时删除 value 中的规则
+var registeredConflicts = make(map[string][]string)
+
+// reservedItemPrefix 由 explain, index, profiling, trace 等模块使用的规则前缀，注册规则时不可使用
+var reservedItemPrefix = []string{"OK", "ERR", "EXP", "IDX", "PRO", "TRA"}
+
+var (
+	ruleItemRegex     = regexp.MustCompile(`^[A-Z]{3}\.[0-9]{3}$`)
+	ruleSeverityRegex = regexp.MustCompile(`^L[0-8]$`)
+)
+
+// RegisterRule 注册启发式规则，供以库的形式引用 advisor 时扩展评审规则
+// Func 为只依赖 SQL 的规则，IndexFunc 为依赖数据字典的规则，两者至少需要指定一个
+// TiFunc 可选，Vitess 解析失败时代替 Func 基于 TiDB AST 评审
+// 注册后的规则与内置规则一样参与 ignore-rules 过滤、冲突合并及格式化输出
+// 注意：RegisterRule 不是并发安全的，需要在开始评审前（如 init 函数中）完成注册
+func RegisterRule(rule Rule) error {
+	if !ruleItemRegex.MatchString(rule.Item) {
+		return fmt.Errorf("RegisterRule: item '%s' should match %s", rule.Item, ruleItemRegex.String())
+	}
+	for _, prefix := range reservedItemPrefix {
+		if strings.HasPrefix(rule.Item, prefix) {
+			return fmt.Errorf("RegisterRule: item prefix '%s' is reserved", prefix)
+		}
+	}
+	if _, ok := HeuristicRules[rule.Item]; ok {
+		return fmt.Errorf("RegisterRule: item '%s' already exists", rule.Item)
+	}
+	if !ruleSeverityRegex.MatchString(rule.Severity) {
+		return fmt.Errorf("RegisterRule: item '%s' severity '%s' should be L[0-8]", rule.Item, rule.Severity)
+	}
+	if rule.Func == nil && rule.IndexFunc == nil {
+		return fmt.Errorf("RegisterRule: item '%s' both Func and IndexFunc are nil", rule.Item)
+	}
+	if rule.Fix != "" && !isFixRule(rule.Fix) {
+		return fmt.Errorf("RegisterRule: item '%s' fix '%s' is not a rewrite rule", rule.Item, rule.Fix)
+	}
+	if rule.Category == "" {
+		rule.Category = strings.Split(rule.Item, ".")[0]
+	}
+
+	// 规则函数返回的结果中未填写的字段使用注册时的元信息补全
+	meta := rule
+	if rule.Func == nil {
+		rule.Func = (*Query4Audit).RuleOK
+	} else {
+		f := rule.Func
+		rule.Func = func(q *Query4Audit) Rule {
+			return meta.complete(f(q))
+		}
+	}
+	if rule.TiFunc != nil {
+		f := rule.TiFunc
+		rule.TiFunc = func(q *Query4Audit) Rule {
+			return meta.complete(f(q))
+		}
+	}
+	if rule.IndexFunc != nil {
+		f := rule.IndexFunc
+		rule.IndexFunc = func(idxAdv *IndexAdvisor) Rule {
+			return meta.complete(f(idxAdv))
+		}
+	}
+
+	registeredRules[rule.Item] = rule
+	HeuristicRules[rule.Item] = rule
+	return nil
+}
+
+// UnregisterRule 删除通过 RegisterRule 注册的规则，同时从所有冲突关系中移除该规则，内置规则不可删除
+func UnregisterRule(item string) {
+	if _, ok := registeredRules[item]; !ok {
+		return
+	}
+	delete(registeredRules, item)
+	delete(HeuristicRules, item)
+	delete(registeredConflicts, item)
+	for k, overrides := range registeredConflicts {
+		var kept []string
+		for _, o := range overrides {
+			if o != item {
+				kept = append(kept, o)
+			}
+		}
+		if len(kept) == 0 {
+			delete(registeredConflicts, k)
+		} else {
+			registeredConflicts[k] = kept
+		}
+	}
+}
+
+// RegisterConflict 注册规则间的冲突关系，当 item 命中时 MergeConflictHeuristicRules 会删除 overrides 中的规则
+// item 和 overrides 既可以是内置规则也可以是注册的规则
+func RegisterConflict(item string, overrides ...string) {
+	for _, o := range overrides {
+		if o == item {
+			continue
+		}
+		registeredConflicts[item] = append(registeredConflicts[item], o)
+	}
+}
+
+// RegisteredRules 返回所有通过 RegisterRule 注册的规则
+func RegisteredRules() map[string]Rule {
+	rules := make(map[string]Rule)
+	for item, rule := range registeredRules {
+		rules[item] = rule
+	}
+	return rules
+}
+
+// complete 用注册时的规则元信息补全规则函数返回的建议
+func (r Rule) complete(res Rule) Rule {
+	if res.Item != r.Item {
+		return res
+	}
+	if res.Severity == "" {
+		res.Severity = r.Severity
+	}
+	if res.Summary == "" {
+		res.Summary = r.Summary
+	}
+	if res.Content == "" {
+		res.Content = r.Content
+	}
+	if res.Case == "" {
+		res.Case = r.Case
+	}
+	if res.Category == "" {
+		res.Category = r.Category
+	}
+	if res.URL == "" {
+		res.URL = r.URL
+	}
+	if res.Fix == "" {
+		res.Fix = r.Fix
+	}
+	return res
+}
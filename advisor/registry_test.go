@@ -0,0 +1,195 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package advisor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+func TestRegisterRule(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	orgIgnoreRules := common.Config.IgnoreRules
+	common.Config.IgnoreRules = []string{}
+	defer func() { common.Config.IgnoreRules = orgIgnoreRules }()
+
+	rule := Rule{
+		Item:     "CUS.001",
+		Severity: "L3",
+		Summary:  "custom rule",
+		Content:  "custom rule content",
+		URL:      "https://example.com/CUS.001",
+		Func: func(q *Query4Audit) Rule {
+			if strings.Contains(q.Query, "custom") {
+				return Rule{Item: "CUS.001"}
+			}
+			return HeuristicRules["OK"]
+		},
+	}
+	if err := RegisterRule(rule); err != nil {
+		t.Fatal(err)
+	}
+	defer UnregisterRule("CUS.001")
+
+	// 重复注册、非法参数
+	for _, r := range []Rule{
+		rule,
+		{Item: "ALI.001", Severity: "L1", Func: rule.Func},
+		{Item: "IDX.999", Severity: "L1", Func: rule.Func},
+		{Item: "custom", Severity: "L1", Func: rule.Func},
+		{Item: "CUS.002", Severity: "L9", Func: rule.Func},
+		{Item: "CUS.003", Severity: "L1"},
+	} {
+		if err := RegisterRule(r); err == nil {
+			t.Errorf("RegisterRule %s should return error", r.Item)
+		}
+	}
+
+	// 重新初始化规则列表后注册的规则依然存在
+	InitHeuristicRules()
+	if _, ok := HeuristicRules["CUS.001"]; !ok {
+		t.Error("CUS.001 lost after InitHeuristicRules")
+	}
+
+	q, err := NewQuery4Audit("select custom from tbl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sug := q.HeuristicCheck()
+	r, ok := sug["CUS.001"]
+	if !ok {
+		t.Fatal("CUS.001 should be hit")
+	}
+	if r.Severity != "L3" || r.Category != "CUS" || r.URL != rule.URL {
+		t.Errorf("CUS.001 metadata not completed: %v", r)
+	}
+
+	// ignore-rules 过滤
+	common.Config.IgnoreRules = []string{"CUS.*"}
+	if _, ok := q.HeuristicCheck()["CUS.001"]; ok {
+		t.Error("CUS.001 should be ignored")
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestRegisterRuleIndexFunc(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	orgOnlineDSNDisable := common.Config.OnlineDSN.Disable
+	common.Config.OnlineDSN.Disable = false
+	defer func() { common.Config.OnlineDSN.Disable = orgOnlineDSNDisable }()
+
+	err := RegisterRule(Rule{
+		Item:     "CUS.010",
+		Severity: "L2",
+		Summary:  "custom index rule",
+		IndexFunc: func(idxAdv *IndexAdvisor) Rule {
+			return Rule{Item: "CUS.010"}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer UnregisterRule("CUS.010")
+
+	q, err := NewQuery4Audit("select 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// IndexFunc 规则不参与 Query4Audit.HeuristicCheck
+	if _, ok := q.HeuristicCheck()["CUS.010"]; ok {
+		t.Error("CUS.010 should not be checked without IndexAdvisor")
+	}
+
+	idxAdv := &IndexAdvisor{Ast: q.Stmt}
+	r, ok := idxAdv.HeuristicCheck(*q)["CUS.010"]
+	if !ok {
+		t.Fatal("CUS.010 should be hit")
+	}
+	if r.Summary != "custom index rule" || r.Severity != "L2" {
+		t.Errorf("CUS.010 metadata not completed: %v", r)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestRegisterConflict(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	err := RegisterRule(Rule{
+		Item:     "CUS.020",
+		Severity: "L2",
+		Func:     (*Query4Audit).RuleOK,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer UnregisterRule("CUS.020")
+	RegisterConflict("CUS.020", "COL.001", "CUS.020")
+
+	rules := MergeConflictHeuristicRules(map[string]Rule{
+		"CUS.020": {Item: "CUS.020"},
+		"COL.001": {Item: "COL.001"},
+		"ALI.001": {Item: "ALI.001"},
+	})
+	if _, ok := rules["COL.001"]; ok {
+		t.Error("COL.001 should be merged by CUS.020")
+	}
+	if _, ok := rules["CUS.020"]; !ok {
+		t.Error("CUS.020 should not be merged by itself")
+	}
+	if _, ok := rules["ALI.001"]; !ok {
+		t.Error("ALI.001 should not be merged")
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestUnregisterRuleConflict(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	err := RegisterRule(Rule{
+		Item:     "CUS.030",
+		Severity: "L2",
+		Func:     (*Query4Audit).RuleOK,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterConflict("COL.001", "CUS.030")
+	UnregisterRule("CUS.030")
+
+	// 重新注册同名规则时不应继承已删除规则的冲突关系
+	err = RegisterRule(Rule{
+		Item:     "CUS.030",
+		Severity: "L2",
+		Func:     (*Query4Audit).RuleOK,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer UnregisterRule("CUS.030")
+
+	rules := MergeConflictHeuristicRules(map[string]Rule{
+		"CUS.030": {Item: "CUS.030"},
+		"COL.001": {Item: "COL.001"},
+	})
+	if _, ok := rules["CUS.030"]; !ok {
+		t.Error("CUS.030 should not be merged by stale COL.001 conflict")
+	}
+	if _, ok := registeredConflicts["COL.001"]; ok {
+		t.Errorf("stale conflict left: %v", registeredConflicts["COL.001"])
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
@@ -0,0 +1,207 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package advisor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/XiaoMi/soar/ast"
+	"github.com/XiaoMi/soar/database"
+)
+
+// PlanStep 执行计划签名中的一步，即按连接顺序访问的一张表
+type PlanStep struct {
+	Table      string
+	AccessType string
+	Key        string
+	Rows       int64 // 估算扫描行数，不参与签名比较
+}
+
+// String 签名中的表示形式，如 a(REF:idx_fk_city_id)
+func (step PlanStep) String() string {
+	if step.Key == "" {
+		return fmt.Sprintf("%s(%s)", step.Table, step.AccessType)
+	}
+	return fmt.Sprintf("%s(%s:%s)", step.Table, step.AccessType, step.Key)
+}
+
+// PlanSignature 归一化后的执行计划，由连接顺序、每张表的访问方式及使用的索引组成
+type PlanSignature struct {
+	Steps []PlanStep
+	Cost  float64 // 查询代价，JSON 格式取 query_cost，传统格式取 last_query_cost，未知时为 0
+}
+
+// NewPlanSignature 从 EXPLAIN 结果中提取执行计划签名
+func NewPlanSignature(exp *database.ExplainInfo) PlanSignature {
+	var sig PlanSignature
+	if exp == nil {
+		return sig
+	}
+	rows := exp.ExplainRows
+	sig.Cost = exp.QueryCost
+	if exp.ExplainFormat == database.JSONFormatExplain && exp.ExplainJSON != nil {
+		rows = database.ConvertExplainJSON2Row(exp.ExplainJSON)
+		if cost := database.ParseJSONCost(exp.ExplainJSON.QueryBlock.CostInfo.QueryCost); cost > 0 {
+			sig.Cost = cost
+		}
+	}
+	for _, row := range rows {
+		key := row.Key
+		if strings.EqualFold(key, "NULL") {
+			key = ""
+		}
+		sig.Steps = append(sig.Steps, PlanStep{
+			Table:      strings.ToLower(row.TableName),
+			AccessType: strings.ToUpper(row.AccessType),
+			Key:        strings.ToLower(key),
+			Rows:       row.Rows,
+		})
+	}
+	return sig
+}
+
+// String 签名的文本形式，如 c(ALL) -> a(REF:idx_fk_city_id)
+func (sig PlanSignature) String() string {
+	var steps []string
+	for _, step := range sig.Steps {
+		steps = append(steps, step.String())
+	}
+	return strings.Join(steps, " -> ")
+}
+
+// Equal 连接顺序、访问方式及索引均相同时认为执行计划未发生变化
+func (sig PlanSignature) Equal(other PlanSignature) bool {
+	return sig.String() == other.String()
+}
+
+// Rows 各表估算扫描行数之和
+func (sig PlanSignature) Rows() int64 {
+	var rows int64
+	for _, step := range sig.Steps {
+		rows += step.Rows
+	}
+	return rows
+}
+
+// PlanRegression 在两个环境中执行计划不一致或执行 EXPLAIN 失败的 SQL
+type PlanRegression struct {
+	ID        string
+	SQL       string
+	Base      PlanSignature
+	Target    PlanSignature
+	BaseErr   error
+	TargetErr error
+}
+
+// PlanRegressionChecker 对比同一批 SQL 在两个环境中的执行计划，用于 MySQL 升级前的回归检查
+type PlanRegressionChecker struct {
+	BaseName    string // 基准环境，如 OnlineDSN
+	TargetName  string // 对比环境，如升级后的 TestDSN
+	Checked     int
+	Regressions []PlanRegression
+}
+
+// NewPlanRegressionChecker 构造 PlanRegressionChecker
+func NewPlanRegressionChecker(baseName, targetName string) *PlanRegressionChecker {
+	return &PlanRegressionChecker{
+		BaseName:   baseName,
+		TargetName: targetName,
+	}
+}
+
+// Compare 对比一条 SQL 在两个环境中的 EXPLAIN 结果，执行计划变化时返回 true
+func (c *PlanRegressionChecker) Compare(id, sql string, base, target *database.ExplainInfo, baseErr, targetErr error) bool {
+	c.Checked++
+	r := PlanRegression{
+		ID:        id,
+		SQL:       sql,
+		Base:      NewPlanSignature(base),
+		Target:    NewPlanSignature(target),
+		BaseErr:   baseErr,
+		TargetErr: targetErr,
+	}
+	if baseErr == nil && targetErr == nil && r.Base.Equal(r.Target) {
+		return false
+	}
+	c.Regressions = append(c.Regressions, r)
+	return true
+}
+
+// Format 以 markdown 格式输出执行计划发生变化的 SQL，并给出左右对比及估算行数、代价的变化
+func (c *PlanRegressionChecker) Format() string {
+	var buf []string
+	buf = append(buf, "# 执行计划回归检查\n")
+	var failed int
+	for _, r := range c.Regressions {
+		if r.BaseErr != nil || r.TargetErr != nil {
+			failed++
+		}
+	}
+	buf = append(buf, fmt.Sprintf("共检查 %d 条 SQL，%d 条执行计划发生变化，%d 条执行 EXPLAIN 失败。\n",
+		c.Checked, len(c.Regressions)-failed, failed))
+
+	for _, r := range c.Regressions {
+		buf = append(buf, fmt.Sprintf("## Query: %s\n", r.ID))
+		buf = append(buf, fmt.Sprintf("```sql\n%s\n```\n", ast.Compress(r.SQL)))
+		if r.BaseErr != nil {
+			buf = append(buf, fmt.Sprintf("* %s EXPLAIN 失败: %s", c.BaseName, r.BaseErr.Error()))
+		}
+		if r.TargetErr != nil {
+			buf = append(buf, fmt.Sprintf("* %s EXPLAIN 失败: %s", c.TargetName, r.TargetErr.Error()))
+		}
+		if r.BaseErr != nil || r.TargetErr != nil {
+			buf = append(buf, "")
+			continue
+		}
+
+		buf = append(buf, fmt.Sprintf("| # | %s | %s | |", c.BaseName, c.TargetName))
+		buf = append(buf, "|---|---|---|---|")
+		for i := 0; i < len(r.Base.Steps) || i < len(r.Target.Steps); i++ {
+			var base, target, mark string
+			if i < len(r.Base.Steps) {
+				base = fmt.Sprintf("%s rows=%d", r.Base.Steps[i].String(), r.Base.Steps[i].Rows)
+			}
+			if i < len(r.Target.Steps) {
+				target = fmt.Sprintf("%s rows=%d", r.Target.Steps[i].String(), r.Target.Steps[i].Rows)
+			}
+			if i >= len(r.Base.Steps) || i >= len(r.Target.Steps) || r.Base.Steps[i].String() != r.Target.Steps[i].String() {
+				mark = "≠"
+			}
+			buf = append(buf, fmt.Sprintf("| %d | %s | %s | %s |", i+1, base, target, mark))
+		}
+		buf = append(buf, "")
+		buf = append(buf, "* 估算扫描行数: "+formatPlanChange(float64(r.Base.Rows()), float64(r.Target.Rows())))
+		if r.Base.Cost > 0 || r.Target.Cost > 0 {
+			buf = append(buf, "* 查询代价: "+formatPlanChange(r.Base.Cost, r.Target.Cost))
+		}
+		buf = append(buf, "")
+	}
+	return strings.Join(buf, "\n")
+}
+
+// formatPlanChange 输出变化前后的值及变化比例
+func formatPlanChange(before, after float64) string {
+	change := fmt.Sprintf("%s → %s", formatExplainNumber(before), formatExplainNumber(after))
+	if before > 0 {
+		change += fmt.Sprintf(" (%+.1f%%)", (after-before)/before*100)
+	}
+	if after > before && before > 0 && after/before >= 2 {
+		change = "☠️ " + change
+	}
+	return change
+}
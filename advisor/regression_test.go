@@ -0,0 +1,76 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package advisor
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+	"github.com/XiaoMi/soar/database"
+)
+
+func TestPlanRegressionChecker(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	parse := func(text string) *database.ExplainInfo {
+		exp, err := database.ParseExplainText(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return exp
+	}
+	before := parse(`{"query_block": {"select_id": 1, "cost_info": {"query_cost": "200.00"}, "nested_loop": [
+  {"table": {"table_name": "c", "access_type": "ALL", "rows_examined_per_scan": 600}},
+  {"table": {"table_name": "a", "access_type": "ref", "key": "idx_fk_city_id", "rows_examined_per_scan": 1}}]}}`)
+	after := parse(`{"query_block": {"select_id": 1, "cost_info": {"query_cost": "650.00"}, "nested_loop": [
+  {"table": {"table_name": "a", "access_type": "ALL", "rows_examined_per_scan": 603}},
+  {"table": {"table_name": "c", "access_type": "eq_ref", "key": "PRIMARY", "rows_examined_per_scan": 1}}]}}`)
+	same := parse(`{"query_block": {"select_id": 1, "cost_info": {"query_cost": "210.00"}, "nested_loop": [
+  {"table": {"table_name": "c", "access_type": "ALL", "rows_examined_per_scan": 620}},
+  {"table": {"table_name": "a", "access_type": "ref", "key": "idx_fk_city_id", "rows_examined_per_scan": 1}}]}}`)
+
+	if sig := NewPlanSignature(before).String(); sig != "c(ALL) -> a(REF:idx_fk_city_id)" {
+		t.Errorf("signature got %s", sig)
+	}
+
+	checker := NewPlanRegressionChecker("5.7", "8.0")
+	sql := "select * from address a join city c using (city_id)"
+	if checker.Compare("A", sql, before, same, nil, nil) {
+		t.Error("estimated rows change should not be regression")
+	}
+	if !checker.Compare("B", sql, before, after, nil, nil) {
+		t.Error("join order change should be regression")
+	}
+	checker.Compare("C", "select * from t", before, nil, nil, errors.New("Table 't' doesn't exist"))
+
+	report := checker.Format()
+	for _, want := range []string{
+		"共检查 3 条 SQL，1 条执行计划发生变化，1 条执行 EXPLAIN 失败。",
+		"| # | 5.7 | 8.0 | |",
+		"| 1 | c(ALL) rows=600 | a(ALL) rows=603 | ≠ |",
+		"| 2 | a(REF:idx_fk_city_id) rows=1 | c(EQ_REF:primary) rows=1 | ≠ |",
+		"* 估算扫描行数: 601 → 604 (+0.5%)",
+		"* 查询代价: ☠️ 200 → 650 (+225.0%)",
+		"* 8.0 EXPLAIN 失败: Table 't' doesn't exist",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report should contain %s, got:\n%s", want, report)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
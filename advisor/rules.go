@@ -35,9 +35,10 @@ import (
 
 // Query4Audit 待评审的SQL结构体，由原SQL和其对应的抽象语法树组成
 type Query4Audit struct {
-	Query  string              // 查询语句
-	Stmt   sqlparser.Statement // 通过Vitess解析出的抽象语法树
-	TiStmt []tidb.StmtNode     // 通过TiDB解析出的抽象语法树
+	Query   string              // 查询语句
+	Stmt    sqlparser.Statement // 通过Vitess解析出的抽象语法树
+	TiStmt  []tidb.StmtNode     // 通过TiDB解析出的抽象语法树
+	StmtErr error               // Vitess 解析错误，此时 Stmt 为空，启发式规则改用 TiStmt 评审
 }
 
 // NewQuery4Audit return a struct for Query4Audit
@@ -59,6 +60,7 @@ func NewQuery4Audit(sql string, options ...string) (*Query4Audit, error) {
 	q.Stmt, vErr = sqlparser.Parse(sql)
 	if vErr != nil {
 		common.Log.Warn("NewQuery4Audit vitess parse Error: %s, Query: %s", vErr.Error(), sql)
+		q.StmtErr = vErr
 	}
 
 	// TODO: charset, collation
@@ -67,15 +69,52 @@ func NewQuery4Audit(sql string, options ...string) (*Query4Audit, error) {
 	return q, err
 }
 
+// HeuristicCheck 对 SQL 逐条执行 HeuristicRules 中不依赖数据字典的启发式规则
+// Vitess 解析失败时规则改用 TiDB AST 评审，仍无法评审的规则通过 ERR.004 列出
+func (q *Query4Audit) HeuristicCheck() map[string]Rule {
+	heuristicSuggest := make(map[string]Rule)
+	var unevaluated []string
+	for item, rule := range HeuristicRules {
+		// 去除忽略的建议检查
+		if IsIgnoreRule(item) || rule.Func == nil {
+			continue
+		}
+		f := rule.Func
+		if q.StmtErr != nil && q.TiStmt != nil {
+			switch {
+			case rule.TiFunc != nil:
+				f = rule.TiFunc
+			case !rule.TiSafe:
+				unevaluated = append(unevaluated, item)
+				continue
+			}
+		}
+		r := f(q)
+		if r.Item == item {
+			heuristicSuggest[item] = r
+		}
+	}
+	if len(unevaluated) > 0 && !IsIgnoreRule("ERR.004") {
+		heuristicSuggest["ERR.004"] = RuleUnevaluated(q.StmtErr, unevaluated)
+	}
+	return heuristicSuggest
+}
+
 // Rule 评审规则元数据结构
 type Rule struct {
-	Item     string                  `json:"Item"`     // 规则代号
-	Severity string                  `json:"Severity"` // 危险等级：L[0-8], 数字越大表示级别越高
-	Summary  string                  `json:"Summary"`  // 规则摘要
-	Content  string                  `json:"Content"`  // 规则解释
-	Case     string                  `json:"Case"`     // SQL示例
-	Position int                     `json:"Position"` // 建议所处SQL字符位置，默认0表示全局建议
-	Func     func(*Query4Audit) Rule `json:"-"`        // 函数名
+	Item      string                   `json:"Item"`               // 规则代号
+	Severity  string                   `json:"Severity"`           // 危险等级：L[0-8], 数字越大表示级别越高
+	Summary   string                   `json:"Summary"`            // 规则摘要
+	Content   string                   `json:"Content"`            // 规则解释
+	Case      string                   `json:"Case"`               // SQL示例
+	Position  int                      `json:"Position"`           // 建议所处SQL字符位置，默认0表示全局建议
+	Category  string                   `json:"Category,omitempty"` // 规则分类，注册规则时未指定则取 Item 前缀
+	URL       string                   `json:"URL,omitempty"`      // 规则说明文档地址
+	Fix       string                   `json:"Fix,omitempty"`      // 可自动修复该建议的 ast.RewriteRules 规则名称，供 -report-type fix 使用
+	Func      func(*Query4Audit) Rule  `json:"-"`                  // 函数名
+	TiFunc    func(*Query4Audit) Rule  `json:"-"`                  // Vitess 解析失败时基于 TiDB AST 的规则函数
+	TiSafe    bool                     `json:"-"`                  // Func 不依赖 Vitess AST，Vitess 解析失败时仍调用 Func，TiFunc 为空且未标记时跳过该规则并通过 ERR.004 列出
+	IndexFunc func(*IndexAdvisor) Rule `json:"-"`                  // 依赖数据字典的规则函数，由 IndexAdvisor.HeuristicCheck 调用
 }
 
 /*
@@ -88,7 +127,7 @@ type Rule struct {
 * CLA   Classic
 * COL   Column
 * DIS   Distinct
-* ERR   Error, 特指MySQL执行返回的报错信息, ERR.000为vitess语法错误，ERR.001为执行错误，ERR.002为EXPLAIN错误
+* ERR   Error, 特指MySQL执行返回的报错信息, ERR.000为vitess语法错误，ERR.001为执行错误，ERR.002为EXPLAIN错误，ERR.004为vitess解析失败导致未评审的规则
 * EXP   Explain, 由explain模块给
 * FUN   Function
 * IDX   Index, 由index模块给
@@ -132,6 +171,7 @@ func InitHeuristicRules() {
 			Content:  `In column or table aliases (such as "tbl AS alias"), explicit use of the AS keyword is easier to understand than implicit aliases (such as "tbl alias"). `,
 			Case:     "select name from tbl t1 where id <1000",
 			Func:     (*Query4Audit).RuleImplicitAlias,
+			TiSafe:   true,
 		},
 		"ALI.002": {
 			Item:     "ALI.002",
@@ -140,6 +180,7 @@ func InitHeuristicRules() {
 			Content:  `Example: "SELECT tbl.* col1, col2" The above SQL sets aliases for the column wildcards. Such SQL may have logic errors. You might be looking for col1, but instead of it, the last column of tbl is renamed. `,
 			Case:     "select tbl.* as c1,c2,c3 from tbl where id <1000",
 			Func:     (*Query4Audit).RuleStarAlias,
+			TiSafe:   true,
 		},
 		"ALI.003": {
 			Item:     "ALI.003",
@@ -156,6 +197,7 @@ func InitHeuristicRules() {
 			Content:  `Many beginners will mistake ALTER TABLE tbl_name [DEFAULT] CHARACTER SET'UTF8' to modify the character set of all fields, but in fact it will only affect the subsequent newly added fields and will not change the characters of the existing fields in the table set. If you want to modify the character set of all fields in the entire table, it is recommended to use ALTER TABLE tbl_name CONVERT TO CHARACTER SET charset_name;`,
 			Case:     "ALTER TABLE tbl_name CONVERT TO CHARACTER SET charset_name;",
 			Func:     (*Query4Audit).RuleAlterCharset,
+			TiSafe:   true,
 		},
 		"ALT.002": {
 			Item:     "ALT.002",
@@ -164,6 +206,7 @@ func InitHeuristicRules() {
 			Content:  `Each table structure change will have an impact on online services, even if it is possible to adjust through online tools, please try to reduce the number of operations by merging ALTER requests. `,
 			Case:     "ALTER TABLE tbl ADD COLUMN col int, ADD INDEX idx_col (`col`);",
 			Func:     (*Query4Audit).RuleOK, // This suggestion is given in indexAdvisor
+			TiSafe:   true,
 		},
 		"ALT.003": {
 			Item:     "ALT.003",
@@ -172,6 +215,7 @@ func InitHeuristicRules() {
 			Content:  `If the business logic dependency is not completely eliminated, after the column is deleted, the data may not be written or the deleted column data cannot be queried, which may cause the program to be abnormal. In this case, even if the backup data is rolled back, the data requested by the user will be lost. `,
 			Case:     "ALTER TABLE tbl DROP COLUMN col;",
 			Func:     (*Query4Audit).RuleAlterDropColumn,
+			TiSafe:   true,
 		},
 		"ALT.004": {
 			Item:     "ALT.004",
@@ -180,6 +224,7 @@ func InitHeuristicRules() {
 			Content:  `Primary key and foreign key are two important constraints in relational databases. Deleting existing constraints will break the existing business logic. Before operating, please confirm the impact with the DBA and think twice. `,
 			Case:     "ALTER TABLE tbl DROP PRIMARY KEY;",
 			Func:     (*Query4Audit).RuleAlterDropKey,
+			TiSafe:   true,
 		},
 		"ARG.001": {
 			Item:     "ARG.001",
@@ -188,6 +233,7 @@ func InitHeuristicRules() {
 			Content:  `For example, "%foo", if the query parameter has a wildcard in the preceding term, the existing index cannot be used. `,
 			Case:     "select c1,c2,c3 from tbl where name like'%foo'",
 			Func:     (*Query4Audit).RulePrefixLike,
+			TiFunc:   (*Query4Audit).TiRulePrefixLike,
 		},
 		"ARG.002": {
 			Item:     "ARG.002",
@@ -196,14 +242,17 @@ func InitHeuristicRules() {
 			Content:  `LIKE query that does not contain wildcards may have a logic error, because it is logically the same as an equivalent query. `,
 			Case:     "select c1,c2,c3 from tbl where name like'foo'",
 			Func:     (*Query4Audit).RuleEqualLike,
+			TiFunc:   (*Query4Audit).TiRuleEqualLike,
 		},
 		"ARG.003": {
-			Item:     "ARG.003",
-			Severity: "L4",
-			Summary:  "The parameter comparison contains implicit conversion, and the index cannot be used",
-			Content:  "Implicit type conversion has the risk of not hitting the index. In the case of high concurrency and large data volume, the consequences of not hitting the index are very serious.",
-			Case:     "SELECT * FROM sakila.film WHERE length >= '60';",
-			Func:     (*Query4Audit).RuleOK, // The suggestion is given in IndexAdvisor, RuleImplicitConversion
+			Item:      "ARG.003",
+			Severity:  "L4",
+			Summary:   "The parameter comparison contains implicit conversion, and the index cannot be used",
+			Content:   "Implicit type conversion has the risk of not hitting the index. In the case of high concurrency and large data volume, the consequences of not hitting the index are very serious.",
+			Case:      "SELECT * FROM sakila.film WHERE length >= '60';",
+			Func:      (*Query4Audit).RuleOK, // The suggestion is given in IndexAdvisor, RuleImplicitConversion
+			TiSafe:    true,
+			IndexFunc: (*IndexAdvisor).RuleImplicitConversion,
 		},
 		"ARG.004": {
 			Item:     "ARG.004",
@@ -211,6 +260,7 @@ func InitHeuristicRules() {
 			Summary:  "IN (NULL)/NOT IN (NULL) is never true",
 			Content:  "The correct way is col IN ('val1','val2','val3') OR col IS NULL",
 			Case:     "SELECT * FROM tb WHERE col IN (NULL);",
+			Fix:      "innull",
 			Func:     (*Query4Audit).RuleIn,
 		},
 		"ARG.005": {
@@ -228,6 +278,7 @@ func InitHeuristicRules() {
 			Content:  `Using IS NULL or IS NOT NULL may cause the engine to give up using the index and perform a full table scan, such as: select id from t where num is null; you can set a default value of 0 on num to ensure that the num column in the table is not NULL Value, and then query like this: select id from t where num=0;`,
 			Case:     "select id from t where num is null",
 			Func:     (*Query4Audit).RuleIsNullIsNotNull,
+			TiFunc:   (*Query4Audit).TiRuleIsNullIsNotNull,
 		},
 		"ARG.007": {
 			Item:     "ARG.007",
@@ -252,6 +303,7 @@ func InitHeuristicRules() {
 			Content:  `If there are spaces before and after the VARCHAR column, it may cause logic problems. For example, in MySQL 5.5,'a' and'a' may be considered the same value in the query. `,
 			Case:     "SELECT'abc'",
 			Func:     (*Query4Audit).RuleSpaceWithQuote,
+			TiSafe:   true,
 		},
 		"ARG.010": {
 			Item:     "ARG.010",
@@ -284,6 +336,7 @@ func InitHeuristicRules() {
 			Content:  "Chinese full-width quotation marks \"\" or ‘’ are used in the DDL statement. This may be a writing error. Please confirm whether it meets expectations.",
 			Case:     "CREATE TABLE tb (a varchar(10) default'“”'",
 			Func:     (*Query4Audit).RuleFullWidthQuote,
+			TiSafe:   true,
 		},
 		"ARG.014": {
 			Item:     "ARG.014",
@@ -300,6 +353,7 @@ func InitHeuristicRules() {
 			Content:  `The SELECT statement has no WHERE clause, and may check more rows than expected (full table scan). If precision is not required for SELECT COUNT(*) type requests, it is recommended to use SHOW TABLE STATUS or EXPLAIN instead. `,
 			Case:     "select id from tbl",
 			Func:     (*Query4Audit).RuleNoWhere,
+			TiFunc:   (*Query4Audit).TiRuleNoWhere,
 		},
 		"CLA.002": {
 			Item:     "CLA.002",
@@ -308,6 +362,7 @@ func InitHeuristicRules() {
 			Content:  `ORDER BY RAND() is a very inefficient method of retrieving random rows from the result set, because it sorts the entire result and discards most of its data. `,
 			Case:     "select name from tbl where id <1000 order by rand(number)",
 			Func:     (*Query4Audit).RuleOrderByRand,
+			TiFunc:   (*Query4Audit).TiRuleOrderByRand,
 		},
 		"CLA.003": {
 			Item:     "CLA.003",
@@ -316,22 +371,25 @@ func InitHeuristicRules() {
 			Content:  `The complexity of using LIMIT and OFFSET to page the result set is O(n^2), and it will cause performance problems as the data increases. Using "bookmark" scanning method to achieve higher efficiency of paging. `,
 			Case:     "select c1,c2 from tbl where name=xx order by number limit 1 offset 20",
 			Func:     (*Query4Audit).RuleOffsetLimit,
+			TiFunc:   (*Query4Audit).TiRuleOffsetLimit,
 		},
 		"CLA.004": {
-			Item:     "CLA.004",
-			Severity: "L2",
-			Summary:  "It is not recommended to group by constants",
-			Content:  `GROUP BY 1 means group by the first column. If you use numbers in the GROUP BY clause instead of expressions or column names, it may cause problems when the order of the query columns is changed. `,
-			Case:     "select col1,col2 from tbl group by 1",
-			Func:     (*Query4Audit).RuleGroupByConst,
+			Item:      "CLA.004",
+			Severity:  "L2",
+			Summary:   "It is not recommended to group by constants",
+			Content:   `GROUP BY 1 means group by the first column. If you use numbers in the GROUP BY clause instead of expressions or column names, it may cause problems when the order of the query columns is changed. `,
+			Case:      "select col1,col2 from tbl group by 1",
+			Func:      (*Query4Audit).RuleGroupByConst,
+			IndexFunc: (*IndexAdvisor).RuleGroupByConst,
 		},
 		"CLA.005": {
-			Item:     "CLA.005",
-			Severity: "L2",
-			Summary:  "ORDER BY constant column has no meaning",
-			Content:  `There may be an error in SQL logic; at most it is just a useless operation and will not change the query result. `,
-			Case:     "select id from test where id=1 order by id",
-			Func:     (*Query4Audit).RuleOrderByConst,
+			Item:      "CLA.005",
+			Severity:  "L2",
+			Summary:   "ORDER BY constant column has no meaning",
+			Content:   `There may be an error in SQL logic; at most it is just a useless operation and will not change the query result. `,
+			Case:      "select id from test where id=1 order by id",
+			Func:      (*Query4Audit).RuleOrderByConst,
+			IndexFunc: (*IndexAdvisor).RuleOrderByConst,
 		},
 		"CLA.006": {
 			Item:     "CLA.006",
@@ -348,6 +406,7 @@ func InitHeuristicRules() {
 			Content:  `All expressions in the ORDER BY clause must be sorted in a uniform ASC or DESC direction in order to take advantage of the index. `,
 			Case:     "select c1,c2,c3 from t1 where c1='foo' order by c2 desc, c3 asc",
 			Func:     (*Query4Audit).RuleMixOrderBy,
+			TiFunc:   (*Query4Audit).TiRuleMixOrderBy,
 		},
 		"CLA.008": {
 			Item:     "CLA.008",
@@ -355,7 +414,9 @@ func InitHeuristicRules() {
 			Summary:  "Please add ORDER BY condition for GROUP BY display",
 			Content:  `By default, MySQL will sort'GROUP BY col1, col2, ...' requests in the following order:'ORDER BY col1, col2, ...'. If the GROUP BY statement does not specify the ORDER BY condition, it will cause unnecessary sorting. If sorting is not required, it is recommended to add'ORDER BY NULL'. `,
 			Case:     "select c1,c2,c3 from t1 where c1='foo' group by c2",
+			Fix:      "orderbynull",
 			Func:     (*Query4Audit).RuleExplicitOrderBy,
+			TiFunc:   (*Query4Audit).TiRuleExplicitOrderBy,
 		},
 		"CLA.009": {
 			Item:     "CLA.009",
@@ -388,6 +449,7 @@ func InitHeuristicRules() {
 			Content:  `SQL is a very expressive language, you can accomplish many things in a single SQL query or a single statement. But this does not mean that you must use only one line of code, or that it is a good idea to use one line of code to get every task. A common consequence of obtaining all results with one query is to get a Cartesian product. This happens when there are no conditions between the two tables in the query to restrict their relationship. There is no corresponding restriction and directly use two tables for join query, you will get a combination of each row in the first table and each row in the second table. Each such combination will become a row in the result set, and eventually you will get a result set with a large number of rows. It is important to consider that these queries are difficult to write, difficult to modify, and difficult to debug. The increasing number of database query requests should be expected. Managers want more complex reports and add more fields to the user interface. If your design is complex and a single query, it will be time-consuming and laborious to expand them. For you or the project, time spent on these things is not worth it. Break the complex spaghetti query into a few simple queries. When you split a complex SQL query, the result may be many similar queries, which may differ only in data types. Writing all these queries is very tedious, so it is best to have a program that automatically generates these codes. SQL code generation is a good application. Although SQL supports solving complex problems with one line of code, don't do unrealistic things. `,
 			Case:     "This is a very long and very long SQL, the case is omitted.",
 			Func:     (*Query4Audit).RuleSpaghettiQueryAlert,
+			TiSafe:   true,
 		},
 		/*
 			https://www.datacamp.com/community/tutorials/sql-tutorial-query
@@ -427,6 +489,7 @@ func InitHeuristicRules() {
 			Content:  `It is recommended to use TRUNCATE instead of DELETE when deleting the entire table`,
 			Case:     "delete from tbl",
 			Func:     (*Query4Audit).RuleNoWhere,
+			TiFunc:   (*Query4Audit).TiRuleNoWhere,
 		},
 		"CLA.015": {
 			Item:     "CLA.015",
@@ -435,14 +498,17 @@ func InitHeuristicRules() {
 			Content:  `UPDATE does not specify the WHERE condition is generally fatal, please think twice`,
 			Case:     "update tbl set col=1",
 			Func:     (*Query4Audit).RuleNoWhere,
+			TiFunc:   (*Query4Audit).TiRuleNoWhere,
 		},
 		"CLA.016": {
-			Item:     "CLA.016",
-			Severity: "L2",
-			Summary:  "Don't UPDATE the primary key",
-			Content:  `The primary key is the unique identifier of the record in the data table. It is not recommended to update the primary key column frequently. This will affect the metadata statistics and affect the normal query. `,
-			Case:     "update tbl set col=1",
-			Func:     (*Query4Audit).RuleOK, // It is recommended to give RuleUpdatePrimaryKey in indexAdvisor
+			Item:      "CLA.016",
+			Severity:  "L2",
+			Summary:   "Don't UPDATE the primary key",
+			Content:   `The primary key is the unique identifier of the record in the data table. It is not recommended to update the primary key column frequently. This will affect the metadata statistics and affect the normal query. `,
+			Case:      "update tbl set col=1",
+			Func:      (*Query4Audit).RuleOK, // It is recommended to give RuleUpdatePrimaryKey in indexAdvisor
+			TiSafe:    true,
+			IndexFunc: (*IndexAdvisor).RuleUpdatePrimaryKey,
 		},
 		"COL.001": {
 			Item:     "COL.001",
@@ -450,7 +516,9 @@ func InitHeuristicRules() {
 			Summary:  "It is not recommended to use SELECT * type query",
 			Content:  `When the table structure changes, using the * wildcard to select all columns will cause the meaning and behavior of the query to change, which may cause the query to return more data. `,
 			Case:     "select * from tbl where id=1",
+			Fix:      "star2columns",
 			Func:     (*Query4Audit).RuleSelectStar,
+			TiSafe:   true,
 		},
 		"COL.002": {
 			Item:     "COL.002",
@@ -458,7 +526,9 @@ func InitHeuristicRules() {
 			Summary:  "INSERT/REPLACE does not specify the column name",
 			Content:  `When the table structure changes, if the INSERT or REPLACE request does not explicitly specify the column name, the result of the request will be different from what you expected; it is recommended to use "INSERT INTO tbl(col1, col2)VALUES ..." instead. `,
 			Case:     "insert into tbl values(1,'name')",
+			Fix:      "insertcolumns",
 			Func:     (*Query4Audit).RuleInsertColDef,
+			TiFunc:   (*Query4Audit).TiRuleInsertColDef,
 		},
 		"COL.003": {
 			Item:     "COL.003",
@@ -467,6 +537,7 @@ func InitHeuristicRules() {
 			Content:  `It is recommended to modify the auto-increment ID to an unsigned type`,
 			Case:     "create table test(`id` int(11) NOT NULL AUTO_INCREMENT)",
 			Func:     (*Query4Audit).RuleAutoIncUnsigned,
+			TiSafe:   true,
 		},
 		"COL.004": {
 			Item:     "COL.004",
@@ -475,6 +546,7 @@ func InitHeuristicRules() {
 			Content:  `Please add a default value for the column, if it is an ALTER operation, please don't forget to write the default value of the original field. The field has no default value, and the table structure cannot be changed online when the table is large. `,
 			Case:     "CREATE TABLE tbl (col int) ENGINE=InnoDB;",
 			Func:     (*Query4Audit).RuleAddDefaultValue,
+			TiSafe:   true,
 		},
 		"COL.005": {
 			Item:     "COL.005",
@@ -483,6 +555,7 @@ func InitHeuristicRules() {
 			Content:  `It is recommended to add a comment to each column in the table to clarify the meaning and function of each column in the table. `,
 			Case:     "CREATE TABLE tbl (col int) ENGINE=InnoDB;",
 			Func:     (*Query4Audit).RuleColCommentCheck,
+			TiSafe:   true,
 		},
 		"COL.006": {
 			Item:     "COL.006",
@@ -491,14 +564,17 @@ func InitHeuristicRules() {
 			Content:  `The table contains too many columns`,
 			Case:     "CREATE TABLE tbl (cols ....);",
 			Func:     (*Query4Audit).RuleTooManyFields,
+			TiSafe:   true,
 		},
 		"COL.007": {
-			Item:     "COL.007",
-			Severity: "L3",
-			Summary:  "The table contains too many text/blob columns",
-			Content:  fmt.Sprintf(`The table contains more than %d text/blob columns`, common.Config.MaxTextColsCount),
-			Case:     "CREATE TABLE tbl (cols ....);",
-			Func:     (*Query4Audit).RuleTooManyFields,
+			Item:      "COL.007",
+			Severity:  "L3",
+			Summary:   "The table contains too many text/blob columns",
+			Content:   fmt.Sprintf(`The table contains more than %d text/blob columns`, common.Config.MaxTextColsCount),
+			Case:      "CREATE TABLE tbl (cols ....);",
+			Func:      (*Query4Audit).RuleTooManyFields,
+			TiSafe:    true,
+			IndexFunc: (*IndexAdvisor).RuleMaxTextColsCount,
 		},
 		"COL.008": {
 			Item:     "COL.008",
@@ -507,6 +583,7 @@ func InitHeuristicRules() {
 			Content:  `The storage space is small for the first variable length field, which can save storage space. Secondly, for queries, the search efficiency in a relatively small field is obviously higher. `,
 			Case:     "create table t1(id int,name char(20),last_time date)",
 			Func:     (*Query4Audit).RuleVarcharVSChar,
+			TiSafe:   true,
 		},
 		"COL.009": {
 			Item:     "COL.009",
@@ -515,6 +592,7 @@ func InitHeuristicRules() {
 			Content:  `Actually, any design that uses FLOAT, REAL or DOUBLE PRECISION data types may be an anti-pattern. The value range of floating point numbers used by most applications does not need to reach the maximum/minimum range defined by the IEEE 754 standard. When calculating the total, the accumulated impact of inexact floating-point numbers is serious. Use the NUMERIC or DECIMAL type in SQL to replace FLOAT and similar data types for fixed-precision decimal storage. These data types store data exactly according to the precision you specified when you defined this column. Do not use floating-point numbers as much as possible. `,
 			Case:     "CREATE TABLE tab2 (p_id BIGINT UNSIGNED NOT NULL,a_id BIGINT UNSIGNED NOT NULL,hours float not null,PRIMARY KEY (p_id, a_id))",
 			Func:     (*Query4Audit).RuleImpreciseDataType,
+			TiSafe:   true,
 		},
 		"COL.010": {
 			Item:     "COL.010",
@@ -523,6 +601,7 @@ func InitHeuristicRules() {
 			Content:  `ENUM defines the type of value in the column. When using a string to represent the value in ENUM, the data actually stored in the column is the ordinal number of these values ​​at the time of definition. Therefore, the data in this column is byte-aligned. When you perform a sorting query, the results are sorted according to the actual stored ordinal value, not the alphabetical order of the string value. This may not be what you want. There is no syntax for adding or deleting a value from an ENUM or check constraint; you can only redefine this column with a new set. If you plan to discard an option, you may be annoyed by historical data. As a strategy, changing metadata—that is, changing the definition of tables and columns—should be uncommon, and pay attention to testing and quality assurance. There is a better solution to constrain the optional values ​​in a column: create a check table, each row contains a candidate value that is allowed in the column; then declare a foreign key constraint on the old table that references the new table. `,
 			Case:     "create table tab1(status ENUM('new','in progress','fixed'))",
 			Func:     (*Query4Audit).RuleValuesInDefinition,
+			TiSafe:   true,
 		},
 		// 这个建议从sqlcheck迁移来的，实际生产环境每条建表SQL都会给这条建议，看多了会不开心。
 		"COL.011": {
@@ -532,6 +611,7 @@ func InitHeuristicRules() {
 			Content:  `NULL and 0 are different, 10 multiplied by NULL or NULL. NULL is not the same as an empty string. The result of combining a string with NULL in standard SQL is still NULL. NULL and FALSE are also different. If NULL is involved in the three Boolean operations of AND, OR, and NOT, many people are confused by the result. When you declare a column as NOT NULL, it means that every value in the column must exist and be meaningful. Use NULL to represent a null value that does not exist in any type. When you declare a column as NOT NULL, it means that every value in the column must exist and be meaningful. `,
 			Case:     "select c1,c2,c3 from tbl where c4 is null or c4 <> 1",
 			Func:     (*Query4Audit).RuleNullUsage,
+			TiSafe:   true,
 		},
 		"COL.012": {
 			Item:     "COL.012",
@@ -540,6 +620,7 @@ func InitHeuristicRules() {
 			Content:  `TEXT, BLOB, and JSON type fields cannot specify non-NULL default values. If the NOT NULL restriction is added, writing data without specifying a value for the field may cause writing failure. `,
 			Case:     "CREATE TABLE `tb`(`c` longblob NOT NULL);",
 			Func:     (*Query4Audit).RuleBLOBNotNull,
+			TiSafe:   true,
 		},
 		"COL.013": {
 			Item:     "COL.013",
@@ -548,6 +629,7 @@ func InitHeuristicRules() {
 			Content:  `TIMESTAMP type recommends setting the default value, and it is not recommended to use 0 or 0000-00-00 00:00:00 as the default value. Consider using 1970-08-02 01:01:01`,
 			Case:     "CREATE TABLE tbl( `id` bigint not null, `create_time` timestamp);",
 			Func:     (*Query4Audit).RuleTimestampDefault,
+			TiSafe:   true,
 		},
 		"COL.014": {
 			Item:     "COL.014",
@@ -556,6 +638,7 @@ func InitHeuristicRules() {
 			Content:  `It is recommended that the column and the table use the same character set, do not specify the character set of the column separately. `,
 			Case:     "CREATE TABLE `tb2` (`id` int(11) DEFAULT NULL, `col` char(10) CHARACTER SET utf8 DEFAULT NULL)",
 			Func:     (*Query4Audit).RuleColumnWithCharset,
+			TiSafe:   true,
 		},
 		// https://stackoverflow.com/questions/3466872/why-cant-a-text-column-have-a-default-value-in-mysql
 		"COL.015": {
@@ -565,6 +648,7 @@ func InitHeuristicRules() {
 			Content:  `TEXT, BLOB and JSON type fields in the MySQL database cannot be specified with non-NULL default values. The maximum length of TEXT is 2^16-1 characters, the maximum length of MEDIUMTEXT is 2^32-1 characters, and the maximum length of LONGTEXT is 2^64-1 characters. `,
 			Case:     "CREATE TABLE `tbl` (`c` blob DEFAULT NULL);",
 			Func:     (*Query4Audit).RuleBlobDefaultValue,
+			TiSafe:   true,
 		},
 		"COL.016": {
 			Item:     "COL.016",
@@ -573,6 +657,7 @@ func InitHeuristicRules() {
 			Content:  `INT(M) In the integer data type, M represents the maximum display width. In INT(M), the value of M has nothing to do with how much storage space INT(M) occupies. INT(3), INT(4), INT(8) all occupy 4 bytes of storage space on the disk. In higher versions of MySQL, it is no longer recommended to set the integer display width. `,
 			Case:     "CREATE TABLE tab (a INT(1));",
 			Func:     (*Query4Audit).RuleIntPrecision,
+			TiSafe:   true,
 		},
 		"COL.017": {
 			Item:     "COL.017",
@@ -581,6 +666,7 @@ func InitHeuristicRules() {
 			Content:  fmt.Sprintf(`varchar is a variable-length string, storage space is not allocated in advance, and the length should not exceed %d. If the storage length is too long, MySQL will define the field type as text, and create a separate table with the primary key to correspond , To avoid affecting the index efficiency of other fields.`, common.Config.MaxVarcharLength),
 			Case:     "CREATE TABLE tab (a varchar(3500));",
 			Func:     (*Query4Audit).RuleVarcharLength,
+			TiSafe:   true,
 		},
 		"COL.018": {
 			Item:     "COL.018",
@@ -597,6 +683,7 @@ func InitHeuristicRules() {
 			Content:  "The storage space consumption brought by the use of high-precision time data types is relatively large; MySQL can only support time data types accurate to microseconds above 5.6.4, and version compatibility issues need to be considered when using it.",
 			Case:     "CREATE TABLE t1 (t TIME(3), dt DATETIME(6));",
 			Func:     (*Query4Audit).RuleTimePrecision,
+			TiSafe:   true,
 		},
 		"DIS.001": {
 			Item:     "DIS.001",
@@ -622,6 +709,7 @@ func InitHeuristicRules() {
 			Summary:  "DISTINCT * has no meaning for tables with primary keys",
 			Content:  `When the table already has a primary key, the output result of DISTINCT for all columns is the same as the result of no DISTINCT operation, please don't superfluous. `,
 			Case:     "SELECT DISTINCT * FROM film;",
+			Fix:      "distinctstar",
 			Func:     (*Query4Audit).RuleDistinctStar,
 		},
 		"FUN.001": {
@@ -639,6 +727,7 @@ func InitHeuristicRules() {
 			Content:  `The function of COUNT(*) is to count the number of table rows, and the function of COUNT(COL) is to count the number of non-NULL rows in the specified column. MyISAM table is specially optimized for COUNT(*) to count the number of rows in the whole table, which is usually very fast. But for non-MyISAM tables or certain WHERE conditions are specified, the COUNT(*) operation needs to scan a large number of rows to obtain accurate results, and the performance is therefore not good. Sometimes certain business scenarios do not require a completely accurate COUNT value, and an approximate value can be used instead. The number of rows estimated by the optimizer from EXPLAIN is a good approximation. Executing EXPLAIN does not need to actually execute the query, so the cost is very low. `,
 			Case:     "SELECT c3, COUNT(*) AS accounts FROM tab where c2 <10000 GROUP BY c3 ORDER BY num",
 			Func:     (*Query4Audit).RuleCountStar,
+			TiFunc:   (*Query4Audit).TiRuleCountStar,
 		},
 		"FUN.003": {
 			Item:     "FUN.003",
@@ -647,6 +736,7 @@ func InitHeuristicRules() {
 			Content:  `In some query requests, you need to force a column or expression to return a non-NULL value, so that the query logic becomes simpler, but you don't want to save this value. You can use the COALESCE() function to construct a concatenated expression, so that even a null column does not make the entire expression NULL. `,
 			Case:     "select c1 || coalesce(' '|| c2 ||'', '') || c3 as c from tbl",
 			Func:     (*Query4Audit).RuleStringConcatenation,
+			TiSafe:   true,
 		},
 		"FUN.004": {
 			Item:     "FUN.004",
@@ -663,6 +753,7 @@ func InitHeuristicRules() {
 			Content:  `Don't use COUNT(col) or COUNT(constant) instead of COUNT(*), COUNT(*) is the standard method of counting the number of rows defined by SQL92. It has nothing to do with data, and has nothing to do with NULL and non-NULL. `,
 			Case:     "SELECT COUNT(1) FROM tbl;",
 			Func:     (*Query4Audit).RuleCountConst,
+			TiSafe:   true,
 		},
 		"FUN.006": {
 			Item:     "FUN.006",
@@ -671,6 +762,7 @@ func InitHeuristicRules() {
 			Content:  `When the values ​​of a certain column are all NULL, the return result of COUNT(COL) is 0, but the return result of SUM(COL) is NULL, so you need to pay attention to the NPE problem when using SUM(). The following methods can be used to avoid the NPE problem of SUM: SELECT IF(ISNULL(SUM(COL)), 0, SUM(COL)) FROM tbl`,
 			Case:     "SELECT SUM(COL) FROM tbl;",
 			Func:     (*Query4Audit).RuleSumNPE,
+			TiSafe:   true,
 		},
 		"FUN.007": {
 			Item:     "FUN.007",
@@ -679,6 +771,7 @@ func InitHeuristicRules() {
 			Content:  `There is no feedback and log for the execution of the trigger, which hides the actual execution steps. When there is a problem with the database, the specific execution of the trigger cannot be analyzed through the slow log, and the problem is not easy to find. In MySQL, triggers cannot be temporarily closed or opened. In scenarios such as data migration or data recovery, you need to drop triggers temporarily, which may affect the production environment. `,
 			Case:     "CREATE TRIGGER t1 AFTER INSERT ON work FOR EACH ROW INSERT INTO time VALUES(NOW());",
 			Func:     (*Query4Audit).RuleForbiddenTrigger,
+			TiSafe:   true,
 		},
 		"FUN.008": {
 			Item:     "FUN.008",
@@ -687,6 +780,7 @@ func InitHeuristicRules() {
 			Content:  `The stored procedure has no version control, and it is difficult to achieve business unawareness with the upgrade of the stored procedure in conjunction with the business. Storage procedures also have problems in expansion and transplantation. `,
 			Case:     "CREATE PROCEDURE simpleproc (OUT param1 INT);",
 			Func:     (*Query4Audit).RuleForbiddenProcedure,
+			TiSafe:   true,
 		},
 		"FUN.009": {
 			Item:     "FUN.009",
@@ -695,6 +789,7 @@ func InitHeuristicRules() {
 			Content:  `It is not recommended to use custom functions`,
 			Case:     "CREATE FUNCTION hello (s CHAR(20));",
 			Func:     (*Query4Audit).RuleForbiddenFunction,
+			TiSafe:   true,
 		},
 		"GRP.001": {
 			Item:     "GRP.001",
@@ -703,6 +798,7 @@ func InitHeuristicRules() {
 			Content:  `The columns in GROUP BY used the equivalent query in the previous WHERE condition, so it doesn't make much sense to perform GROUP BY on such columns. `,
 			Case:     "select film_id, title from film where release_year='2006' group by release_year",
 			Func:     (*Query4Audit).RuleOK, // This suggestion is given to RuleGroupByConst in indexAdvisor
+			TiSafe:   true,
 		},
 		"JOI.001": {
 			Item:     "JOI.001",
@@ -727,6 +823,7 @@ func InitHeuristicRules() {
 			Content:  `Due to the wrong WHERE condition, no data is returned from the external table of OUTER JOIN, which will implicitly convert the query to INNER JOIN. Such as: select c from L left join R using(c) where L.a=5 and R.b=10. This kind of SQL logic may have errors or programmers may misunderstand how OUTER JOIN works, because LEFT/RIGHT JOIN is the abbreviation of LEFT/RIGHT OUTER JOIN. `,
 			Case:     "select c1,c2,c3 from t1 left outer join t2 using(c1) where t1.c2=2 and t2.c3=4",
 			Func:     (*Query4Audit).RuleOK, // TODO
+			TiSafe:   true,
 		},
 		"JOI.004": {
 			Item:     "JOI.004",
@@ -735,6 +832,7 @@ func InitHeuristicRules() {
 			Content:  `LEFT OUTER JOIN statement with WHERE clause only in the right table is NULL, it may be the wrong column in the WHERE clause, such as: "... FROM l LEFT OUTER JOIN r ON ll = rr WHERE rz IS NULL", the correct logic for this query may be WHERE rr IS NULL. `,
 			Case:     "select c1,c2,c3 from t1 left outer join t2 on t1.c1=t2.c1 where t2.c2 is null",
 			Func:     (*Query4Audit).RuleOK, // TODO
+			TiSafe:   true,
 		},
 		"JOI.005": {
 			Item:     "JOI.005",
@@ -792,6 +890,7 @@ func InitHeuristicRules() {
 			Content:  `Data with recursive relationships is very common, and data is often organized like a tree or hierarchically. However, creating a foreign key constraint to enforce the relationship between two columns in the same table can lead to clumsy queries. Each level of the tree corresponds to another connection. You will need to issue a recursive query to get all descendants or all ancestors of the node. The solution is to construct an additional closure table. It records the relationship between all nodes in the tree, not just those that have a direct parent-child relationship. You can also compare different levels of data design: closure tables, path enumerations, nested sets. Then choose one according to the needs of the application. `,
 			Case:     "CREATE TABLE tab2 (p_id BIGINT UNSIGNED NOT NULL,a_id BIGINT UNSIGNED NOT NULL,PRIMARY KEY (p_id, a_id),FOREIGN KEY (p_id) REFERENCES tab1(p_id),FOREIGN KEY (a_id) REFERENCES tab3(a_idENCE))",
 			Func:     (*Query4Audit).RuleRecursiveDependency,
+			TiSafe:   true,
 		},
 		// TODO: Add a new composite index, whether the fields are sorted by scattered granularity from large to small, with the highest degree of discrimination on the left
 		"KEY.004": {
@@ -801,6 +900,7 @@ func InitHeuristicRules() {
 			Content:  `If you create a composite index for a column, please make sure that the order of the query attributes and index attributes is the same so that the DBMS can use the index when processing the query. If the query and index attribute orders are not aligned, the DBMS may not be able to use the index during query processing. `,
 			Case:     "create index idx1 on tbl (last_name,first_name)",
 			Func:     (*Query4Audit).RuleIndexAttributeOrder,
+			TiSafe:   true,
 		},
 		"KEY.005": {
 			Item:     "KEY.005",
@@ -809,6 +909,7 @@ func InitHeuristicRules() {
 			Content:  `Table built too many indexes`,
 			Case:     "CREATE TABLE tbl (a int, b int, c int, KEY idx_a (`a`),KEY idx_b(`b`),KEY idx_c(`c`));",
 			Func:     (*Query4Audit).RuleTooManyKeys,
+			TiSafe:   true,
 		},
 		"KEY.006": {
 			Item:     "KEY.006",
@@ -817,6 +918,7 @@ func InitHeuristicRules() {
 			Content:  `Too many columns in primary key`,
 			Case:     "CREATE TABLE tbl (a int, b int, c int, PRIMARY KEY(`a`,`b`,`c`));",
 			Func:     (*Query4Audit).RuleTooManyKeyParts,
+			TiSafe:   true,
 		},
 		"KEY.007": {
 			Item:     "KEY.007",
@@ -841,6 +943,7 @@ func InitHeuristicRules() {
 			Content:  `Please check the data uniqueness of the added unique index column in advance. If the data is not unique, the duplicate columns may be automatically deleted when the online table structure is adjusted, which may cause data loss. `,
 			Case:     "CREATE UNIQUE INDEX part_of_name ON customer (name(10));",
 			Func:     (*Query4Audit).RuleUniqueKeyDup,
+			TiSafe:   true,
 		},
 		"KEY.010": {
 			Item:     "KEY.010",
@@ -849,6 +952,7 @@ func InitHeuristicRules() {
 			Content:  `Full-text index is mainly used to solve the performance problem of fuzzy query, but it is necessary to control the frequency and concurrency of the query. At the same time, pay attention to adjust the ft_min_word_len, ft_max_word_len, ngram_token_size and other parameters. `,
 			Case:     "CREATE TABLE `tb` (`id` int(10) unsigned NOT NULL AUTO_INCREMENT, `ip` varchar(255) NOT NULL DEFAULT'', PRIMARY KEY (`id`), FULLTEXT KEY `ip` (`ip `)) ENGINE=InnoDB;",
 			Func:     (*Query4Audit).RuleFulltextIndex,
+			TiSafe:   true,
 		},
 		"KWR.001": {
 			Item:     "KWR.001",
@@ -857,6 +961,7 @@ func InitHeuristicRules() {
 			Content:  `Because SQL_CALC_FOUND_ROWS can't scale well, it may cause performance problems; it is recommended that the business use other strategies to replace the counting function provided by SQL_CALC_FOUND_ROWS, such as: paging results display, etc. `,
 			Case:     "select SQL_CALC_FOUND_ROWS col from tbl where id>1000",
 			Func:     (*Query4Audit).RuleSQLCalcFoundRows,
+			TiSafe:   true,
 		},
 		"KWR.002": {
 			Item:     "KWR.002",
@@ -865,6 +970,7 @@ func InitHeuristicRules() {
 			Content:  `When using keywords as column names or table names, the program needs to escape the column names and table names. If negligence is caused, the request cannot be executed. `,
 			Case:     "CREATE TABLE tbl (`select` int )",
 			Func:     (*Query4Audit).RuleUseKeyWord,
+			TiSafe:   true,
 		},
 		"KWR.003": {
 			Item:     "KWR.003",
@@ -873,6 +979,7 @@ func InitHeuristicRules() {
 			Content:  `The name of the table should only indicate the content of the entity in the table, not the number of entities, and the corresponding DO class name is also in singular form, which conforms to the expression habit. `,
 			Case:     "CREATE TABLE tbl (`books` int )",
 			Func:     (*Query4Audit).RulePluralWord,
+			TiSafe:   true,
 		},
 		"KWR.004": {
 			Item:     "KWR.004",
@@ -881,6 +988,7 @@ func InitHeuristicRules() {
 			Content:  `It is recommended to use English, numbers, underscores and other characters when naming libraries, tables, columns, and aliases. Chinese or other multi-byte encoded characters are not recommended. `,
 			Case:     "select col as column from tb",
 			Func:     (*Query4Audit).RuleMultiBytesWord,
+			TiSafe:   true,
 		},
 		"KWR.005": {
 			Item:     "KWR.005",
@@ -889,6 +997,7 @@ func InitHeuristicRules() {
 			Content:  "Some IDEs will automatically insert unicode characters invisible to the naked eye in SQL. Such as: non-break space, zero-width space, etc. Under Linux, you can use the `cat -A file.sql` command to view invisible characters.",
 			Case:     "update tb set status = 1 where id = 1;",
 			Func:     (*Query4Audit).RuleInvisibleUnicode,
+			TiSafe:   true,
 		},
 		"LCK.001": {
 			Item:     "LCK.001",
@@ -897,6 +1006,7 @@ func InitHeuristicRules() {
 			Content:  `INSERT INTO xx SELECT lock granularity is large, please be careful`,
 			Case:     "INSERT INTO tbl SELECT * FROM tbl2;",
 			Func:     (*Query4Audit).RuleInsertSelect,
+			TiFunc:   (*Query4Audit).TiRuleInsertSelect,
 		},
 		"LCK.002": {
 			Item:     "LCK.002",
@@ -905,6 +1015,7 @@ func InitHeuristicRules() {
 			Content:  `Using INSERT ON DUPLICATE KEY UPDATE when the primary key is an auto-increment key may cause a large number of discontinuous and rapid growth of the primary key, resulting in rapid overflow of the primary key and unable to continue writing. In extreme cases, the master-slave data may be inconsistent. `,
 			Case:     "INSERT INTO t1(a,b,c) VALUES (1,2,3) ON DUPLICATE KEY UPDATE c=c+1;",
 			Func:     (*Query4Audit).RuleInsertOnDup,
+			TiFunc:   (*Query4Audit).TiRuleInsertOnDup,
 		},
 		"LIT.001": {
 			Item:     "LIT.001",
@@ -913,6 +1024,7 @@ func InitHeuristicRules() {
 			Content:  `The string literally looks like an IP address, but it is not a parameter of INET_ATON(), indicating that the data is stored as characters instead of integers. It is more efficient to store the IP address as an integer. `,
 			Case:     "insert into tbl (IP,name) values('10.20.306.122','test')",
 			Func:     (*Query4Audit).RuleIPString,
+			TiSafe:   true,
 		},
 		"LIT.002": {
 			Item:     "LIT.002",
@@ -929,6 +1041,7 @@ func InitHeuristicRules() {
 			Content:  `Store the ID as a list as a VARCHAR/TEXT column, which can cause performance and data integrity issues. Querying such columns requires the use of pattern matching expressions. Using a comma-separated list to do a multi-table join query to locate a row of data is extremely inelegant and time-consuming. This will make it more difficult to verify the ID. Consider, how much data can the list support at most? Store IDs in a separate table instead of using multi-valued attributes, so that each individual attribute value can occupy a row. In this way, the cross table realizes the many-to-many relationship between the two tables. This will simplify the query better and verify the ID more effectively. `,
 			Case:     "select c1,c2,c3,c4 from tab1 where col_id REGEXP'[[:<:]]12[[:>:]]'",
 			Func:     (*Query4Audit).RuleMultiValueAttribute,
+			TiSafe:   true,
 		},
 		"LIT.004": {
 			Item:     "LIT.004",
@@ -937,6 +1050,7 @@ func InitHeuristicRules() {
 			Content:  `USE database, SHOW DATABASES and other commands also need to end with a semicolon or the set DELIMITER. `,
 			Case:     "USE db",
 			Func:     (*Query4Audit).RuleOK, // TODO: RuleAddDelimiter
+			TiSafe:   true,
 		},
 		"RES.001": {
 			Item:     "RES.001",
@@ -945,6 +1059,7 @@ func InitHeuristicRules() {
 			Content:  `The column returned by SQL is neither in the aggregate function nor in the column of the GROUP BY expression, so the result of these values ​​will be non-deterministic. For example: select a, b, c from tbl where foo="bar" group by a, the result returned by the SQL is uncertain. `,
 			Case:     "select c1,c2,c3 from t1 where c2='foo' group by c2",
 			Func:     (*Query4Audit).RuleNoDeterministicGroupby,
+			TiFunc:   (*Query4Audit).TiRuleNoDeterministicGroupby,
 		},
 		"RES.002": {
 			Item:     "RES.002",
@@ -953,6 +1068,7 @@ func InitHeuristicRules() {
 			Content:  `LIMIT without ORDER BY will lead to non-deterministic results, depending on the query execution plan. `,
 			Case:     "select col1,col2 from tbl where name=xx limit 10",
 			Func:     (*Query4Audit).RuleNoDeterministicLimit,
+			TiFunc:   (*Query4Audit).TiRuleNoDeterministicLimit,
 		},
 		"RES.003": {
 			Item:     "RES.003",
@@ -961,6 +1077,7 @@ func InitHeuristicRules() {
 			Content:  `UPDATE/DELETE operation using LIMIT condition is as dangerous as not adding WHERE condition, it may cause inconsistency of master-slave data or interruption of slave database synchronization. `,
 			Case:     "UPDATE film SET length = 120 WHERE title ='abc' LIMIT 1;",
 			Func:     (*Query4Audit).RuleUpdateDeleteWithLimit,
+			TiFunc:   (*Query4Audit).TiRuleUpdateDeleteWithLimit,
 		},
 		"RES.004": {
 			Item:     "RES.004",
@@ -968,7 +1085,9 @@ func InitHeuristicRules() {
 			Summary:  "UPDATE/DELETE operation specifies the ORDER BY condition",
 			Content:  `Do not specify ORDER BY conditions for UPDATE/DELETE operations. `,
 			Case:     "UPDATE film SET length = 120 WHERE title ='abc' ORDER BY title",
+			Fix:      "dmlorderby",
 			Func:     (*Query4Audit).RuleUpdateDeleteWithOrderby,
+			TiFunc:   (*Query4Audit).TiRuleUpdateDeleteWithOrderby,
 		},
 		"RES.005": {
 			Item:     "RES.005",
@@ -1001,6 +1120,7 @@ func InitHeuristicRules() {
 			Content:  "SELECT INTO OUTFILE needs to be granted FILE permission, which will introduce security issues. Although LOAD DATA can increase the speed of data import, it may also cause excessive delay in synchronization from the library.",
 			Case:     "LOAD DATA INFILE'data.txt' INTO TABLE db2.my_table;",
 			Func:     (*Query4Audit).RuleLoadFile,
+			TiSafe:   true,
 		},
 		"RES.009": {
 			Item:     "RES.009",
@@ -1009,6 +1129,7 @@ func InitHeuristicRules() {
 			Content:  "Similar to this SELECT * FROM tbl WHERE col = col ='abc' statement may be a writing error, the meaning you may want to express is col ='abc'. If it is indeed a business requirement, it is recommended to modify it to col = col and col ='abc'.",
 			Case:     "SELECT * FROM tbl WHERE col = col ='abc'",
 			Func:     (*Query4Audit).RuleMultiCompare,
+			TiSafe:   true,
 		},
 		"RES.010": {
 			Item:     "RES.010",
@@ -1017,6 +1138,7 @@ func InitHeuristicRules() {
 			Content:  "The field defined as ON UPDATE CURRENT_TIMESTAMP will be modified when other fields of the table are updated. If it contains business logic, the user will see hidden dangers. If you modify the data in batches but do not want to modify the field, it will cause data errors. ",
 			Case:     `CREATE TABLE category (category_id TINYINT UNSIGNED NOT NULL AUTO_INCREMENT, name VARCHAR(25) NOT NULL, last_update TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP, PRIMARY KEY (category_id)`,
 			Func:     (*Query4Audit).RuleCreateOnUpdate,
+			TiSafe:   true,
 		},
 		"RES.011": {
 			Item:     "RES.011",
@@ -1025,6 +1147,7 @@ func InitHeuristicRules() {
 			Content:  "The field defined as ON UPDATE CURRENT_TIMESTAMP will be modified when other fields in the table are updated. Please check. If you don’t want to modify the update time of the field, you can use the following method: UPDATE category SET name='ActioN', last_update=last_update WHERE category_id=1",
 			Case:     "UPDATE category SET name='ActioN', last_update=last_update WHERE category_id=1",
 			Func:     (*Query4Audit).RuleOK, // It is recommended to give RuleUpdateOnUpdate in indexAdvisor
+			TiSafe:   true,
 		},
 		"SEC.001": {
 			Item:     "SEC.001",
@@ -1033,6 +1156,7 @@ func InitHeuristicRules() {
 			Content:  `Generally speaking, the fastest way to empty a table is to use the TRUNCATE TABLE tbl_name; statement. However, the TRUNCATE operation is not without cost. TRUNCATE TABLE cannot return the exact number of deleted rows. If you need to return the number of deleted rows, it is recommended to use DELETE syntax. TRUNCATE operation will also reset AUTO_INCREMENT, if you don't want to reset the value, it is recommended to use DELETE FROM tbl_name WHERE 1; instead. The TRUNCATE operation will add source data locks (MDL) to the data dictionary. When TRUNCATE many tables are required at one time, it will affect all requests of the entire instance. Therefore, if you want to TRUNCATE multiple tables, it is recommended to use DROP+CREATE to reduce the lock duration. `,
 			Case:     "TRUNCATE TABLE tbl_name",
 			Func:     (*Query4Audit).RuleTruncateTable,
+			TiFunc:   (*Query4Audit).TiRuleTruncateTable,
 		},
 		"SEC.002": {
 			Item:     "SEC.002",
@@ -1041,6 +1165,7 @@ func InitHeuristicRules() {
 			Content:  `It is not safe to store passwords in plain text or to transmit passwords in plain text on the network. If an attacker can intercept the SQL statement you use to insert the password, they can read the password directly. In addition, inserting the string entered by the user into a pure SQL statement in plaintext will also allow the attacker to discover it. If you can read the password, so can a hacker. The solution is to use a one-way hash function to encrypt the original password. Hashing refers to a function that transforms an input string into another new, unrecognizable string. Add a random string to the password encryption expression to defend against "dictionary attacks." Do not enter the plaintext password into the SQL query statement. Calculate the hash string in the application code, and only use the hash string in the SQL query. `,
 			Case:     "create table test(id int,name varchar(20) not null,password varchar(200)not null)",
 			Func:     (*Query4Audit).RuleReadablePasswords,
+			TiSafe:   true,
 		},
 		"SEC.003": {
 			Item:     "SEC.003",
@@ -1049,6 +1174,7 @@ func InitHeuristicRules() {
 			Content:  `It is necessary to back up data before performing high-risk operations. `,
 			Case:     "delete from table where col ='condition'",
 			Func:     (*Query4Audit).RuleDataDrop,
+			TiFunc:   (*Query4Audit).TiRuleDataDrop,
 		},
 		"SEC.004": {
 			Item:     "SEC.004",
@@ -1057,6 +1183,7 @@ func InitHeuristicRules() {
 			Content:  `SLEEP(), BENCHMARK(), GET_LOCK(), RELEASE_LOCK() and other functions usually appear in SQL injection statements, which will seriously affect database performance. `,
 			Case:     "SELECT BENCHMARK(10, RAND())",
 			Func:     (*Query4Audit).RuleInjection,
+			TiSafe:   true,
 		},
 		"STA.001": {
 			Item:     "STA.001",
@@ -1065,6 +1192,7 @@ func InitHeuristicRules() {
 			Content:  `"<>" is the inequality operator in standard SQL. `,
 			Case:     "select col1,col2 from tbl where type!=0",
 			Func:     (*Query4Audit).RuleStandardINEQ,
+			TiSafe:   true,
 		},
 		"STA.002": {
 			Item:     "STA.002",
@@ -1073,6 +1201,7 @@ func InitHeuristicRules() {
 			Content:  `When using the db.table or table.column format to access a table or field, please do not add a space after the dot, although the syntax is correct. `,
 			Case:     "select col from sakila. film",
 			Func:     (*Query4Audit).RuleSpaceAfterDot,
+			TiSafe:   true,
 		},
 		"STA.003": {
 			Item:     "STA.003",
@@ -1081,6 +1210,7 @@ func InitHeuristicRules() {
 			Content:  `It is recommended that the common secondary index be prefixed with ` + common.Config.IdxPrefix + `, and the unique index should be prefixed with` + common.Config.UkPrefix + `. `,
 			Case:     "select col from now where type!=0",
 			Func:     (*Query4Audit).RuleIdxPrefix,
+			TiSafe:   true,
 		},
 		"STA.004": {
 			Item:     "STA.004",
@@ -1089,6 +1219,7 @@ func InitHeuristicRules() {
 			Content:  `Start with a letter or underscore. Only letters, numbers and underscores are allowed in the name. Please unify capitalization and do not use camel case nomenclature. Do not use consecutive underscores'__' in the name, as it is difficult to recognize. `,
 			Case:     "CREATE TABLE `abc` (a int);",
 			Func:     (*Query4Audit).RuleStandardName,
+			TiSafe:   true,
 		},
 		"SUB.001": {
 			Item:     "SUB.001",
@@ -1097,6 +1228,7 @@ func InitHeuristicRules() {
 			Content:  `MySQL executes a subquery with each row in the external query as a dependent subquery. This is a common cause of severe performance problems. This may be improved in MySQL 5.6 version, but for 5.1 and earlier versions, it is recommended to rewrite this type of query as JOIN or LEFT OUTER JOIN respectively. `,
 			Case:     "select col1,col2,col3 from table1 where col2 in(select col from table2)",
 			Func:     (*Query4Audit).RuleInSubquery,
+			TiFunc:   (*Query4Audit).TiRuleInSubquery,
 		},
 		"SUB.002": {
 			Item:     "SUB.002",
@@ -1124,6 +1256,7 @@ func InitHeuristicRules() {
 			Content:  `MySQL's optimization effect on sub-queries is not good. MySQL will execute sub-queries as dependent sub-queries for each row in the external query. This is a common cause of severe performance problems. `,
 			Case:     "SELECT * from tb where id in (select id from (select id from tb))",
 			Func:     (*Query4Audit).RuleSubqueryDepth,
+			TiFunc:   (*Query4Audit).TiRuleSubqueryDepth,
 		},
 		// SUB.005灵感来自 https://blog.csdn.net/zhuocr/article/details/61192418
 		"SUB.005": {
@@ -1149,6 +1282,7 @@ func InitHeuristicRules() {
 			Content:  `Sometimes MySQL cannot "push down" the restriction conditions from the outer layer to the inner layer, which will make the conditions that could restrict the partial return results unable to be applied to the optimization of the inner query. For example: (SELECT * FROM tb1 ORDER BY name) UNION ALL (SELECT * FROM tb2 ORDER BY name) LIMIT 20; MySQL will put the results of the two sub-queries in a temporary table, and then take out 20 results, which can be passed in the two LIMIT 20 is added to each subquery to reduce the data in the temporary table. (SELECT * FROM tb1 ORDER BY name LIMIT 20) UNION ALL (SELECT * FROM tb2 ORDER BY name LIMIT 20) LIMIT 20;`,
 			Case:     "(SELECT * FROM tb1 ORDER BY name LIMIT 20) UNION ALL (SELECT * FROM tb2 ORDER BY name LIMIT 20) LIMIT 20;",
 			Func:     (*Query4Audit).RuleUNIONLimit,
+			TiSafe:   true,
 		},
 		"TBL.001": {
 			Item:     "TBL.001",
@@ -1157,6 +1291,7 @@ func InitHeuristicRules() {
 			Content:  `Partition table is not recommended`,
 			Case:     "CREATE TABLE trb3(id INT, name VARCHAR(50), purchased DATE) PARTITION BY RANGE(YEAR(purchased)) (PARTITION p0 VALUES LESS THAN (1990), PARTITION p1 VALUES LESS THAN (1995), PARTITION p2 VALUES LESS THAN (2000), PARTITION p3 VALUES LESS THAN (2005) );",
 			Func:     (*Query4Audit).RulePartitionNotAllowed,
+			TiSafe:   true,
 		},
 		"TBL.002": {
 			Item:     "TBL.002",
@@ -1165,6 +1300,7 @@ func InitHeuristicRules() {
 			Content:  `It is recommended to use the recommended storage engine when creating a table or modifying the storage engine of a table, such as: ` + strings.Join(common.Config.AllowEngines, ","),
 			Case:     "create table test(`id` int(11) NOT NULL AUTO_INCREMENT)",
 			Func:     (*Query4Audit).RuleAllowEngine,
+			TiSafe:   true,
 		},
 		"TBL.003": {
 			Item:     "TBL.003",
@@ -1181,6 +1317,7 @@ func InitHeuristicRules() {
 			Content:  `AUTO_INCREMENT is not 0 will cause data holes. `,
 			Case:     "CREATE TABLE tbl (a int) AUTO_INCREMENT = 10;",
 			Func:     (*Query4Audit).RuleAutoIncrementInitNotZero,
+			TiSafe:   true,
 		},
 		"TBL.005": {
 			Item:     "TBL.005",
@@ -1189,6 +1326,7 @@ func InitHeuristicRules() {
 			Content:  `The table character set is only allowed to be set to'` + strings.Join(common.Config.AllowCharsets, ",") + "'",
 			Case:     "CREATE TABLE tbl (a int) DEFAULT CHARSET = latin1;",
 			Func:     (*Query4Audit).RuleTableCharsetCheck,
+			TiSafe:   true,
 		},
 		"TBL.006": {
 			Item:     "TBL.006",
@@ -1197,6 +1335,7 @@ func InitHeuristicRules() {
 			Content:  `View is not recommended`,
 			Case:     "create view v_today (today) AS SELECT CURRENT_DATE;",
 			Func:     (*Query4Audit).RuleForbiddenView,
+			TiSafe:   true,
 		},
 		"TBL.007": {
 			Item:     "TBL.007",
@@ -1205,6 +1344,7 @@ func InitHeuristicRules() {
 			Content:  `Temporary tables are not recommended`,
 			Case:     "CREATE TEMPORARY TABLE `work` (`time` time DEFAULT NULL) ENGINE=InnoDB;",
 			Func:     (*Query4Audit).RuleForbiddenTempTable,
+			TiSafe:   true,
 		},
 		"TBL.008": {
 			Item:     "TBL.008",
@@ -1213,8 +1353,19 @@ func InitHeuristicRules() {
 			Content:  `COLLATE is only allowed to be set to'` + strings.Join(common.Config.AllowCollates, ",") + "'",
 			Case:     "CREATE TABLE tbl (a int) DEFAULT COLLATE = latin1_bin;",
 			Func:     (*Query4Audit).RuleTableCharsetCheck,
+			TiSafe:   true,
 		},
 	}
+
+	// 通过 RegisterRule 注册的规则不随配置重新初始化而丢失
+	for item, rule := range registeredRules {
+		HeuristicRules[item] = rule
+	}
+}
+
+// isMySQLError 判断是否为 MySQL 执行报错，ERR.004 仅提示未能评审的规则，不计入报错也不影响评分
+func isMySQLError(item string) bool {
+	return strings.HasPrefix(item, "ERR") && item != "ERR.004"
 }
 
 // IsIgnoreRule 判断是否是过滤规则
@@ -1324,7 +1475,7 @@ func FormatSuggest(sql string, currentDB string, format string, suggests ...map[
 			}
 		}
 
-	case "markdown", "html", "explain-digest", "duplicate-key-checker":
+	case "markdown", "html", "explain-digest", "duplicate-key-checker", "unused-index-checker":
 		if sql != "" && len(suggest) > 0 {
 			switch common.Config.ExplainSQLReportType {
 			case "fingerprint":
@@ -1342,7 +1493,7 @@ func FormatSuggest(sql string, currentDB string, format string, suggests ...map[
 		common.Log.Debug("FormatSuggest, start of sortedMySQLSuggest")
 		var sortedMySQLSuggest []string
 		for item := range suggest {
-			if strings.HasPrefix(item, "ERR") {
+			if isMySQLError(item) {
 				if suggest[item].Content == "" {
 					delete(suggest, item)
 				} else {
@@ -1394,7 +1545,14 @@ func FormatSuggest(sql string, currentDB string, format string, suggests ...map[
 			buf = append(buf, "## Profiling信息\n")
 		}
 		for _, item := range sortedProfilingSuggest {
-			buf = append(buf, fmt.Sprintln(suggest[item].Content))
+			// PRO.001 为 Profiling 结果，其他为基于 Profiling 结果给出的建议
+			if suggest[item].Summary != "" {
+				buf = append(buf, fmt.Sprintln("### ", suggest[item].Summary))
+				buf = append(buf, fmt.Sprintln(suggest[item].Content))
+				buf = append(buf, fmt.Sprint(suggest[item].Case, "\n"))
+			} else {
+				buf = append(buf, fmt.Sprintln(suggest[item].Content))
+			}
 			delete(suggest, item)
 		}
 
@@ -1437,9 +1595,15 @@ func FormatSuggest(sql string, currentDB string, format string, suggests ...map[
 			}
 			buf = append(buf, fmt.Sprintln("* **Content:** ", common.MarkdownEscape(suggest[item].Content)))
 
-			if format == "duplicate-key-checker" {
+			switch format {
+			case "duplicate-key-checker":
 				buf = append(buf, fmt.Sprintf("* **原建表语句:** \n```sql\n%s\n```\n", suggest[item].Case), "\n\n")
-			} else {
+			case "unused-index-checker":
+				if suggest[item].Case != "" {
+					buf = append(buf, fmt.Sprintf("* **设置为不可见索引:** \n```sql\n%s\n```\n", suggest[item].Case))
+				}
+				buf = append(buf, "\n\n")
+			default:
 				buf = append(buf, fmt.Sprint("* **Case:** ", common.MarkdownEscape(suggest[item].Case), "\n\n"))
 			}
 		}
@@ -1470,6 +1634,9 @@ func FormatSuggest(sql string, currentDB string, format string, suggests ...map[
 				score = 0
 			}
 			buf = append(buf, fmt.Sprintln("* **Content:** ", common.MarkdownEscape(suggest[item].Content)))
+			if suggest[item].URL != "" {
+				buf = append(buf, fmt.Sprintln("* **URL:** ", suggest[item].URL))
+			}
 			// buf = append(buf, fmt.Sprint("* **Case:** ", common.MarkdownEscape(suggest[item].Case), "\n\n"))
 		}
 
@@ -1522,7 +1689,7 @@ func formatJSON(sql string, db string, suggest map[string]Rule) string {
 		}
 		score = score - l*5
 		// ## MySQL execute failed
-		if strings.HasPrefix(item, "ERR") && suggest[item].Content != "" {
+		if isMySQLError(item) && suggest[item].Content != "" {
 			score = 0
 		}
 	}
@@ -1603,8 +1770,11 @@ func ListHeuristicRules(rules ...map[string]Rule) {
 				fmt.Print("## ", common.MarkdownEscape(r[item].Summary),
 					"\n\n* **Item**:", r[item].Item,
 					"\n* **Severity**:", r[item].Severity,
-					"\n* **Content**:", common.MarkdownEscape(r[item].Content),
-					"\n* **Case**:\n\n```sql\n", r[item].Case, "\n```\n")
+					"\n* **Content**:", common.MarkdownEscape(r[item].Content))
+				if r[item].URL != "" {
+					fmt.Print("\n* **URL**:", r[item].URL)
+				}
+				fmt.Print("\n* **Case**:\n\n```sql\n", r[item].Case, "\n```\n")
 			}
 		}
 	}
@@ -0,0 +1,230 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package advisor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/XiaoMi/soar/common"
+	"github.com/XiaoMi/soar/database"
+)
+
+// UnusedIndex 未使用或很少使用的索引
+type UnusedIndex struct {
+	Name       string   // 索引名
+	Columns    []string // 索引列，函数索引为表达式
+	Reads      int64    // 实例启动以来通过该索引读取的行数
+	Size       int64    // 索引大小（字节），未知时为 -1
+	Constraint string   // 索引支撑的约束 PRIMARY KEY, UNIQUE, FOREIGN KEY，为空时可以设置为不可见索引
+	Invisible  bool     // 已经是不可见索引
+}
+
+// UnusedIndexChecker 根据 performance_schema 中的统计信息检查未使用或很少使用的索引
+func UnusedIndexChecker(conn *database.Connector, databases ...string) map[string]Rule {
+	common.Log.Debug("Enter:  UnusedIndexChecker, Caller: %s", common.Caller())
+	// 复制一份online connector,防止环境切换影响其他功能的使用
+	tmpOnline := *conn
+	ruleMap := make(map[string]Rule)
+	number := 1
+
+	// 错误处理，用于汇总所有的错误
+	funcErrCheck := func(err error) {
+		if err != nil {
+			if sug, ok := ruleMap["ERR.003"]; ok {
+				sug.Content += fmt.Sprintf("; %s", err.Error())
+				ruleMap["ERR.003"] = sug
+			} else {
+				ruleMap["ERR.003"] = Rule{
+					Item:     "ERR.003",
+					Severity: "L8",
+					Content:  err.Error(),
+				}
+			}
+		}
+	}
+
+	uptime, err := tmpOnline.Uptime()
+	if err != nil {
+		funcErrCheck(err)
+		if !common.Config.DryRun {
+			return ruleMap
+		}
+	}
+	version, err := tmpOnline.Version()
+	common.LogIfWarn(err, "")
+
+	// 不指定 DB 的时候检查 online dsn 中的 DB
+	if len(databases) == 0 {
+		databases = append(databases, tmpOnline.Database)
+	}
+
+	for _, db := range databases {
+		usage, err := tmpOnline.ShowIndexUsage(db)
+		if err != nil {
+			funcErrCheck(err)
+			if !common.Config.DryRun {
+				return ruleMap
+			}
+			continue
+		}
+
+		// 获取所有的表
+		tmpOnline.Database = db
+		tables, err := tmpOnline.ShowTables()
+		if err != nil {
+			funcErrCheck(err)
+			if !common.Config.DryRun {
+				return ruleMap
+			}
+		}
+
+		for _, tb := range tables {
+			idxInfo, err := tmpOnline.ShowIndex(tb)
+			if err != nil {
+				funcErrCheck(err)
+				if !common.Config.DryRun {
+					return ruleMap
+				}
+				continue
+			}
+
+			unused := findUnusedIndexes(tb, idxInfo, usage, uptime, func(col string) bool {
+				return tmpOnline.IsForeignKey(db, tb, col)
+			})
+			if len(unused) == 0 {
+				continue
+			}
+
+			key := fmt.Sprintf("IDX.%03d", number)
+			ruleMap[key] = Rule{
+				Item:     key,
+				Severity: "L2",
+				Summary:  fmt.Sprintf("%s.%s存在未使用或很少使用的索引", db, tb),
+				Content:  formatUnusedIndexes(unused, uptime, version),
+				Case:     invisibleIndexDDL(db, tb, unused, version),
+			}
+			number++
+		}
+	}
+
+	return ruleMap
+}
+
+// findUnusedIndexes 找出表中自启动以来未被读取，或按运行时长折算平均每天读取行数低于 -min-index-reads 的索引
+func findUnusedIndexes(tb string, idxInfo *database.TableIndexInfo, usage *database.IndexUsageInfo, uptime int64, isForeignKey func(col string) bool) []UnusedIndex {
+	var unused []UnusedIndex
+	// 索引名 -> 在 unused 中的下标，不需要关注的索引为 -1
+	indexes := make(map[string]int)
+	for _, row := range idxInfo.Rows {
+		i, ok := indexes[row.KeyName]
+		if !ok {
+			i = -1
+			reads, ok := usage.IndexReads(tb, row.KeyName)
+			if ok && lowReads(reads, uptime) {
+				idx := UnusedIndex{
+					Name:      row.KeyName,
+					Reads:     reads,
+					Size:      usage.IndexSize(tb, row.KeyName),
+					Invisible: strings.EqualFold(row.Visible, "NO"),
+				}
+				switch {
+				case row.KeyName == "PRIMARY":
+					idx.Constraint = "PRIMARY KEY"
+				case row.NonUnique == 0:
+					idx.Constraint = "UNIQUE"
+				}
+				unused = append(unused, idx)
+				i = len(unused) - 1
+			}
+			indexes[row.KeyName] = i
+		}
+		if i < 0 {
+			continue
+		}
+		idx := &unused[i]
+
+		col := row.ColumnName
+		if col == "" && len(row.Expression) > 0 {
+			col = fmt.Sprintf("(%s)", row.Expression)
+		}
+		idx.Columns = append(idx.Columns, col)
+		// InnoDB 要求外键列是某个索引的最左前缀，保守起见首列为外键列的索引都认为可能支撑着外键
+		if row.SeqInIndex == 1 && idx.Constraint == "" && row.ColumnName != "" && isForeignKey(row.ColumnName) {
+			idx.Constraint = "FOREIGN KEY"
+		}
+	}
+	return unused
+}
+
+// lowReads 判断读取次数是否低于阈值，无法获取运行时长时只认为从未读取的索引未被使用
+func lowReads(reads, uptime int64) bool {
+	if reads == 0 {
+		return true
+	}
+	if uptime <= 0 {
+		return false
+	}
+	return float64(reads)*86400/float64(uptime) < float64(common.Config.MinIdxReads)
+}
+
+// formatUnusedIndexes 输出未使用的索引的读取次数、大小及约束信息
+func formatUnusedIndexes(unused []UnusedIndex, uptime int64, version int) string {
+	var buf []string
+	if uptime > 0 {
+		buf = append(buf, fmt.Sprintf("实例已运行%.1f小时", float64(uptime)/3600))
+		if uptime < 86400 {
+			buf[0] += "，统计时间不足一天，结果仅供参考"
+		}
+	}
+	for _, idx := range unused {
+		content := fmt.Sprintf("索引%s(%s)读取%d行", idx.Name, strings.Join(idx.Columns, ", "), idx.Reads)
+		if idx.Size >= 0 {
+			content += fmt.Sprintf("，大小%.2f MB", float64(idx.Size)/1024/1024)
+		}
+		switch {
+		case idx.Constraint != "":
+			content += fmt.Sprintf("，支撑%s约束，不能直接删除", idx.Constraint)
+		case idx.Invisible:
+			content += "，已是不可见索引，确认无影响后可以删除"
+		case !supportInvisibleIndex(version):
+			content += "，当前版本不支持不可见索引，删除前请充分评估"
+		}
+		buf = append(buf, content)
+	}
+	return strings.Join(buf, "; ")
+}
+
+// invisibleIndexDDL 为可以安全测试的索引生成设置为不可见索引的语句
+func invisibleIndexDDL(db, tb string, unused []UnusedIndex, version int) string {
+	if !supportInvisibleIndex(version) {
+		return ""
+	}
+	var ddl []string
+	for _, idx := range unused {
+		if idx.Constraint != "" || idx.Invisible {
+			continue
+		}
+		ddl = append(ddl, fmt.Sprintf("ALTER TABLE `%s`.`%s` ALTER INDEX `%s` INVISIBLE;", db, tb, idx.Name))
+	}
+	return strings.Join(ddl, "\n")
+}
+
+// supportInvisibleIndex MySQL 8.0 开始支持不可见索引，MariaDB 的版本号从 10 开始，不支持该语法
+func supportInvisibleIndex(version int) bool {
+	return version >= 80000 && version < 100000
+}
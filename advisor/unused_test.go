@@ -0,0 +1,94 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package advisor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+	"github.com/XiaoMi/soar/database"
+)
+
+func TestFindUnusedIndexes(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	orgMinIdxReads := common.Config.MinIdxReads
+	common.Config.MinIdxReads = 10
+
+	idxInfo := &database.TableIndexInfo{
+		Rows: []database.TableIndexRow{
+			{KeyName: "PRIMARY", NonUnique: 0, SeqInIndex: 1, ColumnName: "film_id"},
+			{KeyName: "uk_title", NonUnique: 0, SeqInIndex: 1, ColumnName: "title"},
+			{KeyName: "idx_language_id", NonUnique: 1, SeqInIndex: 1, ColumnName: "language_id"},
+			{KeyName: "idx_rating", NonUnique: 1, SeqInIndex: 1, ColumnName: "rating"},
+			{KeyName: "idx_rating", NonUnique: 1, SeqInIndex: 2, ColumnName: "rental_rate"},
+			{KeyName: "idx_year", NonUnique: 1, SeqInIndex: 1, ColumnName: "release_year", Visible: "NO"},
+			{KeyName: "idx_length", NonUnique: 1, SeqInIndex: 1, ColumnName: "length"},
+		},
+	}
+	usage := &database.IndexUsageInfo{
+		Source: database.IndexUsageFromPerformanceSchema,
+		Reads: map[string]map[string]int64{
+			"film": {"PRIMARY": 0, "uk_title": 0, "idx_language_id": 0, "idx_rating": 5, "idx_length": 100000},
+		},
+		Sizes: map[string]map[string]int64{
+			"film": {"idx_rating": 2 * 1024 * 1024},
+		},
+	}
+	isForeignKey := func(col string) bool { return col == "language_id" }
+
+	// 运行两天，idx_rating 平均每天读取 2.5 行，idx_year 在 performance_schema 中无记录
+	unused := findUnusedIndexes("film", idxInfo, usage, 2*86400, isForeignKey)
+	var names []string
+	for _, idx := range unused {
+		names = append(names, idx.Name+":"+idx.Constraint)
+	}
+	if strings.Join(names, ",") != "PRIMARY:PRIMARY KEY,uk_title:UNIQUE,idx_language_id:FOREIGN KEY,idx_rating:,idx_year:" {
+		t.Errorf("findUnusedIndexes got %v", names)
+	}
+	if len(unused) != 5 || strings.Join(unused[3].Columns, ",") != "rating,rental_rate" || unused[3].Size != 2*1024*1024 || !unused[4].Invisible {
+		t.Errorf("findUnusedIndexes got %v", unused)
+	}
+
+	ddl := invisibleIndexDDL("sakila", "film", unused, 80023)
+	if ddl != "ALTER TABLE `sakila`.`film` ALTER INDEX `idx_rating` INVISIBLE;" {
+		t.Errorf("invisibleIndexDDL got %s", ddl)
+	}
+	if invisibleIndexDDL("sakila", "film", unused, 50730) != "" || invisibleIndexDDL("sakila", "film", unused, 100612) != "" {
+		t.Error("invisibleIndexDDL should return empty before MySQL 8.0 and on MariaDB")
+	}
+
+	content := formatUnusedIndexes(unused, 2*86400, 80023)
+	if !strings.Contains(content, "实例已运行48.0小时") ||
+		!strings.Contains(content, "索引idx_rating(rating, rental_rate)读取5行，大小2.00 MB") ||
+		!strings.Contains(content, "索引uk_title(title)读取0行，支撑UNIQUE约束") {
+		t.Errorf("formatUnusedIndexes got %s", content)
+	}
+
+	// sys.schema_unused_indexes 中只有未使用的索引，不在其中的索引不能认为未被使用
+	usage = &database.IndexUsageInfo{
+		Source: database.IndexUsageFromSys,
+		Reads:  map[string]map[string]int64{"film": {"idx_rating": 0}},
+	}
+	unused = findUnusedIndexes("film", idxInfo, usage, 0, isForeignKey)
+	if len(unused) != 1 || unused[0].Name != "idx_rating" || unused[0].Size != -1 {
+		t.Errorf("findUnusedIndexes with sys schema got %v", unused)
+	}
+
+	common.Config.MinIdxReads = orgMinIdxReads
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package advisor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/XiaoMi/soar/common"
+	"github.com/XiaoMi/soar/database"
+)
+
+// IndexValidation 在测试环境中添加索引前后的执行计划对比
+type IndexValidation struct {
+	Before     database.ExplainRow `json:"before"`      // 添加索引前，使用该索引的表对应的执行计划
+	After      database.ExplainRow `json:"after"`       // 添加索引后使用该索引的执行计划
+	BeforeCost float64             `json:"before_cost"` // 添加索引前的 last_query_cost，未开启 -show-last-query-cost 时为 0
+	AfterCost  float64             `json:"after_cost"`  // 添加索引后的 last_query_cost
+}
+
+// ValidateIndexAdvise 在测试环境中逐条临时添加建议的索引后重新 EXPLAIN，与原执行计划对比
+// 优化器没有使用的索引建议将被剔除，未开启 -validate-index 或测试环境不可用时原样返回
+func (idxAdv *IndexAdvisor) ValidateIndexAdvise(sql string, advises IndexAdvises) IndexAdvises {
+	if !common.Config.ValidateIndex || len(advises) == 0 ||
+		common.Config.TestDSN.Disable || idxAdv.vEnv.Offline() {
+		return advises
+	}
+
+	var indexes IndexAdvises
+	for _, idx := range advises {
+		// 删除索引的建议无需验证
+		if idx.Drop {
+			indexes = append(indexes, idx)
+			continue
+		}
+
+		// 索引建议中使用的是线上环境的库名，根据索引信息为测试环境中的表重新生成 DDL
+		table := fmt.Sprintf("`%s`.`%s`", idx.Database, idx.Table)
+		vTable := fmt.Sprintf("`%s`.`%s`", idxAdv.vEnv.DBHash(idx.Database), idx.Table)
+		ddl := idx.addIndexSQL(vTable)
+		rollback := fmt.Sprintf("alter table %s drop index `%s`", vTable, idx.Name)
+		if idx.Generated != "" {
+			rollback += fmt.Sprintf(", drop column `%s`", idx.Generated)
+		}
+
+		// 添加索引前的执行计划与临时索引在同一次加锁中获取，避免受其他并发评审的临时索引影响
+		before, after, err := idxAdv.vEnv.HypotheticalExplain(sql, ddl, rollback)
+		if err != nil {
+			// 无法验证时保留原建议
+			common.Log.Warning("ValidateIndexAdvise '%s' Error: %v", ddl, err)
+			indexes = append(indexes, idx)
+			continue
+		}
+
+		validation := compareExplain(idx.Name, before, after)
+		if validation == nil {
+			common.Log.Info("index %s on %s is not used by optimizer, SQL: %s", idx.Name, table, sql)
+			continue
+		}
+		idx.Validation = validation
+		indexes = append(indexes, idx)
+	}
+	return indexes
+}
+
+// addIndexSQL 根据索引信息生成在 table 上添加该索引的 DDL，table 为已转义的表名
+func (idx IndexInfo) addIndexSQL(table string) string {
+	if idx.Generated != "" {
+		return fmt.Sprintf("alter table %s add column `%s` %s, add index `%s` (`%s`)",
+			table, idx.Generated, idx.generatedDef, idx.Name, idx.Generated)
+	}
+	if idx.Expression != "" {
+		return fmt.Sprintf("alter table %s add index `%s` ((%s))", table, idx.Name, idx.Expression)
+	}
+	var defs []string
+	for _, col := range idx.ColumnDetails {
+		def := fmt.Sprintf("`%s`", col.Name)
+		if col.SubPart > 0 {
+			def += fmt.Sprintf("(%d)", col.SubPart)
+		}
+		if col.Desc {
+			def += " DESC"
+		}
+		defs = append(defs, def)
+	}
+	return fmt.Sprintf("alter table %s add index `%s` (%s)", table, idx.Name, strings.Join(defs, ","))
+}
+
+// compareExplain 查找添加索引后使用了该索引的执行计划，与添加前同一张表的执行计划对比，未使用该索引时返回 nil
+func compareExplain(name string, before, after *database.ExplainInfo) *IndexValidation {
+	for _, row := range after.ExplainRows {
+		// index_merge 时 key 中会有多个索引
+		for _, key := range strings.Split(row.Key, ",") {
+			if key != name {
+				continue
+			}
+			validation := &IndexValidation{
+				After:      row,
+				BeforeCost: before.QueryCost,
+				AfterCost:  after.QueryCost,
+			}
+			for _, b := range before.ExplainRows {
+				if b.ID == row.ID && b.TableName == row.TableName {
+					validation.Before = b
+					break
+				}
+			}
+			return validation
+		}
+	}
+	return nil
+}
+
+// formatIndexValidation 以表格形式输出添加索引前后的执行计划对比
+func formatIndexValidation(name string, v *IndexValidation) string {
+	cost := func(c float64) string {
+		if c <= 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.3f", c)
+	}
+	key := func(k string) string {
+		if k == "" {
+			return "NULL"
+		}
+		return k
+	}
+	buf := []string{
+		fmt.Sprintf("索引%s添加前后的执行计划对比：", name),
+		"",
+		"| | type | key | rows | query cost |",
+		"|---|---|---|---|---|",
+		fmt.Sprintf("| 添加前 | %s | %s | %d | %s |", v.Before.AccessType, key(v.Before.Key), v.Before.Rows, cost(v.BeforeCost)),
+		fmt.Sprintf("| 添加后 | %s | %s | %d | %s |", v.After.AccessType, key(v.After.Key), v.After.Rows, cost(v.AfterCost)),
+	}
+	return strings.Join(buf, "\n")
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package advisor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+	"github.com/XiaoMi/soar/database"
+)
+
+func TestCompareExplain(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	before := &database.ExplainInfo{
+		ExplainRows: []database.ExplainRow{
+			{ID: 1, TableName: "f", AccessType: "ALL", Rows: 1000},
+			{ID: 1, TableName: "l", AccessType: "eq_ref", Key: "PRIMARY", Rows: 1},
+		},
+		QueryCost: 201.5,
+	}
+	after := &database.ExplainInfo{
+		ExplainRows: []database.ExplainRow{
+			{ID: 1, TableName: "f", AccessType: "index_merge", Key: "idx_title,idx_language_id", Rows: 12},
+			{ID: 1, TableName: "l", AccessType: "eq_ref", Key: "PRIMARY", Rows: 1},
+		},
+		QueryCost: 15.2,
+	}
+
+	v := compareExplain("idx_language_id", before, after)
+	if v == nil || v.Before.AccessType != "ALL" || v.After.Rows != 12 || v.BeforeCost != 201.5 {
+		t.Errorf("compareExplain got %v", v)
+	}
+	if compareExplain("idx_rating", before, after) != nil {
+		t.Error("idx_rating is not used, compareExplain should return nil")
+	}
+
+	plan := formatIndexValidation("idx_language_id", v)
+	if !strings.Contains(plan, "| 添加前 | ALL | NULL | 1000 | 201.500 |") ||
+		!strings.Contains(plan, "| 添加后 | index_merge | idx_title,idx_language_id | 12 | 15.200 |") {
+		t.Errorf("formatIndexValidation got %s", plan)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestAddIndexSQL(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	vTable := "`optimizer_abc`.`film`"
+	cases := []struct {
+		idx  IndexInfo
+		want string
+	}{
+		// 库名未知时建议中的 DDL 不带库名，验证时仍需在测试环境的库中添加
+		{
+			IndexInfo{Name: "idx_title", Table: "film", DDL: "alter table `film` add index `idx_title` (`title`)",
+				ColumnDetails: []*common.Column{{Name: "title"}}},
+			"alter table `optimizer_abc`.`film` add index `idx_title` (`title`)",
+		},
+		{
+			IndexInfo{Name: "idx_a_b_c", ColumnDetails: []*common.Column{{Name: "a"}, {Name: "b", SubPart: 10}, {Name: "c", Desc: true}}},
+			"alter table `optimizer_abc`.`film` add index `idx_a_b_c` (`a`,`b`(10),`c` DESC)",
+		},
+		{
+			IndexInfo{Name: "idx_lower_title", Expression: "lower(title)", ColumnDetails: []*common.Column{{Name: "title"}}},
+			"alter table `optimizer_abc`.`film` add index `idx_lower_title` ((lower(title)))",
+		},
+		{
+			IndexInfo{Name: "idx_gc_lower_title", Expression: "lower(title)", Generated: "gc_lower_title",
+				generatedDef: "varchar(255) generated always as (lower(title)) virtual"},
+			"alter table `optimizer_abc`.`film` add column `gc_lower_title` varchar(255) generated always as (lower(title)) virtual, add index `idx_gc_lower_title` (`gc_lower_title`)",
+		},
+	}
+	for _, c := range cases {
+		if got := c.idx.addIndexSQL(vTable); got != c.want {
+			t.Errorf("%s want:\n%s\ngot:\n%s", c.idx.Name, c.want, got)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
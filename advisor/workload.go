@@ -0,0 +1,277 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package advisor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/XiaoMi/soar/ast"
+	"github.com/XiaoMi/soar/common"
+	"github.com/XiaoMi/soar/database"
+)
+
+// WorkloadQuery 工作负载中的一类 SQL，相同 fingerprint 的 SQL 归为一类
+type WorkloadQuery struct {
+	ID    string `json:"id"`    // fingerprint.ID
+	Query string `json:"query"` // 第一次出现的 SQL
+	Count int    `json:"count"` // 在工作负载中出现的次数
+}
+
+// WorkloadIndex 工作负载索引建议中的一条索引
+type WorkloadIndex struct {
+	IndexInfo
+	Queries []*WorkloadQuery `json:"queries"` // 该索引能够服务的 SQL
+}
+
+// Weight 索引的权重，即其服务的 SQL 在工作负载中出现次数之和
+func (idx *WorkloadIndex) Weight() int {
+	weight := 0
+	for _, q := range idx.Queries {
+		weight += q.Count
+	}
+	return weight
+}
+
+// serve 将 SQL 添加到索引服务的列表中
+func (idx *WorkloadIndex) serve(queries ...*WorkloadQuery) {
+	for _, q := range queries {
+		has := false
+		for _, s := range idx.Queries {
+			if s.ID == q.ID {
+				has = true
+				break
+			}
+		}
+		if !has {
+			idx.Queries = append(idx.Queries, q)
+		}
+	}
+}
+
+// WorkloadTableAdvise 工作负载中单张表的索引建议
+type WorkloadTableAdvise struct {
+	Database string           `json:"database"` // 数据库名
+	Table    string           `json:"table"`    // 表名
+	DDL      string           `json:"ddl"`      // 合并后的 ALTER 语句
+	Existed  int              `json:"existed"`  // 表上已存在的索引数
+	Indexes  []*WorkloadIndex `json:"indexes"`  // 采纳的索引
+	Dropped  []*WorkloadIndex `json:"dropped"`  // 超出 MaxIdxCount 限制未被采纳的索引
+}
+
+// WorkloadIndexAdvisor 以整个工作负载为单位给出索引建议
+// 逐条 SQL 的索引建议会相互重叠，且无法感知单表索引个数限制，这里汇总所有 SQL 的候选索引后统一取舍
+type WorkloadIndexAdvisor struct {
+	queries    map[string]*WorkloadQuery
+	tables     []string                    // 按出现顺序记录的 db.table
+	candidates map[string][]*WorkloadIndex // key 为 db.table
+	existed    map[string]int              // 表上已存在的索引数，key 为 db.table
+}
+
+// NewWorkloadIndexAdvisor 初始化工作负载索引建议
+func NewWorkloadIndexAdvisor() *WorkloadIndexAdvisor {
+	return &WorkloadIndexAdvisor{
+		queries:    make(map[string]*WorkloadQuery),
+		candidates: make(map[string][]*WorkloadIndex),
+		existed:    make(map[string]int),
+	}
+}
+
+// Add 记录一条 SQL，相同 fingerprint 的 SQL 只累加出现次数
+// 首次出现时返回 true，调用方需要继续通过 AddAdvises 添加该 SQL 的索引建议
+func (w *WorkloadIndexAdvisor) Add(id, sql string) bool {
+	if q, ok := w.queries[id]; ok {
+		q.Count++
+		return false
+	}
+	w.queries[id] = &WorkloadQuery{ID: id, Query: sql, Count: 1}
+	return true
+}
+
+// AddAdvises 添加单条 SQL 的候选索引，idxAdv 用于获取表上已存在的索引数，可以为 nil
+func (w *WorkloadIndexAdvisor) AddAdvises(id string, idxAdv *IndexAdvisor, advises IndexAdvises) {
+	q, ok := w.queries[id]
+	if !ok {
+		return
+	}
+	for _, advise := range advises {
+		// 只关注添加索引的建议，删除冗余索引、可选的覆盖索引及函数索引建议不参与取舍
+		// 含有降序列的索引建议通过 isKeyPartsPart 比较排序方向，只与方向一致的左前缀索引合并
+		if len(advise.ColumnDetails) == 0 || advise.Covering || advise.Expression != "" || advise.Drop {
+			continue
+		}
+		key := fmt.Sprintf("`%s`.`%s`", advise.Database, advise.Table)
+		if _, ok := w.candidates[key]; !ok {
+			w.tables = append(w.tables, key)
+		}
+		if idxAdv != nil && idxAdv.vEnv != nil {
+			if indexMeta := idxAdv.IndexMeta[idxAdv.vEnv.DBHash(advise.Database)][advise.Table]; indexMeta != nil {
+				w.existed[key] = existedIndexCount(indexMeta)
+			}
+		}
+
+		has := false
+		for _, idx := range w.candidates[key] {
+			if len(idx.ColumnDetails) == len(advise.ColumnDetails) &&
+				isKeyPartsPart(idx.ColumnDetails, advise.ColumnDetails) {
+				idx.serve(q)
+				has = true
+				break
+			}
+		}
+		if !has {
+			w.candidates[key] = append(w.candidates[key], &WorkloadIndex{
+				IndexInfo: advise,
+				Queries:   []*WorkloadQuery{q},
+			})
+		}
+	}
+}
+
+// isKeyPartsPart 在 common.IsColsPart 的基础上要求前缀长度和排序方向也一致
+// idx(a(10)) 和 idx(a DESC) 都不能代替 idx(a)，仅用于负载索引建议的合并
+func isKeyPartsPart(a, b []*common.Column) bool {
+	if !common.IsColsPart(a, b) {
+		return false
+	}
+	times := len(a)
+	if len(b) < times {
+		times = len(b)
+	}
+	for i := 0; i < times; i++ {
+		if a[i].SubPart != b[i].SubPart || a[i].Desc != b[i].Desc {
+			return false
+		}
+	}
+	return true
+}
+
+// existedIndexCount 表上已存在的索引数
+func existedIndexCount(indexMeta *database.TableIndexInfo) int {
+	keys := make(map[string]bool)
+	for _, row := range indexMeta.Rows {
+		keys[row.KeyName] = true
+	}
+	return len(keys)
+}
+
+// Advise 合并左前缀兼容的候选索引，并按权重在 MaxIdxCount 限制内为每张表挑选索引
+func (w *WorkloadIndexAdvisor) Advise() []WorkloadTableAdvise {
+	var advises []WorkloadTableAdvise
+	for _, key := range w.tables {
+		candidates := w.candidates[key]
+		advise := WorkloadTableAdvise{
+			Database: candidates[0].Database,
+			Table:    candidates[0].Table,
+			Existed:  w.existed[key],
+		}
+
+		// 列多的索引优先保留，其左前缀索引服务的 SQL 都可以由它来服务
+		sorted := make([]*WorkloadIndex, len(candidates))
+		copy(sorted, candidates)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return len(sorted[i].ColumnDetails) > len(sorted[j].ColumnDetails)
+		})
+		var merged []*WorkloadIndex
+		for _, idx := range sorted {
+			has := false
+			for _, m := range merged {
+				if isKeyPartsPart(idx.ColumnDetails, m.ColumnDetails) {
+					common.Log.Debug("merge index %s into %s", idx.Name, m.Name)
+					m.serve(idx.Queries...)
+					has = true
+					break
+				}
+			}
+			if !has {
+				merged = append(merged, &WorkloadIndex{
+					IndexInfo: idx.IndexInfo,
+					Queries:   append([]*WorkloadQuery{}, idx.Queries...),
+				})
+			}
+		}
+
+		// 按服务的 SQL 出现次数挑选索引，直到达到单表索引个数上限
+		sort.SliceStable(merged, func(i, j int) bool {
+			return merged[i].Weight() > merged[j].Weight()
+		})
+		budget := common.Config.MaxIdxCount - advise.Existed
+		if budget < 0 {
+			budget = 0
+		}
+		if len(merged) > budget {
+			advise.Indexes, advise.Dropped = merged[:budget], merged[budget:]
+		} else {
+			advise.Indexes = merged
+		}
+
+		var ddl []string
+		for _, idx := range advise.Indexes {
+			ddl = append(ddl, idx.DDL)
+		}
+		// 同一张表的 ALTER 合并后只会有一条
+		for _, v := range ast.MergeAlterTables(ddl...) {
+			advise.DDL = strings.TrimSpace(v)
+		}
+		advises = append(advises, advise)
+	}
+	return advises
+}
+
+// FormatWorkloadAdvise 以 markdown 格式输出工作负载索引建议
+func FormatWorkloadAdvise(advises []WorkloadTableAdvise) string {
+	var buf []string
+	buf = append(buf, "# 工作负载索引建议\n")
+	if len(advises) == 0 {
+		buf = append(buf, "未发现需要添加的索引。\n")
+		return strings.Join(buf, "\n")
+	}
+
+	for _, advise := range advises {
+		buf = append(buf, fmt.Sprintf("## `%s`.`%s`\n", advise.Database, advise.Table))
+		if advise.DDL != "" {
+			buf = append(buf, fmt.Sprintf("```sql\n%s\n```\n", advise.DDL))
+		}
+		for _, idx := range advise.Indexes {
+			buf = append(buf, fmt.Sprintf("* **%s** (%s) 服务 %d 类 SQL，共出现 %d 次",
+				idx.Name, common.JoinColumnsName(idx.ColumnDetails, ", "), len(idx.Queries), idx.Weight()))
+			buf = append(buf, formatWorkloadQueries(idx.Queries)...)
+		}
+		if len(advise.Dropped) > 0 {
+			buf = append(buf, "")
+			buf = append(buf, fmt.Sprintf("以下索引超出单表索引个数限制 (max-index-count: %d，已有索引: %d)，未被采纳：\n",
+				common.Config.MaxIdxCount, advise.Existed))
+			for _, idx := range advise.Dropped {
+				buf = append(buf, fmt.Sprintf("* %s (%s) 服务 %d 类 SQL，共出现 %d 次",
+					idx.Name, common.JoinColumnsName(idx.ColumnDetails, ", "), len(idx.Queries), idx.Weight()))
+				buf = append(buf, formatWorkloadQueries(idx.Queries)...)
+			}
+		}
+		buf = append(buf, "")
+	}
+	return strings.Join(buf, "\n")
+}
+
+// formatWorkloadQueries 列出索引服务的 SQL
+func formatWorkloadQueries(queries []*WorkloadQuery) []string {
+	var buf []string
+	for _, q := range queries {
+		buf = append(buf, fmt.Sprintf("    * [%s] (%d 次) `%s`", q.ID, q.Count, ast.Compress(q.Query)))
+	}
+	return buf
+}
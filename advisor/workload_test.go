@@ -0,0 +1,160 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package advisor
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+// workloadIndex 构造 sakila.film 表上的添加索引建议
+func workloadIndex(cols ...string) IndexInfo {
+	var details []*common.Column
+	for _, col := range cols {
+		details = append(details, &common.Column{Name: col, DB: "sakila", Table: "film"})
+	}
+	name := "idx_" + strings.Join(cols, "_")
+	return IndexInfo{
+		Name:          name,
+		Database:      "sakila",
+		Table:         "film",
+		DDL:           fmt.Sprintf("alter table `sakila`.`film` add index `%s` (`%s`)", name, strings.Join(cols, "`,`")),
+		ColumnDetails: details,
+	}
+}
+
+func TestWorkloadIndexAdvise(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	orgMaxIdxCount := common.Config.MaxIdxCount
+	common.Config.MaxIdxCount = 2
+	defer func() { common.Config.MaxIdxCount = orgMaxIdxCount }()
+
+	w := NewWorkloadIndexAdvisor()
+	workload := []struct {
+		id      string
+		indexes []IndexInfo
+	}{
+		{"q1", []IndexInfo{workloadIndex("title")}},
+		{"q2", []IndexInfo{workloadIndex("title", "release_year")}},
+		{"q3", []IndexInfo{workloadIndex("language_id")}},
+		{"q4", []IndexInfo{workloadIndex("rating")}},
+		{"q3", nil},
+		{"q3", nil},
+		{"q4", nil},
+	}
+	for _, q := range workload {
+		if w.Add(q.id, "select * from film where "+q.id) {
+			w.AddAdvises(q.id, nil, q.indexes)
+		}
+	}
+
+	advises := w.Advise()
+	if len(advises) != 1 {
+		t.Fatalf("want 1 table, got %d", len(advises))
+	}
+	var names []string
+	for _, idx := range advises[0].Indexes {
+		names = append(names, fmt.Sprintf("%s:%d", idx.Name, idx.Weight()))
+	}
+	// idx_title 与 idx_title_release_year 左前缀兼容，合并后服务 q1, q2
+	if strings.Join(names, ",") != "idx_language_id:3,idx_title_release_year:2" {
+		t.Errorf("Indexes got %v", names)
+	}
+	if len(advises[0].Dropped) != 1 || advises[0].Dropped[0].Name != "idx_rating" {
+		t.Errorf("Dropped got %v", advises[0].Dropped)
+	}
+	if advises[0].DDL != "ALTER TABLE `sakila`.`film` add index `idx_language_id` (`language_id`), add index `idx_title_release_year` (`title`,`release_year`) ;" {
+		t.Errorf("DDL got %s", advises[0].DDL)
+	}
+	if !strings.Contains(FormatWorkloadAdvise(advises), "未被采纳") {
+		t.Error("FormatWorkloadAdvise should list dropped indexes")
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestWorkloadIndexColumnSpec(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	orgMaxIdxCount := common.Config.MaxIdxCount
+	common.Config.MaxIdxCount = 5
+	defer func() { common.Config.MaxIdxCount = orgMaxIdxCount }()
+
+	prefix := workloadIndex("title")
+	prefix.Name = "idx_title_10"
+	prefix.ColumnDetails = []*common.Column{{Name: "title", DB: "sakila", Table: "film", SubPart: 10}}
+	drop := workloadIndex("language_id")
+	drop.DDL = "alter table `sakila`.`film` drop index `idx_language_id`"
+	drop.Drop = true
+	desc := workloadIndex("rating", "rental_duration")
+	desc.Name = "idx_rating_rental_duration_desc"
+	desc.DDL = "alter table `sakila`.`film` add index `idx_rating_rental_duration_desc` (`rating`,`rental_duration` DESC)"
+	desc.ColumnDetails[1].Desc = true
+
+	w := NewWorkloadIndexAdvisor()
+	w.Add("q1", "select * from film where title = 'a'")
+	w.AddAdvises("q1", nil, IndexAdvises{workloadIndex("title"), drop})
+	w.Add("q2", "select * from film where title like 'a%'")
+	w.AddAdvises("q2", nil, IndexAdvises{prefix, desc})
+	w.Add("q3", "select * from film where rating = 'G'")
+	w.AddAdvises("q3", nil, IndexAdvises{workloadIndex("rating")})
+	w.Add("q4", "select * from film where rating = 'G' order by rental_duration limit 10")
+	w.AddAdvises("q4", nil, IndexAdvises{workloadIndex("rating", "rental_duration")})
+
+	advises := w.Advise()
+	if len(advises) != 1 {
+		t.Fatalf("want 1 table, got %d", len(advises))
+	}
+	// 前缀索引不能代替整列索引，删除索引的建议不参与取舍
+	// 降序索引可以代替方向一致的左前缀索引，不能代替排序方向不同的索引
+	var names []string
+	for _, idx := range advises[0].Indexes {
+		names = append(names, fmt.Sprintf("%s:%d", idx.Name, idx.Weight()))
+	}
+	if strings.Join(names, ",") != "idx_rating_rental_duration_desc:2,idx_rating_rental_duration:1,idx_title:1,idx_title_10:1" {
+		t.Errorf("Indexes got %v", names)
+	}
+	if !strings.Contains(advises[0].DDL, "(`rating`,`rental_duration` DESC)") {
+		t.Errorf("DDL got %s", advises[0].DDL)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestIsKeyPartsPart(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	id := []*common.Column{{Name: "id"}}
+	cases := []struct {
+		b    []*common.Column
+		want bool
+	}{
+		{[]*common.Column{{Name: "iD"}}, true},
+		{[]*common.Column{{Name: "id", SubPart: 10}}, false}, // 前缀索引
+		{[]*common.Column{{Name: "id", Desc: true}}, false},  // 降序索引
+		{[]*common.Column{{Name: "name"}}, false},
+	}
+	for _, c := range cases {
+		if got := isKeyPartsPart(id, c.b); got != c.want {
+			t.Errorf("isKeyPartsPart(id, %s) want: %v, got: %v", c.b[0].Name, c.want, got)
+		}
+		// common.IsColsPart 只比较列名，重复索引、冗余索引的检查不受前缀长度和排序方向影响
+		if got := common.IsColsPart(id, c.b); got != (c.b[0].Name != "name") {
+			t.Errorf("IsColsPart(id, %s) got: %v", c.b[0].Name, got)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
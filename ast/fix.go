@@ -0,0 +1,145 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ast
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/XiaoMi/soar/common"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// maxFixTextTokens 逐 token 对齐的计算量为两条 SQL token 数的乘积，超出时直接使用改写后的 SQL
+const maxFixTextTokens = 4000000
+
+// textToken 原始文本中的 token，trivia 为 token 之前的空白及注释
+type textToken struct {
+	key     string // 用于对齐的 token 类型及小写的值，不同的引号、大小写视为相同的 token
+	trivia  string
+	comment bool // trivia 中是否含有注释
+	text    string
+}
+
+// scanTextTokens 使用 vitess 的切词方式切分 SQL，注释归入下一个 token 的 trivia，返回的 tail 为最后一个 token 之后的内容
+func scanTextTokens(sql string) (tokens []textToken, tail string, ok bool) {
+	tkn := sqlparser.NewStringTokenizer(sql)
+	prev, start := 0, 0
+	comment := false
+	for {
+		typ, val := tkn.Scan()
+		if typ == 0 {
+			break
+		}
+		end := tkn.Position - 1
+		if typ == sqlparser.LEX_ERROR || end < prev || end > len(sql) {
+			return nil, "", false
+		}
+		if typ == sqlparser.COMMENT {
+			comment = true
+			prev = end
+			continue
+		}
+		text := strings.TrimLeft(sql[prev:end], " \t\r\n")
+		tokens = append(tokens, textToken{
+			key:     fmt.Sprintf("%d:%s", typ, strings.ToLower(string(val))),
+			trivia:  sql[start : end-len(text)],
+			comment: comment,
+			text:    text,
+		})
+		prev, start, comment = end, end, false
+	}
+	return tokens, sql[start:], true
+}
+
+// ApplyRewriteText 将改写后的 SQL 应用到原始文本上，未改变的部分保留原始的大小写、空白及注释，新增的部分使用改写后的文本
+// 改写规则作用在 AST 上，sqlparser.String 输出的 SQL 会丢失注释和原有的格式，这里按 token 对齐两条 SQL 只替换发生变化的部分
+// 无法对齐或合并结果与改写后的 SQL 语义不一致时返回 newSQL
+func ApplyRewriteText(orgSQL, newSQL string) string {
+	a, tail, ok := scanTextTokens(orgSQL)
+	if !ok {
+		return newSQL
+	}
+	b, _, ok := scanTextTokens(newSQL)
+	if !ok || len(a)*len(b) > maxFixTextTokens {
+		return newSQL
+	}
+
+	// lcs[i][j] 为 a[i:], b[j:] 的最长公共子序列长度
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i].key == b[j].key:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var buf strings.Builder
+	var texts []string
+	changed := false
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i].key == b[j].key:
+			// 紧跟在改动之后的 token 使用改写后的空白，原始文本中有注释或换行时保留原样
+			trivia := a[i].trivia
+			if changed && !a[i].comment && !strings.Contains(trivia, "\n") {
+				trivia = b[j].trivia
+			}
+			buf.WriteString(trivia + a[i].text)
+			texts = append(texts, a[i].text)
+			changed = false
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			// 删除的 token 前的注释仍然保留
+			if a[i].comment {
+				buf.WriteString(a[i].trivia)
+			}
+			changed = true
+			i++
+		default:
+			buf.WriteString(b[j].trivia + b[j].text)
+			texts = append(texts, b[j].text)
+			changed = true
+			j++
+		}
+	}
+	buf.WriteString(tail)
+
+	// 去除注释后重新解析，与改写后的 SQL 不一致时不使用合并的结果
+	merged, err := sqlparser.Parse(strings.Join(texts, " "))
+	if err != nil {
+		return newSQL
+	}
+	stmt, err := sqlparser.Parse(newSQL)
+	if err != nil || sqlparser.String(merged) != sqlparser.String(stmt) {
+		common.Log.Debug("ApplyRewriteText merged SQL mismatch, use rewritten SQL: %s", newSQL)
+		return newSQL
+	}
+	return buf.String()
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ast
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+func TestApplyRewriteText(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	cases := []struct {
+		org, rewritten, want string
+	}{
+		{
+			// 保留注释、大小写及换行，新增的部分使用改写后的文本
+			org:       "SELECT col /* c */ FROM tbl\nGROUP BY col",
+			rewritten: "select col from tbl group by col order by null",
+			want:      "SELECT col /* c */ FROM tbl\nGROUP BY col order by null",
+		},
+		{
+			org:       "-- 查询\nSELECT col FROM tbl WHERE c IN (1, NULL) # 条件",
+			rewritten: "select col from tbl where (c in (1) or c is null)",
+			want:      "-- 查询\nSELECT col FROM tbl WHERE (c IN (1) or c is NULL) # 条件",
+		},
+		{
+			org:       "select `Col` from tbl where id = 'a'",
+			rewritten: "select Col from tbl where id = 'a' order by null",
+			want:      "select `Col` from tbl where id = 'a' order by null",
+		},
+		{
+			// 无法切词时使用改写后的 SQL
+			org:       "select 'abc",
+			rewritten: "select 1 from dual",
+			want:      "select 1 from dual",
+		},
+	}
+	for _, c := range cases {
+		if got := ApplyRewriteText(c.org, c.rewritten); got != c.want {
+			t.Errorf("want: %s\ngot: %s", c.want, got)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
@@ -406,6 +406,184 @@ func FindGroupByCols(node sqlparser.SQLNode) []*common.Column {
 	return columns
 }
 
+// FindSelectCols 获取 SELECT 列表中使用到的列，用于覆盖索引建议，子查询中的列不包含在内
+// 如果 SELECT 列表中包含 * 或者不是单个 SELECT 语句，无法确定所有的列，第二个返回值为 false
+func FindSelectCols(node sqlparser.SQLNode) ([]*common.Column, bool) {
+	common.Log.Debug("Enter:  FindSelectCols(), Caller: %s", common.Caller())
+	sel, ok := node.(*sqlparser.Select)
+	if !ok {
+		return nil, false
+	}
+	var columns []*common.Column
+	for _, expr := range sel.SelectExprs {
+		switch expr := expr.(type) {
+		case *sqlparser.StarExpr:
+			return nil, false
+		case *sqlparser.AliasedExpr:
+			err := sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+				switch col := node.(type) {
+				case *sqlparser.Subquery:
+					return false, nil
+				case *sqlparser.ColName:
+					columns = common.MergeColumn(columns, &common.Column{
+						Name:  col.Name.String(),
+						Table: col.Qualifier.Name.String(),
+						DB:    col.Qualifier.Qualifier.String(),
+						Alias: make([]string, 0),
+					})
+				}
+				return true, nil
+			}, expr)
+			common.LogIfWarn(err, "")
+		}
+	}
+	return columns, true
+}
+
+// FunctionalExpr WHERE 及 JOIN 条件中作用在单张表的列上的函数表达式，这类条件无法使用普通索引
+type FunctionalExpr struct {
+	Expr     string           // 去掉库表前缀后的表达式
+	FuncName string           // 最外层的函数名或 JSON 操作符，小写
+	Columns  []*common.Column // 表达式中用到的列，均属于同一张表
+}
+
+// IsJSON 表达式是否为 JSON 函数或 JSON 操作符，其返回值无法直接添加索引
+func (f FunctionalExpr) IsJSON() bool {
+	return strings.HasPrefix(f.FuncName, "json_") || f.FuncName == sqlparser.JSONExtractOp || f.FuncName == sqlparser.JSONUnquoteExtractOp
+}
+
+// FindFunctionalExprs 获取 WHERE 及 JOIN 条件中 `函数(列) operator 值` 形式的条件中的函数表达式，子查询中的表达式不包含在内
+// SELECT 列表、HAVING、ORDER BY 等处的比较无法通过索引过滤数据，不在查找范围内
+func FindFunctionalExprs(node sqlparser.SQLNode) []FunctionalExpr {
+	common.Log.Debug("Enter:  FindFunctionalExprs(), Caller: %s", common.Caller())
+	var exprs []FunctionalExpr
+	find := func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		switch node := node.(type) {
+		case *sqlparser.Subquery:
+			return false, nil
+		case *sqlparser.ComparisonExpr:
+			_, eq := eqOperators[node.Operator]
+			_, inEq := inEqOperators[node.Operator]
+			if !eq && !inEq {
+				return true, nil
+			}
+			f, ok := functionalExpr(node.Left, node.Right)
+			if !ok {
+				f, ok = functionalExpr(node.Right, node.Left)
+			}
+			if !ok {
+				return true, nil
+			}
+			for _, e := range exprs {
+				if e.Expr == f.Expr && common.JoinColumnsName(e.Columns, ",") == common.JoinColumnsName(f.Columns, ",") &&
+					e.Columns[0].Table == f.Columns[0].Table && e.Columns[0].DB == f.Columns[0].DB {
+					return true, nil
+				}
+			}
+			exprs = append(exprs, f)
+		}
+		return true, nil
+	}
+	err := sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		switch node := node.(type) {
+		case *sqlparser.Subquery:
+			return false, nil
+		case *sqlparser.Where:
+			if node.Type == sqlparser.WhereStr {
+				common.LogIfWarn(sqlparser.Walk(find, node.Expr), "")
+			}
+			return false, nil
+		case *sqlparser.JoinTableExpr:
+			// 嵌套的 JOIN 在 LeftExpr, RightExpr 中继续查找
+			common.LogIfWarn(sqlparser.Walk(find, node.Condition.On), "")
+		}
+		return true, nil
+	}, node)
+	common.LogIfWarn(err, "")
+	return exprs
+}
+
+// functionalExpr 判断 expr 是否为作用在单张表的列上的函数，且 other 中不含有该表的列
+func functionalExpr(expr, other sqlparser.Expr) (FunctionalExpr, bool) {
+	var f FunctionalExpr
+	switch e := expr.(type) {
+	case *sqlparser.FuncExpr:
+		if e.IsAggregate() {
+			return f, false
+		}
+		f.FuncName = e.Name.Lowered()
+	case *sqlparser.ConvertExpr:
+		f.FuncName = "cast"
+	case *sqlparser.SubstrExpr:
+		f.FuncName = "substring"
+	case *sqlparser.BinaryExpr:
+		if e.Operator != sqlparser.JSONExtractOp && e.Operator != sqlparser.JSONUnquoteExtractOp {
+			return f, false
+		}
+		f.FuncName = e.Operator
+	default:
+		return f, false
+	}
+
+	var colNames []*sqlparser.ColName
+	hasSubquery := false
+	err := sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		switch n := node.(type) {
+		case *sqlparser.Subquery:
+			hasSubquery = true
+			return false, nil
+		case *sqlparser.ColName:
+			colNames = append(colNames, n)
+		}
+		return true, nil
+	}, expr)
+	common.LogIfWarn(err, "")
+	if hasSubquery || len(colNames) == 0 {
+		return f, false
+	}
+
+	qualifier := colNames[0].Qualifier
+	for _, col := range colNames {
+		if col.Qualifier != qualifier {
+			return f, false
+		}
+		f.Columns = common.MergeColumn(f.Columns, &common.Column{
+			Name:  col.Name.String(),
+			Table: qualifier.Name.String(),
+			DB:    qualifier.Qualifier.String(),
+			Alias: make([]string, 0),
+		})
+	}
+
+	// 比较的另一侧含有同一张表的列时无法通过索引定位
+	sameTable := false
+	err = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		switch n := node.(type) {
+		case *sqlparser.Subquery:
+			return false, nil
+		case *sqlparser.ColName:
+			if n.Qualifier.Name == qualifier.Name {
+				sameTable = true
+			}
+		}
+		return true, nil
+	}, other)
+	common.LogIfWarn(err, "")
+	if sameTable {
+		return f, false
+	}
+
+	// 索引定义中不能含有表名前缀，生成表达式后再恢复原 AST
+	for _, col := range colNames {
+		col.Qualifier = sqlparser.TableName{}
+	}
+	f.Expr = sqlparser.String(expr)
+	for _, col := range colNames {
+		col.Qualifier = qualifier
+	}
+	return f, true
+}
+
 // FindOrderByCols 为索引优化获取orderBy中可能添加索引的列信息
 func FindOrderByCols(node sqlparser.SQLNode) []*common.Column {
 	common.Log.Debug("Enter:  FindOrderByCols(), Caller: %s", common.Caller())
@@ -437,6 +615,51 @@ func FindOrderByCols(node sqlparser.SQLNode) []*common.Column {
 	return columns
 }
 
+// OrderByKeyPart ORDER BY 中的列及其排序方向
+type OrderByKeyPart struct {
+	Column *common.Column
+	Desc   bool
+}
+
+// FindOrderByKeyParts 按书写顺序获取顶层查询 ORDER BY 中的列及排序方向，用于消除排序的索引建议
+// ORDER BY 中含有常量、运算或函数时无法通过索引消除排序，返回 nil
+func FindOrderByKeyParts(node sqlparser.SQLNode) []OrderByKeyPart {
+	common.Log.Debug("Enter:  FindOrderByKeyParts(), Caller: %s", common.Caller())
+	sel, ok := node.(*sqlparser.Select)
+	if !ok {
+		return nil
+	}
+
+	var parts []OrderByKeyPart
+	for _, order := range sel.OrderBy {
+		col, ok := order.Expr.(*sqlparser.ColName)
+		if !ok {
+			return nil
+		}
+		column := &common.Column{
+			Name:  col.Name.String(),
+			Table: col.Qualifier.Name.String(),
+			DB:    col.Qualifier.Qualifier.String(),
+			Alias: make([]string, 0),
+		}
+		// 重复的列只有第一次出现时影响排序结果
+		duplicate := false
+		for _, p := range parts {
+			if p.Column.Equal(column) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			parts = append(parts, OrderByKeyPart{
+				Column: column,
+				Desc:   order.Direction == sqlparser.DescScr,
+			})
+		}
+	}
+	return parts
+}
+
 // FindJoinTable 获取 Join 中需要添加索引的表
 // join 优化添加索引分为三种类型：1. inner join, 2. left join, 3.right join
 // 针对三种优化类型，需要三种不同的索引添加方案:
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/XiaoMi/soar/common"
@@ -145,6 +146,98 @@ func TestFindOrderBy(t *testing.T) {
 	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
 }
 
+func TestFindSelectCols(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	sqlList := map[string]string{
+		"select a, count(b), c.d from t, c where e = 1":                  "a,b,d",
+		"select a, (select max(x) from t2) from t":                       "a",
+		"select * from t where a = 1":                                    "",
+		"select a from t union select b from t":                          "",
+		"select t.a as x, concat(b, 'c') from t group by t.a order by b": "a,b",
+	}
+
+	for sql, want := range sqlList {
+		stmt, err := sqlparser.Parse(sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cols, ok := FindSelectCols(stmt)
+		if ok != (want != "") {
+			t.Errorf("%s want %v, got %v", sql, want != "", ok)
+		}
+		if got := common.JoinColumnsName(cols, ","); got != want {
+			t.Errorf("%s want %s, got %s", sql, want, got)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestFindFunctionalExprs(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	sqlList := map[string]string{
+		"select * from t where DATE(created_at) = '2020-01-01'":                    "DATE(created_at):date",
+		"select * from t a join u b on lower(a.email) = b.email":                   "lower(email):lower",
+		"select * from t where '1' = JSON_EXTRACT(doc, '$.k') and doc->>'$.n' > 1": "JSON_EXTRACT(doc, '$.k'):json_extract;doc ->> '$.n':->>",
+		"select * from t where a + 1 > 3 and count(b) > 1":                         "",
+		"select * from t a join u b on concat(a.x, b.y) = 'z'":                     "",
+		"select * from t where upper(a) = upper(b)":                                "",
+		"select * from t where id in (select id from u where year(d) = 2020)":      "",
+		"select year(d) = 2020 from t where lower(a) = 'x'":                        "lower(a):lower",
+		"select a from t group by a having max(b) > 1 and lower(a) = 'x'":          "",
+		"update t set c = date(d) = '2020-01-01' where id = 1":                     "",
+		"select * from t a join u b on a.id = b.id join v c on year(c.d) = 2020":   "year(d):year",
+	}
+
+	for sql, want := range sqlList {
+		stmt, err := sqlparser.Parse(sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, f := range FindFunctionalExprs(stmt) {
+			got = append(got, f.Expr+":"+f.FuncName)
+		}
+		if strings.Join(got, ";") != want {
+			t.Errorf("%s want %s, got %s", sql, want, strings.Join(got, ";"))
+		}
+		// 生成表达式时临时去掉的表名前缀需要恢复
+		if strings.Contains(sql, "a.email") && !strings.Contains(sqlparser.String(stmt), "lower(a.email)") {
+			t.Errorf("FindFunctionalExprs should not change the AST: %s", sqlparser.String(stmt))
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestFindOrderByKeyParts(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	sqlList := map[string]string{
+		"select * from t where a = 1 order by b desc, c asc limit 20": "b DESC,c",
+		"select * from t order by b, b, c desc":                       "b,c DESC",
+		"select * from t order by b, c + 1":                           "",
+		"select * from t order by rand()":                             "",
+		"select * from t union select * from u order by 1":            "",
+	}
+
+	for sql, want := range sqlList {
+		stmt, err := sqlparser.Parse(sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, p := range FindOrderByKeyParts(stmt) {
+			part := p.Column.Name
+			if p.Desc {
+				part += " DESC"
+			}
+			got = append(got, part)
+		}
+		if strings.Join(got, ",") != want {
+			t.Errorf("%s want %s, got %s", sql, want, strings.Join(got, ","))
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
 func TestFindSubquery(t *testing.T) {
 	common.Log.Debug("Entering function: %s", common.GetFunctionName())
 	sqlList := []string{
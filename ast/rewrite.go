@@ -38,6 +38,7 @@ type Rule struct {
 	Original    string                  `json:"Original"` // 错误示范。为空或"暂不支持"不会出现在list-rewrite-rules中
 	Suggest     string                  `json:"Suggest"`  // 正确示范。
 	Func        func(*Rewrite) *Rewrite `json:"-"`        // 如果不定义 Func 需要多条 SQL 联动改写
+	Unsafe      bool                    `json:"-"`        // 改写后查询结果可能发生变化，-report-type fix 时需要 -fix-unsafe 才会自动执行
 }
 
 // RewriteRules SQL重写规则，注意这个规则是有序的，先后顺序不能乱
@@ -86,6 +87,7 @@ func init() {
 			Original:    "select country_id from city union select country_id from country",
 			Suggest:     "select country_id from city union all select country_id from country",
 			Func:        (*Rewrite).RewriteUnionAll,
+			Unsafe:      true,
 		},
 		{
 			Name:        "or2in",
@@ -97,9 +99,10 @@ func init() {
 		{
 			Name:        "innull",
 			Description: "如果 IN 条件中可能有 NULL 值而又想匹配 NULL 值时，建议添加OR col IS NULL",
-			Original:    "暂不支持",
-			Suggest:     "暂不支持",
+			Original:    "SELECT * FROM tb WHERE col IN (1, NULL)",
+			Suggest:     "select * from tb where (col in (1) or col is null)",
 			Func:        (*Rewrite).RewriteInNull,
+			Unsafe:      true,
 		},
 		// 把所有跟 or 相关的重写完之后才进行 or 转 union 的重写
 		{
@@ -145,6 +148,7 @@ func init() {
 			Original:    "SELECT DISTINCT * FROM film;",
 			Suggest:     "SELECT * FROM film",
 			Func:        (*Rewrite).RewriteDistinctStar,
+			Unsafe:      true,
 		},
 		{
 			Name:        "standard",
@@ -295,6 +299,63 @@ func (rw *Rewrite) Rewrite() *Rewrite {
 	return rw
 }
 
+// RewriteByName 按 RewriteRules 中定义的顺序执行 names 指定的重写规则，不受 -rewrite-rules 配置影响
+// 每条规则的输出作为下一条规则的输入，返回实际改变了 SQL 的规则名称，供 -report-type fix 使用
+func (rw *Rewrite) RewriteByName(names ...string) (applied []string) {
+	for _, rule := range RewriteRules {
+		if rule.Func == nil {
+			continue
+		}
+		for _, name := range names {
+			if rule.Name != name {
+				continue
+			}
+			if rw.applyRule(rule) {
+				applied = append(applied, rule.Name)
+			}
+			break
+		}
+	}
+	rw.NewSQL = rw.SQL
+	return applied
+}
+
+// applyRule 执行单条重写规则，规则 panic 或输出无法解析时恢复执行前的 SQL，返回 SQL 是否发生变化
+func (rw *Rewrite) applyRule(rule Rule) (changed bool) {
+	sql := rw.SQL
+	defer func() {
+		if err := recover(); err != nil {
+			common.Log.Error("Query rewrite %s Error: %s, maybe hit a bug.\nQuery: %s \nAST: %s",
+				rule.Name, err, sql, pretty.Sprint(rw.Stmt))
+			// 规则可能已经修改了抽象语法树，重新解析执行前的 SQL
+			rw.SQL, rw.NewSQL = sql, sql
+			rw.Stmt, _ = sqlparser.Parse(sql)
+			changed = false
+		}
+	}()
+
+	before := sqlparser.String(rw.Stmt)
+	rw.NewSQL = ""
+	rule.Func(rw)
+	if rw.NewSQL == "" {
+		rw.NewSQL = sql
+		return false
+	}
+	newStmt, err := sqlparser.Parse(rw.NewSQL)
+	if err != nil {
+		common.Log.Warning("RewriteByName rule %s output parse error: %v", rule.Name, err)
+		rw.Stmt, _ = sqlparser.Parse(sql)
+		rw.NewSQL = sql
+		return false
+	}
+	if sqlparser.String(newStmt) != before {
+		changed = true
+		rw.SQL = rw.NewSQL
+	}
+	rw.Stmt = newStmt
+	return changed
+}
+
 // RewriteDelimiter delimiter: 补分号，可以指定不同的DELIMITER
 func (rw *Rewrite) RewriteDelimiter() *Rewrite {
 	if rw.NewSQL != "" {
@@ -666,10 +727,9 @@ func (rw *Rewrite) RewriteIntWidth() *Rewrite {
 
 // RewriteStar2Columns star2columns: 对应COL.001，SELECT补全*指代的列名
 func (rw *Rewrite) RewriteStar2Columns() *Rewrite {
-	// 如果未配置mysql环境或从环境中获取失败，*不进行替换
-	if common.Config.TestDSN.Disable || len(rw.Columns) == 0 {
-		common.Log.Debug("(rw *Rewrite) RewriteStar2Columns(): Rewrite failed. TestDSN.Disable: %v, len(rw.Columns):%d",
-			common.Config.TestDSN.Disable, len(rw.Columns))
+	// 如果未配置mysql环境或离线数据字典，或从中获取失败，*不进行替换
+	if len(rw.Columns) == 0 {
+		common.Log.Debug("(rw *Rewrite) RewriteStar2Columns(): Rewrite failed. len(rw.Columns):%d", len(rw.Columns))
 		return rw
 	}
 
@@ -1134,8 +1194,46 @@ func removeDup(vt ...sqlparser.Expr) sqlparser.ValTuple {
 	return uni
 }
 
-// RewriteInNull innull: TODO: 对应ARG.004
+// RewriteInNull innull: 对应 ARG.004，将 col IN (..., NULL) 改写为 col IN (...) OR col IS NULL
+// NOT IN (NULL) 恒为假且无等价改写，保持原样
 func (rw *Rewrite) RewriteInNull() *Rewrite {
+	sqlparser.Rewrite(rw.Stmt, nil, func(c *sqlparser.Cursor) bool {
+		n, ok := c.Node().(*sqlparser.ComparisonExpr)
+		if !ok || n.Operator != sqlparser.InStr {
+			return true
+		}
+		tuple, ok := n.Right.(sqlparser.ValTuple)
+		if !ok {
+			return true
+		}
+		var values sqlparser.ValTuple
+		for _, v := range tuple {
+			if _, null := v.(*sqlparser.NullVal); !null {
+				values = append(values, v)
+			}
+		}
+		if len(values) == len(tuple) {
+			return true
+		}
+
+		isNull := &sqlparser.IsExpr{Operator: sqlparser.IsNullStr, Expr: n.Left}
+		if len(values) == 0 {
+			c.Replace(isNull)
+			return true
+		}
+		c.Replace(&sqlparser.ParenExpr{
+			Expr: &sqlparser.OrExpr{
+				Left: &sqlparser.ComparisonExpr{
+					Operator: sqlparser.InStr,
+					Left:     n.Left,
+					Right:    values,
+				},
+				Right: isNull,
+			},
+		})
+		return true
+	})
+	rw.NewSQL = sqlparser.String(rw.Stmt)
 	return rw
 }
 
@@ -1293,10 +1391,9 @@ func (rw *Rewrite) RewriteGroupByConst() *Rewrite {
 // RewriteSubQuery2Join 将 subquery 转写成 join
 func (rw *Rewrite) RewriteSubQuery2Join() *Rewrite {
 	var err error
-	// 如果未配置 mysql 环境或从环境中获取失败
-	if common.Config.TestDSN.Disable || len(rw.Columns) == 0 {
-		common.Log.Debug("(rw *Rewrite) RewriteSubQuery2Join(): Rewrite failed. TestDSN.Disable: %v, len(rw.Columns):%d",
-			common.Config.TestDSN.Disable, len(rw.Columns))
+	// 如果未配置 mysql 环境或离线数据字典，或从中获取失败
+	if len(rw.Columns) == 0 {
+		common.Log.Debug("(rw *Rewrite) RewriteSubQuery2Join(): Rewrite failed. len(rw.Columns):%d", len(rw.Columns))
 		return rw
 	}
 
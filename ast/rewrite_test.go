@@ -19,6 +19,7 @@ package ast
 import (
 	"fmt"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/XiaoMi/soar/common"
@@ -253,6 +254,91 @@ func TestRewriteAddOrderByNull(t *testing.T) {
 	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
 }
 
+func TestRewriteInNull(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	testSQL := []map[string]string{
+		{
+			"input":  "SELECT * FROM tb WHERE col IN (1, NULL)",
+			"output": "select * from tb where (col in (1) or col is null)",
+		},
+		{
+			"input":  "SELECT * FROM tb WHERE col IN (NULL) AND c = 1",
+			"output": "select * from tb where col is null and c = 1",
+		},
+		{
+			"input":  "SELECT * FROM tb WHERE col NOT IN (NULL)",
+			"output": "select * from tb where col not in (null)",
+		},
+		{
+			"input":  "SELECT * FROM tb WHERE col IN (1, 2)",
+			"output": "select * from tb where col in (1, 2)",
+		},
+	}
+	for _, sql := range testSQL {
+		rw := NewRewrite(sql["input"]).RewriteInNull()
+		if rw.NewSQL != sql["output"] {
+			t.Errorf("want: %s\ngot: %s", sql["output"], rw.NewSQL)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestRewriteByName(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	testSQL := []struct {
+		input   string
+		names   []string
+		output  string
+		applied []string
+	}{
+		{
+			input:   "SELECT DISTINCT * FROM tbl WHERE col IN (1, NULL) GROUP BY col",
+			names:   []string{"distinctstar", "orderbynull", "innull"},
+			output:  "select * from tbl where (col in (1) or col is null) group by col order by null",
+			applied: []string{"orderbynull", "innull", "distinctstar"},
+		},
+		{
+			// 未命中的规则不改写 SQL
+			input:   "SELECT col FROM tbl GROUP BY col ORDER BY col",
+			names:   []string{"orderbynull"},
+			output:  "SELECT col FROM tbl GROUP BY col ORDER BY col",
+			applied: nil,
+		},
+	}
+	for _, sql := range testSQL {
+		rw := NewRewrite(sql.input)
+		applied := rw.RewriteByName(sql.names...)
+		if rw.NewSQL != sql.output {
+			t.Errorf("want: %s\ngot: %s", sql.output, rw.NewSQL)
+		}
+		if strings.Join(applied, ",") != strings.Join(sql.applied, ",") {
+			t.Errorf("want applied: %v, got: %v", sql.applied, applied)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestRewriteByNamePanic(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	orgRules := RewriteRules
+	defer func() { RewriteRules = orgRules }()
+	RewriteRules = append(append([]Rule{}, orgRules...), Rule{
+		Name: "panic",
+		Func: func(rw *Rewrite) *Rewrite { rw.NewSQL = "select 1"; panic("rewrite panic") },
+	})
+
+	// 规则 panic 时保留之前规则的改写结果
+	rw := NewRewrite("SELECT col FROM tbl GROUP BY col")
+	applied := rw.RewriteByName("orderbynull", "panic")
+	if want := "select col from tbl group by col order by null"; rw.NewSQL != want {
+		t.Errorf("want: %s\ngot: %s", want, rw.NewSQL)
+	}
+	if strings.Join(applied, ",") != "orderbynull" {
+		t.Errorf("want applied: orderbynull, got: %v", applied)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
 func TestRewriteRemoveDMLOrderBy(t *testing.T) {
 	common.Log.Debug("Entering function: %s", common.GetFunctionName())
 	testSQL := []map[string]string{
@@ -0,0 +1,427 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ast
+
+import (
+	"strings"
+
+	"github.com/XiaoMi/soar/common"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/opcode"
+)
+
+// 本文件为 meta.go 中 Vitess AST 辅助函数对应的 TiDB AST 实现
+// Vitess 无法解析的语法（CTE，窗口函数，部分 DDL 等）由 TiDB parser 解析，启发式规则通过这些函数获取同样的信息
+
+// tiVisitor 将函数包装为 TiDB ast.Visitor
+type tiVisitor struct {
+	visit func(node ast.Node) bool
+}
+
+// Enter visit 返回 false 时跳过该节点的子节点
+func (v *tiVisitor) Enter(node ast.Node) (ast.Node, bool) {
+	return node, !v.visit(node)
+}
+
+// Leave ...
+func (v *tiVisitor) Leave(node ast.Node) (ast.Node, bool) {
+	return node, true
+}
+
+// TiWalk 深度优先遍历 TiDB 抽象语法树，与 sqlparser.Walk 类似，visit 返回 false 时不再遍历该节点的子节点
+func TiWalk(visit func(node ast.Node) bool, nodes ...ast.Node) {
+	v := &tiVisitor{visit: visit}
+	for _, node := range nodes {
+		if node != nil {
+			node.Accept(v)
+		}
+	}
+}
+
+// tiIsArithmetic 判断二元运算是否为数值计算，与 sqlparser.BinaryExpr 对应
+func tiIsArithmetic(op opcode.Op) bool {
+	switch op {
+	case opcode.Plus, opcode.Minus, opcode.Mul, opcode.Div, opcode.IntDiv, opcode.Mod,
+		opcode.And, opcode.Or, opcode.Xor, opcode.LeftShift, opcode.RightShift:
+		return true
+	}
+	return false
+}
+
+// tiIsSubquery 判断节点是否为子查询，TiDB 中 FROM 子句的子查询为 TableSource 下的 SelectStmt
+func tiIsSubquery(node ast.Node) bool {
+	switch n := node.(type) {
+	case *ast.SubqueryExpr:
+		return true
+	case *ast.TableSource:
+		switch n.Source.(type) {
+		case *ast.SelectStmt, *ast.SetOprStmt:
+			return true
+		}
+	}
+	return false
+}
+
+// TiGetMeta 获取 SQL 中使用到的库表信息，对应 GetMeta，CTE 的名称不是实体表，不包含在内
+func TiGetMeta(node ast.Node, meta common.Meta) common.Meta {
+	if meta == nil {
+		meta = make(common.Meta)
+	}
+	ctes := make(map[string]bool)
+	TiWalk(func(node ast.Node) bool {
+		if with, ok := node.(*ast.WithClause); ok {
+			for _, cte := range with.CTEs {
+				ctes[cte.Name.L] = true
+			}
+		}
+		return true
+	}, node)
+	TiWalk(func(node ast.Node) bool {
+		ts, ok := node.(*ast.TableSource)
+		if !ok {
+			return true
+		}
+		tb, ok := ts.Source.(*ast.TableName)
+		if !ok || tb.Name.O == "" || (tb.Schema.O == "" && ctes[tb.Name.L]) {
+			return true
+		}
+		db := tb.Schema.O
+		if meta[db] == nil {
+			meta[db] = common.NewDB(db)
+		}
+		if meta[db].Table[tb.Name.O] == nil {
+			meta[db].Table[tb.Name.O] = common.NewTable(tb.Name.O)
+		}
+		mergeAlias(db, tb.Name.O, ts.AsName.O, meta)
+		return true
+	}, node)
+	return meta
+}
+
+// TiFindColumn 从传入的 node 中获取所有可能加索引的的 column 信息，对应 FindColumn
+func TiFindColumn(node ast.Node) []*common.Column {
+	common.Log.Debug("Enter:  TiFindColumn, Caller: %s", common.Caller())
+	var result []*common.Column
+	TiWalk(func(node ast.Node) bool {
+		switch col := node.(type) {
+		case *ast.FuncCallExpr, *ast.AggregateFuncExpr, *ast.WindowFuncExpr:
+			// 忽略function
+			return false
+		case *ast.ColumnNameExpr:
+			result = common.MergeColumn(result, &common.Column{
+				Name:  col.Name.Name.O,
+				Table: col.Name.Table.O,
+				DB:    col.Name.Schema.O,
+				Alias: make([]string, 0),
+			})
+		}
+		return true
+	}, node)
+	return result
+}
+
+// TiFindWhereCols 获取 WHERE 条件中使用到的所有列，对应 FindAllCols(node, WhereExpression)，子查询中的列不包含在内
+func TiFindWhereCols(node ast.Node) []*common.Column {
+	common.Log.Debug("Enter:  TiFindWhereCols(), Caller: %s", common.Caller())
+	var columns []*common.Column
+	TiWalk(func(node ast.Node) bool {
+		if tiIsSubquery(node) {
+			return false
+		}
+		var where ast.ExprNode
+		switch n := node.(type) {
+		case *ast.SelectStmt:
+			where = n.Where
+		case *ast.UpdateStmt:
+			where = n.Where
+		case *ast.DeleteStmt:
+			where = n.Where
+		}
+		if where != nil {
+			TiWalk(func(node ast.Node) bool {
+				if tiIsSubquery(node) {
+					return false
+				}
+				if col, ok := node.(*ast.ColumnNameExpr); ok {
+					columns = common.MergeColumn(columns, &common.Column{
+						Name:  col.Name.Name.O,
+						Table: col.Name.Table.O,
+						DB:    col.Name.Schema.O,
+						Alias: make([]string, 0),
+					})
+				}
+				return true
+			}, where)
+		}
+		return true
+	}, node)
+	return columns
+}
+
+// TiFindEQColsInWhere 获取等值条件信息，对应 FindEQColsInWhere
+func TiFindEQColsInWhere(node ast.Node) []*common.Column {
+	common.Log.Debug("Enter:  TiFindEQColsInWhere(), Caller: %s", common.Caller())
+	var columns []*common.Column
+	TiWalk(func(node ast.Node) bool {
+		if tiIsSubquery(node) {
+			return false
+		}
+		var newCols []*common.Column
+		switch n := node.(type) {
+		case *ast.Join:
+			// 忽略 join condition
+			return false
+
+		case *ast.BinaryOperationExpr:
+			switch n.Op {
+			case opcode.LogicOr:
+				// 忽略 or condition
+				return false
+			case opcode.EQ, opcode.NullEQ:
+				if _, ok := n.L.(*ast.ColumnNameExpr); ok {
+					newCols = TiFindColumn(n)
+				}
+			default:
+				if tiIsArithmetic(n.Op) {
+					// 忽略数值计算
+					return false
+				}
+			}
+
+		case *ast.PatternInExpr:
+			// 只有单值的in条件才算做是等值查询
+			if !n.Not && n.Sel == nil && len(n.List) == 1 {
+				newCols = TiFindColumn(n)
+			}
+
+		case *ast.IsNullExpr:
+			if !n.Not {
+				newCols = TiFindColumn(n)
+			}
+
+		case *ast.IsTruthExpr:
+			newCols = TiFindColumn(n)
+		}
+
+		// operator两边都为列的情况不提供索引建议
+		// 如果该列位于function中则不予提供索引建议
+		if len(newCols) == 1 {
+			columns = common.MergeColumn(columns, newCols[0])
+		}
+		return true
+	}, node)
+	return columns
+}
+
+// TiFindINEQColsInWhere 获取非等值条件中可能需要加索引的列，对应 FindINEQColsInWhere
+func TiFindINEQColsInWhere(node ast.Node) []*common.Column {
+	common.Log.Debug("Enter:  TiFindINEQColsInWhere(), Caller: %s", common.Caller())
+	var columns []*common.Column
+	TiWalk(func(node ast.Node) bool {
+		if tiIsSubquery(node) {
+			return false
+		}
+		var newCols []*common.Column
+		switch n := node.(type) {
+		case *ast.Join:
+			return false
+
+		case *ast.BinaryOperationExpr:
+			switch n.Op {
+			case opcode.LogicOr:
+				return false
+			case opcode.LT, opcode.LE, opcode.GT, opcode.GE, opcode.NE:
+				newCols = TiFindColumn(n)
+			default:
+				if tiIsArithmetic(n.Op) {
+					return false
+				}
+			}
+
+		case *ast.PatternLikeExpr:
+			// like前百分号查询无法使用索引
+			if v, ok := n.Pattern.(ast.ValueExpr); ok && strings.HasPrefix(v.GetString(), "%") {
+				break
+			}
+			newCols = TiFindColumn(n)
+
+		case *ast.PatternInExpr:
+			// 多值in属于非等值条件，not in 无需添加索引
+			if !n.Not && n.Sel == nil && len(n.List) > 1 {
+				newCols = TiFindColumn(n)
+			}
+
+		case *ast.IsNullExpr:
+			if n.Not {
+				newCols = TiFindColumn(n)
+			}
+
+		case *ast.BetweenExpr:
+			// between 中只存在非等值条件查询
+			columns = common.MergeColumn(columns, TiFindColumn(n)...)
+		}
+
+		// operator两边都为列的情况不提供索引建议
+		if len(newCols) == 1 {
+			columns = common.MergeColumn(columns, newCols[0])
+		}
+		return true
+	}, node)
+	return columns
+}
+
+// TiFindGroupByCols 获取groupBy中可能需要加索引的列信息，对应 FindGroupByCols
+func TiFindGroupByCols(node ast.Node) []*common.Column {
+	common.Log.Debug("Enter:  TiFindGroupByCols(), Caller: %s", common.Caller())
+	isIgnore := false
+	var columns []*common.Column
+	TiWalk(func(node ast.Node) bool {
+		if tiIsSubquery(node) {
+			return false
+		}
+		switch n := node.(type) {
+		case *ast.Join:
+			return false
+		case *ast.GroupByClause:
+			for _, item := range n.Items {
+				switch item.Expr.(type) {
+				case *ast.BinaryOperationExpr, *ast.FuncCallExpr, *ast.AggregateFuncExpr:
+					// 如果group by中出现数值计算、函数等
+					isIgnore = true
+				default:
+					columns = common.MergeColumn(columns, TiFindColumn(item.Expr)...)
+				}
+			}
+			return false
+		}
+		return true
+	}, node)
+	if isIgnore {
+		return []*common.Column{}
+	}
+	return columns
+}
+
+// TiFindOrderByCols 为索引优化获取orderBy中可能添加索引的列信息，对应 FindOrderByCols
+func TiFindOrderByCols(node ast.Node) []*common.Column {
+	common.Log.Debug("Enter:  TiFindOrderByCols(), Caller: %s", common.Caller())
+	var columns []*common.Column
+	var lastDesc *bool
+	directionNotEq := false
+	TiWalk(func(node ast.Node) bool {
+		if tiIsSubquery(node) {
+			return false
+		}
+		switch n := node.(type) {
+		case *ast.Join, *ast.WindowSpec:
+			// 忽略 join condition 及窗口函数中的排序
+			return false
+		case *ast.OrderByClause:
+			for _, item := range n.Items {
+				// MySQL对于排序顺序不同的查询无法使用索引（8.0后支持）
+				if lastDesc != nil && *lastDesc != item.Desc {
+					directionNotEq = true
+					return false
+				}
+				desc := item.Desc
+				lastDesc = &desc
+				columns = common.MergeColumn(columns, TiFindColumn(item.Expr)...)
+			}
+			return false
+		}
+		return true
+	}, node)
+	if directionNotEq {
+		// 当发现Order by中排序顺序不同时，即放弃Oder by条件中的字段
+		return []*common.Column{}
+	}
+	return columns
+}
+
+// TiFindJoinCols 获取 join condition 中使用到的列，对应 FindJoinCols
+func TiFindJoinCols(node ast.Node) [][]*common.Column {
+	common.Log.Debug("Enter:  TiFindJoinCols(), Caller: %s", common.Caller())
+	var columns [][]*common.Column
+	TiWalk(func(node ast.Node) bool {
+		join, ok := node.(*ast.Join)
+		if !ok || join.Right == nil {
+			return true
+		}
+
+		// on
+		if join.On != nil {
+			cols := TiFindColumn(join.On.Expr)
+			if len(cols) > 1 {
+				columns = append(columns, cols)
+			}
+		}
+
+		// using
+		if len(join.Using) > 0 {
+			left, right := tiTableName(join.Left), tiTableName(join.Right)
+			var cols []*common.Column
+			for _, col := range join.Using {
+				for _, tb := range []string{left, right} {
+					if tb != "" {
+						cols = append(cols, &common.Column{
+							Name:  col.Name.O,
+							Table: tb,
+							Alias: make([]string, 0),
+						})
+					}
+				}
+			}
+			columns = append(columns, cols)
+		}
+		return true
+	}, node)
+	return columns
+}
+
+// tiTableName 获取 join 一侧的实体表名，非实体表返回空
+func tiTableName(node ast.ResultSetNode) string {
+	if ts, ok := node.(*ast.TableSource); ok {
+		if tb, ok := ts.Source.(*ast.TableName); ok {
+			return tb.Name.O
+		}
+	}
+	return ""
+}
+
+// TiGetSubqueryDepth 获取一条SQL的嵌套深度，对应 GetSubqueryDepth
+func TiGetSubqueryDepth(node ast.Node) int {
+	depth := 1
+	var visit func(node ast.Node) bool
+	visit = func(node ast.Node) bool {
+		if with, ok := node.(*ast.WithClause); ok {
+			// CTE 不属于子查询，只统计其中包含的子查询
+			for _, cte := range with.CTEs {
+				if cte.Query != nil {
+					TiWalk(visit, cte.Query.Query)
+				}
+			}
+			return false
+		}
+		if tiIsSubquery(node) {
+			depth++
+		}
+		return true
+	}
+	TiWalk(visit, node)
+	return depth
+}
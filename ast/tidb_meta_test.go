@@ -0,0 +1,200 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ast
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+
+	"github.com/pingcap/parser/ast"
+)
+
+func tiColumnNames(cols []*common.Column) string {
+	var names []string
+	for _, col := range cols {
+		name := col.Name
+		if col.Table != "" {
+			name = col.Table + "." + name
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ",")
+}
+
+func tiParseOne(t *testing.T, sql string) ast.StmtNode {
+	stmts, err := TiParse(sql, "", "")
+	if err != nil || len(stmts) != 1 {
+		t.Fatalf("TiParse %s, error: %v", sql, err)
+	}
+	return stmts[0]
+}
+
+func TestTiFindColumn(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	cases := map[string]string{
+		"select a, t.b from t where c = 1":                "a,t.b,c",
+		"select count(d), max(e) from t group by a":       "a",
+		"with x as (select a from t) select b from x":     "a,b",
+		"select a from t where id in (select id from b)":  "a,id",
+		"select a, row_number() over (order by b) from t": "a",
+	}
+	for sql, want := range cases {
+		if got := tiColumnNames(TiFindColumn(tiParseOne(t, sql))); got != want {
+			t.Errorf("SQL: %s, want: %s, got: %s", sql, want, got)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestTiFindCondition(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	cases := []struct {
+		sql  string
+		eq   string
+		inEq string
+	}{
+		{"select * from film where length % 20 = 4", "", ""},
+		{"select * from film where a = 1 and b > 2 and c in (1) and d in (1, 2)", "a,c", "b,d"},
+		{"select * from film where a is null and b is not null and c like 'x%' and d like '%x'", "a", "b,c"},
+		{"select * from film where a = 1 or b = 2", "", ""},
+		{"select * from film where a between 1 and 2 and b not in (1, 2)", "", "a"},
+		{"select * from film where a = (select max(id) from t where c = 1)", "", ""},
+		{"with t as (select * from film where x = 1) select * from t where a = 1", "a", ""},
+	}
+	for _, c := range cases {
+		stmt := tiParseOne(t, c.sql)
+		if eq := tiColumnNames(TiFindEQColsInWhere(stmt)); eq != c.eq {
+			t.Errorf("SQL: %s, EQ want: %s, got: %s", c.sql, c.eq, eq)
+		}
+		if inEq := tiColumnNames(TiFindINEQColsInWhere(stmt)); inEq != c.inEq {
+			t.Errorf("SQL: %s, INEQ want: %s, got: %s", c.sql, c.inEq, inEq)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestTiFindGroupByOrderBy(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	cases := []struct {
+		sql     string
+		groupBy string
+		orderBy string
+	}{
+		{"select a from t group by c order by d, c", "c", "d,c"},
+		{"select a from t group by c order by d, c desc", "c", ""},
+		{"select a from t group by c + 1 order by d desc", "", "d"},
+		{"select a, row_number() over (order by b) from t group by a", "a", ""},
+		{"with x as (select a from t group by a) select a, sum(b) over (partition by c order by d desc) from x order by a", "", "a"},
+	}
+	for _, c := range cases {
+		stmt := tiParseOne(t, c.sql)
+		if groupBy := tiColumnNames(TiFindGroupByCols(stmt)); groupBy != c.groupBy {
+			t.Errorf("SQL: %s, group by want: %s, got: %s", c.sql, c.groupBy, groupBy)
+		}
+		if orderBy := tiColumnNames(TiFindOrderByCols(stmt)); orderBy != c.orderBy {
+			t.Errorf("SQL: %s, order by want: %s, got: %s", c.sql, c.orderBy, orderBy)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestTiFindJoinCols(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	cases := map[string][]string{
+		"select * from a join b on a.id = b.id where a.c = 1":                {"a.id,b.id"},
+		"select t from a left join b using (c1, c2)":                         {"a.c1,b.c1,a.c2,b.c2"},
+		"select * from a join b on a.id = b.id join c on c.id = b.cid":       {"c.id,b.cid", "a.id,b.id"},
+		"select * from a where id in (select id from b join c on b.x = 1)":   nil,
+		"with x as (select id from a) select * from x join b on x.id = b.id": {"x.id,b.id"},
+	}
+	for sql, want := range cases {
+		var got []string
+		for _, cols := range TiFindJoinCols(tiParseOne(t, sql)) {
+			got = append(got, tiColumnNames(cols))
+		}
+		if strings.Join(got, ";") != strings.Join(want, ";") {
+			t.Errorf("SQL: %s, want: %v, got: %v", sql, want, got)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestTiGetMeta(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	cases := map[string]string{
+		"with x as (select a from t1 where b = 1) select * from x join sakila.t2 y on x.a = y.a": "sakila.t2:y;t1",
+		"select a, row_number() over (order by b) from t1 a1 where id in (select id from t3)":    "t1:a1;t3",
+		"with recursive r as (select 1 n union all select n + 1 from r) select n from r":         "",
+	}
+	for sql, want := range cases {
+		var got []string
+		for db, meta := range TiGetMeta(tiParseOne(t, sql), nil) {
+			for _, tb := range meta.Table {
+				name := tb.TableName
+				if db != "" {
+					name = db + "." + name
+				}
+				if len(tb.TableAliases) > 0 {
+					name += ":" + strings.Join(tb.TableAliases, ",")
+				}
+				got = append(got, name)
+			}
+		}
+		sort.Strings(got)
+		if strings.Join(got, ";") != want {
+			t.Errorf("SQL: %s, want: %s, got: %s", sql, want, strings.Join(got, ";"))
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestTiFindWhereCols(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	cases := map[string]string{
+		"with x as (select a from t where c = 1) select * from x where a = 1 and b > 2": "a,b",
+		"select a, rank() over (partition by d order by e) from t where b = 1":          "b",
+		"select a from t where id in (select id from u where c = 1)":                    "id",
+		"select a from t": "",
+	}
+	for sql, want := range cases {
+		if got := tiColumnNames(TiFindWhereCols(tiParseOne(t, sql))); got != want {
+			t.Errorf("SQL: %s, want: %s, got: %s", sql, want, got)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestTiGetSubqueryDepth(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	cases := map[string]int{
+		"select * from a": 1,
+		"select * from a where id in (select id from b)":                             2,
+		"select * from (select * from a) t":                                          2,
+		"select * from a where id in (select id from (select id from b) c)":          3,
+		"with t as (select * from a) select * from t":                                1,
+		"with t as (select * from a where id in (select id from b)) select * from t": 2,
+	}
+	for sql, want := range cases {
+		if got := TiGetSubqueryDepth(tiParseOne(t, sql)); got != want {
+			t.Errorf("SQL: %s, want: %d, got: %d", sql, want, got)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
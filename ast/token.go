@@ -43,8 +43,6 @@ const (
 )
 
 var maxCachekeySize = 15
-var cacheHits int
-var cacheMisses int
 
 var tokenBoundaries = []string{
 	// multi character
@@ -819,12 +817,10 @@ func Tokenize(sql string) []Token {
 			// Retrieve from cache
 			token = tokenCache[cacheKey]
 			tokenLength = len(token.Val)
-			cacheHits = cacheHits + 1
 		} else {
 			// Get the next token and the token type
 			token = getNextToken(sql, token)
 			tokenLength = len(token.Val)
-			cacheMisses = cacheMisses + 1
 			// If the token is shorter than the max length, store it in cache
 			if cacheKey != "" && tokenLength < maxCachekeySize {
 				tokenCache[cacheKey] = token
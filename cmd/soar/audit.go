@@ -0,0 +1,435 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/XiaoMi/soar/advisor"
+	"github.com/XiaoMi/soar/ast"
+	"github.com/XiaoMi/soar/common"
+	"github.com/XiaoMi/soar/database"
+	"github.com/XiaoMi/soar/env"
+
+	"github.com/go-sql-driver/mysql"
+	tidb "github.com/pingcap/parser/ast"
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// auditTask 单条 SQL 的评审上下文，评审过程中的中间状态及结果都保存在这里，不同 SQL 之间不共享
+type auditTask struct {
+	seq         int                  // 提交顺序，并发评审时按该顺序输出
+	sql         string               // 去除注释后的 SQL
+	fingerprint string               // SQL 指纹
+	id          string               // fingerprint.ID
+	currentDB   string               // 当前 SQL 使用的 database
+	useDB       string               // 最近一条 USE 语句指定的 database，未指定时为空
+	lineCounter int                  // SQL 所在行号，用于 -report-type lint
+	cfg         common.Configuration // 提交评审时的配置快照，audit 中的流程判断只读取该快照，advisor 等仍读取只读的 common.Config
+	q           *advisor.Query4Audit // 语法解析结果
+	columns     common.TableColumns  // SQL 重写需要的表结构信息
+
+	heuristicSuggest map[string]advisor.Rule // 启发式建议
+	expSuggest       map[string]advisor.Rule // EXPLAIN 解读
+	idxSuggest       map[string]advisor.Rule // 索引建议
+	proSuggest       map[string]advisor.Rule // Profiling 信息
+	traceSuggest     map[string]advisor.Rule // Trace 信息
+	mysqlSuggest     map[string]advisor.Rule // MySQL 返回的 ERROR 信息
+}
+
+// newAuditTask 初始化评审任务
+func newAuditTask(sql string) *auditTask {
+	return &auditTask{
+		sql:              sql,
+		cfg:              *common.Config,
+		heuristicSuggest: make(map[string]advisor.Rule),
+		expSuggest:       make(map[string]advisor.Rule),
+		idxSuggest:       make(map[string]advisor.Rule),
+		proSuggest:       make(map[string]advisor.Rule),
+		traceSuggest:     make(map[string]advisor.Rule),
+		mysqlSuggest:     make(map[string]advisor.Rule),
+	}
+}
+
+// audit 依次给出启发式建议、索引建议、EXPLAIN 解读、Profiling、Trace 信息
+// 依赖数据库环境的部分使用传入的 vEnv, rEnv，并发评审时每个 worker 使用各自复制的环境
+func (t *auditTask) audit(vEnv *env.VirtualEnv, rEnv *database.Connector) {
+	q := t.q
+	sql := t.sql
+
+	// +++++++++++++++++++++启发式规则建议[开始]+++++++++++++++++++++++{
+	common.Log.Debug("start of heuristic advisor Query: %s", q.Query)
+	for item, rule := range q.HeuristicCheck() {
+		t.heuristicSuggest[item] = rule
+	}
+	common.Log.Debug("end of heuristic advisor Query: %s", q.Query)
+	// +++++++++++++++++++++启发式规则建议[结束]+++++++++++++++++++++++}
+
+	// +++++++++++++++++++++索引优化建议[开始]+++++++++++++++++++++++{
+	// 如果配置了索引建议过滤规则，不进行索引优化建议
+	// 在配置文件 ignore-rules 中添加 'IDX.*' 即可屏蔽索引优化建议
+	common.Log.Debug("start of index advisor Query: %s", q.Query)
+	if !advisor.IsIgnoreRule("IDX.") {
+		if vEnv.BuildVirtualEnv(rEnv, q.Query) {
+			idxAdvisor, err := advisor.NewAdvisor(vEnv, *rEnv, *q)
+			if err != nil || (idxAdvisor == nil && vEnv.Error == nil) {
+				if idxAdvisor == nil {
+					// 如果 SQL 是 DDL 语句，则返回的 idxAdvisor 为 nil，可以忽略不处理
+					// TODO alter table add index 语句检查索引是否已经存在
+					common.Log.Debug("idxAdvisor by pass Query: %s", q.Query)
+				} else {
+					common.Log.Warning("advisor.NewAdvisor Error: %v", err)
+				}
+			} else {
+				// 创建环境时没有出现错误，生成索引建议
+				if vEnv.Error == nil {
+					// 开启 -validate-index 时在测试环境中验证索引建议是否会被优化器使用
+					t.idxSuggest = idxAdvisor.ValidateIndexAdvise(q.Query, idxAdvisor.IndexAdvise()).Format()
+
+					// 依赖数据字典的启发式建议
+					for i, r := range idxAdvisor.HeuristicCheck(*q) {
+						t.heuristicSuggest[i] = r
+					}
+
+					// FUN.001 与对应的函数索引建议相互关联
+					advisor.LinkFunctionalIndex(t.heuristicSuggest, t.idxSuggest)
+
+					// 采样数据经过脱敏时在报告中说明
+					if t.cfg.Sampling {
+						if rule, ok := maskedColumnsRule(q, rEnv.Database, idxAdvisor.IndexColumns()); ok {
+							t.idxSuggest[rule.Item] = rule
+						}
+						if rule, ok := biasedSamplingRule(q, rEnv.Database); ok {
+							t.idxSuggest[rule.Item] = rule
+						}
+					}
+				} else {
+					// 根据错误号输出建议
+					switch vEnv.Error.(*mysql.MySQLError).Number {
+					case 1061:
+						t.idxSuggest["IDX.001"] = advisor.Rule{
+							Item:     "IDX.001",
+							Severity: "L2",
+							Summary:  "索引名称已存在",
+							Content:  strings.Trim(strings.Split(vEnv.Error.Error(), ":")[1], " "),
+							Case:     sql,
+						}
+					default:
+						// vEnv.VEnvBuild 阶段给出的 ERROR 是 ERR.001
+						delete(t.mysqlSuggest, "ERR.000")
+						t.mysqlSuggest["ERR.001"] = advisor.RuleMySQLError("ERR.001", vEnv.Error)
+						common.Log.Error("BuildVirtualEnv DDL Execute Error : %v", vEnv.Error)
+					}
+				}
+			}
+		} else {
+			common.Log.Error("vEnv.BuildVirtualEnv Error: prepare SQL '%s' in vEnv failed.", q.Query)
+		}
+	}
+	common.Log.Debug("end of index advisor Query: %s", q.Query)
+	// +++++++++++++++++++++索引优化建议[结束]+++++++++++++++++++++++}
+
+	// +++++++++++++++++++++EXPLAIN 建议[开始]+++++++++++++++++++++++{
+	// 如果未配置 Online 或 Test 无法给 Explain 建议
+	common.Log.Debug("start of explain Query: %s", q.Query)
+	if !t.cfg.OnlineDSN.Disable && !t.cfg.TestDSN.Disable {
+		// 因为 EXPLAIN 依赖数据库环境，所以把这段逻辑放在启发式建议和索引建议后面
+		if t.cfg.Explain {
+			// 执行 EXPLAIN
+			explainType := database.ExplainType[t.cfg.ExplainType]
+			formatType := database.ExplainFormatType[t.cfg.ExplainFormat]
+			// EXPLAIN ANALYZE 会实际执行查询，只能在测试环境中执行，无需先尝试线上环境
+			analyze := formatType == database.AnalyzeFormatExplain
+			var explainInfo *database.ExplainInfo
+			var err error
+			if !analyze {
+				explainInfo, err = rEnv.Explain(q.Query, explainType, formatType)
+				if err != nil {
+					// 线上环境执行失败才到测试环境 EXPLAIN，比如在用户提供建表语句及查询语句的场景
+					common.Log.Warn("rEnv.Explain Warn: %v", err)
+				}
+			}
+			if analyze || err != nil {
+				explainInfo, err = vEnv.Explain(q.Query, explainType, formatType)
+				if err != nil {
+					// EXPLAIN 阶段给出的 ERROR 是 ERR.002
+					t.mysqlSuggest["ERR.002"] = advisor.RuleMySQLError("ERR.002", err)
+					common.Log.Error("vEnv.Explain Error: %v", err)
+				}
+			}
+			// 分析 EXPLAIN 结果
+			if explainInfo != nil {
+				t.expSuggest = advisor.ExplainAdvisor(explainInfo)
+			} else {
+				common.Log.Warn("rEnv&vEnv.Explain explainInfo nil, SQL: %s", q.Query)
+			}
+		}
+	}
+	common.Log.Debug("end of explain Query: %s", q.Query)
+	// +++++++++++++++++++++ EXPLAIN 建议[结束]+++++++++++++++++++++++}
+
+	// +++++++++++++++++++++ Profiling [开始]+++++++++++++++++++++++++{
+	common.Log.Debug("start of profiling Query: %s", q.Query)
+	if t.cfg.Profiling {
+		res, content, err := vEnv.ProfilingReport(q.Query)
+		if err == nil {
+			t.proSuggest = advisor.ProfilingAdvisor(res, content)
+		} else {
+			common.Log.Error("Profiling Error: %v", err)
+		}
+	}
+	common.Log.Debug("end of profiling Query: %s", q.Query)
+	// +++++++++++++++++++++ Profiling [结束]++++++++++++++++++++++++++}
+
+	// +++++++++++++++++++++ Trace [开始]+++++++++++++++++++++++++{
+	common.Log.Debug("start of trace Query: %s", q.Query)
+	if t.cfg.Trace {
+		res, err := vEnv.Trace(q.Query)
+		if err == nil {
+			t.traceSuggest["TRA.001"] = advisor.Rule{
+				Item:     "TRA.001",
+				Severity: "L0",
+				Content:  database.FormatTraceSummary(res),
+			}
+		} else {
+			common.Log.Error("Trace Error: %v", err)
+		}
+	}
+	common.Log.Debug("end of trace Query: %s", q.Query)
+	// +++++++++++++++++++++Trace [结束]++++++++++++++++++++++++++}
+
+	// SQL 转写需要的源信息采集，如果没有配置环境则只做有限改写
+	if t.cfg.ReportType == "rewrite" && q.Stmt != nil {
+		t.columns = vEnv.GenTableColumns(ast.GetMeta(q.Stmt, nil))
+	}
+}
+
+// maskedColumnsRule SQL 中用到的表在采样时被脱敏的列，fake 不会改变散粒度，hash, null, truncate 可能影响索引建议
+// idxCols 为索引建议用到的列，其中未使用 fake 脱敏的列的散粒度不可靠，单独列出
+func maskedColumnsRule(q *advisor.Query4Audit, currentDB string, idxCols []*common.Column) (advisor.Rule, bool) {
+	if q.Stmt == nil {
+		return advisor.Rule{}, false
+	}
+	var cols []string
+	for db, meta := range ast.GetMeta(q.Stmt, nil) {
+		if db == "" {
+			db = currentDB
+		}
+		for _, tb := range meta.Table {
+			for _, col := range database.MaskedColumns(db, tb.TableName) {
+				cols = append(cols, fmt.Sprintf("%s.%s.%s", db, tb.TableName, col))
+			}
+		}
+	}
+	if len(cols) == 0 {
+		return advisor.Rule{}, false
+	}
+	sort.Strings(cols)
+
+	unreliable := make(map[string]bool)
+	for _, col := range idxCols {
+		db := col.DB
+		if db == "" {
+			db = currentDB
+		}
+		if strategy := database.MaskedColumnStrategy(db, col.Table, col.Name); strategy != "" && strategy != "fake" {
+			unreliable[fmt.Sprintf("%s.%s.%s", db, col.Table, col.Name)] = true
+		}
+	}
+	content := fmt.Sprintf("%s。fake 不会改变散粒度；hash 截断为原值的长度，较短的值可能冲突；null, truncate 会改变散粒度。", strings.Join(cols, ", "))
+	if len(unreliable) > 0 {
+		content += fmt.Sprintf("索引建议用到的列 %s 未使用 fake 脱敏，散粒度不可靠，相关索引建议仅供参考。", strings.Join(common.SortedKey(unreliable), ", "))
+	}
+	return advisor.Rule{
+		Item:     "SMP.001",
+		Severity: "L0",
+		Summary:  "采样数据中的脱敏列",
+		Content:  content,
+	}, true
+}
+
+// biasedSamplingRule SQL 中用到的表没有整型的单列主键或唯一索引，采样时只读取了前若干行，数据分布可能与全表不一致
+func biasedSamplingRule(q *advisor.Query4Audit, currentDB string) (advisor.Rule, bool) {
+	if q.Stmt == nil {
+		return advisor.Rule{}, false
+	}
+	var tables []string
+	for db, meta := range ast.GetMeta(q.Stmt, nil) {
+		if db == "" {
+			db = currentDB
+		}
+		for _, tb := range meta.Table {
+			if database.BiasedSampling(db, tb.TableName) {
+				tables = append(tables, fmt.Sprintf("%s.%s", db, tb.TableName))
+			}
+		}
+	}
+	if len(tables) == 0 {
+		return advisor.Rule{}, false
+	}
+	sort.Strings(tables)
+	return advisor.Rule{
+		Item:     "SMP.002",
+		Severity: "L0",
+		Summary:  "采样数据有偏",
+		Content:  fmt.Sprintf("%s 没有整型的单列主键或唯一索引，无法随机选取区间采样，只采集了表中的前若干行，数据分布可能与全表不一致，相关列的索引建议仅供参考。", strings.Join(tables, ", ")),
+	}, true
+}
+
+// auditPool 评审 worker 池，workers 小于等于 1 时在调用方 goroutine 中逐条评审
+// 评审结果按 Submit 的顺序交给 report 输出，report 只会在同一个 goroutine 中被调用
+// DDL 会改变测试环境中的表结构，提交时先等待之前的 SQL 评审完成，再在调用方 goroutine 中串行评审
+// worker 启动后 common.Config 只读，advisor, database, env 中的代码不经过 auditTask.cfg 直接读取
+type auditPool struct {
+	vEnv   *env.VirtualEnv
+	rEnv   *database.Connector
+	report func(*auditTask)
+
+	seq     int
+	tasks   chan *auditTask
+	results chan *auditTask
+	workers sync.WaitGroup
+	pending sync.WaitGroup // 已提交但还没有输出的任务
+	done    chan struct{}
+}
+
+// newAuditPool 创建评审 worker 池，每个 worker 使用独立复制的 vEnv, rEnv
+func newAuditPool(workers int, vEnv *env.VirtualEnv, rEnv *database.Connector, report func(*auditTask)) *auditPool {
+	p := &auditPool{
+		vEnv:   vEnv,
+		rEnv:   rEnv,
+		report: report,
+	}
+	if workers <= 1 {
+		return p
+	}
+
+	p.tasks = make(chan *auditTask, workers)
+	p.results = make(chan *auditTask, workers)
+	p.done = make(chan struct{})
+	for i := 0; i < workers; i++ {
+		p.workers.Add(1)
+		go p.work(vEnv.Clone(), rEnv.Clone())
+	}
+
+	// 按提交顺序输出评审结果
+	go func() {
+		pending := make(map[int]*auditTask)
+		next := 0
+		for t := range p.results {
+			pending[t.seq] = t
+			for {
+				r, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				p.report(r)
+				p.pending.Done()
+				next++
+			}
+		}
+		close(p.done)
+	}()
+	return p
+}
+
+// work 从任务队列中获取 SQL 进行评审
+func (p *auditPool) work(vEnv *env.VirtualEnv, rEnv *database.Connector) {
+	defer p.workers.Done()
+	defer func() {
+		if vEnv.Conn != p.vEnv.Conn {
+			common.LogIfWarn(vEnv.Conn.Close(), "")
+		}
+		if rEnv.Conn != p.rEnv.Conn {
+			common.LogIfWarn(rEnv.Conn.Close(), "")
+		}
+	}()
+
+	for t := range p.tasks {
+		// USE 语句的上下文在提交任务时已经确定，不依赖 worker 处理 SQL 的顺序
+		rEnv.Database = p.rEnv.Database
+		if t.useDB != "" {
+			rEnv.Database = t.useDB
+		}
+		t.audit(vEnv, rEnv)
+		p.results <- t
+	}
+}
+
+// Submit 提交评审任务
+func (p *auditPool) Submit(t *auditTask) {
+	if p.tasks == nil {
+		t.audit(p.vEnv, p.rEnv)
+		p.report(t)
+		return
+	}
+	t.seq = p.seq
+	p.seq++
+	if !isDDLTask(t) {
+		p.pending.Add(1)
+		p.tasks <- t
+		return
+	}
+
+	// 等待之前提交的 SQL 评审完成，避免其在 DDL 执行后的表结构上 EXPLAIN
+	p.pending.Wait()
+	p.pending.Add(1)
+	rEnv := *p.rEnv
+	if t.useDB != "" {
+		rEnv.Database = t.useDB
+	}
+	t.audit(p.vEnv, &rEnv)
+	p.results <- t
+	// DDL 输出后再提交之后的 SQL
+	p.pending.Wait()
+}
+
+// isDDLTask 判断评审任务是否会改变测试环境中的库表结构
+func isDDLTask(t *auditTask) bool {
+	if t.q == nil {
+		return false
+	}
+	switch t.q.Stmt.(type) {
+	case *sqlparser.DDL, *sqlparser.DBDDL:
+		return true
+	}
+	// Vitess 无法解析的 DDL 按 TiDB 的解析结果判断
+	if t.q.Stmt == nil {
+		for _, stmt := range t.q.TiStmt {
+			if _, ok := stmt.(tidb.DDLNode); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Wait 等待所有已提交的任务评审完成并输出，之后提交的任务将在调用方 goroutine 中逐条评审
+func (p *auditPool) Wait() {
+	if p.tasks == nil {
+		return
+	}
+	close(p.tasks)
+	p.workers.Wait()
+	close(p.results)
+	<-p.done
+	p.tasks = nil
+}
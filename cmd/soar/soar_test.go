@@ -22,9 +22,12 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 
+	"github.com/XiaoMi/soar/advisor"
 	"github.com/XiaoMi/soar/common"
+	"github.com/XiaoMi/soar/env"
 )
 
 var update = flag.Bool("update", false, "update .golden files")
@@ -69,7 +72,7 @@ func Test_Main_More(_ *testing.T) {
 	orgRerportType := common.Config.ReportType
 	for _, typ := range []string{
 		"json", "html", "markdown", "fingerprint", "compress", "pretty", "rewrite",
-		"ast", "tiast", "ast-json", "tiast-json", "tokenize", "lint", "tables", "query-type",
+		"ast", "tiast", "ast-json", "tiast-json", "tokenize", "lint", "tables", "query-type", "fix",
 	} {
 		common.Config.ReportType = typ
 		main()
@@ -181,3 +184,66 @@ func Test_Main_verboseInfo(t *testing.T) {
 	common.Config.Verbose = orgVerbose
 	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
 }
+
+func Test_Main_auditPool(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	orgParallel := common.Config.Parallel
+	vEnv, rEnv := env.BuildEnv()
+
+	sqls := []string{
+		"select * from film",
+		"use sakila",
+		"select col from tbl where col in (1, null)",
+		"select col from tbl group by col",
+		"alter table tbl add column c int",
+		"delete from tbl",
+		"select distinct * from film",
+	}
+	for _, parallel := range []int{1, 4} {
+		common.Config.Parallel = parallel
+		var reported []string
+		pool := newAuditPool(parallel, vEnv, rEnv, func(task *auditTask) {
+			reported = append(reported, task.sql)
+		})
+		for _, sql := range sqls {
+			task := newAuditTask(sql)
+			var err error
+			task.q, err = advisor.NewQuery4Audit(sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pool.Submit(task)
+		}
+		pool.Wait()
+		if strings.Join(reported, ";") != strings.Join(sqls, ";") {
+			t.Errorf("parallel %d, want: %v, got: %v", parallel, sqls, reported)
+		}
+	}
+	common.Config.Parallel = orgParallel
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func Test_Main_isDDLTask(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	for sql, ddl := range map[string]bool{
+		"alter table tbl add index idx_a (a)": true,
+		"create table tbl (a int)":            true,
+		"create database db":                  true,
+		"select * from tbl":                   false,
+		"insert into tbl values (1)":          false,
+		// Vitess 无法解析，只能通过 TiDB AST 判断
+		"create temporary table tbl (a int)":        true,
+		"create algorithm=merge view v as select 1": true,
+	} {
+		task := newAuditTask(sql)
+		var err error
+		task.q, err = advisor.NewQuery4Audit(sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isDDLTask(task) != ddl {
+			t.Errorf("%s want DDL %v", sql, ddl)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
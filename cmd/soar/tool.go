@@ -28,6 +28,9 @@ import (
 	"github.com/XiaoMi/soar/common"
 	"github.com/XiaoMi/soar/database"
 	"github.com/XiaoMi/soar/env"
+
+	"github.com/percona/go-mysql/query"
+	"vitess.io/vitess/go/vt/sqlparser"
 )
 
 // initConfig load config from default->file->cmdFlag
@@ -60,6 +63,11 @@ func initConfig() {
 		fmt.Println(err.Error())
 		os.Exit(1)
 	}
+	// 不支持的配置项取值直接退出
+	if err := common.ValidateConfig(); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
 
 	// 更新 HeuristicRules 中与配置相关的文字
 	advisor.InitHeuristicRules()
@@ -173,7 +181,7 @@ func reportTool(sql string, bom []byte) (isContinue bool, exitCode int) {
 		return false, 0
 	case "explain-digest":
 		// 当用户输入为 EXPLAIN 信息，只对 Explain 信息进行分析
-		// 注意： 这里只能处理一条 SQL 的 EXPLAIN 信息，用户一次反馈多条 SQL 的 EXPLAIN 信息无法处理
+		// 输入中可以包含多段 EXPLAIN 信息及产生它们的 SQL，每段分别给出分析结果
 		advisor.DigestExplainText(sql)
 		return false, 0
 	case "chardet":
@@ -192,6 +200,208 @@ func reportTool(sql string, bom []byte) (isContinue bool, exitCode int) {
 	}
 }
 
+// fixTool 根据启发式建议自动修复 SQL，输出修复后的 SQL 或修复前后的 unified diff
+// 无法自动修复的建议以注释的形式列在对应 SQL 之前
+func fixTool(buf string, vEnv *env.VirtualEnv, rEnv *database.Connector) string {
+	var fixed strings.Builder
+	for rest := buf; rest != ""; {
+		orgSQL, sql, bufBytes := ast.SplitStatement([]byte(rest), []byte(common.Config.Delimiter))
+		if len(rest) == len(bufBytes) {
+			// 防止切分死循环，当剩余的内容和原 SQL 相同时直接清空
+			orgSQL, sql, bufBytes = rest, rest, nil
+		}
+		rest = string(bufBytes)
+		lineStart := fixed.Len() == 0 || strings.HasSuffix(fixed.String(), "\n")
+		fixed.WriteString(fixStatement(orgSQL, sql, lineStart, vEnv, rEnv))
+	}
+
+	if !common.Config.FixDiff {
+		return fixed.String() + "\n"
+	}
+	name := "stdin"
+	if _, err := os.Stat(common.Config.Query); err == nil {
+		name = common.Config.Query
+	}
+	return common.UnifiedDiff(buf+"\n", fixed.String()+"\n", name, name)
+}
+
+// fixStatement 修复单条 SQL，orgSQL 为切分出的原始内容，包含前导空白及分隔符
+// lineStart 表示 orgSQL 是否从新的一行开始，否则需要换行后再输出注释
+func fixStatement(orgSQL, sql string, lineStart bool, vEnv *env.VirtualEnv, rEnv *database.Connector) string {
+	sql = database.RemoveSQLComments(sql)
+	if sql == "" || advisor.InBlackList(query.Fingerprint(sql)) {
+		return orgSQL
+	}
+	q, err := advisor.NewQuery4Audit(sql)
+	if err != nil {
+		common.Log.Warning("fixStatement syntax error, SQL: %s, Error: %v", sql, err)
+		return orgSQL
+	}
+
+	suggest := q.HeuristicCheck()
+	var columns common.TableColumns
+	if vEnv.BuildVirtualEnv(rEnv, q.Query) && vEnv.Error == nil {
+		// 依赖数据字典的启发式建议
+		idxAdvisor, err := advisor.NewAdvisor(vEnv, *rEnv, *q)
+		if err == nil && idxAdvisor != nil {
+			for i, r := range idxAdvisor.HeuristicCheck(*q) {
+				suggest[i] = r
+			}
+		}
+		// star2columns, insertcolumns 等修复规则需要表结构信息
+		columns = vEnv.GenTableColumns(ast.GetMeta(q.Stmt, nil))
+	}
+	newSQL, fixedRules, unfixed := advisor.Fix(sql, advisor.MergeConflictHeuristicRules(suggest), columns)
+
+	trimmed := strings.TrimLeft(orgSQL, " \t\r\n")
+	prefix := orgSQL[:len(orgSQL)-len(trimmed)]
+	if len(unfixed) > 0 && !lineStart && !strings.HasSuffix(prefix, "\n") {
+		prefix = strings.TrimRight(prefix, " \t") + "\n"
+	}
+	var buf strings.Builder
+	buf.WriteString(prefix)
+	for _, r := range unfixed {
+		buf.WriteString(fmt.Sprintf("-- %s %s\n", r.Item, r.Summary))
+	}
+	if len(fixedRules) > 0 {
+		// 修复只替换发生变化的部分，保留原始语句的注释、大小写及空白
+		stmt := strings.TrimSuffix(strings.TrimRight(trimmed, " \t\r\n"), common.Config.Delimiter)
+		buf.WriteString(ast.ApplyRewriteText(stmt, newSQL))
+		if suffix := trimmed[len(stmt):]; suffix != "" {
+			buf.WriteString(suffix)
+		} else {
+			buf.WriteString(common.Config.Delimiter)
+		}
+	} else {
+		buf.WriteString(trimmed)
+	}
+	return buf.String()
+}
+
+// workloadIndexTool 汇总所有 SQL 的候选索引，以表为单位给出合并后的索引建议
+// 相同 fingerprint 的 SQL 只分析一次，出现次数作为索引取舍的权重
+func workloadIndexTool(buf string, vEnv *env.VirtualEnv, rEnv *database.Connector) string {
+	workload := advisor.NewWorkloadIndexAdvisor()
+	for rest := buf; rest != ""; {
+		_, sql, bufBytes := ast.SplitStatement([]byte(rest), []byte(common.Config.Delimiter))
+		if len(rest) == len(bufBytes) {
+			sql, bufBytes = rest, nil
+		}
+		rest = string(bufBytes)
+
+		sql = database.RemoveSQLComments(sql)
+		fingerprint := strings.TrimSpace(query.Fingerprint(sql))
+		if sql == "" || advisor.InBlackList(fingerprint) {
+			continue
+		}
+		// `use ?` 需要每次都执行，用于切换数据库
+		id := query.Id(fingerprint)
+		if !workload.Add(id, sql) && !strings.HasPrefix(fingerprint, "use") {
+			continue
+		}
+		q, err := advisor.NewQuery4Audit(sql)
+		if err != nil {
+			common.Log.Warning("workloadIndexTool syntax error, SQL: %s, Error: %v", sql, err)
+			continue
+		}
+		if !vEnv.BuildVirtualEnv(rEnv, q.Query) || vEnv.Error != nil {
+			common.Log.Warning("workloadIndexTool BuildVirtualEnv failed, SQL: %s, Error: %v", sql, vEnv.Error)
+			continue
+		}
+		idxAdvisor, err := advisor.NewAdvisor(vEnv, *rEnv, *q)
+		if err != nil || idxAdvisor == nil {
+			continue
+		}
+		workload.AddAdvises(id, idxAdvisor, idxAdvisor.ValidateIndexAdvise(q.Query, idxAdvisor.IndexAdvise()))
+	}
+	return advisor.FormatWorkloadAdvise(workload.Advise())
+}
+
+// planRegressionTool 对比 SQL 在线上环境与测试环境中的执行计划，用于数据库升级前检查关键 SQL 的执行计划是否发生变化
+// 测试环境需要与线上环境有相同的库表结构，EXPLAIN 直接在 -test-dsn 指定的库中执行，不创建临时库
+func planRegressionTool(buf string, vEnv *env.VirtualEnv, rEnv *database.Connector) string {
+	if common.Config.OnlineDSN.Disable || common.Config.TestDSN.Disable {
+		return "plan-regression 需要可用的 -online-dsn 及 -test-dsn\n"
+	}
+	// 两个环境版本不同，EXPLAIN 语法按各自的版本决定
+	base := *rEnv
+	base.ServerVersion = common.Config.OnlineDSN.Version
+	target := *vEnv.Connector
+	target.ServerVersion = common.Config.TestDSN.Version
+	if target.Database == "" {
+		target.Database = base.Database
+	}
+	checker := advisor.NewPlanRegressionChecker(
+		fmt.Sprintf("%s (%d)", common.Config.OnlineDSN.Addr, common.Config.OnlineDSN.Version),
+		fmt.Sprintf("%s (%d)", common.Config.TestDSN.Addr, common.Config.TestDSN.Version))
+	checked := make(map[string]bool)
+	for rest := buf; rest != ""; {
+		_, sql, bufBytes := ast.SplitStatement([]byte(rest), []byte(common.Config.Delimiter))
+		if len(rest) == len(bufBytes) {
+			sql, bufBytes = rest, nil
+		}
+		rest = string(bufBytes)
+
+		sql = strings.TrimSpace(database.RemoveSQLComments(sql))
+		fingerprint := strings.TrimSpace(query.Fingerprint(sql))
+		if sql == "" || advisor.InBlackList(fingerprint) {
+			continue
+		}
+		// USE 语句在两个环境中同时切换数据库
+		if strings.HasPrefix(fingerprint, "use") {
+			if stmt, err := sqlparser.Parse(sql); err == nil {
+				if use, ok := stmt.(*sqlparser.Use); ok {
+					base.Database = use.DBName.String()
+					target.Database = use.DBName.String()
+				}
+			}
+			continue
+		}
+		id := query.Id(fingerprint)
+		if checked[id] {
+			continue
+		}
+		checked[id] = true
+
+		baseExp, baseErr := base.Explain(sql, database.TraditionalExplainType, database.JSONFormatExplain)
+		targetExp, targetErr := target.Explain(sql, database.TraditionalExplainType, database.JSONFormatExplain)
+		checker.Compare(id, sql, baseExp, targetExp, baseErr, targetErr)
+	}
+	return checker.Format()
+}
+
+// snapshotTool 采集线上环境快照并保存到 -snapshot 指定的文件
+// 如果指定了 -query，其中 SQL 使用到的库都会被采集，使用到的列会计算散粒度
+func snapshotTool(rEnv *database.Connector) int {
+	meta := make(common.Meta)
+	if common.Config.Query != "" {
+		buf := initQuery(common.Config.Query)
+		for rest := buf; rest != ""; {
+			_, sql, bufBytes := ast.SplitStatement([]byte(rest), []byte(common.Config.Delimiter))
+			if len(rest) == len(bufBytes) {
+				sql, bufBytes = rest, nil
+			}
+			rest = string(bufBytes)
+			stmt, err := sqlparser.Parse(database.RemoveSQLComments(sql))
+			if err != nil {
+				continue
+			}
+			meta = ast.GetMeta(stmt, meta)
+		}
+	}
+
+	snapshot, err := rEnv.TakeSnapshot(meta)
+	if err != nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+	if err = snapshot.Save(common.Config.Snapshot); err != nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+	return 0
+}
+
 // initQuery
 func initQuery(query string) string {
 	// 读入待优化 SQL ，当配置文件或命令行参数未指定 SQL 时从管道读取
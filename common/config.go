@@ -51,19 +51,36 @@ var (
 // Configuration 配置文件定义结构体
 type Configuration struct {
 	// +++++++++++++++测试环境+++++++++++++++++
-	OnlineDSN               *Dsn   `yaml:"online-dsn"`                // 线上环境数据库配置
-	TestDSN                 *Dsn   `yaml:"test-dsn"`                  // 测试环境数据库配置
-	AllowOnlineAsTest       bool   `yaml:"allow-online-as-test"`      // 允许 Online 环境也可以当作 Test 环境
-	DropTestTemporary       bool   `yaml:"drop-test-temporary"`       // 是否清理Test环境产生的临时库表
-	CleanupTestDatabase     bool   `yaml:"cleanup-test-database"`     // 清理残余的测试数据库（程序异常退出或未开启drop-test-temporary）  issue #48
-	OnlySyntaxCheck         bool   `yaml:"only-syntax-check"`         // 只做语法检查不输出优化建议
-	SamplingStatisticTarget int    `yaml:"sampling-statistic-target"` // 数据采样因子，对应 PostgreSQL 的 default_statistics_target
-	Sampling                bool   `yaml:"sampling"`                  // 数据采样开关
-	SamplingCondition       string `yaml:"sampling-condition"`        // 指定采样条件，如：WHERE xxx LIMIT xxx;
-	Profiling               bool   `yaml:"profiling"`                 // 在开启数据采样的情况下，在测试环境执行进行profile
-	Trace                   bool   `yaml:"trace"`                     // 在开启数据采样的情况下，在测试环境执行进行Trace
-	Explain                 bool   `yaml:"explain"`                   // Explain开关
-	Delimiter               string `yaml:"delimiter"`                 // SQL分隔符
+	OnlineDSN               *Dsn     `yaml:"online-dsn"`                // 线上环境数据库配置
+	TestDSN                 *Dsn     `yaml:"test-dsn"`                  // 测试环境数据库配置
+	Schema                  string   `yaml:"schema"`                    // 离线数据字典，建表语句或 mysqldump --no-data 文件，多个文件用逗号分隔
+	Snapshot                string   `yaml:"snapshot"`                  // 采集线上环境库表结构及统计信息快照并保存到指定文件
+	OnlineSnapshot          string   `yaml:"online-snapshot"`           // 使用 -snapshot 采集的快照文件代替线上环境
+	AllowOnlineAsTest       bool     `yaml:"allow-online-as-test"`      // 允许 Online 环境也可以当作 Test 环境
+	DropTestTemporary       bool     `yaml:"drop-test-temporary"`       // 是否清理Test环境产生的临时库表
+	CleanupTestDatabase     bool     `yaml:"cleanup-test-database"`     // 清理残余的测试数据库（程序异常退出或未开启drop-test-temporary）  issue #48
+	OnlySyntaxCheck         bool     `yaml:"only-syntax-check"`         // 只做语法检查不输出优化建议
+	SamplingStatisticTarget int      `yaml:"sampling-statistic-target"` // 数据采样因子，对应 PostgreSQL 的 default_statistics_target
+	Sampling                bool     `yaml:"sampling"`                  // 数据采样开关
+	SamplingCondition       string   `yaml:"sampling-condition"`        // 指定采样条件，如：WHERE xxx LIMIT xxx;
+	SamplingParallel        int      `yaml:"sampling-parallel"`         // 并发采样的表数量
+	SamplingChunks          int      `yaml:"sampling-chunks"`           // 每张表按主键随机选取的区间个数
+	SamplingMaxBytes        int64    `yaml:"sampling-max-bytes"`        // 每张表采样的最大数据量（字节）
+	SamplingSeed            int64    `yaml:"sampling-seed"`             // 采样随机数种子，为 0 时每次随机，指定后采样结果可复现
+	SamplingMask            []string `yaml:"sampling-mask"`             // 采样数据脱敏规则，如 column:(?i)phone=fake, type:BLOB=null, db.table.column=hash
+	SamplingMaskKey         string   `yaml:"sampling-mask-key"`         // hash, fake 脱敏使用的密钥，为空时每次运行随机生成，需要保密
+	Synthetic               bool     `yaml:"synthetic"`                 // 数据合成开关，根据线上环境的统计信息生成测试数据，不读取线上数据
+	SyntheticMaxRows        int64    `yaml:"synthetic-max-rows"`        // 每张表合成的最大行数
+	FixtureDir              string   `yaml:"fixture-dir"`               // 测试数据 CSV 文件目录，文件名为 db.table.csv 或 table.csv
+	FixtureDump             []string `yaml:"fixture-dump"`              // 测试数据 mysqldump 文件，只导入其中的 INSERT, REPLACE 语句
+	Profiling               bool     `yaml:"profiling"`                 // 在开启数据采样的情况下，在测试环境执行进行profile
+	ProfilingBackend        string   `yaml:"profiling-backend"`         // Profiling 信息来源，performance_schema 或 profile(SHOW PROFILE)
+	ProfilingMaxExamined    float64  `yaml:"profiling-max-examined"`    // 扫描行数与返回行数之比超过该配置给出 PRO.004 警告
+	ProfilingMaxLockTime    float64  `yaml:"profiling-max-lock-time"`   // 锁等待时间超过该配置（毫秒）给出 PRO.005 警告
+	Trace                   bool     `yaml:"trace"`                     // 在开启数据采样的情况下，在测试环境执行进行Trace
+	Explain                 bool     `yaml:"explain"`                   // Explain开关
+	Delimiter               string   `yaml:"delimiter"`                 // SQL分隔符
+	Parallel                int      `yaml:"parallel"`                  // 并发评审的 worker 数量，小于等于 1 时逐条评审
 
 	// +++++++++++++++日志相关+++++++++++++++++
 	// 日志级别，这里使用了 beego 的 log 包
@@ -87,6 +104,8 @@ type Configuration struct {
 	// ++++++++++++++优化建议相关++++++++++++++
 	IgnoreRules          []string `yaml:"ignore-rules"`              // 忽略的优化建议规则
 	RewriteRules         []string `yaml:"rewrite-rules"`             // 生效的重写规则
+	FixDiff              bool     `yaml:"fix-diff"`                  // -report-type fix 时输出 unified diff 而非修复后的 SQL
+	FixUnsafe            bool     `yaml:"fix-unsafe"`                // -report-type fix 时自动执行 innull, distinctstar 等可能改变查询结果的重写规则
 	BlackList            string   `yaml:"blacklist"`                 // blacklist 中的 SQL 不会被评审，可以是指纹，也可以是正则
 	MaxJoinTableCount    int      `yaml:"max-join-table-count"`      // 单条 SQL 中 JOIN 表的最大数量
 	MaxGroupByColsCount  int      `yaml:"max-group-by-cols-count"`   // 单条 SQL 中 GroupBy 包含列的最大数量
@@ -97,9 +116,13 @@ type Configuration struct {
 	MaxQueryCost         int64    `yaml:"max-query-cost"`            // last_query_cost 超过该值时将给予警告
 	SpaghettiQueryLength int      `yaml:"spaghetti-query-length"`    // SQL最大长度警告，超过该长度会给警告
 	AllowDropIndex       bool     `yaml:"allow-drop-index"`          // 允许输出删除重复索引的建议
+	CoveringIndex        bool     `yaml:"covering-index"`            // 将 SELECT 中的列追加到索引末尾，额外给出可选的覆盖索引建议
+	ValidateIndex        bool     `yaml:"validate-index"`            // 在测试环境中临时添加建议的索引，对比前后执行计划，剔除优化器不使用的索引
+	MinIdxReads          int64    `yaml:"min-index-reads"`           // 按实例运行时长折算，平均每天读取行数低于该值的索引认为很少使用
 	MaxInCount           int      `yaml:"max-in-count"`              // IN()最大数量
 	MaxIdxBytesPerColumn int      `yaml:"max-index-bytes-percolumn"` // 索引中单列最大字节数，默认767
 	MaxIdxBytes          int      `yaml:"max-index-bytes"`           // 索引总长度限制，默认3072
+	PrefixTolerance      float64  `yaml:"prefix-tolerance"`          // 前缀索引的选择性与整列相差不超过该比例时即可采用，范围 0~1
 	AllowCharsets        []string `yaml:"allow-charsets"`            // 允许使用的 DEFAULT CHARSET
 	AllowCollates        []string `yaml:"allow-collates"`            // 允许使用的 COLLATE
 	AllowEngines         []string `yaml:"allow-engines"`             // 允许使用的存储引擎
@@ -116,7 +139,7 @@ type Configuration struct {
 	// ++++++++++++++EXPLAIN检查项+++++++++++++
 	ExplainSQLReportType   string   `yaml:"explain-sql-report-type"`  // EXPLAIN markdown 格式输出 SQL 样式，支持 sample, fingerprint, pretty 等
 	ExplainType            string   `yaml:"explain-type"`             // EXPLAIN方式 [traditional, extended, partitions]
-	ExplainFormat          string   `yaml:"explain-format"`           // FORMAT=[json, traditional]
+	ExplainFormat          string   `yaml:"explain-format"`           // FORMAT=[json, traditional, tree, analyze]
 	ExplainWarnSelectType  []string `yaml:"explain-warn-select-type"` // 哪些 select_type 不建议使用
 	ExplainWarnAccessType  []string `yaml:"explain-warn-access-type"` // 哪些 access type 不建议使用
 	ExplainMaxKeyLength    int      `yaml:"explain-max-keys"`         // 最大 key_len
@@ -125,6 +148,9 @@ type Configuration struct {
 	ExplainWarnExtra       []string `yaml:"explain-warn-extra"`       // 哪些 extra 信息会给警告
 	ExplainMaxFiltered     float64  `yaml:"explain-max-filtered"`     // filtered 大于该配置给出警告
 	ExplainWarnScalability []string `yaml:"explain-warn-scalability"` // 复杂度警告名单
+	ExplainMaxMisestimate  float64  `yaml:"explain-max-misestimate"`  // EXPLAIN ANALYZE 中实际行数与预估行数相差的倍数超过该配置给出警告
+	ExplainMaxLoops        int64    `yaml:"explain-max-loops"`        // EXPLAIN ANALYZE 中嵌套循环内迭代器的执行次数超过该配置给出警告
+	ExplainPlanFormat      string   `yaml:"explain-plan-format"`      // 以树形展示执行计划 [ascii, dot, mermaid]，为空时不展示
 	ShowWarnings           bool     `yaml:"show-warnings"`            // explain extended with show warnings
 	ShowLastQueryCost      bool     `yaml:"show-last-query-cost"`     // switch with show status like 'last_query_cost'
 	// ++++++++++++++其他配置项+++++++++++++++
@@ -139,6 +165,7 @@ type Configuration struct {
 }
 
 // Config 默认设置
+// 参数解析完成、-parallel 的评审 worker 启动后只读，advisor, database, env 在评审过程中直接读取，不能再修改
 var Config = &Configuration{
 	OnlineDSN:               newDSN(nil),
 	TestDSN:                 newDSN(nil),
@@ -149,10 +176,27 @@ var Config = &Configuration{
 	OnlySyntaxCheck:         false,
 	SamplingStatisticTarget: 100,
 	Sampling:                false,
+	SamplingParallel:        4,
+	SamplingChunks:          10,
+	SamplingMaxBytes:        64 * 1024 * 1024,
+	SamplingSeed:            0,
+	SamplingMask:            []string{},
+	SamplingMaskKey:         "",
+	Synthetic:               false,
+	SyntheticMaxRows:        100000,
+	FixtureDir:              "",
+	FixtureDump:             []string{},
 	Profiling:               false,
+	ProfilingBackend:        "performance_schema",
+	ProfilingMaxExamined:    100,
+	ProfilingMaxLockTime:    100,
 	Trace:                   false,
 	Explain:                 true,
 	Delimiter:               ";",
+	Parallel:                1,
+	Schema:                  "",
+	Snapshot:                "",
+	OnlineSnapshot:          "",
 	MinCardinality:          0,
 
 	MaxJoinTableCount:    5,
@@ -162,10 +206,14 @@ var Config = &Configuration{
 	MaxTextColsCount:     2,
 	MaxIdxBytesPerColumn: 767,
 	MaxIdxBytes:          3072,
+	PrefixTolerance:      0.01,
 	MaxTotalRows:         9999999,
 	MaxQueryCost:         9999,
 	SpaghettiQueryLength: 2048,
 	AllowDropIndex:       false,
+	CoveringIndex:        false,
+	ValidateIndex:        false,
+	MinIdxReads:          10,
 	LogLevel:             3,
 	LogOutput:            "soar.log",
 	ReportType:           "markdown",
@@ -200,6 +248,9 @@ var Config = &Configuration{
 	ExplainWarnExtra:       []string{"Using temporary", "Using filesort"},
 	ExplainMaxFiltered:     100.0,
 	ExplainWarnScalability: []string{"O(n)"},
+	ExplainMaxMisestimate:  10,
+	ExplainMaxLoops:        1000,
+	ExplainPlanFormat:      "",
 	ShowWarnings:           false,
 	ShowLastQueryCost:      false,
 
@@ -216,6 +267,8 @@ var Config = &Configuration{
 		"insertcolumns",
 		"distinctstar",
 	},
+	FixDiff:   false,
+	FixUnsafe: false,
 
 	ListHeuristicRules: false,
 	ListRewriteRules:   false,
@@ -245,10 +298,14 @@ type Dsn struct {
 	AllowNativePasswords bool `yaml:"allow-native-passwords"` // Allows the native password authentication method
 	AllowOldPasswords    bool `yaml:"allow-old-passwords"`    // Allows the old insecure password method
 
-	Disable bool `yaml:"disable"`
-	Version int  `yaml:"-"` // 版本自动检查，不可配置
+	Disable  bool `yaml:"disable"`
+	Embedded bool `yaml:"embedded"` // 使用进程内嵌的 TiDB 作为测试环境，DSN 配置为 embedded://
+	Version  int  `yaml:"-"`        // 版本自动检查，不可配置
 }
 
+// EmbeddedDSN 内嵌 TiDB 测试环境的 DSN 标识
+const EmbeddedDSN = "embedded://"
+
 // newDSN create default Dsn struct
 func newDSN(cfg *mysql.Config) *Dsn {
 	dsn := &Dsn{
@@ -443,6 +500,17 @@ func parseDSN(odbc string, d *Dsn) *Dsn {
 
 // ParseDSN compatible with old version soar < 0.11.0
 func ParseDSN(odbc string, d *Dsn) *Dsn {
+	// embedded:// 使用内嵌 TiDB，监听地址等信息在环境初始化时补全
+	if strings.TrimSpace(odbc) == EmbeddedDSN {
+		if d != nil && d.Embedded {
+			return d
+		}
+		dsn := newDSN(nil)
+		dsn.User = "root"
+		dsn.Schema = "test" // TiDB 启动时默认创建的库
+		dsn.Embedded = true
+		return dsn
+	}
 	cfg, err := mysql.ParseDSN(odbc)
 	if err != nil {
 		// Log.Debug("go-sql-driver/mysql.ParseDSN Error: %s, DSN: %s, try to use old version parseDSN", err.Error(), odbc)
@@ -456,6 +524,9 @@ func FormatDSN(env *Dsn) string {
 	if env == nil || env.Disable {
 		return ""
 	}
+	if env.Embedded && env.Addr == "" {
+		return EmbeddedDSN
+	}
 	dsn, err := env.newMySQLConfig()
 	if err != nil {
 		return ""
@@ -545,6 +616,9 @@ func PrintConfiguration() {
 	if !Config.Verbose {
 		Config.OnlineDSN.Password = "********"
 		Config.TestDSN.Password = "********"
+		if Config.SamplingMaskKey != "" {
+			Config.SamplingMaskKey = "********"
+		}
 	}
 	data, _ := yaml.Marshal(Config)
 	fmt.Print(string(data))
@@ -583,18 +657,35 @@ func readCmdFlags() error {
 	_ = flag.String("config", "", "Config file path")
 	// +++++++++++++++测试环境+++++++++++++++++
 	onlineDSN := flag.String("online-dsn", FormatDSN(Config.OnlineDSN), "OnlineDSN, 线上环境数据库配置, username:password@tcp(ip:port)/schema")
-	testDSN := flag.String("test-dsn", FormatDSN(Config.TestDSN), "TestDSN, 测试环境数据库配置, username:password@tcp(ip:port)/schema")
+	testDSN := flag.String("test-dsn", FormatDSN(Config.TestDSN), "TestDSN, 测试环境数据库配置, username:password@tcp(ip:port)/schema, 配置为 embedded:// 时使用内嵌 TiDB 作为测试环境")
+	schema := flag.String("schema", Config.Schema, "Schema, 离线数据字典，指定建表语句或 mysqldump --no-data 导出的文件，多个文件用逗号分隔，测试环境不可用时代替测试环境提供库表结构")
+	snapshot := flag.String("snapshot", Config.Snapshot, "Snapshot, 采集线上环境库表结构及统计信息快照并保存到指定文件，用于 -online-snapshot 离线评审")
+	onlineSnapshot := flag.String("online-snapshot", Config.OnlineSnapshot, "OnlineSnapshot, 使用 -snapshot 采集的快照文件代替线上环境")
 	allowOnlineAsTest := flag.Bool("allow-online-as-test", Config.AllowOnlineAsTest, "AllowOnlineAsTest, 允许线上环境也可以当作测试环境")
 	dropTestTemporary := flag.Bool("drop-test-temporary", Config.DropTestTemporary, "DropTestTemporary, 是否清理测试环境产生的临时库表")
 	cleanupTestDatabase := flag.Bool("cleanup-test-database", Config.CleanupTestDatabase, "单次运行清理历史1小时前残余的测试库。")
 	onlySyntaxCheck := flag.Bool("only-syntax-check", Config.OnlySyntaxCheck, "OnlySyntaxCheck, 只做语法检查不输出优化建议")
 	profiling := flag.Bool("profiling", Config.Profiling, "Profiling, 开启数据采样的情况下在测试环境执行Profile")
+	profilingBackend := flag.String("profiling-backend", Config.ProfilingBackend, "ProfilingBackend, Profiling信息来源，支持 performance_schema, profile(SHOW PROFILE)")
+	profilingMaxExamined := flag.Float64("profiling-max-examined", Config.ProfilingMaxExamined, "ProfilingMaxExamined, 扫描行数与返回行数之比超过该配置给出警告")
+	profilingMaxLockTime := flag.Float64("profiling-max-lock-time", Config.ProfilingMaxLockTime, "ProfilingMaxLockTime, 锁等待时间超过该配置（毫秒）给出警告")
 	trace := flag.Bool("trace", Config.Trace, "Trace, 开启数据采样的情况下在测试环境执行Trace")
 	explain := flag.Bool("explain", Config.Explain, "Explain, 是否开启Explain执行计划分析")
 	sampling := flag.Bool("sampling", Config.Sampling, "Sampling, 数据采样开关")
 	samplingStatisticTarget := flag.Int("sampling-statistic-target", Config.SamplingStatisticTarget, "SamplingStatisticTarget, 数据采样因子，对应 PostgreSQL 的 default_statistics_target")
 	samplingCondition := flag.String("sampling-condition", Config.SamplingCondition, "SamplingCondition, 数据采样条件，如： WHERE xxx LIMIT xxx")
+	samplingParallel := flag.Int("sampling-parallel", Config.SamplingParallel, "SamplingParallel, 并发采样的表数量")
+	samplingChunks := flag.Int("sampling-chunks", Config.SamplingChunks, "SamplingChunks, 每张表按主键随机选取的区间个数")
+	samplingMaxBytes := flag.Int64("sampling-max-bytes", Config.SamplingMaxBytes, "SamplingMaxBytes, 每张表采样的最大数据量（字节）")
+	samplingMask := flag.String("sampling-mask", strings.Join(Config.SamplingMask, ","), "SamplingMask, 采样数据脱敏规则，格式为 目标=策略，目标支持 column:列名正则, type:数据类型, db.table.column，策略支持 hash, fake, null, truncate[:n]，多条规则用逗号分隔")
+	samplingMaskKey := flag.String("sampling-mask-key", Config.SamplingMaskKey, "SamplingMaskKey, hash, fake 脱敏使用的密钥，为空时每次运行随机生成，指定后脱敏结果可复现，需要保密")
+	samplingSeed := flag.Int64("sampling-seed", Config.SamplingSeed, "SamplingSeed, 采样随机数种子，为0时每次随机，指定后采样结果可复现")
+	synthetic := flag.Bool("synthetic", Config.Synthetic, "Synthetic, 数据合成开关，根据线上环境的行数、散粒度、直方图及外键生成测试数据，不读取线上数据")
+	syntheticMaxRows := flag.Int64("synthetic-max-rows", Config.SyntheticMaxRows, "SyntheticMaxRows, 每张表合成的最大行数")
+	fixtureDir := flag.String("fixture-dir", Config.FixtureDir, "FixtureDir, 测试数据 CSV 文件目录，文件名为 db.table.csv 或 table.csv，第一行为列名，\\N 表示 NULL")
+	fixtureDump := flag.String("fixture-dump", strings.Join(Config.FixtureDump, ","), "FixtureDump, 测试数据 mysqldump 文件，只导入其中的 INSERT, REPLACE 语句，多个文件用逗号分隔")
 	delimiter := flag.String("delimiter", Config.Delimiter, "Delimiter, SQL分隔符")
+	parallel := flag.Int("parallel", Config.Parallel, "Parallel, 并发评审的 worker 数量，输出顺序与输入保持一致")
 	minCardinality := flag.Float64("min-cardinality", Config.MinCardinality, "MinCardinality，索引列散粒度最低阈值，散粒度低于该值的列不添加索引，建议范围0.0 ~ 100.0")
 	// +++++++++++++++日志相关+++++++++++++++++
 	logLevel := flag.Int("log-level", Config.LogLevel, "LogLevel, 日志级别, [0:Emergency, 1:Alert, 2:Critical, 3:Error, 4:Warning, 5:Notice, 6:Informational, 7:Debug]")
@@ -609,6 +700,8 @@ func readCmdFlags() error {
 	// ++++++++++++++优化建议相关++++++++++++++
 	ignoreRules := flag.String("ignore-rules", strings.Join(Config.IgnoreRules, ","), "IgnoreRules, 忽略的优化建议规则")
 	rewriteRules := flag.String("rewrite-rules", strings.Join(Config.RewriteRules, ","), "RewriteRules, 生效的重写规则")
+	fixDiff := flag.Bool("fix-diff", Config.FixDiff, "FixDiff, -report-type fix 时输出修复前后的 unified diff 而非修复后的 SQL")
+	fixUnsafe := flag.Bool("fix-unsafe", Config.FixUnsafe, "FixUnsafe, -report-type fix 时自动执行 innull, distinctstar 等可能改变查询结果的重写规则，默认只作为建议列出")
 	blackList := flag.String("blacklist", Config.BlackList, "指定 blacklist 配置文件的位置，文件中的 SQL 不会被评审。一行一条SQL，可以是指纹，也可以是正则")
 	maxJoinTableCount := flag.Int("max-join-table-count", Config.MaxJoinTableCount, "MaxJoinTableCount, 单条 SQL 中 JOIN 表的最大数量")
 	maxGroupByColsCount := flag.Int("max-group-by-cols-count", Config.MaxGroupByColsCount, "MaxGroupByColsCount, 单条 SQL 中 GroupBy 包含列的最大数量")
@@ -619,9 +712,13 @@ func readCmdFlags() error {
 	maxQueryCost := flag.Int64("max-query-cost", Config.MaxQueryCost, "MaxQueryCost, last_query_cost 超过该值时将给予警告")
 	spaghettiQueryLength := flag.Int("spaghetti-query-length", Config.SpaghettiQueryLength, "SpaghettiQueryLength, SQL最大长度警告，超过该长度会给警告")
 	allowDropIdx := flag.Bool("allow-drop-index", Config.AllowDropIndex, "AllowDropIndex, 允许输出删除重复索引的建议")
+	coveringIdx := flag.Bool("covering-index", Config.CoveringIndex, "CoveringIndex, 将 SELECT 中的列追加到索引末尾，额外给出可选的覆盖索引建议")
+	validateIdx := flag.Bool("validate-index", Config.ValidateIndex, "ValidateIndex, 在测试环境中临时添加建议的索引，对比前后执行计划，剔除优化器不使用的索引")
+	minIdxReads := flag.Int64("min-index-reads", Config.MinIdxReads, "MinIdxReads, 按实例运行时长折算，平均每天读取行数低于该值的索引认为很少使用")
 	maxInCount := flag.Int("max-in-count", Config.MaxInCount, "MaxInCount, IN()最大数量")
 	maxIdxBytesPerColumn := flag.Int("max-index-bytes-percolumn", Config.MaxIdxBytesPerColumn, "MaxIdxBytesPerColumn, 索引中单列最大字节数")
 	maxIdxBytes := flag.Int("max-index-bytes", Config.MaxIdxBytes, "MaxIdxBytes, 索引总长度限制")
+	prefixTolerance := flag.Float64("prefix-tolerance", Config.PrefixTolerance, "PrefixTolerance, 前缀索引的选择性与整列相差不超过该比例时即可采用，范围 0~1")
 	allowCharsets := flag.String("allow-charsets", strings.ToLower(strings.Join(Config.AllowCharsets, ",")), "AllowCharsets")
 	allowCollates := flag.String("allow-collates", strings.ToLower(strings.Join(Config.AllowCollates, ",")), "AllowCollates")
 	allowEngines := flag.String("allow-engines", strings.ToLower(strings.Join(Config.AllowEngines, ",")), "AllowEngines")
@@ -636,7 +733,7 @@ func readCmdFlags() error {
 	// ++++++++++++++EXPLAIN检查项+++++++++++++
 	explainSQLReportType := flag.String("explain-sql-report-type", strings.ToLower(Config.ExplainSQLReportType), "ExplainSQLReportType [pretty, sample, fingerprint]")
 	explainType := flag.String("explain-type", strings.ToLower(Config.ExplainType), "ExplainType [extended, partitions, traditional]")
-	explainFormat := flag.String("explain-format", strings.ToLower(Config.ExplainFormat), "ExplainFormat [json, traditional]")
+	explainFormat := flag.String("explain-format", strings.ToLower(Config.ExplainFormat), "ExplainFormat [json, traditional, tree, analyze]")
 	explainWarnSelectType := flag.String("explain-warn-select-type", strings.Join(Config.ExplainWarnSelectType, ","), "ExplainWarnSelectType, 哪些select_type不建议使用")
 	explainWarnAccessType := flag.String("explain-warn-access-type", strings.Join(Config.ExplainWarnAccessType, ","), "ExplainWarnAccessType, 哪些access type不建议使用")
 	explainMaxKeyLength := flag.Int("explain-max-keys", Config.ExplainMaxKeyLength, "ExplainMaxKeyLength, 最大key_len")
@@ -645,6 +742,9 @@ func readCmdFlags() error {
 	explainWarnExtra := flag.String("explain-warn-extra", strings.Join(Config.ExplainWarnExtra, ","), "ExplainWarnExtra, 哪些extra信息会给警告")
 	explainMaxFiltered := flag.Float64("explain-max-filtered", Config.ExplainMaxFiltered, "ExplainMaxFiltered, filtered大于该配置给出警告")
 	explainWarnScalability := flag.String("explain-warn-scalability", strings.Join(Config.ExplainWarnScalability, ","), "ExplainWarnScalability, 复杂度警告名单, 支持O(n),O(log n),O(1),O(?)")
+	explainMaxMisestimate := flag.Float64("explain-max-misestimate", Config.ExplainMaxMisestimate, "ExplainMaxMisestimate, EXPLAIN ANALYZE中实际行数与预估行数相差的倍数超过该配置给出警告")
+	explainMaxLoops := flag.Int64("explain-max-loops", Config.ExplainMaxLoops, "ExplainMaxLoops, EXPLAIN ANALYZE中嵌套循环内迭代器的执行次数超过该配置给出警告")
+	explainPlanFormat := flag.String("explain-plan-format", strings.ToLower(Config.ExplainPlanFormat), "ExplainPlanFormat, 以树形展示执行计划 [ascii, dot, mermaid]，为空时不展示")
 	showWarnings := flag.Bool("show-warnings", Config.ShowWarnings, "ShowWarnings")
 	showLastQueryCost := flag.Bool("show-last-query-cost", Config.ShowLastQueryCost, "ShowLastQueryCost")
 	// +++++++++++++++++其他+++++++++++++++++++
@@ -673,11 +773,24 @@ func readCmdFlags() error {
 	Config.CleanupTestDatabase = *cleanupTestDatabase
 	Config.OnlySyntaxCheck = *onlySyntaxCheck
 	Config.Profiling = *profiling
+	Config.ProfilingBackend = strings.ToLower(*profilingBackend)
+	Config.ProfilingMaxExamined = *profilingMaxExamined
+	Config.ProfilingMaxLockTime = *profilingMaxLockTime
 	Config.Trace = *trace
 	Config.Explain = *explain
 	Config.Sampling = *sampling
 	Config.SamplingStatisticTarget = *samplingStatisticTarget
 	Config.SamplingCondition = *samplingCondition
+	Config.SamplingParallel = *samplingParallel
+	Config.SamplingChunks = *samplingChunks
+	Config.SamplingMaxBytes = *samplingMaxBytes
+	Config.SamplingSeed = *samplingSeed
+	Config.SamplingMask = strings.Split(*samplingMask, ",")
+	Config.SamplingMaskKey = *samplingMaskKey
+	Config.Synthetic = *synthetic
+	Config.SyntheticMaxRows = *syntheticMaxRows
+	Config.FixtureDir = *fixtureDir
+	Config.FixtureDump = strings.Split(*fixtureDump, ",")
 
 	Config.LogLevel = *logLevel
 
@@ -698,6 +811,8 @@ func readCmdFlags() error {
 	Config.MarkdownHTMLFlags = *markdownHTMLFlags
 	Config.IgnoreRules = strings.Split(*ignoreRules, ",")
 	Config.RewriteRules = strings.Split(*rewriteRules, ",")
+	Config.FixDiff = *fixDiff
+	Config.FixUnsafe = *fixUnsafe
 	*blackList = strings.TrimSpace(*blackList)
 	Config.MinCardinality = *minCardinality
 
@@ -720,6 +835,7 @@ func readCmdFlags() error {
 	Config.MaxTextColsCount = *maxTextColsCount
 	Config.MaxIdxBytesPerColumn = *maxIdxBytesPerColumn
 	Config.MaxIdxBytes = *maxIdxBytes
+	Config.PrefixTolerance = *prefixTolerance
 	if *allowCharsets != "" {
 		Config.AllowCharsets = strings.Split(strings.ToLower(*allowCharsets), ",")
 	}
@@ -738,10 +854,17 @@ func readCmdFlags() error {
 	Config.MaxTotalRows = *maxTotalRows
 	Config.MaxQueryCost = *maxQueryCost
 	Config.AllowDropIndex = *allowDropIdx
+	Config.CoveringIndex = *coveringIdx
+	Config.ValidateIndex = *validateIdx
+	Config.MinIdxReads = *minIdxReads
 	Config.MaxInCount = *maxInCount
 	Config.SpaghettiQueryLength = *spaghettiQueryLength
 	Config.Query = *query
 	Config.Delimiter = *delimiter
+	Config.Parallel = *parallel
+	Config.Schema = *schema
+	Config.Snapshot = *snapshot
+	Config.OnlineSnapshot = *onlineSnapshot
 
 	Config.ExplainSQLReportType = strings.ToLower(*explainSQLReportType)
 	Config.ExplainType = strings.ToLower(*explainType)
@@ -754,6 +877,9 @@ func readCmdFlags() error {
 	Config.ExplainWarnExtra = strings.Split(*explainWarnExtra, ",")
 	Config.ExplainMaxFiltered = *explainMaxFiltered
 	Config.ExplainWarnScalability = strings.Split(*explainWarnScalability, ",")
+	Config.ExplainMaxMisestimate = *explainMaxMisestimate
+	Config.ExplainMaxLoops = *explainMaxLoops
+	Config.ExplainPlanFormat = strings.ToLower(*explainPlanFormat)
 	Config.ShowWarnings = *showWarnings
 	Config.ShowLastQueryCost = *showLastQueryCost
 	Config.ListHeuristicRules = *listHeuristicRules
@@ -776,6 +902,20 @@ func readCmdFlags() error {
 	return nil
 }
 
+// ValidateConfig 检查配置项的取值，配置文件与命令行参数都处理完成后调用
+func ValidateConfig() error {
+	// 内嵌 TiDB 只能作为测试环境，线上环境需要真实的数据库
+	if Config.OnlineDSN != nil && Config.OnlineDSN.Embedded {
+		return fmt.Errorf("online-dsn: %s only supported by test-dsn", EmbeddedDSN)
+	}
+	switch Config.ProfilingBackend {
+	case "performance_schema", "profile":
+	default:
+		return fmt.Errorf("profiling-backend: %s not support, use performance_schema or profile", Config.ProfilingBackend)
+	}
+	return nil
+}
+
 // ParseConfig 加载配置文件和命令行参数
 func ParseConfig(configFile string) error {
 	var err error
@@ -854,6 +994,16 @@ var ReportTypes = []ReportType{
 		Description: "该格式为默认输出格式，以markdown格式展现，可以用网页浏览器插件直接打开，也可以用markdown编辑器打开",
 		Example:     `echo "select * from film" | soar`,
 	},
+	{
+		Name:        "fix",
+		Description: "根据命中的启发式建议执行对应的 SQL 重写规则，输出修复后的 SQL，无法自动修复的建议以注释形式列出，配合 -fix-diff 参数输出 unified diff。innull, distinctstar 等可能改变查询结果的规则需要 -fix-unsafe 参数才会自动执行",
+		Example:     `echo "select * from film group by film_id" | soar -report-type fix`,
+	},
+	{
+		Name:        "workload-index",
+		Description: "汇总所有 SQL 的候选索引，合并左前缀兼容的索引，按 SQL 出现次数在 max-index-count 限制内为每张表给出一条合并后的 ALTER 语句",
+		Example:     `soar -report-type workload-index -query workload.sql`,
+	},
 	{
 		Name:        "rewrite",
 		Description: "SQL重写功能，配合-rewrite-rules参数一起使用，可以通过-list-rewrite-rules 查看所有支持的 SQL 重写规则",
@@ -915,6 +1065,16 @@ EOF`,
 		Description: "对 OnlineDsn 中指定的 database 进行索引重复检查",
 		Example:     `soar -report-type duplicate-key-checker -online-dsn user:password@127.0.0.1:3306/db`,
 	},
+	{
+		Name:        "unused-index-checker",
+		Description: "根据 OnlineDsn 中 performance_schema 的统计信息列出指定 database 中未使用或很少使用的索引，MySQL 8.0 给出设置为不可见索引的语句",
+		Example:     `soar -report-type unused-index-checker -online-dsn user:password@127.0.0.1:3306/db`,
+	},
+	{
+		Name:        "plan-regression",
+		Description: "对比 SQL 在 OnlineDsn 与 TestDsn 中的执行计划，列出连接顺序、访问方式或索引发生变化的 SQL，用于 MySQL 升级前的回归检查",
+		Example:     `soar -report-type plan-regression -online-dsn user:password@127.0.0.1:3306/db -test-dsn user:password@127.0.0.1:3307/db -query critical.sql`,
+	},
 	{
 		Name:        "html",
 		Description: "以HTML格式输出报表",
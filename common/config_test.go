@@ -103,6 +103,8 @@ func TestParseDSN(t *testing.T) {
 		"user:password@/dbname",
 		"user:password@/",
 		"user:password@tcp(localhost:3307)/database?timeout=5s",
+		// embedded TiDB
+		"embedded://",
 	}
 	err := GoldenDiff(func() {
 		for _, dsn := range dsns {
@@ -116,6 +118,34 @@ func TestParseDSN(t *testing.T) {
 	Log.Debug("Exiting function: %s", GetFunctionName())
 }
 
+func TestValidateConfig(t *testing.T) {
+	Log.Debug("Entering function: %s", GetFunctionName())
+	orgOnlineDSN := Config.OnlineDSN
+	orgProfilingBackend := Config.ProfilingBackend
+	defer func() {
+		Config.OnlineDSN = orgOnlineDSN
+		Config.ProfilingBackend = orgProfilingBackend
+	}()
+
+	Config.OnlineDSN = ParseDSN("user:password@tcp(localhost:3307)/database", nil)
+	if err := ValidateConfig(); err != nil {
+		t.Error(err)
+	}
+	Config.OnlineDSN = ParseDSN(EmbeddedDSN, nil)
+	if err := ValidateConfig(); err == nil {
+		t.Error("embedded online-dsn should be rejected")
+	}
+
+	Config.OnlineDSN = orgOnlineDSN
+	for backend, valid := range map[string]bool{"performance_schema": true, "profile": true, "profiles": false, "": false} {
+		Config.ProfilingBackend = backend
+		if err := ValidateConfig(); (err == nil) != valid {
+			t.Errorf("profiling-backend %q, valid: %v, error: %v", backend, valid, err)
+		}
+	}
+	Log.Debug("Exiting function: %s", GetFunctionName())
+}
+
 func TestListReportTypes(t *testing.T) {
 	Log.Debug("Entering function: %s", GetFunctionName())
 	err := GoldenDiff(func() { ListReportTypes() }, t.Name(), update)
@@ -0,0 +1,174 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext unified diff 中变更前后保留的上下文行数
+const diffContext = 3
+
+// diffLine 行级 diff 结果，Op 为 ' ', '-', '+' 之一
+type diffLine struct {
+	Op   byte
+	Text string
+}
+
+// UnifiedDiff 按行对比 a, b 两段文本，返回 unified diff 格式的差异，两者相同时返回空字符串
+func UnifiedDiff(a, b, fromFile, toFile string) string {
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	// 找出所有变更行，相邻变更间隔不超过 2*diffContext 行时合并为一个 hunk
+	var changes []int
+	for i, l := range lines {
+		if l.Op != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var buf strings.Builder
+	buf.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", fromFile, toFile))
+	for i := 0; i < len(changes); {
+		j := i
+		for j+1 < len(changes) && changes[j+1]-changes[j] <= 2*diffContext {
+			j++
+		}
+		start := changes[i] - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := changes[j] + diffContext + 1
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		// hunk 起始行号为 hunk 之前的行数加一
+		var aStart, bStart, aLen, bLen int
+		for _, l := range lines[:start] {
+			if l.Op != '+' {
+				aStart++
+			}
+			if l.Op != '-' {
+				bStart++
+			}
+		}
+		for _, l := range lines[start:end] {
+			if l.Op != '+' {
+				aLen++
+			}
+			if l.Op != '-' {
+				bLen++
+			}
+		}
+		if aLen > 0 {
+			aStart++
+		}
+		if bLen > 0 {
+			bStart++
+		}
+
+		buf.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", aStart, aLen, bStart, bLen))
+		for _, l := range lines[start:end] {
+			buf.WriteByte(l.Op)
+			buf.WriteString(l.Text)
+			buf.WriteByte('\n')
+		}
+		i = j + 1
+	}
+	return buf.String()
+}
+
+// splitLines 按行切分文本，忽略末尾换行
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines Myers 算法求最短编辑路径
+// http://www.xmailserver.org/diff2.pdf
+func diffLines(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max
+	v := make([]int, 2*max+2)
+	var trace [][]int
+
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// 从终点回溯编辑路径
+	var lines []diffLine
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			lines = append(lines, diffLine{Op: ' ', Text: a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			lines = append(lines, diffLine{Op: '+', Text: b[y-1]})
+			y--
+		} else {
+			lines = append(lines, diffLine{Op: '-', Text: a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		lines = append(lines, diffLine{Op: ' ', Text: a[x-1]})
+		x--
+		y--
+	}
+
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package common
+
+import (
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	Log.Debug("Entering function: %s", GetFunctionName())
+	cases := []struct {
+		a, b, diff string
+	}{
+		{
+			a:    "select 1;\n",
+			b:    "select 1;\n",
+			diff: "",
+		},
+		{
+			a:    "use sakila;\nselect * from film group by film_id;\nselect 1;\n",
+			b:    "use sakila;\nselect * from film group by film_id order by null;\nselect 1;\n",
+			diff: "--- a.sql\n+++ b.sql\n@@ -1,3 +1,3 @@\n use sakila;\n-select * from film group by film_id;\n+select * from film group by film_id order by null;\n select 1;\n",
+		},
+		{
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			b:    "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n",
+			diff: "--- a.sql\n+++ b.sql\n@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -9,4 +10,3 @@\n 9\n 10\n 11\n-12\n",
+		},
+	}
+	for _, c := range cases {
+		diff := UnifiedDiff(c.a, c.b, "a.sql", "b.sql")
+		if diff != c.diff {
+			t.Errorf("want:\n%s\ngot:\n%s", c.diff, diff)
+		}
+	}
+	Log.Debug("Exiting function: %s", GetFunctionName())
+}
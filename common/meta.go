@@ -73,6 +73,8 @@ type Column struct {
 	Extra       string   `json:"extra"`       // 其他
 	Comment     string   `json:"comment"`     // 备注
 	Privileges  string   `json:"privileges"`  // 权限
+	SubPart     int      `json:"sub_part"`    // 索引中的前缀长度，0 表示整列
+	Desc        bool     `json:"desc"`        // 索引中是否为降序
 }
 
 // TableColumns 这个结构体中的元素是有序的  map[db]map[table][]columns
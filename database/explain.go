@@ -25,6 +25,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/XiaoMi/soar/ast"
 	"github.com/XiaoMi/soar/common"
@@ -39,12 +40,16 @@ import (
 const (
 	TraditionalFormatExplain = iota // 默认输出
 	JSONFormatExplain               // JSON格式输出
+	TreeFormatExplain               // FORMAT=TREE 输出，MySQL 8.0.16 开始支持
+	AnalyzeFormatExplain            // EXPLAIN ANALYZE 输出，MySQL 8.0.18 开始支持，会实际执行查询
 )
 
 // ExplainFormatType EXPLAIN 支持的 FORMAT_TYPE
 var ExplainFormatType = map[string]int{
 	"traditional": 0,
 	"json":        1,
+	"tree":        2,
+	"analyze":     3,
 }
 
 // explain_type
@@ -69,8 +74,11 @@ type ExplainInfo struct {
 	ExplainFormat int
 	ExplainRows   []ExplainRow
 	ExplainJSON   *ExplainJSON
+	ExplainTree   []*ExplainTreeNode  // FORMAT=TREE 及 EXPLAIN ANALYZE 输出的迭代器树
+	IndexColumns  map[string][]string // JSON 格式执行计划中使用到的索引定义，[表别名.索引名]索引列
 	Warnings      []ExplainWarning
 	QueryCost     float64
+	TiDB          bool // 执行计划来自内嵌 TiDB，为 TiDB 优化器的语义
 }
 
 // ExplainRow 单行Explain
@@ -119,9 +127,6 @@ type ExplainJSONMaterializedFromSubquery struct {
 	QueryBlock          *ExplainJSONQueryBlock `json:"query_block"`
 }
 
-// 该变量用于存放 JSON 到 Traditional 模式的所有 ExplainJSONTable
-var explainJSONTables []*ExplainJSONTable
-
 // ExplainJSONTable JSON
 type ExplainJSONTable struct {
 	TableName                string                              `json:"table_name"`
@@ -179,6 +184,7 @@ type ExplainJSONDuplicatesRemoval struct {
 	BufferResult        ExplainJSONBufferResult      `json:"buffer_result"`
 	GroupingOperation   ExplainJSONGroupingOperation `json:"grouping_operation"`
 	Table               ExplainJSONTable             `json:"table"`
+	NestedLoop          []ExplainJSONNestedLoop      `json:"nested_loop"`
 }
 
 // ExplainJSONOrderingOperation JSON
@@ -187,6 +193,7 @@ type ExplainJSONOrderingOperation struct {
 	Table                   ExplainJSONTable             `json:"table"`
 	DuplicatesRemoval       ExplainJSONDuplicatesRemoval `json:"duplicates_removal"`
 	GroupingOperation       ExplainJSONGroupingOperation `json:"grouping_operation"`
+	NestedLoop              []ExplainJSONNestedLoop      `json:"nested_loop"`
 	OrderbySubqueries       []ExplainJSONSubqueries      `json:"order_by_subqueries"`
 	OptimizedAwaySubqueries []ExplainJSONSubqueries      `json:"optimized_away_subqueries"`
 }
@@ -387,14 +394,14 @@ var ExplainExtra = map[string]string{
 	"Using sort_union":                         "开启了index merge，即：对多个索引分别进行条件扫描，然后将它们各自的结果进行合并，使用的算法为：index_merge_sort_union",
 }
 
-// 提取ExplainJSON中所有的ExplainJSONTable, 将其写入全局变量explainJSONTables
+// 提取ExplainJSON中所有的ExplainJSONTable, 追加到 tables 中返回
 // depth只是用于debug，逻辑上并未使用
-func findTablesInJSON(explainJSON string, depth int) {
+func findTablesInJSON(explainJSON string, depth int, tables []*ExplainJSONTable) []*ExplainJSONTable {
 	common.Log.Debug("findTablesInJSON Enter: depth(%d), json(%s)", depth, explainJSON)
 	// 去除注释，语法检查
 	explainJSON = RemoveSQLComments(explainJSON)
 	if !gjson.Valid(explainJSON) {
-		return
+		return tables
 	}
 	// 提取所有ExplainJSONTable struct
 	for _, key := range ExplainKeyWords {
@@ -409,30 +416,28 @@ func findTablesInJSON(explainJSON string, depth int) {
 			err := json.Unmarshal([]byte(result.Raw), table)
 			common.LogIfError(err, "")
 			if table.TableName != "" {
-				explainJSONTables = append(explainJSONTables, table)
+				tables = append(tables, table)
 			}
-			findTablesInJSON(result.String(), depth+1)
+			tables = findTablesInJSON(result.String(), depth+1, tables)
 		} else {
 			common.Log.Debug("findTablesInJSON ScanOther: depth(%d), key(%s), array_len(%d), json(%s)", depth, key, len(result.Array()), result.String)
 			for _, val := range result.Array() {
 				if val.String() != "" {
-					findTablesInJSON(val.String(), depth+1)
+					tables = findTablesInJSON(val.String(), depth+1, tables)
 				}
 			}
-			findTablesInJSON(result.String(), depth+1)
+			tables = findTablesInJSON(result.String(), depth+1, tables)
 		}
 	}
+	return tables
 }
 
 // FormatJSONIntoTraditional 将JSON形式转换为TRADITIONAL形式，方便前端展现
 func FormatJSONIntoTraditional(explainJSON string) []ExplainRow {
-	// 查找JSON中的所有ExplainJSONTable
-	explainJSONTables = []*ExplainJSONTable{}
-	findTablesInJSON(explainJSON, 0)
-
 	var explainRows []ExplainRow
 	id := -1
-	for _, table := range explainJSONTables {
+	// 查找JSON中的所有ExplainJSONTable
+	for _, table := range findTablesInJSON(explainJSON, 0, nil) {
 		keyLen := table.KeyLength
 		filtered, err := strconv.ParseFloat(table.Filtered, 64)
 		if err != nil {
@@ -482,7 +487,7 @@ func (db *Connector) supportExplainWrite() (bool, error) {
 
 	// 5.6以上版本支持 EXPLAIN UPDATE/DELETE 等语句，但需要开启写入
 	// 如开启了 read_only, EXPLAIN UPDATE/DELETE 也会受限制
-	if common.Config.TestDSN.Version >= 50600 {
+	if db.explainVersion() >= 50600 {
 		readOnly, err := db.SingleIntValue("read_only")
 		if err != nil {
 			return false, err
@@ -570,26 +575,46 @@ func (db *Connector) explainQuery(sql string, explainType int, formatType int) s
 	if sql == "" || err != nil {
 		return sql
 	} else {
+		// EXPLAIN ANALYZE 会实际执行语句，写操作需要转换为 SELECT
+		if formatType == AnalyzeFormatExplain {
+			if stmt, err := sqlparser.Parse(sql); err == nil {
+				switch stmt.(type) {
+				case *sqlparser.Insert, *sqlparser.Update, *sqlparser.Delete:
+					if rw := ast.NewRewrite(sql); rw != nil {
+						sql = rw.RewriteDML2Select().NewSQL
+					}
+				}
+			}
+		}
 		// MySQL 5.7 support MAX_EXECUTION_TIME hint
 		// ref: https://dev.mysql.com/doc/refman/5.7/en/optimizer-hints.html
 		re := regexp.MustCompile(`(?i)(^select)(.*)`)
 		sql = re.ReplaceAllString(sql, "SELECT /*+ MAX_EXECUTION_TIME(1000) */${2}")
 	}
 
+	// 内嵌 TiDB 不支持 FORMAT=JSON 及 EXTENDED, PARTITIONS 关键字
+	if db.embedded() {
+		return fmt.Sprintf("explain %s", sql)
+	}
+
 	// 5.6以上支持 FORMAT=JSON
 	explainFormat := ""
 	switch formatType {
 	case JSONFormatExplain:
-		if common.Config.TestDSN.Version >= 50600 {
+		if db.explainVersion() >= 50600 {
 			explainFormat = "FORMAT=JSON"
 		}
+	case TreeFormatExplain:
+		explainFormat = "FORMAT=TREE"
+	case AnalyzeFormatExplain:
+		explainFormat = "ANALYZE"
 	}
 
 	// 执行 explain
 	switch explainType {
 	case ExtendedExplainType:
 		// 5.6以上extended关键字已经不推荐使用，8.0废弃了这个关键字
-		if common.Config.TestDSN.Version >= 50600 {
+		if db.explainVersion() >= 50600 {
 			sql = fmt.Sprintf("explain %s", sql)
 		} else {
 			sql = fmt.Sprintf("explain extended %s", sql)
@@ -603,6 +628,14 @@ func (db *Connector) explainQuery(sql string, explainType int, formatType int) s
 	return sql
 }
 
+// explainVersion 执行 EXPLAIN 的数据库版本，未指定 ServerVersion 时使用测试环境的版本
+func (db *Connector) explainVersion() int {
+	if db.ServerVersion > 0 {
+		return db.ServerVersion
+	}
+	return common.Config.TestDSN.Version
+}
+
 // MySQLExplainWarnings WARNINGS信息中包含的优化器信息
 func MySQLExplainWarnings(exp *ExplainInfo) string {
 	content := "## MySQL优化器调优结果\n\n```sql\n"
@@ -743,6 +776,16 @@ func ParseExplainText(content string) (exp *ExplainInfo, err error) {
 	exp = &ExplainInfo{ExplainFormat: TraditionalFormatExplain}
 
 	content = strings.TrimSpace(content)
+	// 树形输出也可能来自 mysql 客户端的表格或 \G 输出，需要先于其他格式判断
+	if isTreeExplainText(content) {
+		exp.ExplainTree, err = parseTreeExplainText(content)
+		exp.ExplainFormat = TreeFormatExplain
+		if treeExplainAnalyzed(exp.ExplainTree) {
+			exp.ExplainFormat = AnalyzeFormatExplain
+		}
+		return exp, err
+	}
+
 	verticalFormat := strings.HasPrefix(content, "*")
 	jsonFormat := strings.HasPrefix(content, "{")
 	traditionalFormat := strings.HasPrefix(content, "+")
@@ -827,7 +870,7 @@ func parseTraditionalExplainText(content string) (explainRows []ExplainRow, err
 
 		keylen = colsMap["key_len"]
 
-		rows, err = strconv.ParseInt(colsMap["Rows"], 10, 64)
+		rows, err = strconv.ParseInt(colsMap["rows"], 10, 64)
 		if err != nil {
 			rows = 0
 		}
@@ -917,8 +960,8 @@ func parseVerticalExplainText(content string) (explainRows []ExplainRow, err err
 		if strings.HasPrefix(l, "ref:") {
 			explainRow.Ref = strings.Split(strings.TrimPrefix(l, "ref: "), ",")
 		}
-		if strings.HasPrefix(l, "Rows:") {
-			rows := strings.TrimPrefix(l, "Rows: ")
+		if strings.HasPrefix(l, "rows:") {
+			rows := strings.TrimPrefix(l, "rows: ")
 			explainRow.Rows, err = strconv.ParseInt(rows, 10, 64)
 			if err != nil {
 				explainRow.Rows = 0
@@ -967,6 +1010,21 @@ func ParseExplainResult(res QueryResult, formatType int) (exp *ExplainInfo, err
 		return exp, err
 	}
 
+	// FORMAT=TREE 及 EXPLAIN ANALYZE 只有一行一列的文本
+	if formatType == TreeFormatExplain || formatType == AnalyzeFormatExplain {
+		if res.Rows.Next() {
+			var explainString string
+			err = res.Rows.Scan(&explainString)
+			if err != nil {
+				common.Log.Debug(err.Error())
+			}
+			exp.ExplainTree, err = parseTreeExplainText(explainString)
+		}
+		res.Rows.Close()
+		exp.QueryCost = res.QueryCost
+		return exp, err
+	}
+
 	/*
 				+----+-------------+-------+------------+------+---------------+------+---------+------+------+----------+-------+
 				| id | select_type | table | partitions | type | possible_keys | key  | key_len | ref  | rows | filtered | Extra |
@@ -1067,9 +1125,13 @@ func ParseExplainResult(res QueryResult, formatType int) (exp *ExplainInfo, err
 // Explain 获取 SQL 的 explain 信息
 func (db *Connector) Explain(sql string, explainType int, formatType int) (exp *ExplainInfo, err error) {
 	exp = &ExplainInfo{SQL: sql}
-	if explainType != TraditionalExplainType {
+	if explainType != TraditionalExplainType || !explainFormatSupported(formatType, db.explainVersion()) {
 		formatType = TraditionalFormatExplain
 	}
+	// EXPLAIN ANALYZE 会实际执行查询，只允许在测试环境中使用
+	if formatType == AnalyzeFormatExplain && db.Addr != common.Config.TestDSN.Addr {
+		return exp, errors.New("EXPLAIN ANALYZE executes the query, only available in test environment")
+	}
 
 	defer func() {
 		if e := recover(); e != nil {
@@ -1092,12 +1154,146 @@ func (db *Connector) Explain(sql string, explainType int, formatType int) (exp *
 	}
 
 	// 解析mysql结果，输出ExplainInfo
-	exp, err = ParseExplainResult(res, formatType)
+	if db.embedded() {
+		exp, err = ParseTiDBExplainResult(res)
+	} else {
+		exp, err = ParseExplainResult(res, formatType)
+	}
+	if err == nil && formatType == JSONFormatExplain && exp.ExplainJSON != nil {
+		exp.IndexColumns = db.explainIndexColumns(sql, exp)
+	}
+	return exp, err
+}
+
+// explainFormatSupported 检查 MySQL 版本是否支持对应的 EXPLAIN 输出格式，MariaDB 的版本号从 10 开始，不支持树形输出
+func explainFormatSupported(formatType int, version int) bool {
+	switch formatType {
+	case TreeFormatExplain:
+		return version >= 80016 && version < 100000
+	case AnalyzeFormatExplain:
+		return version >= 80018 && version < 100000
+	}
+	return true
+}
+
+// embedded 是否为内嵌 TiDB 测试环境
+func (db *Connector) embedded() bool {
+	return common.Config.TestDSN.Embedded && db.Addr == common.Config.TestDSN.Addr
+}
+
+// TiDBExplainAccessType TiDB 扫描算子对应的 MySQL 访问类型
+var TiDBExplainAccessType = map[string]string{
+	"TableFullScan":   "ALL",
+	"TableRangeScan":  "range",
+	"IndexFullScan":   "index",
+	"IndexRangeScan":  "range",
+	"Point_Get":       "const",
+	"Batch_Point_Get": "range",
+}
+
+// ParseTiDBExplainResult 解析 TiDB 的 EXPLAIN 结果，将其中的扫描算子转换为传统格式的 ExplainRow
+func ParseTiDBExplainResult(res QueryResult) (exp *ExplainInfo, err error) {
+	exp = &ExplainInfo{
+		ExplainFormat: TraditionalFormatExplain,
+		TiDB:          true,
+	}
+	/*
+		+---------------------+---------+-----------+--------------------------+-----------------------------------------------+
+		| id                  | estRows | task      | access object            | operator info                                 |
+		+---------------------+---------+-----------+--------------------------+-----------------------------------------------+
+		| IndexReader_6       | 10.00   | root      |                          | index:IndexRangeScan_5                        |
+		| └─IndexRangeScan_5  | 10.00   | cop[tikv] | table:t, index:idx_c(c)  | range:["a","a"], keep order:false, stats:pseudo |
+		+---------------------+---------+-----------+--------------------------+-----------------------------------------------+
+	*/
+	var id, estRows, task, object, info, colByPass []byte
+	fields := map[string]interface{}{
+		"id":            &id,
+		"estRows":       &estRows,
+		"task":          &task,
+		"access object": &object,
+		"operator info": &info,
+	}
+	var explainFields []interface{}
+	cols, err := res.Rows.Columns()
+	common.LogIfError(err, "")
+	for _, col := range cols {
+		if f, ok := fields[col]; ok {
+			explainFields = append(explainFields, f)
+		} else {
+			explainFields = append(explainFields, &colByPass)
+		}
+	}
+
+	operatorSuffix := regexp.MustCompile(`_\d+(\(\w+\))?$`)
+	for res.Rows.Next() {
+		if err = res.Rows.Scan(explainFields...); err != nil {
+			common.Log.Warn(err.Error())
+			continue
+		}
+		// 去掉算子树的缩进、编号及 Build/Probe 标识，如：└─IndexRangeScan_5(Build) -> IndexRangeScan
+		operator := strings.TrimLeftFunc(string(id), func(r rune) bool {
+			return !unicode.IsLetter(r)
+		})
+		operator = operatorSuffix.ReplaceAllString(operator, "")
+		// TableRowIDScan 是 IndexLookUp 回表，不单独作为一次表访问
+		if operator == "TableRowIDScan" {
+			continue
+		}
+
+		// access object: table:t, partition:p0, index:idx_c(c)
+		var table, key, partition string
+		for _, obj := range strings.Split(string(object), ",") {
+			kv := strings.SplitN(strings.TrimSpace(obj), ":", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "table":
+				table = kv[1]
+			case "partition":
+				partition = kv[1]
+			case "index":
+				key = strings.Split(kv[1], "(")[0]
+			}
+		}
+		if table == "" {
+			continue
+		}
+		if key == "" && strings.HasSuffix(operator, "Point_Get") {
+			key = "PRIMARY"
+		}
+
+		expRow := ExplainRow{
+			ID:           1,
+			SelectType:   "SIMPLE",
+			TableName:    table,
+			Partitions:   partition,
+			AccessType:   TiDBExplainAccessType[operator],
+			PossibleKeys: []string{key},
+			Key:          key,
+			Ref:          []string{""},
+			Rows:         int64(NullFloat(estRows)),
+			Filtered:     100.00,
+			Extra:        operator + ": " + string(info),
+		}
+		if expRow.AccessType == "" {
+			expRow.AccessType = "ALL"
+		}
+		expRow.Scalability = ExplainScalability[expRow.AccessType]
+		exp.ExplainRows = append(exp.ExplainRows, expRow)
+	}
+	res.Rows.Close()
+	if res.Warning != nil {
+		res.Warning.Close()
+	}
 	return exp, err
 }
 
 // PrintMarkdownExplainTable 打印 markdown 格式的 explain table
 func PrintMarkdownExplainTable(exp *ExplainInfo) string {
+	if len(exp.ExplainTree) > 0 {
+		return printMarkdownExplainTree(exp)
+	}
 	var buf []string
 	rows := exp.ExplainRows
 	// JSON 转换为 TRADITIONAL 格式
@@ -0,0 +1,109 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/XiaoMi/soar/ast"
+	"github.com/XiaoMi/soar/common"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// ExplainJSONTables 提取 JSON 格式执行计划中的所有表，与 ConvertExplainJSON2Row 不同，
+// 这里保留 cost_info, used_key_parts, attached_condition 等 JSON 格式特有的信息
+func ExplainJSONTables(explainJSON *ExplainJSON) []*ExplainJSONTable {
+	if explainJSON == nil {
+		return nil
+	}
+	buf, err := json.Marshal(explainJSON)
+	if err != nil {
+		return nil
+	}
+	return findTablesInJSON(string(buf), 0, nil)
+}
+
+// ParseJSONCost cost_info 中的代价为字符串，如 "1.20"，8.0 中较大的值会使用科学计数法，如 "1.02e+06"
+func ParseJSONCost(cost string) float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(cost), 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+// JSONTableCost 单表自身的代价，即 read_cost 与 eval_cost 之和，prefix_cost 为包含之前所有表的累计代价
+func JSONTableCost(table *ExplainJSONTable) float64 {
+	return ParseJSONCost(table.CostInfo.ReadCost) + ParseJSONCost(table.CostInfo.EvalCost)
+}
+
+// IndexColumnsKey ExplainInfo.IndexColumns 的 key
+func IndexColumnsKey(table, key string) string {
+	return strings.ToLower(table + "." + key)
+}
+
+// explainIndexColumns 获取 JSON 格式执行计划中使用到的索引定义，用于判断 used_key_parts 是否只用到了部分索引列
+// JSON 中的 table_name 为表别名，需要从 SQL 中还原出实际的库表名，获取失败时不影响 EXPLAIN 结果
+func (db *Connector) explainIndexColumns(sql string, exp *ExplainInfo) map[string][]string {
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		return nil
+	}
+	// [alias]{db, table}
+	aliases := make(map[string][2]string)
+	for dbName, database := range ast.GetMeta(stmt, nil) {
+		for tbName, table := range database.Table {
+			aliases[tbName] = [2]string{dbName, tbName}
+			for _, alias := range table.TableAliases {
+				aliases[alias] = [2]string{dbName, tbName}
+			}
+		}
+	}
+
+	indexes := make(map[string][]string)
+	cache := make(map[[2]string]*TableIndexInfo)
+	for _, table := range ExplainJSONTables(exp.ExplainJSON) {
+		name, ok := aliases[table.TableName]
+		if table.Key == "" || len(table.UsedKeyParts) == 0 || !ok || name[1] == "" {
+			continue
+		}
+		tbIndex, ok := cache[name]
+		if !ok {
+			conn := *db
+			if name[0] != "" {
+				conn.Database = name[0]
+				if db.DBHash != nil {
+					conn.Database = db.DBHash(name[0])
+				}
+			}
+			tbIndex, err = conn.ShowIndex(name[1])
+			common.LogIfWarn(err, "")
+			cache[name] = tbIndex
+		}
+		var columns []string
+		for _, row := range tbIndex.FindIndex(IndexKeyName, table.Key) {
+			columns = append(columns, row.ColumnName)
+		}
+		if len(columns) > 0 {
+			indexes[IndexColumnsKey(table.TableName, table.Key)] = columns
+		}
+	}
+	return indexes
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+func TestExplainJSONTables(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	exp, err := ParseExplainText(`{
+  "query_block": {
+    "select_id": 1,
+    "cost_info": {"query_cost": "1.02e+06"},
+    "table": {
+      "table_name": "t",
+      "access_type": "ALL",
+      "rows_examined_per_scan": 16,
+      "cost_info": {"read_cost": "2.50", "eval_cost": "1.60", "prefix_cost": "4.10"},
+      "materialized_from_subquery": {
+        "using_temporary_table": true,
+        "dependent": false,
+        "cacheable": true,
+        "query_block": {
+          "select_id": 2,
+          "table": {
+            "table_name": "film",
+            "access_type": "range",
+            "key": "idx_title",
+            "used_key_parts": ["title"],
+            "cost_info": {"read_cost": "7.21", "eval_cost": "1.60", "prefix_cost": "8.81"},
+            "attached_condition": "(film.title like 'A%')"
+          }
+        }
+      }
+    }
+  }
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables := ExplainJSONTables(exp.ExplainJSON)
+	if len(tables) != 2 {
+		t.Fatalf("want 2 tables, got %d", len(tables))
+	}
+	if !tables[0].MaterializedFromSubquery.UsingTemporaryTable || JSONTableCost(tables[0]) != 4.1 {
+		t.Errorf("derived table got %+v", tables[0])
+	}
+	if tables[1].TableName != "film" || tables[1].UsedKeyParts[0] != "title" || tables[1].AttachedCondition != "(film.title like 'A%')" {
+		t.Errorf("film got %+v", tables[1])
+	}
+	if cost := ParseJSONCost(exp.ExplainJSON.QueryBlock.CostInfo.QueryCost); cost != 1020000 {
+		t.Errorf("query cost got %f", cost)
+	}
+	if ExplainJSONTables(nil) != nil {
+		t.Error("nil explain should return no table")
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestExplainIndexColumns(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	s, err := LoadSnapshot(filepath.Join("testdata", "snapshot.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err := ParseExplainText(`{
+  "query_block": {
+    "select_id": 1,
+    "table": {"table_name": "f", "access_type": "ref", "key": "idx_title", "used_key_parts": ["title"]}
+  }
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql := "select * from sakila.film f where title = 'a'"
+
+	// SQL 中的 sakila 在测试环境中对应 test 库
+	conn := &Connector{Database: "optimizer_xxx", Snapshot: s, DBHash: func(db string) string {
+		if db == "sakila" {
+			return "test"
+		}
+		return db
+	}}
+	indexes := conn.explainIndexColumns(sql, exp)
+	if columns := indexes[IndexColumnsKey("f", "idx_title")]; len(columns) != 1 || columns[0] != "title" {
+		t.Errorf("IndexColumns got %v", indexes)
+	}
+
+	// 没有库名映射时 sakila.film 不存在
+	conn.DBHash = nil
+	if indexes = conn.explainIndexColumns(sql, exp); len(indexes) != 0 {
+		t.Errorf("IndexColumns without DBHash got %v", indexes)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
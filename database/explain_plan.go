@@ -0,0 +1,371 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PlanNode 树形展示的执行计划节点，Table 为空时表示 Select, Nested loop, Ordering 等操作
+type PlanNode struct {
+	Operation   string
+	Table       string
+	AccessType  string
+	Key         string
+	Rows        int64
+	Filtered    float64
+	Scalability string
+	Extra       string
+	Children    []*PlanNode
+}
+
+// Label 节点的展示文本，表节点会标注 access type, key, rows, filtered 及 Scalability
+func (node *PlanNode) Label() string {
+	if node.Table == "" {
+		return node.Operation
+	}
+	label := fmt.Sprintf("%s [%s", node.Table, node.AccessType)
+	if node.Key != "" && node.Key != "NULL" {
+		label += " key=" + node.Key
+	}
+	label += fmt.Sprintf(" rows=%d filtered=%.2f%%", node.Rows, node.Filtered)
+	if node.Scalability != "" {
+		label += " " + node.Scalability
+	}
+	label += "]"
+	if node.Extra != "" && node.Extra != "NULL" {
+		label += " " + node.Extra
+	}
+	return label
+}
+
+// explainUnionTableExp <union1,2>, <derived2>, <subquery2> 等由其他 select 生成的临时表
+var explainUnionTableExp = regexp.MustCompile(`^<(union|derived|subquery)([0-9,]+)>$`)
+
+// BuildExplainPlan 根据执行计划构建树，JSON 格式按嵌套关系构建，传统格式按 id 及派生表、UNION 临时表的引用关系构建
+func BuildExplainPlan(exp *ExplainInfo) *PlanNode {
+	if exp == nil {
+		return nil
+	}
+	if exp.ExplainFormat == JSONFormatExplain && exp.ExplainJSON != nil {
+		buf, err := json.Marshal(exp.ExplainJSON)
+		if err != nil {
+			return nil
+		}
+		var v map[string]interface{}
+		if err = json.Unmarshal(buf, &v); err != nil {
+			return nil
+		}
+		nodes := planFromJSON(v)
+		if len(nodes) == 0 {
+			return nil
+		}
+		return nodes[0]
+	}
+	return planFromRows(exp.ExplainRows)
+}
+
+// planFromRows 传统格式中 id 相同的行属于同一个 select 并按顺序做嵌套循环连接
+func planFromRows(rows []ExplainRow) *PlanNode {
+	if len(rows) == 0 {
+		return nil
+	}
+	var ids []int
+	selects := make(map[int]*PlanNode)
+	for _, row := range rows {
+		if _, ok := selects[row.ID]; !ok {
+			ids = append(ids, row.ID)
+			operation := fmt.Sprintf("Select #%d", row.ID)
+			if row.ID == 0 {
+				operation = "Select"
+			}
+			if row.SelectType != "" {
+				operation += " (" + row.SelectType + ")"
+			}
+			selects[row.ID] = &PlanNode{Operation: operation}
+		}
+	}
+
+	referenced := make(map[int]bool)
+	for _, row := range rows {
+		node := &PlanNode{
+			Table:       row.TableName,
+			AccessType:  row.AccessType,
+			Key:         row.Key,
+			Rows:        row.Rows,
+			Filtered:    row.Filtered,
+			Scalability: row.Scalability,
+			Extra:       row.Extra,
+		}
+		if m := explainUnionTableExp.FindStringSubmatch(row.TableName); len(m) > 0 {
+			for _, id := range strings.Split(m[2], ",") {
+				i, err := strconv.Atoi(id)
+				if child, ok := selects[i]; err == nil && ok && i != row.ID {
+					node.Children = append(node.Children, child)
+					referenced[i] = true
+				}
+			}
+		}
+		selects[row.ID].Children = append(selects[row.ID].Children, node)
+	}
+
+	// 未被引用的 select 中第一个为最外层查询，其余的为 WHERE, SELECT 列表中的子查询
+	var root *PlanNode
+	for _, id := range ids {
+		if referenced[id] {
+			continue
+		}
+		if root == nil {
+			root = selects[id]
+			continue
+		}
+		root.Children = append(root.Children, selects[id])
+	}
+	return root
+}
+
+// planSubqueryKeys JSON 格式中以数组形式出现的子查询
+var planSubqueryKeys = []string{
+	"attached_subqueries",
+	"select_list_subqueries",
+	"having_subqueries",
+	"optimized_away_subqueries",
+	"order_by_subqueries",
+	"group_by_subqueries",
+	"update_value_subqueries",
+	"query_specifications",
+}
+
+// planFromJSON 按 MySQL 输出的嵌套关系遍历 JSON 执行计划，没有包含任何表的操作会被忽略
+func planFromJSON(v map[string]interface{}) []*PlanNode {
+	var nodes []*PlanNode
+	if block, ok := v["query_block"].(map[string]interface{}); ok {
+		id, _ := block["select_id"].(float64)
+		operation := fmt.Sprintf("Select #%d", int(id))
+		if cost := jsonString(block, "cost_info", "query_cost"); cost != "" {
+			operation += " cost=" + cost
+		}
+		if msg, _ := block["message"].(string); msg != "" {
+			operation += ": " + msg
+		}
+		node := &PlanNode{Operation: operation, Children: planFromJSON(block)}
+		if id > 0 || len(node.Children) > 0 {
+			nodes = append(nodes, node)
+		}
+	}
+
+	if table, ok := v["table"].(map[string]interface{}); ok {
+		if name, _ := table["table_name"].(string); name != "" {
+			access, _ := table["access_type"].(string)
+			key, _ := table["key"].(string)
+			rows, _ := table["rows_examined_per_scan"].(float64)
+			filtered, _ := strconv.ParseFloat(jsonString(table, "filtered"), 64)
+			nodes = append(nodes, &PlanNode{
+				Table:       name,
+				AccessType:  access,
+				Key:         key,
+				Rows:        int64(rows),
+				Filtered:    filtered,
+				Scalability: ExplainScalability[access],
+				Children:    planFromJSON(table),
+			})
+		}
+	}
+
+	if loops, ok := v["nested_loop"].([]interface{}); ok {
+		node := &PlanNode{Operation: "Nested loop"}
+		for _, loop := range loops {
+			if l, ok := loop.(map[string]interface{}); ok {
+				node.Children = append(node.Children, planFromJSON(l)...)
+			}
+		}
+		nodes = appendPlanOperation(nodes, node)
+	}
+
+	for _, op := range []struct {
+		key       string
+		operation string
+	}{
+		{"ordering_operation", "Ordering"},
+		{"grouping_operation", "Grouping"},
+		{"duplicates_removal", "Duplicates removal"},
+		{"buffer_result", "Buffer result"},
+		{"materialized_from_subquery", "Materialize"},
+		{"union_result", "Union result"},
+	} {
+		obj, ok := v[op.key].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		node := &PlanNode{Operation: op.operation + planJSONFlags(obj), Children: planFromJSON(obj)}
+		if op.key == "union_result" {
+			if name, _ := obj["table_name"].(string); name != "" {
+				node.Operation = "Union result " + name + planJSONFlags(obj)
+			}
+		}
+		nodes = appendPlanOperation(nodes, node)
+	}
+
+	for _, key := range planSubqueryKeys {
+		subqueries, _ := v[key].([]interface{})
+		for _, subquery := range subqueries {
+			s, ok := subquery.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			children := planFromJSON(s)
+			if dependent, _ := s["dependent"].(bool); dependent && len(children) > 0 && children[0].Table == "" {
+				children[0].Operation += " (dependent)"
+			}
+			nodes = append(nodes, children...)
+		}
+	}
+	return nodes
+}
+
+// appendPlanOperation 只保留包含子节点的操作
+func appendPlanOperation(nodes []*PlanNode, node *PlanNode) []*PlanNode {
+	if len(node.Children) == 0 {
+		return nodes
+	}
+	return append(nodes, node)
+}
+
+// planJSONFlags 操作中是否使用了临时表、文件排序
+func planJSONFlags(obj map[string]interface{}) string {
+	var flags []string
+	if tmp, _ := obj["using_temporary_table"].(bool); tmp {
+		flags = append(flags, "Using temporary")
+	}
+	if sort, _ := obj["using_filesort"].(bool); sort {
+		flags = append(flags, "Using filesort")
+	}
+	if dependent, _ := obj["dependent"].(bool); dependent {
+		flags = append(flags, "dependent")
+	}
+	if len(flags) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(flags, ", ") + ")"
+}
+
+// jsonString 按路径获取 JSON 对象中的字符串值
+func jsonString(v map[string]interface{}, path ...string) string {
+	for i, key := range path {
+		if i == len(path)-1 {
+			s, _ := v[key].(string)
+			return s
+		}
+		v, _ = v[key].(map[string]interface{})
+	}
+	return ""
+}
+
+// RenderExplainPlan 以 ascii, dot 或 mermaid 格式输出执行计划树
+func RenderExplainPlan(root *PlanNode, format string) string {
+	if root == nil {
+		return ""
+	}
+	switch strings.ToLower(format) {
+	case "dot":
+		return renderPlanDOT(root)
+	case "mermaid":
+		return renderPlanMermaid(root)
+	default:
+		return renderPlanASCII(root)
+	}
+}
+
+// renderPlanASCII 缩进的 ASCII 树，用于终端输出
+func renderPlanASCII(root *PlanNode) string {
+	buf := []string{root.Label()}
+	var render func(node *PlanNode, prefix string)
+	render = func(node *PlanNode, prefix string) {
+		for i, child := range node.Children {
+			branch, indent := "├── ", "│   "
+			if i == len(node.Children)-1 {
+				branch, indent = "└── ", "    "
+			}
+			buf = append(buf, prefix+branch+child.Label())
+			render(child, prefix+indent)
+		}
+	}
+	render(root, "")
+	return strings.Join(buf, "\n")
+}
+
+// walkPlan 按先序遍历为每个节点编号，fn 的 parent 为 -1 时表示根节点
+func walkPlan(root *PlanNode, fn func(id int, node *PlanNode, parent int)) {
+	id := 0
+	var walk func(node *PlanNode, parent int)
+	walk = func(node *PlanNode, parent int) {
+		self := id
+		id++
+		fn(self, node, parent)
+		for _, child := range node.Children {
+			walk(child, self)
+		}
+	}
+	walk(root, -1)
+}
+
+// renderPlanDOT Graphviz DOT 格式，可以通过 dot -Tpng 生成图片
+func renderPlanDOT(root *PlanNode) string {
+	buf := []string{"digraph plan {", "  node [shape=box];"}
+	var edges []string
+	walkPlan(root, func(id int, node *PlanNode, parent int) {
+		label := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(node.Label())
+		buf = append(buf, fmt.Sprintf(`  n%d [label="%s"];`, id, label))
+		if parent >= 0 {
+			edges = append(edges, fmt.Sprintf("  n%d -> n%d;", parent, id))
+		}
+	})
+	buf = append(buf, edges...)
+	buf = append(buf, "}")
+	return strings.Join(buf, "\n")
+}
+
+// renderPlanMermaid Mermaid 流程图，用于 markdown 及 HTML 报告
+func renderPlanMermaid(root *PlanNode) string {
+	buf := []string{"graph TD"}
+	walkPlan(root, func(id int, node *PlanNode, parent int) {
+		label := strings.NewReplacer(`"`, "#quot;").Replace(node.Label())
+		if parent >= 0 {
+			buf = append(buf, fmt.Sprintf(`  n%d --> n%d["%s"]`, parent, id, label))
+		} else {
+			buf = append(buf, fmt.Sprintf(`  n%d["%s"]`, id, label))
+		}
+	})
+	return strings.Join(buf, "\n")
+}
+
+// PrintMarkdownExplainPlan 以 markdown 代码块的形式输出执行计划树
+func PrintMarkdownExplainPlan(exp *ExplainInfo, format string) string {
+	plan := RenderExplainPlan(BuildExplainPlan(exp), format)
+	if plan == "" {
+		return ""
+	}
+	lang := strings.ToLower(format)
+	if lang != "dot" && lang != "mermaid" {
+		lang = "text"
+	}
+	return "```" + lang + "\n" + plan + "\n```\n"
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+func TestBuildExplainPlan(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	// 派生表中的 UNION 以及 WHERE 条件中的子查询
+	exp := &ExplainInfo{ExplainRows: []ExplainRow{
+		{ID: 1, SelectType: "PRIMARY", TableName: "<derived2>", AccessType: "ALL", Rows: 20, Filtered: 100, Scalability: "O(n)", Extra: "Using where"},
+		{ID: 4, SelectType: "SUBQUERY", TableName: "city", AccessType: "ALL", Rows: 600, Filtered: 10, Scalability: "O(n)", Extra: "Using where"},
+		{ID: 2, SelectType: "DERIVED", TableName: "<union3,5>", AccessType: "ALL", Scalability: "O(n)"},
+		{ID: 3, SelectType: "DERIVED", TableName: "actor", AccessType: "ALL", Rows: 200, Filtered: 100, Scalability: "O(n)"},
+		{ID: 5, SelectType: "UNION", TableName: "film", AccessType: "ref", Key: "idx_title", Rows: 1, Filtered: 100, Scalability: "O(log n)"},
+	}}
+	want := `Select #1 (PRIMARY)
+├── <derived2> [ALL rows=20 filtered=100.00% O(n)] Using where
+│   └── Select #2 (DERIVED)
+│       └── <union3,5> [ALL rows=0 filtered=0.00% O(n)]
+│           ├── Select #3 (DERIVED)
+│           │   └── actor [ALL rows=200 filtered=100.00% O(n)]
+│           └── Select #5 (UNION)
+│               └── film [ref key=idx_title rows=1 filtered=100.00% O(log n)]
+└── Select #4 (SUBQUERY)
+    └── city [ALL rows=600 filtered=10.00% O(n)] Using where`
+	if got := RenderExplainPlan(BuildExplainPlan(exp), "ascii"); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+
+	exp, err := ParseExplainText(`{
+  "query_block": {
+    "select_id": 1,
+    "cost_info": {"query_cost": "24.50"},
+    "ordering_operation": {
+      "using_filesort": true,
+      "nested_loop": [
+        {"table": {"table_name": "c", "access_type": "ALL", "rows_examined_per_scan": 600, "filtered": "100.00"}},
+        {"table": {"table_name": "a", "access_type": "ref", "key": "idx_fk_city_id", "rows_examined_per_scan": 1, "filtered": "100.00",
+          "attached_subqueries": [{"dependent": true, "cacheable": false, "query_block": {"select_id": 2,
+            "table": {"table_name": "p", "access_type": "eq_ref", "key": "PRIMARY", "rows_examined_per_scan": 1, "filtered": "100.00"}}}]}}
+      ]
+    }
+  }
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := BuildExplainPlan(exp)
+	want = `Select #1 cost=24.50
+└── Ordering (Using filesort)
+    └── Nested loop
+        ├── c [ALL rows=600 filtered=100.00% O(n)]
+        └── a [ref key=idx_fk_city_id rows=1 filtered=100.00% O(log n)]
+            └── Select #2 (dependent)
+                └── p [eq_ref key=PRIMARY rows=1 filtered=100.00% O(log n)]`
+	if got := RenderExplainPlan(plan, "ascii"); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+
+	want = `digraph plan {
+  node [shape=box];
+  n0 [label="Select #1 cost=24.50"];
+  n1 [label="Ordering (Using filesort)"];
+  n2 [label="Nested loop"];
+  n3 [label="c [ALL rows=600 filtered=100.00% O(n)]"];
+  n4 [label="a [ref key=idx_fk_city_id rows=1 filtered=100.00% O(log n)]"];
+  n5 [label="Select #2 (dependent)"];
+  n6 [label="p [eq_ref key=PRIMARY rows=1 filtered=100.00% O(log n)]"];
+  n0 -> n1;
+  n1 -> n2;
+  n2 -> n3;
+  n2 -> n4;
+  n4 -> n5;
+  n5 -> n6;
+}`
+	if got := RenderExplainPlan(plan, "dot"); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+
+	want = "```mermaid\ngraph TD\n" +
+		`  n0["Select #1 cost=24.50"]
+  n0 --> n1["Ordering (Using filesort)"]
+  n1 --> n2["Nested loop"]
+  n2 --> n3["c [ALL rows=600 filtered=100.00% O(n)]"]
+  n2 --> n4["a [ref key=idx_fk_city_id rows=1 filtered=100.00% O(log n)]"]
+  n4 --> n5["Select #2 (dependent)"]
+  n5 --> n6["p [eq_ref key=PRIMARY rows=1 filtered=100.00% O(log n)]"]` + "\n```\n"
+	if got := PrintMarkdownExplainPlan(exp, "mermaid"); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
@@ -0,0 +1,207 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/XiaoMi/soar/ast"
+)
+
+// ExplainBlock 从用户粘贴的文本中切分出的一段 EXPLAIN 输出，SQL 为紧挨在它之前的 SQL 文本，找不到时为空
+type ExplainBlock struct {
+	SQL  string
+	Text string
+}
+
+var (
+	// explainVerticalRowExp \G 输出的行分隔线，如 *************************** 1. row ***************************
+	explainVerticalRowExp = regexp.MustCompile(`^\*+ \d+\. row \*+$`)
+	// explainPromptExp mysql 客户端的提示符及续行提示符
+	explainPromptExp = regexp.MustCompile(`^\s*(mysql|MySQL \[[^\]]*\]|MariaDB \[[^\]]*\])>\s?|^\s+->\s?`)
+	// explainSQLExp 看起来像 SQL 的文本，用于区分工单中的描述文字
+	explainSQLExp = regexp.MustCompile(`(?is)^\s*(explain|desc|describe|select|insert|update|delete|replace|with|table|\()\b`)
+	// explainPrefixExp SQL 前面的 EXPLAIN 关键字及其参数
+	explainPrefixExp = regexp.MustCompile(`(?is)^\s*(explain|desc|describe)(\s+(analyze|extended|partitions|format\s*=\s*\w+))*\s+`)
+)
+
+// SplitExplainText 将包含多段 EXPLAIN 输出的文本切分成多个 ExplainBlock
+// 支持传统表格、\G 输出、JSON 及 FORMAT=TREE 格式，各段之间可以夹杂产生它们的 SQL 或其他文字
+func SplitExplainText(content string) []ExplainBlock {
+	var blocks []ExplainBlock
+	var pending []string
+	lines := strings.Split(strings.Replace(content, "\r\n", "\n", -1), "\n")
+	for i := 0; i < len(lines); {
+		line := strings.TrimRight(lines[i], " \t")
+		var end int
+		switch {
+		case strings.HasPrefix(line, "+"):
+			end = tableExplainEnd(lines, i)
+		case explainVerticalRowExp.MatchString(strings.TrimSpace(line)):
+			end = verticalExplainEnd(lines, i)
+		case strings.HasPrefix(line, "{"):
+			end = jsonExplainEnd(lines, i)
+		case strings.HasPrefix(line, "-> ") || strings.HasPrefix(line, "EXPLAIN: -> "):
+			// 没有表格边框的 FORMAT=TREE 输出，根迭代器没有缩进，以此与 mysql 客户端的续行提示符区分
+			end = treeExplainEnd(lines, i)
+		default:
+			pending = append(pending, lines[i])
+			i++
+			continue
+		}
+		text := strings.TrimSpace(strings.Join(lines[i:end], "\n"))
+		blocks = append(blocks, ExplainBlock{
+			SQL:  explainBlockSQL(pending),
+			Text: unwrapJSONExplain(text),
+		})
+		pending = nil
+		i = skipRowsInSet(lines, end)
+	}
+	return blocks
+}
+
+// tableExplainEnd 表格由 3 条分隔线组成：表头上下各一条，数据之后一条
+func tableExplainEnd(lines []string, start int) int {
+	borders := 0
+	for i := start; i < len(lines); i++ {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), "+") {
+			borders++
+			if borders == 3 {
+				return i + 1
+			}
+		}
+	}
+	return len(lines)
+}
+
+// verticalExplainEnd \G 输出到空行或 "N rows in set" 为止
+func verticalExplainEnd(lines []string, start int) int {
+	for i := start + 1; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || explainRowsInSet.MatchString(line) {
+			return i
+		}
+	}
+	return len(lines)
+}
+
+// treeExplainEnd 树形输出中的迭代器都以 "-> " 开头，到第一个不以它开头的行为止
+func treeExplainEnd(lines []string, start int) int {
+	for i := start + 1; i < len(lines); i++ {
+		if !strings.HasPrefix(strings.TrimSpace(lines[i]), "-> ") {
+			return i
+		}
+	}
+	return len(lines)
+}
+
+// jsonExplainEnd 按括号匹配找到 JSON 的结束位置，忽略字符串中的括号
+func jsonExplainEnd(lines []string, start int) int {
+	depth := 0
+	inString, escaped := false, false
+	for i := start; i < len(lines); i++ {
+		for _, c := range lines[i] {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\' && inString:
+				escaped = true
+			case c == '"':
+				inString = !inString
+			case inString:
+			case c == '{':
+				depth++
+			case c == '}':
+				depth--
+			}
+		}
+		if depth <= 0 {
+			return i + 1
+		}
+	}
+	return len(lines)
+}
+
+// skipRowsInSet 跳过 EXPLAIN 输出之后的空行及 "N rows in set" 提示
+func skipRowsInSet(lines []string, i int) int {
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line != "" && !explainRowsInSet.MatchString(line) {
+			break
+		}
+	}
+	return i
+}
+
+// unwrapJSONExplain 去掉 mysql 客户端在 JSON 外层输出的表格或 \G 的行分隔线，其他格式原样返回
+func unwrapJSONExplain(text string) string {
+	lines := strings.Split(text, "\n")
+	var json string
+	switch {
+	case len(lines) >= 5 && strings.HasPrefix(lines[0], "+") && strings.Trim(lines[1], "| ") == "EXPLAIN":
+		var body []string
+		for _, line := range lines[3:] {
+			if strings.HasPrefix(line, "+") {
+				break
+			}
+			body = append(body, line)
+		}
+		json = strings.TrimSpace(strings.Join(body, "\n"))
+		json = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(json, "|"), "|"))
+	case len(lines) >= 2 && explainVerticalRowExp.MatchString(lines[0]):
+		json = strings.TrimSpace(strings.TrimPrefix(strings.Join(lines[1:], "\n"), "EXPLAIN:"))
+	}
+	if !strings.HasPrefix(json, "{") {
+		return text
+	}
+	return json
+}
+
+// explainBlockSQL 从 EXPLAIN 输出之前的文本中提取最后一条 SQL，去掉客户端提示符及 EXPLAIN 关键字
+func explainBlockSQL(pending []string) string {
+	var buf []string
+	for _, line := range pending {
+		buf = append(buf, explainPromptExp.ReplaceAllString(line, ""))
+	}
+	text := strings.Replace(strings.Join(buf, "\n"), `\G`, ";", -1)
+
+	// 按语句切分，字符串及注释中的分号不作为分隔符
+	var sql string
+	for buf := []byte(text); len(buf) > 0; {
+		stmt, _, left := ast.SplitStatement(buf, []byte(";"))
+		if len(left) == len(buf) {
+			// 防止切分死循环
+			stmt, left = string(buf), nil
+		}
+		buf = left
+		stmt = strings.TrimSuffix(strings.TrimSpace(stmt), ";")
+		if strings.TrimSpace(stmt) == "" {
+			continue
+		}
+		// 保留最后一段文字中从 SQL 关键字开始的部分，前面可能是工单中的描述
+		sql = ""
+		stmtLines := strings.Split(stmt, "\n")
+		for i, line := range stmtLines {
+			if explainSQLExp.MatchString(line) {
+				sql = strings.TrimSpace(strings.Join(stmtLines[i:], "\n"))
+				break
+			}
+		}
+	}
+	return strings.TrimSpace(explainPrefixExp.ReplaceAllString(sql, ""))
+}
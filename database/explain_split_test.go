@@ -0,0 +1,85 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+func TestSplitExplainText(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	text := `客户反馈下面两条 SQL 很慢：
+
+mysql> explain select * from film
+    -> where title = 'ACE; GOLDFINGER';
++----+-------------+-------+------+---------------+------+---------+------+------+----------+-------------+
+| id | select_type | table | type | possible_keys | key  | key_len | ref  | rows | filtered | Extra       |
++----+-------------+-------+------+---------------+------+---------+------+------+----------+-------------+
+|  1 | SIMPLE      | film  | ALL  | NULL          | NULL | NULL    | NULL | 1000 |    10.00 | Using where |
++----+-------------+-------+------+---------------+------+---------+------+------+----------+-------------+
+1 row in set, 1 warning (0.00 sec)
+
+mysql> EXPLAIN FORMAT=JSON select * from city where city_id = 1\G
+*************************** 1. row ***************************
+EXPLAIN: {
+  "query_block": {
+    "select_id": 1,
+    "table": {"table_name": "city", "access_type": "const", "key": "PRIMARY", "rows_examined_per_scan": 1}
+  }
+}
+1 row in set, 1 warning (0.00 sec)
+
+另外这是同事贴的 JSON:
+{
+  "query_block": {"select_id": 1, "message": "no matching row in const table"}
+}
+
+-> Limit: 20 row(s)  (cost=0.35..0.55 rows=20)
+    -> Table scan on film  (cost=105 rows=1000)
+`
+	blocks := SplitExplainText(text)
+	if len(blocks) != 4 {
+		t.Fatalf("want 4 blocks, got %d: %+v", len(blocks), blocks)
+	}
+
+	sqls := []string{
+		"select * from film\nwhere title = 'ACE; GOLDFINGER'",
+		"select * from city where city_id = 1",
+		"",
+		"",
+	}
+	formats := []int{TraditionalFormatExplain, JSONFormatExplain, JSONFormatExplain, TreeFormatExplain}
+	for i, block := range blocks {
+		if block.SQL != sqls[i] {
+			t.Errorf("block %d SQL want %q, got %q", i, sqls[i], block.SQL)
+		}
+		exp, err := ParseExplainText(block.Text)
+		if err != nil {
+			t.Errorf("block %d parse error: %v\n%s", i, err, block.Text)
+			continue
+		}
+		if exp.ExplainFormat != formats[i] {
+			t.Errorf("block %d format want %d, got %d", i, formats[i], exp.ExplainFormat)
+		}
+	}
+	if rows := blocks[0].Text; len(rows) == 0 || rows[len(rows)-1] != '+' {
+		t.Errorf("rows in set should be removed, got %s", rows)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
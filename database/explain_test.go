@@ -18,6 +18,7 @@ package database
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/XiaoMi/soar/common"
@@ -2372,14 +2373,48 @@ func TestParseExplainText(t *testing.T) {
 	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
 }
 
+func TestParseExplainTextRows(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	// mysql 客户端输出的列名为小写的 rows
+	texts := []string{`+----+-------------+-------+------+---------------+------+---------+------+------+----------+-------------+
+| id | select_type | table | type | possible_keys | key  | key_len | ref  | rows | filtered | Extra       |
++----+-------------+-------+------+---------------+------+---------+------+------+----------+-------------+
+|  1 | SIMPLE      | film  | ALL  | NULL          | NULL | NULL    | NULL | 1000 |    10.00 | Using where |
++----+-------------+-------+------+---------------+------+---------+------+------+----------+-------------+`,
+		`*************************** 1. row ***************************
+           id: 1
+  select_type: SIMPLE
+        table: film
+   partitions: NULL
+         type: ALL
+possible_keys: NULL
+          key: NULL
+      key_len: NULL
+          ref: NULL
+         rows: 1000
+     filtered: 10.00
+        Extra: Using where`,
+	}
+	for _, text := range texts {
+		exp, err := ParseExplainText(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(exp.ExplainRows) != 1 || exp.ExplainRows[0].Rows != 1000 {
+			t.Errorf("rows want 1000, got %+v", exp.ExplainRows)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
 func TestFindTablesInJson(t *testing.T) {
 	common.Log.Debug("Entering function: %s", common.GetFunctionName())
 	idx := 9
 	for _, j := range exp[idx : idx+1] {
 		pretty.Println(j)
-		findTablesInJSON(j, 0)
+		tables := findTablesInJSON(j, 0, nil)
+		pretty.Println(len(tables), tables)
 	}
-	pretty.Println(len(explainJSONTables), explainJSONTables)
 	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
 }
 
@@ -2473,3 +2508,21 @@ func TestExplainAbleSQL(t *testing.T) {
 	}
 	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
 }
+
+func TestExplainVersion(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	orgVersion := common.Config.TestDSN.Version
+	common.Config.TestDSN.Version = 80023
+	defer func() { common.Config.TestDSN.Version = orgVersion }()
+
+	// FORMAT=JSON 取决于执行 EXPLAIN 的连接的版本，而不是测试环境的版本
+	conn := &Connector{Addr: "127.0.0.1:3307", ServerVersion: 50540}
+	if sql := conn.explainQuery("select 1", TraditionalExplainType, JSONFormatExplain); strings.Contains(sql, "FORMAT=JSON") {
+		t.Errorf("5.5 should not use FORMAT=JSON, got: %s", sql)
+	}
+	conn.ServerVersion = 0
+	if sql := conn.explainQuery("select 1", TraditionalExplainType, JSONFormatExplain); !strings.Contains(sql, "FORMAT=JSON") {
+		t.Errorf("TestDSN version should be used, got: %s", sql)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
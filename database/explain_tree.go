@@ -0,0 +1,208 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ExplainTreeNode FORMAT=TREE 及 EXPLAIN ANALYZE 输出中的一个迭代器
+// https://dev.mysql.com/doc/refman/8.0/en/explain.html#explain-analyze
+type ExplainTreeNode struct {
+	Detail        string             // 迭代器的完整描述，不含前面的 "-> "
+	Operation     string             // 去掉代价及实际执行信息后的迭代器描述，如 Table scan on film
+	Cost          float64            // 优化器估算的代价
+	EstimatedRows float64            // 优化器估算的每次执行返回的行数
+	Analyzed      bool               // 是否含有 EXPLAIN ANALYZE 的实际执行信息
+	NeverExecuted bool               // EXPLAIN ANALYZE 中未被执行的迭代器
+	FirstRowTime  float64            // 读取第一行的平均耗时，毫秒
+	ActualTime    float64            // 读取全部行的平均耗时，毫秒
+	ActualRows    float64            // 每次执行平均返回的行数
+	Loops         int64              // 迭代器被执行的次数
+	Children      []*ExplainTreeNode // 子迭代器
+}
+
+// explainNumber 执行计划中的数值，较大的值会使用科学计数法
+const explainNumber = `([0-9]+(?:\.[0-9]+)?(?:e[+-]?[0-9]+)?)`
+
+var (
+	// explainTreeLineExp 树形执行计划中的一行，文本可能来自 mysql 客户端的表格或 \G 输出
+	explainTreeLineExp = regexp.MustCompile(`(?m)^(\|\s*|EXPLAIN:\s*|\s*)-> `)
+	explainCostExp     = regexp.MustCompile(`\s*\(cost=` + explainNumber + `(?:\.\.` + explainNumber + `)? rows=` + explainNumber + `\)`)
+	explainActualExp   = regexp.MustCompile(`\s*\(actual time=` + explainNumber + `\.\.` + explainNumber + ` rows=` + explainNumber + ` loops=([0-9]+)\)`)
+	explainNeverExp    = regexp.MustCompile(`\s*\(never executed\)`)
+	explainRowsInSet   = regexp.MustCompile(`^\d+ rows? in set`)
+)
+
+// isTreeExplainText 判断文本是否为 FORMAT=TREE 或 EXPLAIN ANALYZE 的输出
+func isTreeExplainText(content string) bool {
+	return explainTreeLineExp.MatchString(content)
+}
+
+// parseTreeExplainText 解析 FORMAT=TREE 及 EXPLAIN ANALYZE 的输出，子迭代器比父迭代器多缩进 4 个空格
+func parseTreeExplainText(content string) ([]*ExplainTreeNode, error) {
+	type level struct {
+		indent int
+		node   *ExplainTreeNode
+	}
+	var roots []*ExplainTreeNode
+	var stack []level
+	var last *ExplainTreeNode
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		// 去掉 mysql 客户端输出的表格边框、表头及 \G 输出的列名
+		if strings.HasPrefix(line, "+") || strings.HasPrefix(line, "*") ||
+			explainRowsInSet.MatchString(line) || strings.Trim(line, "| ") == "EXPLAIN" {
+			continue
+		}
+		line = strings.TrimSuffix(line, "|")
+		line = strings.TrimPrefix(line, "EXPLAIN:")
+		line = strings.TrimPrefix(line, "|")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		idx := strings.Index(line, "-> ")
+		if idx < 0 || strings.TrimSpace(line[:idx]) != "" {
+			// 被截断成多行的迭代器描述
+			if last != nil {
+				last.Detail += " " + strings.TrimSpace(line)
+			}
+			continue
+		}
+		node := &ExplainTreeNode{Detail: strings.TrimSpace(line[idx+3:])}
+
+		for len(stack) > 0 && stack[len(stack)-1].indent >= idx {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, node)
+		} else {
+			parent := stack[len(stack)-1].node
+			parent.Children = append(parent.Children, node)
+		}
+		stack = append(stack, level{indent: idx, node: node})
+		last = node
+	}
+
+	if len(roots) == 0 {
+		return nil, errors.New("no iterator found in tree format explain")
+	}
+	WalkExplainTree(roots, func(node, parent *ExplainTreeNode) {
+		node.parseDetail()
+	})
+	return roots, nil
+}
+
+// parseDetail 从迭代器描述中解析代价、估算行数及实际执行信息
+func (node *ExplainTreeNode) parseDetail() {
+	op := node.Detail
+	if m := explainCostExp.FindStringSubmatch(op); len(m) > 0 {
+		cost := m[1]
+		if m[2] != "" {
+			cost = m[2]
+		}
+		node.Cost, _ = strconv.ParseFloat(cost, 64)
+		node.EstimatedRows, _ = strconv.ParseFloat(m[3], 64)
+		op = strings.Replace(op, m[0], "", 1)
+	}
+	if m := explainActualExp.FindStringSubmatch(op); len(m) > 0 {
+		node.Analyzed = true
+		node.FirstRowTime, _ = strconv.ParseFloat(m[1], 64)
+		node.ActualTime, _ = strconv.ParseFloat(m[2], 64)
+		node.ActualRows, _ = strconv.ParseFloat(m[3], 64)
+		node.Loops, _ = strconv.ParseInt(m[4], 10, 64)
+		op = strings.Replace(op, m[0], "", 1)
+	}
+	if m := explainNeverExp.FindString(op); m != "" {
+		node.Analyzed = true
+		node.NeverExecuted = true
+		op = strings.Replace(op, m, "", 1)
+	}
+	node.Operation = strings.TrimSpace(op)
+}
+
+// TotalTime 迭代器所有执行次数的总耗时（包含子迭代器），毫秒
+func (node *ExplainTreeNode) TotalTime() float64 {
+	return node.ActualTime * float64(node.Loops)
+}
+
+// SelfTime 迭代器自身的耗时，即总耗时减去子迭代器的总耗时，毫秒
+func (node *ExplainTreeNode) SelfTime() float64 {
+	self := node.TotalTime()
+	for _, child := range node.Children {
+		self -= child.TotalTime()
+	}
+	if self < 0 {
+		return 0
+	}
+	return self
+}
+
+// WalkExplainTree 先序遍历执行计划树，根节点的 parent 为 nil
+func WalkExplainTree(roots []*ExplainTreeNode, fn func(node, parent *ExplainTreeNode)) {
+	var walk func(node, parent *ExplainTreeNode)
+	walk = func(node, parent *ExplainTreeNode) {
+		fn(node, parent)
+		for _, child := range node.Children {
+			walk(child, node)
+		}
+	}
+	for _, root := range roots {
+		walk(root, nil)
+	}
+}
+
+// treeExplainAnalyzed 执行计划树中是否含有 EXPLAIN ANALYZE 的实际执行信息
+func treeExplainAnalyzed(roots []*ExplainTreeNode) bool {
+	analyzed := false
+	WalkExplainTree(roots, func(node, parent *ExplainTreeNode) {
+		if node.Analyzed {
+			analyzed = true
+		}
+	})
+	return analyzed
+}
+
+// FormatExplainTree 将执行计划树还原成 FORMAT=TREE 的文本
+func FormatExplainTree(roots []*ExplainTreeNode) string {
+	var buf []string
+	var format func(node *ExplainTreeNode, depth int)
+	format = func(node *ExplainTreeNode, depth int) {
+		buf = append(buf, strings.Repeat("    ", depth)+"-> "+node.Detail)
+		for _, child := range node.Children {
+			format(child, depth+1)
+		}
+	}
+	for _, root := range roots {
+		format(root, 0)
+	}
+	return strings.Join(buf, "\n")
+}
+
+// printMarkdownExplainTree 以代码块的形式打印树形执行计划
+func printMarkdownExplainTree(exp *ExplainInfo) string {
+	title := "以下为 FORMAT=TREE 格式的执行计划"
+	if exp.ExplainFormat == AnalyzeFormatExplain {
+		title = "以下为 EXPLAIN ANALYZE 的执行结果，actual time 单位为毫秒，rows 为每次执行平均返回的行数"
+	}
+	return title + "\n\n```text\n" + FormatExplainTree(exp.ExplainTree) + "\n```\n"
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+var treeExplain = []string{
+	// EXPLAIN ANALYZE 的表格输出
+	`+----------------------------------------------------------------------------------------------------+
+| EXPLAIN                                                                                            |
++----------------------------------------------------------------------------------------------------+
+| -> Nested loop inner join  (cost=4.70 rows=10) (actual time=0.071..21.5 rows=10 loops=1)
+    -> Filter: (c.country_id is not null)  (cost=1.25 rows=10) (actual time=0.034..0.061 rows=10 loops=1)
+        -> Table scan on c  (cost=1.25 rows=10) (actual time=0.032..0.056 rows=10 loops=1)
+    -> Index lookup on a using idx_fk_city_id (city_id=c.city_id)  (cost=0.26 rows=1) (actual time=2.1..2.14 rows=1 loops=10)
+    -> Select #2 (subquery in condition; run only once)
+        -> Table scan on b  (never executed)
+ |
++----------------------------------------------------------------------------------------------------+
+1 row in set (0.02 sec)`,
+	// FORMAT=TREE 的 \G 输出
+	`*************************** 1. row ***************************
+EXPLAIN: -> Limit: 20 row(s)  (cost=0.35..0.55 rows=20)
+    -> Sort: film.title DESC, limit input to 20 row(s) per chunk  (cost=105 rows=1000)
+        -> Table scan on film  (cost=105 rows=1000)
+
+1 row in set (0.00 sec)`,
+}
+
+func TestParseTreeExplainText(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	exp, err := ParseExplainText(treeExplain[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp.ExplainFormat != AnalyzeFormatExplain || len(exp.ExplainTree) != 1 {
+		t.Fatalf("want 1 analyzed root, got format %d, %d roots", exp.ExplainFormat, len(exp.ExplainTree))
+	}
+	root := exp.ExplainTree[0]
+	if root.Operation != "Nested loop inner join" || len(root.Children) != 3 {
+		t.Errorf("root got %s with %d children", root.Operation, len(root.Children))
+	}
+	lookup := root.Children[1]
+	if lookup.Operation != "Index lookup on a using idx_fk_city_id (city_id=c.city_id)" ||
+		lookup.EstimatedRows != 1 || lookup.ActualTime != 2.14 || lookup.Loops != 10 {
+		t.Errorf("index lookup got %+v", lookup)
+	}
+	if never := root.Children[2].Children[0]; !never.NeverExecuted || never.Operation != "Table scan on b" {
+		t.Errorf("never executed got %+v", never)
+	}
+	// 21.5 - 0.061 - 2.14 * 10
+	if self := root.SelfTime(); self < 0.038 || self > 0.04 {
+		t.Errorf("root self time got %f", self)
+	}
+	if !strings.HasPrefix(FormatExplainTree(exp.ExplainTree), "-> Nested loop inner join  (cost=4.70 rows=10)") {
+		t.Errorf("FormatExplainTree got %s", FormatExplainTree(exp.ExplainTree))
+	}
+
+	exp, err = ParseExplainText(treeExplain[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp.ExplainFormat != TreeFormatExplain || len(exp.ExplainTree) != 1 {
+		t.Fatalf("want 1 tree root, got format %d, %d roots", exp.ExplainFormat, len(exp.ExplainTree))
+	}
+	var ops []string
+	WalkExplainTree(exp.ExplainTree, func(node, parent *ExplainTreeNode) {
+		ops = append(ops, node.Operation)
+	})
+	if strings.Join(ops, ";") != "Limit: 20 row(s);Sort: film.title DESC, limit input to 20 row(s) per chunk;Table scan on film" {
+		t.Errorf("operations got %s", strings.Join(ops, ";"))
+	}
+	if exp.ExplainTree[0].Cost != 0.55 || exp.ExplainTree[0].Children[0].Children[0].EstimatedRows != 1000 {
+		t.Errorf("cost got %+v", exp.ExplainTree[0])
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestExplainFormatSupported(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	cases := []struct {
+		format  int
+		version int
+		want    bool
+	}{
+		{TreeFormatExplain, 80016, true},
+		{TreeFormatExplain, 80015, false},
+		{AnalyzeFormatExplain, 80016, false},
+		{AnalyzeFormatExplain, 80030, true},
+		{AnalyzeFormatExplain, 100406, false},
+		{JSONFormatExplain, 50600, true},
+	}
+	for _, c := range cases {
+		if got := explainFormatSupported(c.format, c.version); got != c.want {
+			t.Errorf("format %d version %d want %v, got %v", c.format, c.version, c.want, got)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+// 索引使用情况统计信息的来源
+const (
+	IndexUsageFromPerformanceSchema = "performance_schema.table_io_waits_summary_by_index_usage"
+	IndexUsageFromSys               = "sys.schema_unused_indexes"
+)
+
+// IndexUsageInfo 某个库中索引的使用情况
+type IndexUsageInfo struct {
+	Source string                      // 统计信息来源
+	Reads  map[string]map[string]int64 // 表名 -> 索引名 -> 实例启动（或统计被重置）以来通过该索引读取的行数
+	Sizes  map[string]map[string]int64 // 表名 -> 索引名 -> 索引大小（字节）
+}
+
+// IndexReads 获取索引读取的行数，ok 为 false 时表示该索引有被使用，但无法得知具体的读取次数
+func (info *IndexUsageInfo) IndexReads(tb, idx string) (reads int64, ok bool) {
+	reads, ok = info.Reads[tb][idx]
+	// performance_schema 中没有记录的索引所在表自启动以来未被打开过，读取次数为 0
+	if !ok && info.Source == IndexUsageFromPerformanceSchema {
+		return 0, true
+	}
+	return reads, ok
+}
+
+// IndexSize 获取索引大小（字节），无法获取时返回 -1
+func (info *IndexUsageInfo) IndexSize(tb, idx string) int64 {
+	if size, ok := info.Sizes[tb][idx]; ok {
+		return size
+	}
+	return -1
+}
+
+// ShowIndexUsage 获取指定库中各个索引的读取次数及大小
+// 优先读取 performance_schema.table_io_waits_summary_by_index_usage，没有权限时退而使用 sys.schema_unused_indexes，此时只包含未使用的索引
+func (db *Connector) ShowIndexUsage(dbName string) (*IndexUsageInfo, error) {
+	info := &IndexUsageInfo{
+		Source: IndexUsageFromPerformanceSchema,
+		Reads:  make(map[string]map[string]int64),
+		Sizes:  make(map[string]map[string]int64),
+	}
+	if db.Snapshot != nil {
+		return info, errors.New("snapshot has no performance_schema statistics")
+	}
+
+	enabled, err := db.SingleIntValue("performance_schema")
+	if err != nil {
+		return info, err
+	}
+	if enabled != 1 {
+		return info, errors.New("performance_schema is disabled")
+	}
+
+	// INDEX_NAME 为 NULL 的行是全表扫描的统计，不属于任何索引
+	sql := fmt.Sprintf("SELECT OBJECT_NAME, INDEX_NAME, COUNT_READ FROM %s WHERE OBJECT_SCHEMA = '%s' AND INDEX_NAME IS NOT NULL",
+		IndexUsageFromPerformanceSchema, Escape(dbName, false))
+	common.Log.Debug("ShowIndexUsage, execute SQL: %s", sql)
+	res, err := db.Query(sql)
+	if err != nil {
+		common.Log.Warn("ShowIndexUsage, Query performance_schema Error: %v, fallback to %s", err, IndexUsageFromSys)
+		info.Source = IndexUsageFromSys
+		sql = fmt.Sprintf("SELECT object_name, index_name, 0 FROM %s WHERE object_schema = '%s'",
+			IndexUsageFromSys, Escape(dbName, false))
+		common.Log.Debug("ShowIndexUsage, execute SQL: %s", sql)
+		res, err = db.Query(sql)
+		if err != nil {
+			return info, err
+		}
+	}
+	err = scanIndexStats(res, info.Reads)
+	if err != nil {
+		return info, err
+	}
+
+	// 索引大小来自 InnoDB 持久化统计信息，没有 mysql 库权限时不影响使用情况的判断
+	sql = fmt.Sprintf("SELECT table_name, index_name, stat_value * @@innodb_page_size FROM mysql.innodb_index_stats WHERE stat_name = 'size' AND database_name = '%s'",
+		Escape(dbName, false))
+	common.Log.Debug("ShowIndexUsage, execute SQL: %s", sql)
+	res, err = db.Query(sql)
+	if err != nil {
+		common.Log.Warn("ShowIndexUsage, Query index size Error: %v", err)
+		return info, nil
+	}
+	common.LogIfError(scanIndexStats(res, info.Sizes), "")
+	return info, nil
+}
+
+// scanIndexStats 读取 表名, 索引名, 数值 三列的查询结果
+func scanIndexStats(res QueryResult, stats map[string]map[string]int64) error {
+	var err error
+	for res.Rows.Next() {
+		var tb, idx string
+		var value int64
+		err = res.Rows.Scan(&tb, &idx, &value)
+		if err != nil {
+			break
+		}
+		if _, ok := stats[tb]; !ok {
+			stats[tb] = make(map[string]int64)
+		}
+		stats[tb][idx] = value
+	}
+	res.Rows.Close()
+	return err
+}
+
+// Uptime 获取实例运行时长（秒）
+func (db *Connector) Uptime() (int64, error) {
+	if db.Snapshot != nil {
+		return 0, errors.New("snapshot has no server status")
+	}
+	res, err := db.Query("SHOW GLOBAL STATUS LIKE 'Uptime'")
+	if err != nil {
+		return 0, err
+	}
+	var name string
+	var uptime int64
+	if res.Rows.Next() {
+		err = res.Rows.Scan(&name, &uptime)
+	}
+	res.Rows.Close()
+	return uptime, err
+}
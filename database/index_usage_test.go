@@ -0,0 +1,39 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+func TestShowIndexUsage(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	usage, err := connTest.ShowIndexUsage("sakila")
+	if err != nil {
+		t.Error("ShowIndexUsage Error: ", err)
+	}
+	if _, ok := usage.IndexReads("film", "idx_title"); usage.Source == IndexUsageFromPerformanceSchema && !ok {
+		t.Error("performance_schema should have idx_title reads")
+	}
+	uptime, err := connTest.Uptime()
+	if err != nil || uptime <= 0 {
+		t.Errorf("Uptime got %d, Error: %v", uptime, err)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
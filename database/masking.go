@@ -0,0 +1,396 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+// MaskRule 采样时的数据脱敏规则，由 -sampling-mask 配置
+// 格式为 `目标=策略`，目标可以是 column:列名正则, type:数据类型 或 db.table.column
+// 策略支持 hash, fake, null, truncate[:n]
+type MaskRule struct {
+	Column   *regexp.Regexp // 列名正则
+	Type     string         // 数据类型，如 VARCHAR
+	Name     string         // db.table.column
+	Strategy string
+	Length   int // truncate 保留的字符数
+}
+
+// maskStrategies 支持的脱敏策略
+var maskStrategies = map[string]bool{
+	"hash":     true, // 使用 HMAC-SHA256 摘要替换，长度与原值相同，较短的值可能冲突，数值类型及索引中的列按 fake 处理
+	"fake":     true, // 保留格式，数字替换为数字，字母替换为同样大小写的字母，汉字替换为汉字，其他字符不变，不同的值替换后仍然不同
+	"null":     true, // 替换为 NULL，会改变列的散粒度
+	"truncate": true, // 只保留前 n 个字符，默认为 3，会改变列的散粒度
+}
+
+// ParseMaskRules 解析 -sampling-mask 配置，忽略空的配置项
+func ParseMaskRules(rules []string) ([]*MaskRule, error) {
+	var masks []*MaskRule
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		idx := strings.LastIndex(rule, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("sampling-mask '%s' should be target=strategy", rule)
+		}
+		target, strategy := strings.TrimSpace(rule[:idx]), strings.ToLower(strings.TrimSpace(rule[idx+1:]))
+
+		mask := &MaskRule{Strategy: strategy}
+		if strings.HasPrefix(strategy, "truncate") {
+			mask.Strategy, mask.Length = "truncate", 3
+			if n := strings.TrimPrefix(strategy, "truncate"); n != "" {
+				length, err := strconv.Atoi(strings.TrimPrefix(n, ":"))
+				if err != nil || length < 0 {
+					return nil, fmt.Errorf("sampling-mask '%s' invalid truncate length", rule)
+				}
+				mask.Length = length
+			}
+		}
+		if !maskStrategies[mask.Strategy] {
+			return nil, fmt.Errorf("sampling-mask '%s' unknown strategy '%s'", rule, strategy)
+		}
+
+		switch {
+		case strings.HasPrefix(target, "column:"):
+			reg, err := regexp.Compile(strings.TrimPrefix(target, "column:"))
+			if err != nil {
+				return nil, fmt.Errorf("sampling-mask '%s' %s", rule, err.Error())
+			}
+			mask.Column = reg
+		case strings.HasPrefix(target, "type:"):
+			mask.Type = strings.ToUpper(strings.TrimPrefix(target, "type:"))
+		case strings.Count(target, ".") == 2:
+			mask.Name = strings.ToLower(target)
+		default:
+			return nil, fmt.Errorf("sampling-mask '%s' target should be column:regexp, type:TYPE or db.table.column", rule)
+		}
+		masks = append(masks, mask)
+	}
+	return masks, nil
+}
+
+// String 规则的展示形式
+func (r *MaskRule) String() string {
+	if r.Strategy == "truncate" {
+		return fmt.Sprintf("truncate:%d", r.Length)
+	}
+	return r.Strategy
+}
+
+// FindMaskRule 查找列对应的脱敏规则，db.table.column 形式的规则优先，其余按配置顺序匹配，没有匹配时返回 nil
+// 日期时间类型的列逐字符替换后不再是合法的值，跳过其中的 hash, fake 规则
+func FindMaskRule(masks []*MaskRule, database, table, column, typ string) *MaskRule {
+	name := strings.ToLower(database + "." + table + "." + column)
+	for _, mask := range masks {
+		if mask.Name != "" && mask.Name == name && mask.applicable(typ) {
+			return mask
+		}
+	}
+	for _, mask := range masks {
+		switch {
+		case !mask.applicable(typ):
+			continue
+		case mask.Column != nil && mask.Column.MatchString(column):
+			return mask
+		case mask.Type != "" && strings.EqualFold(mask.Type, typ):
+			return mask
+		}
+	}
+	return nil
+}
+
+// applicable 规则是否可以用于该类型的列
+func (r *MaskRule) applicable(typ string) bool {
+	if r.Strategy != "hash" && r.Strategy != "fake" {
+		return true
+	}
+	switch strings.ToUpper(typ) {
+	case "DATE", "DATETIME", "TIMESTAMP", "TIME", "YEAR":
+		common.Log.Warning("sampling-mask %s can't be applied to %s column, skipped", r.Strategy, typ)
+		return false
+	}
+	return true
+}
+
+// Distinct 脱敏后不同的值是否仍然可以区分，只有 fake 不会产生冲突
+// null, truncate 会将不同的值变为相同的值，hash 截断后较短的值可能冲突，都不能用于索引列
+func (r *MaskRule) Distinct() bool {
+	return r.Strategy == "fake"
+}
+
+// asFake hash 按 fake 处理后的规则，用于索引列及数值类型的列，保持列的散粒度
+func (r *MaskRule) asFake() *MaskRule {
+	if r.Strategy != "hash" {
+		return r
+	}
+	common.Log.Debug("sampling-mask hash is applied as fake")
+	return &MaskRule{Column: r.Column, Type: r.Type, Name: r.Name, Strategy: "fake"}
+}
+
+// indexedColumns 表中所有索引包含的列，没有脱敏规则时不需要查询
+func (db *Connector) indexedColumns(table string, masks []*MaskRule) (map[string]bool, error) {
+	indexed := make(map[string]bool)
+	if len(masks) == 0 {
+		return indexed, nil
+	}
+	index, err := db.ShowIndex(table)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range index.Rows {
+		if row.ColumnName != "" {
+			indexed[strings.ToLower(row.ColumnName)] = true
+		}
+	}
+	return indexed, nil
+}
+
+// Mask 按规则对值进行脱敏，typ 为列的数据类型，hash, fake 对相同的值总是返回相同的结果
+// fake 对不同的值总是返回不同的结果，不会改变列的散粒度；hash 截断为原值的长度，较短的值可能映射为相同的结果
+func (r *MaskRule) Mask(val []byte, typ string, key []byte) []byte {
+	if val == nil {
+		return nil
+	}
+	numeric := isNumericType(typ)
+	switch r.Strategy {
+	case "null":
+		return nil
+	case "truncate":
+		if utf8.RuneCount(val) <= r.Length {
+			return val
+		}
+		return []byte(string([]rune(string(val))[:r.Length]))
+	case "hash":
+		if numeric {
+			return maskNumber(val, typ, key)
+		}
+		n := utf8.RuneCount(val)
+		if n == 0 {
+			return val
+		}
+		sum := hex.EncodeToString(maskHMAC(key, val, 0))
+		for len(sum) < n {
+			sum += hex.EncodeToString(maskHMAC(key, val, len(sum)))
+		}
+		return []byte(sum[:n])
+	default:
+		if numeric {
+			return maskNumber(val, typ, key)
+		}
+		return maskFake(val, key)
+	}
+}
+
+// maskHMAC 以原值及计数器计算摘要，作为替换字符的随机数来源
+func maskHMAC(key, val []byte, counter int) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write(val)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(counter))
+	_, _ = mac.Write(buf[:])
+	return mac.Sum(nil)
+}
+
+// maskFake 保留格式的替换，手机号、邮箱、身份证号等替换后仍然符合原来的格式
+// 每个字符在同类字符中做移位，位移量只由密钥及之前的原字符决定，两个值第一个不同的字符替换后仍然不同，因此不会产生冲突
+func maskFake(val, key []byte) []byte {
+	state := maskHMAC(key, nil, 0)
+	shift := func(c rune) int {
+		n := int(binary.BigEndian.Uint16(state))
+		var buf [utf8.UTFMax]byte
+		state = maskHMAC(key, append(state, buf[:utf8.EncodeRune(buf[:], c)]...), 0)
+		return n
+	}
+
+	var buf strings.Builder
+	prevDigit := false
+	for _, c := range string(val) {
+		n := shift(c)
+		switch {
+		case c >= '0' && c <= '9' && !prevDigit:
+			// 连续数字的第一位为 0 时保持不变，不为 0 时替换后也不为 0，避免数值的位数发生变化
+			if c != '0' {
+				buf.WriteRune(rune('1' + (int(c-'1')+n%9)%9))
+			} else {
+				buf.WriteRune(c)
+			}
+		case c >= '0' && c <= '9':
+			buf.WriteRune(rune('0' + (int(c-'0')+n%10)%10))
+		case c >= 'a' && c <= 'z':
+			buf.WriteRune(rune('a' + (int(c-'a')+n%26)%26))
+		case c >= 'A' && c <= 'Z':
+			buf.WriteRune(rune('A' + (int(c-'A')+n%26)%26))
+		case c >= 0x4E00 && c < 0x4E00+0x5000:
+			// CJK 统一汉字基本区
+			buf.WriteRune(rune(0x4E00 + (int(c-0x4E00)+n%0x5000)%0x5000))
+		default:
+			buf.WriteRune(c)
+		}
+		prevDigit = c >= '0' && c <= '9'
+	}
+	return []byte(buf.String())
+}
+
+// intRange 整数类型的取值范围
+type intRange struct {
+	min  int64
+	max  int64
+	umax uint64 // UNSIGNED 时的最大值
+}
+
+// intRanges 整数类型的取值范围，驱动返回的类型名中不区分 UNSIGNED
+var intRanges = map[string]intRange{
+	"TINYINT":   {math.MinInt8, math.MaxInt8, math.MaxUint8},
+	"SMALLINT":  {math.MinInt16, math.MaxInt16, math.MaxUint16},
+	"MEDIUMINT": {-1 << 23, 1<<23 - 1, 1<<24 - 1},
+	"INT":       {math.MinInt32, math.MaxInt32, math.MaxUint32},
+	"BIGINT":    {math.MinInt64, math.MaxInt64, math.MaxUint64},
+}
+
+// contains 返回与 val 处于同一区间的值的判断函数，区间为负数、不超过有符号最大值的非负数及只有 UNSIGNED 才能取到的值
+func (r intRange) contains(val string) (func(string) bool, bool) {
+	if n, err := strconv.ParseInt(val, 10, 64); err == nil {
+		if n < 0 {
+			return func(s string) bool {
+				v, err := strconv.ParseInt(s, 10, 64)
+				return err == nil && v >= r.min && v < 0
+			}, true
+		}
+		if n <= r.max {
+			return func(s string) bool {
+				v, err := strconv.ParseInt(s, 10, 64)
+				return err == nil && v >= 0 && v <= r.max
+			}, true
+		}
+	}
+	if n, err := strconv.ParseUint(val, 10, 64); err == nil && n <= r.umax {
+		return func(s string) bool {
+			v, err := strconv.ParseUint(s, 10, 64)
+			return err == nil && v > uint64(r.max) && v <= r.umax
+		}, true
+	}
+	return nil, false
+}
+
+// maskNumber 数值类型的 fake，整数替换后超出列类型的取值范围时对结果继续替换，直到回到原值所在的区间
+// fake 是同位数、同符号数字串上的置换，原值本身在区间内，因此总会回到区间内，不同的值替换后仍然不同
+func maskNumber(val []byte, typ string, key []byte) []byte {
+	fake := maskFake(val, key)
+	r, ok := intRanges[strings.ToUpper(typ)]
+	if !ok {
+		return fake
+	}
+	contains, ok := r.contains(string(val))
+	if !ok {
+		return fake
+	}
+	for !contains(string(fake)) {
+		fake = maskFake(fake, key)
+	}
+	return fake
+}
+
+// isNumericType 数值类型的列只能替换为数字
+func isNumericType(typ string) bool {
+	typ = strings.ToUpper(typ)
+	for _, t := range []string{"INT", "DECIMAL", "FLOAT", "DOUBLE", "YEAR"} {
+		if strings.Contains(typ, t) {
+			return true
+		}
+	}
+	return false
+}
+
+var maskKey struct {
+	sync.Once
+	key []byte
+}
+
+// samplingMaskKey hash, fake 使用的密钥，指定了 -sampling-mask-key 时由该密钥生成，否则每次运行随机生成
+// 使用密钥避免通过枚举手机号等取值空间较小的数据反推原值，-sampling-seed 是公开可复现的配置，不能用于生成密钥
+func samplingMaskKey() []byte {
+	if common.Config.SamplingMaskKey != "" {
+		sum := sha256.Sum256([]byte(common.Config.SamplingMaskKey))
+		return sum[:]
+	}
+	maskKey.Do(func() {
+		maskKey.key = make([]byte, 32)
+		if _, err := crand.Read(maskKey.key); err != nil {
+			common.Log.Error("samplingMaskKey Error: %v", err)
+		}
+	})
+	return maskKey.key
+}
+
+// maskedColumns 采样时被脱敏的列，db.table -> column -> 策略
+var maskedColumns = struct {
+	sync.Mutex
+	m map[string]map[string]string
+}{m: make(map[string]map[string]string)}
+
+// recordMaskedColumn 记录被脱敏的列，用于在报告中说明
+func recordMaskedColumn(database, table, column, strategy string) {
+	maskedColumns.Lock()
+	defer maskedColumns.Unlock()
+	key := strings.ToLower(database + "." + table)
+	if maskedColumns.m[key] == nil {
+		maskedColumns.m[key] = make(map[string]string)
+	}
+	maskedColumns.m[key][column] = strategy
+}
+
+// MaskedColumns 返回线上环境中某张表在采样时被脱敏的列，格式为 `column(strategy)`，按列名排序
+func MaskedColumns(database, table string) []string {
+	maskedColumns.Lock()
+	defer maskedColumns.Unlock()
+	var cols []string
+	for col, strategy := range maskedColumns.m[strings.ToLower(database+"."+table)] {
+		cols = append(cols, fmt.Sprintf("%s(%s)", col, strategy))
+	}
+	sort.Strings(cols)
+	return cols
+}
+
+// MaskedColumnStrategy 返回线上环境中某列在采样时使用的脱敏策略，未脱敏时返回空字符串
+func MaskedColumnStrategy(database, table, column string) string {
+	maskedColumns.Lock()
+	defer maskedColumns.Unlock()
+	for col, strategy := range maskedColumns.m[strings.ToLower(database+"."+table)] {
+		if strings.EqualFold(col, column) {
+			return strategy
+		}
+	}
+	return ""
+}
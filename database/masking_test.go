@@ -0,0 +1,229 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+func TestParseMaskRules(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	masks, err := ParseMaskRules([]string{
+		"",
+		"column:(?i)^(phone|mobile)$=fake",
+		"type:blob=null",
+		"sakila.customer.email=hash",
+		"column:name=truncate:2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(masks) != 4 {
+		t.Fatalf("want 4 rules, got %d", len(masks))
+	}
+	if masks[1].Type != "BLOB" || masks[2].Name != "sakila.customer.email" || masks[3].Length != 2 {
+		t.Errorf("got %+v %+v %+v", masks[1], masks[2], masks[3])
+	}
+
+	cases := []struct {
+		db, table, column, typ string
+		want                   string
+	}{
+		{"sakila", "customer", "Phone", "VARCHAR", "fake"},
+		{"sakila", "customer", "email", "VARCHAR", "hash"},
+		{"sakila", "film", "picture", "BLOB", "null"},
+		{"sakila", "actor", "first_name", "VARCHAR", "truncate:2"},
+		{"sakila", "actor", "actor_id", "SMALLINT", ""},
+		// 日期时间类型跳过 hash, fake
+		{"sakila", "customer", "Mobile", "DATETIME", ""},
+		{"sakila", "customer", "email", "TIMESTAMP", ""},
+	}
+	for _, c := range cases {
+		var got string
+		if mask := FindMaskRule(masks, c.db, c.table, c.column, c.typ); mask != nil {
+			got = mask.String()
+		}
+		if got != c.want {
+			t.Errorf("%s.%s.%s want %s, got %s", c.db, c.table, c.column, c.want, got)
+		}
+	}
+
+	for _, rule := range []string{"phone", "column:phone=encrypt", "column:(=hash", "customer.email=hash", "column:a=truncate:x"} {
+		if _, err = ParseMaskRules([]string{rule}); err == nil {
+			t.Errorf("'%s' should be invalid", rule)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestMaskRule(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	key := []byte("soar")
+	fake := &MaskRule{Strategy: "fake"}
+
+	phone := fake.Mask([]byte("13812345678"), "VARCHAR", key)
+	if !regexp.MustCompile(`^[1-9][0-9]{10}$`).Match(phone) || string(phone) == "13812345678" {
+		t.Errorf("phone got %s", phone)
+	}
+	email := fake.Mask([]byte("Jane.Doe@example.com"), "VARCHAR", key)
+	if !regexp.MustCompile(`^[A-Z][a-z]{3}\.[A-Z][a-z]{2}@[a-z]{7}\.[a-z]{3}$`).Match(email) {
+		t.Errorf("email got %s", email)
+	}
+	name := fake.Mask([]byte("张三"), "VARCHAR", key)
+	if utf8.RuneCount(name) != 2 || string(name) == "张三" {
+		t.Errorf("name got %s", name)
+	}
+
+	// 相同的值脱敏结果相同，不同的值脱敏结果不同，保持散粒度
+	if again := fake.Mask([]byte("13812345678"), "VARCHAR", key); string(again) != string(phone) {
+		t.Errorf("fake should be deterministic, got %s and %s", phone, again)
+	}
+	if other := fake.Mask([]byte("13812345679"), "VARCHAR", key); string(other) == string(phone) {
+		t.Errorf("different values got same result %s", other)
+	}
+	if other := fake.Mask([]byte("13812345678"), "VARCHAR", []byte("other")); string(other) == string(phone) {
+		t.Errorf("different keys got same result %s", other)
+	}
+	distinct := make(map[string]bool)
+	for a := 'a'; a <= 'z'; a++ {
+		for b := 'a'; b <= 'z'; b++ {
+			distinct[string(fake.Mask([]byte(string([]rune{a, b})), "VARCHAR", key))] = true
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		distinct[string(fake.Mask([]byte(strconv.Itoa(i)), "INT", key))] = true
+	}
+	if len(distinct) != 26*26+1000 {
+		t.Errorf("fake should not collide, got %d distinct values", len(distinct))
+	}
+
+	hash := &MaskRule{Strategy: "hash"}
+	if h := hash.Mask([]byte("jane@example.com"), "VARCHAR", key); len(h) != 16 || !regexp.MustCompile(`^[0-9a-f]+$`).Match(h) {
+		t.Errorf("hash got %s", h)
+	}
+	if h := hash.Mask([]byte("12345"), "INT", key); !regexp.MustCompile(`^[1-9][0-9]{4}$`).Match(h) {
+		t.Errorf("numeric hash got %s", h)
+	}
+	if h := hash.Mask(make([]byte, 100), "VARCHAR", key); len(h) != 100 {
+		t.Errorf("long hash got %d bytes", len(h))
+	}
+
+	if v := (&MaskRule{Strategy: "null"}).Mask([]byte("a"), "VARCHAR", key); v != nil {
+		t.Errorf("null got %s", v)
+	}
+	if v := (&MaskRule{Strategy: "truncate", Length: 3}).Mask([]byte("北京市海淀区"), "VARCHAR", key); string(v) != "北京市" {
+		t.Errorf("truncate got %s", v)
+	}
+	if v := fake.Mask(nil, "VARCHAR", key); v != nil {
+		t.Errorf("NULL got %s", v)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestMaskNumberRange(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	key := []byte("key")
+	fake := &MaskRule{Strategy: "fake"}
+	// TINYINT 的每个取值替换后仍在同一区间内，且不会冲突
+	distinct := make(map[int64]bool)
+	for i := -128; i <= 255; i++ {
+		v, err := strconv.ParseInt(string(fake.Mask([]byte(strconv.Itoa(i)), "TINYINT", key)), 10, 64)
+		switch {
+		case err != nil:
+			t.Fatal(err)
+		case i < 0 && (v < -128 || v >= 0), i >= 0 && i <= 127 && (v < 0 || v > 127), i > 127 && (v <= 127 || v > 255):
+			t.Errorf("TINYINT %d masked out of range: %d", i, v)
+		}
+		distinct[v] = true
+	}
+	if len(distinct) != 384 {
+		t.Errorf("fake should not collide, got %d distinct values", len(distinct))
+	}
+	// 接近最大值的 BIGINT 不会溢出
+	for _, val := range []string{"9223372036854775807", "18446744073709551615", "-9223372036854775808"} {
+		masked := string((&MaskRule{Strategy: "hash"}).Mask([]byte(val), "BIGINT", key))
+		if _, err := strconv.ParseInt(masked, 10, 64); err != nil && val[0] != '1' {
+			t.Errorf("BIGINT %s masked out of range: %s", val, masked)
+		}
+		if _, err := strconv.ParseUint(masked, 10, 64); err != nil && val[0] == '1' {
+			t.Errorf("BIGINT UNSIGNED %s masked out of range: %s", val, masked)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestMaskedColumns(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	recordMaskedColumn("sakila", "Customer", "phone", "fake")
+	recordMaskedColumn("sakila", "customer", "email", "hash")
+	cols := MaskedColumns("sakila", "customer")
+	if len(cols) != 2 || cols[0] != "email(hash)" || cols[1] != "phone(fake)" {
+		t.Errorf("got %v", cols)
+	}
+	if cols = MaskedColumns("sakila", "film"); len(cols) != 0 {
+		t.Errorf("got %v", cols)
+	}
+	for col, want := range map[string]string{"Email": "hash", "phone": "fake", "name": ""} {
+		if got := MaskedColumnStrategy("sakila", "customer", col); got != want {
+			t.Errorf("%s want: %s, got: %s", col, want, got)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestIndexedColumnsMask(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	s, err := LoadSnapshot(filepath.Join("testdata", "snapshot.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := &Connector{Addr: s.Addr, Database: s.Database, Snapshot: s}
+	masks, err := ParseMaskRules([]string{"column:title=null"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexed, err := conn.indexedColumns("film", masks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !indexed["film_id"] || !indexed["title"] || indexed["rating"] {
+		t.Errorf("got %v", indexed)
+	}
+	if indexed, _ = conn.indexedColumns("film", nil); len(indexed) != 0 {
+		t.Errorf("no mask rules should not query index, got %v", indexed)
+	}
+
+	// null, truncate 会改变散粒度，hash 较短的值可能冲突，不能用于索引列
+	for strategy, distinct := range map[string]bool{"hash": false, "fake": true, "null": false, "truncate": false} {
+		if d := (&MaskRule{Strategy: strategy}).Distinct(); d != distinct {
+			t.Errorf("%s Distinct want %v, got %v", strategy, distinct, d)
+		}
+	}
+	// 索引列上的 hash 按 fake 处理
+	for strategy, want := range map[string]string{"hash": "fake", "fake": "fake", "null": "null", "truncate": "truncate"} {
+		if got := (&MaskRule{Strategy: strategy}).asFake().Strategy; got != want {
+			t.Errorf("%s asFake want %s, got %s", strategy, want, got)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
@@ -42,6 +42,13 @@ type Connector struct {
 	Database string
 	Charset  string
 	Conn     *sql.DB
+	Snapshot *Snapshot // 不为空时使用快照代替线上环境，不连接数据库
+	// DBHash 不为空时用于将 SQL 中的库名映射为测试环境中的库名，如 optimizer_xxx
+	DBHash func(db string) string
+	// ServerVersion 数据库版本，用于决定 EXPLAIN 的语法，为 0 时使用测试环境的版本
+	ServerVersion int
+
+	dsn *common.Dsn // 创建连接使用的 DSN，用于 Clone
 }
 
 // QueryResult 数据库查询返回值
@@ -65,14 +72,35 @@ func NewConnector(dsn *common.Dsn) (*Connector, error) {
 		Database: dsn.Schema,
 		Charset:  dsn.Charset,
 		Conn:     conn,
+		dsn:      dsn,
 	}
 	return connector, err
 }
 
+// Clone 复制 Connector 并使用相同的 DSN 创建独立的连接池
+// Query 通过 USE 切换数据库，多个 goroutine 共享一个连接池时 SQL 可能在其他 goroutine 切换的数据库上执行，
+// 所以并发评审时每个 worker 需要使用独立的连接池。非 NewConnector 创建的 Connector 复制后共享原连接池
+func (db *Connector) Clone() *Connector {
+	c := *db
+	if db.dsn == nil {
+		return &c
+	}
+	conn, err := sql.Open("mysql", common.FormatDSN(db.dsn))
+	if err != nil {
+		common.Log.Error("Connector.Clone Error: %v", err)
+		return &c
+	}
+	c.Conn = conn
+	return &c
+}
+
 // Query 执行SQL
 func (db *Connector) Query(sql string, params ...interface{}) (QueryResult, error) {
 	var res QueryResult
 	var err error
+	if db.Snapshot != nil {
+		return res, errSnapshotQuery
+	}
 	// 测试环境如果检查是关闭的，则SQL不会被执行
 	if common.Config.TestDSN.Disable {
 		return res, errors.New("dsn is disable")
@@ -126,6 +154,9 @@ func (db *Connector) Query(sql string, params ...interface{}) (QueryResult, erro
 // Version 获取MySQL数据库版本
 func (db *Connector) Version() (int, error) {
 	version := 99999
+	if db.Snapshot != nil {
+		return db.Snapshot.Version, nil
+	}
 	// 从数据库中获取版本信息
 	res, err := db.Query("select @@version")
 	if err != nil {
@@ -173,6 +204,14 @@ func (db *Connector) SingleIntValue(option string) (int, error) {
 
 // ColumnCardinality 粒度计算
 func (db *Connector) ColumnCardinality(tb, col string) float64 {
+	// 使用快照时直接返回采集快照时计算的散粒度
+	if db.Snapshot != nil {
+		if c, ok := db.Snapshot.Cardinality(db.Database, tb, col); ok {
+			return c
+		}
+		return 1
+	}
+
 	// 获取该表上的已有的索引
 
 	// show table status 获取总行数（近似）
@@ -238,6 +277,65 @@ func (db *Connector) ColumnCardinality(tb, col string) float64 {
 	return colNum / float64(rowTotal)
 }
 
+// PrefixSelectivity 计算列的选择性及该列各长度前缀的选择性，结果与 lengths 一一对应
+func (db *Connector) PrefixSelectivity(tb, col string, lengths []int) (float64, []float64, error) {
+	if db.Snapshot != nil {
+		return 0, nil, errors.New("snapshot has no table data")
+	}
+
+	// 与 ColumnCardinality 相同，数据量过大时保护数据库，不进行计算
+	tbStatus, err := db.ShowTableStatus(tb)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(tbStatus.Rows) == 0 || tbStatus.Rows[0].Rows == nil {
+		return 0, nil, fmt.Errorf("no table status: %s", tb)
+	}
+	rowTotal, err := strconv.ParseUint(string(tbStatus.Rows[0].Rows), 10, 64)
+	if err != nil {
+		return 0, nil, err
+	}
+	if rowTotal > common.Config.MaxTotalRows {
+		return 0, nil, fmt.Errorf("table %s rows %d large than max-total-rows", tb, rowTotal)
+	}
+
+	var fields []string
+	for _, n := range lengths {
+		fields = append(fields, fmt.Sprintf("count(distinct left(`%s`, %d))", Escape(col, false), n))
+	}
+	fields = append(fields, fmt.Sprintf("count(distinct `%s`)", Escape(col, false)), "count(*)")
+	res, err := db.Query(fmt.Sprintf("select %s from `%s`.`%s`",
+		strings.Join(fields, ", "),
+		Escape(db.Database, false),
+		Escape(tb, false)))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	counts := make([]float64, len(fields))
+	dest := make([]interface{}, len(fields))
+	for i := range counts {
+		dest[i] = &counts[i]
+	}
+	if res.Rows.Next() {
+		err = res.Rows.Scan(dest...)
+	}
+	res.Rows.Close()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	total := counts[len(counts)-1]
+	if total == 0 {
+		return 0, nil, fmt.Errorf("table %s is empty", tb)
+	}
+	selectivity := make([]float64, len(lengths))
+	for i := range lengths {
+		selectivity[i] = counts[i] / total
+	}
+	return counts[len(counts)-2] / total, selectivity, nil
+}
+
 // IsView 判断表是否是视图
 func (db *Connector) IsView(tbName string) bool {
 	common.Log.Debug("IsView, ShowTableStatus check if `%s` is view", tbName)
@@ -196,6 +196,21 @@ func TestSingleIntValue(t *testing.T) {
 	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
 }
 
+func TestPrefixSelectivity(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	orgDatabase := connTest.Database
+	connTest.Database = "sakila"
+	full, selectivity, err := connTest.PrefixSelectivity("film", "title", []int{1, 4, 255})
+	if err != nil {
+		t.Error("PrefixSelectivity Error: ", err)
+	}
+	if len(selectivity) != 3 || selectivity[0] > selectivity[1] || selectivity[2] != full {
+		t.Errorf("PrefixSelectivity got %f, %v", full, selectivity)
+	}
+	connTest.Database = orgDatabase
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
 func TestIsView(t *testing.T) {
 	common.Log.Debug("Entering function: %s", common.GetFunctionName())
 	originalDatabase := connTest.Database
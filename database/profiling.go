@@ -41,24 +41,8 @@ type ProfilingRow struct {
 // Profiling 执行SQL，并对其 Profile
 func (db *Connector) Profiling(sql string, params ...interface{}) ([]ProfilingRow, error) {
 	var rows []ProfilingRow
-	// 过滤不需要 profiling 的 SQL
-	switch sqlparser.Preview(sql) {
-	case sqlparser.StmtSelect, sqlparser.StmtUpdate, sqlparser.StmtDelete:
-	default:
-		return rows, errors.New("no need profiling")
-	}
-
-	// 测试环境如果检查是关闭的，则 SQL 不会被执行
-	if common.Config.TestDSN.Disable {
-		return rows, errors.New("dsn is disable")
-	}
-
-	// 数据库安全性检查：如果 Connector 的 IP 端口与 TEST 环境不一致，则启用 SQL 白名单
-	// 不在白名单中的 SQL 不允许执行
-	// 执行环境与 test 环境不相同
-	if db.Addr != common.Config.TestDSN.Addr && db.dangerousQuery(sql) {
-		return rows, fmt.Errorf("query execution deny: Execute SQL with DSN(%s/%s) '%s'",
-			db.Addr, db.Database, fmt.Sprintf(sql, params...))
+	if err := db.profilingCheck(sql, params...); err != nil {
+		return rows, err
 	}
 
 	common.Log.Debug("Execute SQL with DSN(%s/%s) : %s", db.Addr, db.Database, sql)
@@ -114,6 +98,30 @@ func (db *Connector) Profiling(sql string, params ...interface{}) ([]ProfilingRo
 	return rows, err
 }
 
+// profilingCheck 检查 SQL 是否需要以及是否允许在当前环境执行 Profiling
+func (db *Connector) profilingCheck(sql string, params ...interface{}) error {
+	// 过滤不需要 profiling 的 SQL
+	switch sqlparser.Preview(sql) {
+	case sqlparser.StmtSelect, sqlparser.StmtUpdate, sqlparser.StmtDelete:
+	default:
+		return errors.New("no need profiling")
+	}
+
+	// 测试环境如果检查是关闭的，则 SQL 不会被执行
+	if common.Config.TestDSN.Disable {
+		return errors.New("dsn is disable")
+	}
+
+	// 数据库安全性检查：如果 Connector 的 IP 端口与 TEST 环境不一致，则启用 SQL 白名单
+	// 不在白名单中的 SQL 不允许执行
+	// 执行环境与 test 环境不相同
+	if db.Addr != common.Config.TestDSN.Addr && db.dangerousQuery(sql) {
+		return fmt.Errorf("query execution deny: Execute SQL with DSN(%s/%s) '%s'",
+			db.Addr, db.Database, fmt.Sprintf(sql, params...))
+	}
+	return nil
+}
+
 // FormatProfiling 格式化输出 Profiling 信息
 func FormatProfiling(rows []ProfilingRow) string {
 	str := []string{"| Status | Duration |"}
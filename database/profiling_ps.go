@@ -0,0 +1,208 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+// psTimerUnit performance_schema 中的 TIMER_WAIT, LOCK_TIME 以皮秒为单位，换算为毫秒
+const psTimerUnit = 1e9
+
+// PSProfile 从 performance_schema 中采集的 SQL 执行信息
+type PSProfile struct {
+	Statement PSStatement
+	Stages    []PSEvent // events_stages_history_long 中该 SQL 经历的各个阶段
+	Waits     []PSEvent // events_waits_history_long 中该 SQL 的等待事件，按事件名汇总
+}
+
+// PSStatement events_statements_history 中的语句级计数器，时间单位为毫秒
+type PSStatement struct {
+	EventID              int64
+	EndEventID           int64
+	Duration             float64
+	LockTime             float64
+	RowsExamined         int64
+	RowsSent             int64
+	RowsAffected         int64
+	CreatedTmpTables     int64
+	CreatedTmpDiskTables int64
+	SortMergePasses      int64
+	SortRows             int64
+	SelectFullJoin       int64
+	SelectScan           int64
+	NoIndexUsed          int64
+}
+
+// PSEvent 阶段或等待事件，时间单位为毫秒
+type PSEvent struct {
+	Name     string
+	Count    int64
+	Duration float64
+}
+
+// PerformanceSchemaProfiling 在测试环境执行 SQL，并从 performance_schema 中采集该线程的语句计数器、阶段及等待事件
+// 阶段及等待事件需要开启 events_stages_history_long, events_waits_history_long 等 consumer 及对应的 instrument，未开启时为空
+func (db *Connector) PerformanceSchemaProfiling(query string, params ...interface{}) (*PSProfile, error) {
+	if err := db.profilingCheck(query, params...); err != nil {
+		return nil, err
+	}
+
+	common.Log.Debug("Execute SQL with DSN(%s/%s) : %s", db.Addr, db.Database, query)
+	// 在同一个连接中执行 SQL 及查询 performance_schema
+	trx, err := db.Conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		trxErr := trx.Rollback()
+		if trxErr != nil {
+			common.Log.Debug(trxErr.Error())
+		}
+	}()
+
+	var threadID int64
+	err = trx.QueryRow("SELECT THREAD_ID FROM performance_schema.threads WHERE PROCESSLIST_ID = CONNECTION_ID()").Scan(&threadID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 执行 SQL，抛弃返回结果
+	tmpRes, err := trx.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	for tmpRes.Next() {
+		continue
+	}
+	tmpRes.Close()
+
+	// 正在执行的语句不会出现在 history 表中，该线程最后一条完成的 SQL 语句即为被 Profiling 的 SQL
+	// 带参数的查询会先发送 COM_STMT_PREPARE，记为 statement/com/Prepare，所以 THREAD_ID 直接拼接在 SQL 中并只查找 statement/sql/ 事件
+	p := &PSProfile{}
+	s := &p.Statement
+	var duration, lockTime float64
+	err = trx.QueryRow(fmt.Sprintf(`SELECT EVENT_ID, IFNULL(END_EVENT_ID, EVENT_ID), IFNULL(TIMER_WAIT, 0), LOCK_TIME,
+ROWS_EXAMINED, ROWS_SENT, ROWS_AFFECTED, CREATED_TMP_TABLES, CREATED_TMP_DISK_TABLES,
+SORT_MERGE_PASSES, SORT_ROWS, SELECT_FULL_JOIN, SELECT_SCAN, NO_INDEX_USED
+FROM performance_schema.events_statements_history WHERE THREAD_ID = %d AND EVENT_NAME LIKE 'statement/sql/%%'
+ORDER BY EVENT_ID DESC LIMIT 1`, threadID)).Scan(
+		&s.EventID, &s.EndEventID, &duration, &lockTime,
+		&s.RowsExamined, &s.RowsSent, &s.RowsAffected, &s.CreatedTmpTables, &s.CreatedTmpDiskTables,
+		&s.SortMergePasses, &s.SortRows, &s.SelectFullJoin, &s.SelectScan, &s.NoIndexUsed)
+	if err != nil {
+		return nil, err
+	}
+	s.Duration, s.LockTime = duration/psTimerUnit, lockTime/psTimerUnit
+
+	p.Stages, err = psEvents(trx.Query(`SELECT EVENT_NAME, 1, IFNULL(TIMER_WAIT, 0)
+FROM performance_schema.events_stages_history_long WHERE THREAD_ID = ? AND NESTING_EVENT_ID = ? ORDER BY EVENT_ID`,
+		threadID, s.EventID))
+	common.LogIfError(err, "")
+
+	// 等待事件嵌套在阶段中，按语句的事件 ID 范围查找
+	p.Waits, err = psEvents(trx.Query(`SELECT EVENT_NAME, COUNT(*), IFNULL(SUM(TIMER_WAIT), 0)
+FROM performance_schema.events_waits_history_long WHERE THREAD_ID = ? AND EVENT_ID > ? AND EVENT_ID <= ?
+GROUP BY EVENT_NAME ORDER BY SUM(TIMER_WAIT) DESC LIMIT 10`,
+		threadID, s.EventID, s.EndEventID))
+	common.LogIfError(err, "")
+	return p, nil
+}
+
+// psEvents 读取 EVENT_NAME, COUNT, TIMER_WAIT 三列
+func psEvents(res *sql.Rows, err error) ([]PSEvent, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	var events []PSEvent
+	for res.Next() {
+		var e PSEvent
+		if err = res.Scan(&e.Name, &e.Count, &e.Duration); err != nil {
+			return events, err
+		}
+		e.Duration /= psTimerUnit
+		events = append(events, e)
+	}
+	return events, res.Err()
+}
+
+// ProfilingReport 按 -profiling-backend 配置选择 Profiling 方式，返回 markdown 格式的结果
+// performance_schema 不可用时退回 SHOW PROFILE，此时返回的 PSProfile 为 nil
+func (db *Connector) ProfilingReport(query string) (*PSProfile, string, error) {
+	if err := db.profilingCheck(query); err != nil {
+		return nil, "", err
+	}
+	if common.Config.ProfilingBackend != "profile" {
+		p, err := db.PerformanceSchemaProfiling(query)
+		if err == nil {
+			return p, FormatPSProfile(p), nil
+		}
+		common.Log.Warn("performance_schema profiling failed, fall back to SHOW PROFILE: %v", err)
+	}
+	rows, err := db.Profiling(query)
+	if err != nil {
+		return nil, "", err
+	}
+	return nil, FormatProfiling(rows), nil
+}
+
+// FormatPSProfile 以 markdown 格式输出语句计数器、各阶段耗时及主要的等待事件
+func FormatPSProfile(p *PSProfile) string {
+	if p == nil {
+		return ""
+	}
+	s := p.Statement
+	str := []string{"| Counter | Value |", "| --- | --- |"}
+	for _, c := range []struct {
+		name  string
+		value string
+	}{
+		{"Duration(ms)", fmt.Sprintf("%.3f", s.Duration)},
+		{"Lock_time(ms)", fmt.Sprintf("%.3f", s.LockTime)},
+		{"Rows_examined", fmt.Sprint(s.RowsExamined)},
+		{"Rows_sent", fmt.Sprint(s.RowsSent)},
+		{"Rows_affected", fmt.Sprint(s.RowsAffected)},
+		{"Created_tmp_tables", fmt.Sprint(s.CreatedTmpTables)},
+		{"Created_tmp_disk_tables", fmt.Sprint(s.CreatedTmpDiskTables)},
+		{"Sort_merge_passes", fmt.Sprint(s.SortMergePasses)},
+		{"Sort_rows", fmt.Sprint(s.SortRows)},
+		{"Select_full_join", fmt.Sprint(s.SelectFullJoin)},
+		{"Select_scan", fmt.Sprint(s.SelectScan)},
+		{"No_index_used", fmt.Sprint(s.NoIndexUsed)},
+	} {
+		str = append(str, fmt.Sprintf("| %s | %s |", c.name, c.value))
+	}
+
+	if len(p.Stages) > 0 {
+		str = append(str, "", "| Stage | Duration(ms) |", "| --- | --- |")
+		for _, e := range p.Stages {
+			str = append(str, fmt.Sprintf("| %s | %.3f |", strings.TrimPrefix(e.Name, "stage/sql/"), e.Duration))
+		}
+	}
+	if len(p.Waits) > 0 {
+		str = append(str, "", "| Wait | Count | Duration(ms) |", "| --- | --- | --- |")
+		for _, e := range p.Waits {
+			str = append(str, fmt.Sprintf("| %s | %d | %.3f |", e.Name, e.Count, e.Duration))
+		}
+	}
+	return strings.Join(str, "\n")
+}
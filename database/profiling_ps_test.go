@@ -0,0 +1,71 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+func TestPerformanceSchemaProfiling(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	p, err := connTest.PerformanceSchemaProfiling("select 1 union all select 2 union all select 3")
+	if err != nil {
+		// 测试环境未开启 performance_schema
+		t.Skip(err)
+	}
+	// 取到的应该是被 Profiling 的 SQL，而不是同一连接中的其他语句
+	if p.Statement.RowsSent != 3 {
+		t.Errorf("Rows_sent want 3, got %d", p.Statement.RowsSent)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestFormatPSProfile(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	p := &PSProfile{
+		Statement: PSStatement{
+			Duration:             12.5,
+			LockTime:             0.125,
+			RowsExamined:         2000,
+			RowsSent:             10,
+			CreatedTmpTables:     1,
+			CreatedTmpDiskTables: 1,
+			SortRows:             10,
+			SelectScan:           1,
+			NoIndexUsed:          1,
+		},
+		Stages: []PSEvent{
+			{Name: "stage/sql/starting", Count: 1, Duration: 0.05},
+			{Name: "stage/sql/Sending data", Count: 1, Duration: 11.2},
+			{Name: "stage/sql/Creating sort index", Count: 1, Duration: 1.1},
+		},
+		Waits: []PSEvent{
+			{Name: "wait/io/table/sql/handler", Count: 2000, Duration: 8.3},
+		},
+	}
+	err := common.GoldenDiff(func() {
+		fmt.Println(FormatPSProfile(p))
+		fmt.Println(FormatPSProfile(&PSProfile{}))
+	}, t.Name(), update)
+	if err != nil {
+		t.Error(err)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
@@ -17,10 +17,16 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/XiaoMi/soar/common"
@@ -46,97 +52,343 @@ import (
 *--------------------
  */
 
-// SamplingData 将数据从 onlineConn 拉取到 db 中
+// samplingBudget 每张表采样的行数及字节数上限
+type samplingBudget struct {
+	rows  int64
+	bytes int64
+}
+
+// exhausted 行数或字节数已达到上限
+func (b *samplingBudget) exhausted() bool {
+	return b.rows <= 0 || b.bytes <= 0
+}
+
+// SamplingData 将数据从 onlineConn 拉取到 db 中，多张表按 -sampling-parallel 并发采样
 func (db *Connector) SamplingData(onlineConn *Connector, tables ...string) error {
-	var err error
+	// 快照中只有统计信息没有数据，散粒度使用采集快照时的计算结果
+	if onlineConn.Snapshot != nil {
+		common.Log.Debug("SamplingData by pass, online snapshot has no data")
+		return nil
+	}
 	if onlineConn.Database == db.Database {
 		return fmt.Errorf("SamplingData the same database, From: %s/%s, To: %s/%s", onlineConn.Addr, onlineConn.Database, db.Addr, db.Database)
 	}
 
-	// 计算需要泵取的数据量
-	wantRowsCount := 300 * common.Config.SamplingStatisticTarget
+	masks, err := ParseMaskRules(common.Config.SamplingMask)
+	if err != nil {
+		return err
+	}
+
+	seed := common.Config.SamplingSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	common.Log.Debug("SamplingData, seed: %d", seed)
 
-	for _, table := range tables {
-		// 表类型检查
-		if onlineConn.IsView(table) {
-			return nil
+	parallel := common.Config.SamplingParallel
+	if parallel < 1 {
+		parallel = 1
+	}
+	errs := make([]error, len(tables))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, table := range tables {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, table string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = db.samplingTable(onlineConn, table, seed, masks)
+		}(i, table)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		// generate where condition
-		var where string
-		if common.Config.SamplingCondition == "" {
-			tableStatus, err := onlineConn.ShowTableStatus(table)
-			if err != nil {
-				return err
-			}
+// samplingTable 对单张表采样，指定了 -sampling-condition 时按条件采样，否则按主键或整型唯一索引随机选取若干区间采样
+func (db *Connector) samplingTable(onlineConn *Connector, table string, seed int64, masks []*MaskRule) error {
+	// 表类型检查
+	if onlineConn.IsView(table) {
+		return nil
+	}
 
-			if len(tableStatus.Rows) == 0 {
-				common.Log.Info("SamplingData, Table %s with no data, stop sampling", table)
-				return nil
-			}
+	indexed, err := onlineConn.indexedColumns(table, masks)
+	if err != nil {
+		return err
+	}
 
-			tableRows, err := strconv.ParseUint(string(tableStatus.Rows[0].Rows), 10, 64)
-			if tableRows == 0 || err != nil {
-				common.Log.Info("SamplingData, Table %s with no data, stop sampling", table)
-				if err != nil {
-					common.Log.Error("SamplingData, Error: ", err.Error())
-				}
-				return nil
-			}
+	budget := &samplingBudget{
+		rows:  int64(300 * common.Config.SamplingStatisticTarget),
+		bytes: common.Config.SamplingMaxBytes,
+	}
+	if budget.bytes <= 0 {
+		budget.bytes = math.MaxInt64
+	}
+	if common.Config.SamplingCondition != "" {
+		return db.startSampling(onlineConn.Conn, onlineConn.Database, table, common.Config.SamplingCondition, budget, masks, indexed)
+	}
+
+	tableStatus, err := onlineConn.ShowTableStatus(table)
+	if err != nil {
+		return err
+	}
+	if len(tableStatus.Rows) == 0 {
+		common.Log.Info("SamplingData, Table %s with no data, stop sampling", table)
+		return nil
+	}
+	tableRows, err := strconv.ParseUint(string(tableStatus.Rows[0].Rows), 10, 64)
+	if tableRows == 0 || err != nil {
+		common.Log.Info("SamplingData, Table %s with no data, stop sampling", table)
+		if err != nil {
+			common.Log.Error("SamplingData, Error: ", err.Error())
+		}
+		return nil
+	}
+	common.Log.Debug("SamplingData, table: %s, tableRows: %d, wantRowsCount: %d", table, tableRows, budget.rows)
 
-			factor := float64(wantRowsCount) / float64(tableRows)
-			common.Log.Debug("SamplingData, tableRows: %d, wantRowsCount: %d, factor: %f", tableRows, wantRowsCount, factor)
-			where = fmt.Sprintf("where RAND() <= %f LIMIT %d", factor, wantRowsCount)
-			if factor >= 1 {
-				where = ""
+	// 数据量小于采样行数时全部拉取，仍受字节数上限限制
+	// TABLE STATUS 中的行数是估算值，仍然需要 LIMIT，否则关闭结果集时会读完整张表
+	if tableRows <= uint64(budget.rows) {
+		_, err = db.samplingQuery(onlineConn.Conn, onlineConn.Database, table, fmt.Sprintf("LIMIT %d", budget.rows), budget, "", masks, indexed)
+		return err
+	}
+
+	key, pk, min, max, err := onlineConn.samplingKeyBounds(table)
+	if err != nil {
+		return err
+	}
+	if pk == "" {
+		// 没有可用于区间采样的整型单列唯一索引时只读取表中的前若干行，避免全表扫描，采样结果是有偏的
+		common.Log.Warn("SamplingData, table %s has no single-column integer primary key or unique index, sampling first %d rows", table, budget.rows)
+		recordBiasedSampling(onlineConn.Database, table)
+		_, err = db.samplingQuery(onlineConn.Conn, onlineConn.Database, table, fmt.Sprintf("LIMIT %d", budget.rows), budget, "", masks, indexed)
+		return err
+	}
+
+	starts := SamplingChunkStarts(min, max, common.Config.SamplingChunks, samplingSeed(seed, onlineConn.Database, table))
+	perChunk := (budget.rows + int64(len(starts)) - 1) / int64(len(starts))
+	// 区间起点按升序排列，每个区间从上一个区间读取到的最大主键之后开始，避免重复数据
+	var last int64
+	var fetched bool
+	for _, start := range starts {
+		if budget.exhausted() {
+			break
+		}
+		cond := fmt.Sprintf("FORCE INDEX (%s) WHERE `%s` >= %d", key, Escape(pk, false), start)
+		if fetched && start <= last {
+			cond = fmt.Sprintf("FORCE INDEX (%s) WHERE `%s` > %d", key, Escape(pk, false), last)
+		}
+		cond += fmt.Sprintf(" ORDER BY `%s` LIMIT %d", Escape(pk, false), perChunk)
+		end, err := db.samplingQuery(onlineConn.Conn, onlineConn.Database, table, cond, budget, pk, masks, indexed)
+		if err != nil {
+			return err
+		}
+		if end != "" {
+			if v, err := strconv.ParseInt(end, 10, 64); err == nil {
+				last, fetched = v, true
 			}
-		} else {
-			where = common.Config.SamplingCondition
 		}
-		err = db.startSampling(onlineConn.Conn, onlineConn.Database, table, where)
 	}
-	return err
+	return nil
+}
+
+// samplingSeed 每张表使用独立的随机数种子，使并发采样的结果与表的采样顺序无关
+func samplingSeed(seed int64, database, table string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(database + "." + table))
+	return seed ^ int64(h.Sum64())
+}
+
+// SamplingChunkStarts 在 [min, max] 中随机选取 chunks 个区间起点，按升序返回，相同的种子返回相同的结果
+func SamplingChunkStarts(min, max int64, chunks int, seed int64) []int64 {
+	if chunks < 1 {
+		chunks = 1
+	}
+	r := rand.New(rand.NewSource(seed))
+	starts := make([]int64, 0, chunks)
+	span := uint64(max - min)
+	for i := 0; i < chunks; i++ {
+		if span == math.MaxUint64 {
+			starts = append(starts, int64(r.Uint64()))
+			continue
+		}
+		starts = append(starts, min+int64(r.Uint64()%(span+1)))
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	return starts
+}
+
+// samplingKey 可用于按区间采样的单列索引及其列名
+type samplingKey struct {
+	Index  string
+	Column string
+}
+
+// samplingKeys 按区间采样的候选索引，主键优先，其次为其他唯一索引，前缀索引及函数索引不能用于区间查询
+// 复合索引的第一列单独并不唯一，按区间读取时区间之间可能重叠或遗漏数据，只使用单列索引
+func samplingKeys(index *TableIndexInfo) []samplingKey {
+	columns := make(map[string]int)
+	for _, row := range index.Rows {
+		columns[row.KeyName]++
+	}
+	var keys []samplingKey
+	for _, row := range index.Rows {
+		if columns[row.KeyName] != 1 || row.NonUnique != 0 || row.ColumnName == "" || row.SubPart > 0 {
+			continue
+		}
+		key := samplingKey{Index: row.KeyName, Column: row.ColumnName}
+		if row.KeyName == "PRIMARY" {
+			keys = append([]samplingKey{key}, keys...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// samplingKeyBounds 获取用于区间采样的索引、列名及最小、最大值，没有整型的单列主键或唯一索引时返回空的列名
+// min, max 通过索引的两端获取，不会扫描全表
+func (db *Connector) samplingKeyBounds(table string) (string, string, int64, int64, error) {
+	index, err := db.ShowIndex(table)
+	if err != nil {
+		return "", "", 0, 0, err
+	}
+	for _, key := range samplingKeys(index) {
+		var min, max sql.NullString
+		err = db.Conn.QueryRow(fmt.Sprintf("SELECT MIN(`%s`), MAX(`%s`) FROM `%s`.`%s`",
+			Escape(key.Column, false), Escape(key.Column, false), Escape(db.Database, false), Escape(table, false))).Scan(&min, &max)
+		if err != nil {
+			return "", "", 0, 0, err
+		}
+		minVal, minErr := strconv.ParseInt(min.String, 10, 64)
+		maxVal, maxErr := strconv.ParseInt(max.String, 10, 64)
+		if !min.Valid || !max.Valid || minErr != nil || maxErr != nil {
+			continue
+		}
+		if key.Index == "PRIMARY" {
+			return "PRIMARY", key.Column, minVal, maxVal, nil
+		}
+		return fmt.Sprintf("`%s`", Escape(key.Index, false)), key.Column, minVal, maxVal, nil
+	}
+	return "", "", 0, 0, nil
+}
+
+// biasedSampling 没有可用于区间采样的索引，只读取了前若干行的表，db.table -> true
+var biasedSampling = struct {
+	sync.Mutex
+	m map[string]bool
+}{m: make(map[string]bool)}
+
+// recordBiasedSampling 记录采样结果有偏的表，用于在报告中说明
+func recordBiasedSampling(database, table string) {
+	biasedSampling.Lock()
+	defer biasedSampling.Unlock()
+	biasedSampling.m[strings.ToLower(database+"."+table)] = true
+}
+
+// BiasedSampling 线上环境中某张表的采样结果是否有偏，即只读取了表中的前若干行
+func BiasedSampling(database, table string) bool {
+	biasedSampling.Lock()
+	defer biasedSampling.Unlock()
+	return biasedSampling.m[strings.ToLower(database+"."+table)]
 }
 
 // startSampling sampling data from OnlineDSN to TestDSN
-func (db *Connector) startSampling(onlineConn *sql.DB, database, table string, where string) error {
+// 按 -sampling-condition 采样时同样受 budget 中行数、字节数上限的限制
+func (db *Connector) startSampling(onlineConn *sql.DB, database, table string, where string, budget *samplingBudget, masks []*MaskRule, indexed map[string]bool) error {
+	_, err := db.samplingQuery(onlineConn, database, table, Escape(where, false), budget, "", masks, indexed)
+	return err
+}
+
+// samplingQuery 按条件从线上环境拉取数据，按 masks 脱敏后写入测试环境，超出 budget 时停止，返回读取到的最后一行中 pk 列的值
+// indexed 为表中的索引列，索引列只能使用不改变散粒度的脱敏规则
+func (db *Connector) samplingQuery(onlineConn *sql.DB, database, table, where string, budget *samplingBudget, pk string, masks []*MaskRule, indexed map[string]bool) (string, error) {
 	samplingQuery := fmt.Sprintf("select * from `%s`.`%s` %s",
 		Escape(database, false),
 		Escape(table, false),
-		Escape(where, false))
+		where)
 	common.Log.Debug("startSampling with Query: %s", samplingQuery)
-	res, err := onlineConn.Query(samplingQuery)
+	// 超出 budget 时需要先取消查询再关闭结果集，否则关闭时仍会读完剩余的数据，线上环境依旧要扫描并发送所有满足条件的行
+	ctx, cancel := context.WithCancel(context.Background())
+	res, err := onlineConn.QueryContext(ctx, samplingQuery)
 	if err != nil {
-		return err
+		cancel()
+		return "", err
 	}
+	defer func() {
+		cancel()
+		res.Close()
+	}()
 
 	// columns list
 	columns, err := res.Columns()
 	if err != nil {
-		return err
+		return "", err
 	}
 	row := make([][]byte, len(columns))
 	tableFields := make([]interface{}, 0)
+	pkIdx := -1
 	for i := range columns {
 		tableFields = append(tableFields, &row[i])
+		if pk != "" && strings.EqualFold(columns[i], pk) {
+			pkIdx = i
+		}
 	}
 	columnTypes, err := res.ColumnTypes()
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	// 每一列对应的脱敏规则
+	var key []byte
+	columnMasks := make([]*MaskRule, len(columns))
+	for i, col := range columns {
+		typ := columnTypes[i].DatabaseTypeName()
+		columnMasks[i] = FindMaskRule(masks, database, table, col, typ)
+		if columnMasks[i] != nil && isNumericType(typ) {
+			// 数值类型的列只能替换为数字，hash 按 fake 处理
+			columnMasks[i] = columnMasks[i].asFake()
+		}
+		if columnMasks[i] != nil && indexed[strings.ToLower(col)] {
+			columnMasks[i] = columnMasks[i].asFake()
+			if !columnMasks[i].Distinct() {
+				return "", fmt.Errorf("sampling-mask %s can't be applied to indexed column %s.%s.%s, it changes the cardinality, use fake instead",
+					columnMasks[i].String(), database, table, col)
+			}
+		}
+		if columnMasks[i] != nil {
+			key = samplingMaskKey()
+			recordMaskedColumn(database, table, col, columnMasks[i].String())
+		}
 	}
 
 	// sampling data
+	var last string
 	var valuesCount int
 	var valuesStr []string
 	maxValuesCount := 200 // one time insert values count, TODO: config able
 	columnsStr := "`" + strings.Join(columns, "`,`") + "`"
-	for res.Next() {
+	for !budget.exhausted() && res.Next() {
 		var values []string
 		err = res.Scan(tableFields...)
 		if err != nil {
 			common.Log.Debug(err.Error())
 		}
+		if pkIdx >= 0 {
+			last = string(row[pkIdx])
+		}
 		for i, val := range row {
+			budget.bytes -= int64(len(val))
+			if columnMasks[i] != nil {
+				val = columnMasks[i].Mask(val, columnTypes[i].DatabaseTypeName(), key)
+			}
 			if val == nil {
 				values = append(values, "NULL")
 			} else {
@@ -156,6 +408,7 @@ func (db *Connector) startSampling(onlineConn *sql.DB, database, table string, w
 				}
 			}
 		}
+		budget.rows--
 		valuesStr = append(valuesStr, "("+strings.Join(values, `,`)+")")
 		valuesCount++
 		if maxValuesCount <= valuesCount {
@@ -173,8 +426,7 @@ func (db *Connector) startSampling(onlineConn *sql.DB, database, table string, w
 			common.LogIfWarn(err, "")
 		}
 	}
-	res.Close()
-	return err
+	return last, err
 }
 
 // 将泵取的数据转换成 insert 语句并在 testConn 数据库中执行
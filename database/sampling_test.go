@@ -0,0 +1,93 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+func TestSamplingChunkStarts(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	starts := SamplingChunkStarts(1, 1000000, 10, 42)
+	if len(starts) != 10 {
+		t.Errorf("want 10 chunks, got %v", starts)
+	}
+	if !sort.SliceIsSorted(starts, func(i, j int) bool { return starts[i] < starts[j] }) {
+		t.Errorf("chunks should be sorted, got %v", starts)
+	}
+	for _, start := range starts {
+		if start < 1 || start > 1000000 {
+			t.Errorf("chunk %d out of range", start)
+		}
+	}
+	// 相同的种子采样结果可复现
+	if again := SamplingChunkStarts(1, 1000000, 10, 42); !reflect.DeepEqual(starts, again) {
+		t.Errorf("same seed got different chunks: %v, %v", starts, again)
+	}
+	if other := SamplingChunkStarts(1, 1000000, 10, 43); reflect.DeepEqual(starts, other) {
+		t.Errorf("different seed got same chunks: %v", other)
+	}
+
+	if starts = SamplingChunkStarts(5, 5, 0, 42); !reflect.DeepEqual(starts, []int64{5}) {
+		t.Errorf("want [5], got %v", starts)
+	}
+	if starts = SamplingChunkStarts(math.MinInt64, math.MaxInt64, 3, 42); len(starts) != 3 {
+		t.Errorf("want 3 chunks, got %v", starts)
+	}
+
+	if samplingSeed(42, "sakila", "film") == samplingSeed(42, "sakila", "actor") {
+		t.Error("tables should use different seeds")
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestSamplingKeys(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	index := &TableIndexInfo{
+		Rows: []TableIndexRow{
+			{KeyName: "uk_email", SeqInIndex: 1, ColumnName: "email"},
+			{KeyName: "idx_store_id", NonUnique: 1, SeqInIndex: 1, ColumnName: "store_id"},
+			{KeyName: "uk_name", SeqInIndex: 1, ColumnName: "name", SubPart: 10},
+			{KeyName: "uk_code", SeqInIndex: 1, ColumnName: "code"},
+			{KeyName: "uk_code", SeqInIndex: 2, ColumnName: "store_id"},
+			{KeyName: "PRIMARY", SeqInIndex: 1, ColumnName: "uuid"},
+		},
+	}
+	// 复合唯一索引的第一列单独并不唯一，不能用于区间采样
+	want := []samplingKey{{"PRIMARY", "uuid"}, {"uk_email", "email"}}
+	if got := samplingKeys(index); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if got := samplingKeys(&TableIndexInfo{}); len(got) != 0 {
+		t.Errorf("want no keys, got %v", got)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestBiasedSampling(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	recordBiasedSampling("sakila", "Film_Text")
+	if !BiasedSampling("sakila", "film_text") || BiasedSampling("sakila", "film") {
+		t.Error("film_text should be biased, film should not")
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
@@ -96,6 +96,10 @@ func (db *Connector) ShowTables() ([]string, error) {
 		}
 	}()
 
+	if db.Snapshot != nil {
+		return db.Snapshot.showTables(db.Database), nil
+	}
+
 	// 执行 show table status
 	res, err := db.Query("show tables")
 	if err != nil {
@@ -120,6 +124,13 @@ func (db *Connector) ShowTables() ([]string, error) {
 func (db *Connector) ShowTableStatus(tableName string) (*TableStatInfo, error) {
 	// 初始化struct
 	tbStatus := newTableStat(tableName)
+	if db.Snapshot != nil {
+		st, err := db.Snapshot.table(db.Database, tableName)
+		if err != nil || st.Status == nil {
+			return tbStatus, err
+		}
+		return st.Status, nil
+	}
 
 	// 执行 show table status
 	res, err := db.Query(fmt.Sprintf("show table status where name = '%s'", Escape(tbStatus.Name, false)))
@@ -218,6 +229,14 @@ func (db *Connector) ShowIndex(tableName string) (*TableIndexInfo, error) {
 		return nil, fmt.Errorf("database('%s') or table('%s') name should not empty", db.Database, tableName)
 	}
 
+	if db.Snapshot != nil {
+		st, err := db.Snapshot.table(db.Database, tableName)
+		if err != nil || st.Index == nil {
+			return tbIndex, err
+		}
+		return st.Index, nil
+	}
+
 	// 执行 show create table
 	res, err := db.Query(fmt.Sprintf("show index from `%s`.`%s`", Escape(db.Database, false), Escape(tableName, false)))
 	if err != nil {
@@ -358,6 +377,17 @@ func NewTableDesc(tableName string) *TableDesc {
 func (db *Connector) ShowColumns(tableName string) (*TableDesc, error) {
 	tbDesc := NewTableDesc(tableName)
 
+	if db.Snapshot != nil {
+		st, err := db.Snapshot.table(db.Database, tableName)
+		if err != nil {
+			return nil, err
+		}
+		if st.Columns == nil {
+			return tbDesc, nil
+		}
+		return st.Columns, nil
+	}
+
 	// 执行 show create table
 	res, err := db.Query(fmt.Sprintf("show full columns from `%s`.`%s`", Escape(db.Database, false), Escape(tableName, false)))
 	if err != nil {
@@ -419,6 +449,9 @@ func (db *Connector) showCreate(createType, name string) (string, error) {
 	// SHOW CREATE TABLE tbl_name
 	// SHOW CREATE TRIGGER trigger_name
 	// SHOW CREATE VIEW view_name
+	if db.Snapshot != nil {
+		return db.Snapshot.showCreate(db.Database, createType, name)
+	}
 	res, err := db.Query(fmt.Sprintf("SHOW CREATE %s `%s`", createType, Escape(name, false)))
 	if err != nil {
 		return "", err
@@ -523,6 +556,9 @@ func (db *Connector) ShowCreateTable(tableName string) (string, error) {
 
 // FindColumn find column
 func (db *Connector) FindColumn(name, dbName string, tables ...string) ([]*common.Column, error) {
+	if db.Snapshot != nil {
+		return db.Snapshot.findColumn(name, dbName, tables...), nil
+	}
 	// 执行 show create table
 	var columns []*common.Column
 	sql := fmt.Sprintf("SELECT "+
@@ -596,6 +632,9 @@ func (db *Connector) FindColumn(name, dbName string, tables ...string) ([]*commo
 
 // IsForeignKey 判断列是否是外键
 func (db *Connector) IsForeignKey(dbName, tbName, column string) bool {
+	if db.Snapshot != nil {
+		return db.Snapshot.isForeignKey(dbName, tbName, column)
+	}
 	sql := fmt.Sprintf("SELECT REFERENCED_COLUMN_NAME FROM INFORMATION_SCHEMA.KEY_COLUMN_USAGE C "+
 		"WHERE REFERENCED_TABLE_SCHEMA <> 'NULL' AND"+
 		" TABLE_NAME='%s' AND"+
@@ -620,17 +659,22 @@ type Reference map[string][]ReferenceValue
 
 // ReferenceValue 用于处理表之间的关系
 type ReferenceValue struct {
-	ReferencedTableSchema string // 夫表所属数据库
-	ReferencedTableName   string // 父表
-	TableSchema           string // 子表所属数据库
-	TableName             string // 子表
-	ConstraintName        string // 关系名称
+	ReferencedTableSchema string   // 夫表所属数据库
+	ReferencedTableName   string   // 父表
+	TableSchema           string   // 子表所属数据库
+	TableName             string   // 子表
+	ConstraintName        string   // 关系名称
+	Columns               []string // 子表中的外键列
+	ReferencedColumns     []string // 父表中被引用的列，与 Columns 一一对应
 }
 
 // ShowReference 查找所有的外键信息
 func (db *Connector) ShowReference(dbName string, tbName ...string) ([]ReferenceValue, error) {
+	if db.Snapshot != nil {
+		return db.Snapshot.showReference(dbName, tbName...), nil
+	}
 	var referenceValues []ReferenceValue
-	sql := `SELECT DISTINCT C.REFERENCED_TABLE_SCHEMA,C.REFERENCED_TABLE_NAME,C.TABLE_SCHEMA,C.TABLE_NAME,C.CONSTRAINT_NAME FROM INFORMATION_SCHEMA.KEY_COLUMN_USAGE C JOIN INFORMATION_SCHEMA. TABLES T ON T.TABLE_NAME = C.TABLE_NAME WHERE C.REFERENCED_TABLE_NAME IS NOT NULL`
+	sql := `SELECT DISTINCT C.REFERENCED_TABLE_SCHEMA,C.REFERENCED_TABLE_NAME,C.TABLE_SCHEMA,C.TABLE_NAME,C.CONSTRAINT_NAME,C.COLUMN_NAME,C.REFERENCED_COLUMN_NAME,C.ORDINAL_POSITION FROM INFORMATION_SCHEMA.KEY_COLUMN_USAGE C JOIN INFORMATION_SCHEMA. TABLES T ON T.TABLE_NAME = C.TABLE_NAME WHERE C.REFERENCED_TABLE_NAME IS NOT NULL`
 	sql = sql + fmt.Sprintf(` AND C.TABLE_SCHEMA = "%s"`, Escape(dbName, false))
 
 	var tables []string
@@ -642,6 +686,8 @@ func (db *Connector) ShowReference(dbName string, tbName ...string) ([]Reference
 		sql = sql + extra
 	}
 
+	sql = sql + ` ORDER BY C.TABLE_NAME, C.CONSTRAINT_NAME, C.ORDINAL_POSITION`
+
 	common.Log.Debug("ShowReference, execute SQL: %s", sql)
 	// 执行SQL查找外键关联关系
 	res, err := db.Query(sql)
@@ -649,13 +695,25 @@ func (db *Connector) ShowReference(dbName string, tbName ...string) ([]Reference
 		return referenceValues, err
 	}
 
-	// 获取值
+	// 获取值，复合外键的每一列为一行，按外键合并
 	for res.Rows.Next() {
 		var rv ReferenceValue
-		err = res.Rows.Scan(&rv.ReferencedTableSchema, &rv.ReferencedTableName, &rv.TableSchema, &rv.TableName, &rv.ConstraintName)
+		var column, refColumn string
+		var position int
+		err = res.Rows.Scan(&rv.ReferencedTableSchema, &rv.ReferencedTableName, &rv.TableSchema, &rv.TableName, &rv.ConstraintName,
+			&column, &refColumn, &position)
 		if err != nil {
 			break
 		}
+		if n := len(referenceValues); n > 0 && referenceValues[n-1].TableSchema == rv.TableSchema &&
+			referenceValues[n-1].TableName == rv.TableName && referenceValues[n-1].ConstraintName == rv.ConstraintName {
+			if len(referenceValues[n-1].Columns) < position {
+				referenceValues[n-1].Columns = append(referenceValues[n-1].Columns, column)
+				referenceValues[n-1].ReferencedColumns = append(referenceValues[n-1].ReferencedColumns, refColumn)
+			}
+			continue
+		}
+		rv.Columns, rv.ReferencedColumns = []string{column}, []string{refColumn}
 		referenceValues = append(referenceValues, rv)
 	}
 	res.Rows.Close()
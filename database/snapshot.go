@@ -0,0 +1,390 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+// errSnapshotQuery 使用快照代替线上环境时不能执行 SQL
+var errSnapshotQuery = errors.New("online snapshot not support execute SQL")
+
+// Snapshot 线上环境库表结构及统计信息快照
+// 在线上环境通过 -snapshot 采集，之后通过 -online-snapshot 代替线上环境离线评审
+type Snapshot struct {
+	Version   int                    `json:"version"`   // 线上环境数据库版本
+	Addr      string                 `json:"addr"`      // 采集快照的线上环境地址
+	Database  string                 `json:"database"`  // 线上环境 DSN 中指定的数据库
+	Created   string                 `json:"created"`   // 快照采集时间
+	Databases map[string]*SnapshotDB `json:"databases"` // 库名 -> 库快照
+}
+
+// SnapshotDB 数据库快照
+type SnapshotDB struct {
+	CreateDatabase string                    `json:"create-database"`
+	Tables         map[string]*SnapshotTable `json:"tables"` // 表名 -> 表快照
+}
+
+// SnapshotTable 表快照，内容与对应的 SHOW 命令输出一致
+type SnapshotTable struct {
+	CreateTable string             `json:"create-table"` // SHOW CREATE TABLE，包含外键
+	Status      *TableStatInfo     `json:"status"`       // SHOW TABLE STATUS
+	Index       *TableIndexInfo    `json:"index"`        // SHOW INDEX
+	Columns     *TableDesc         `json:"columns"`      // SHOW FULL COLUMNS
+	References  []ReferenceValue   `json:"references"`   // 外键关系
+	Cardinality map[string]float64 `json:"cardinality"`  // 列名 -> 散粒度，只包含索引列及评审 SQL 中使用的列
+}
+
+// TakeSnapshot 采集线上环境快照
+// 采集 DSN 中指定的数据库及 meta 中使用到的数据库下的所有表，索引列及 meta 中使用到的列计算散粒度
+func (db *Connector) TakeSnapshot(meta common.Meta) (*Snapshot, error) {
+	var err error
+	s := &Snapshot{
+		Addr:      db.Addr,
+		Database:  db.Database,
+		Created:   time.Now().Format("2006-01-02 15:04:05"),
+		Databases: make(map[string]*SnapshotDB),
+	}
+	s.Version, err = db.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	dbs := []string{db.Database}
+	for name := range meta {
+		if name != "" && name != db.Database {
+			dbs = append(dbs, name)
+		}
+	}
+	sort.Strings(dbs[1:])
+
+	defer func(database string) { db.Database = database }(db.Database)
+	for _, name := range dbs {
+		db.Database = name
+		sdb := &SnapshotDB{Tables: make(map[string]*SnapshotTable)}
+		sdb.CreateDatabase, err = db.ShowCreateDatabase(name)
+		if err != nil {
+			common.Log.Warn("TakeSnapshot ShowCreateDatabase `%s` Error: %v", name, err)
+			continue
+		}
+		tables, err := db.ShowTables()
+		if err != nil {
+			return nil, err
+		}
+		for _, tb := range tables {
+			common.Log.Debug("TakeSnapshot table `%s`.`%s`", name, tb)
+			sdb.Tables[tb], err = db.snapshotTable(tb, requestColumns(meta, name, name == s.Database, tb))
+			if err != nil {
+				return nil, err
+			}
+		}
+		s.Databases[name] = sdb
+	}
+	return s, nil
+}
+
+// requestColumns 评审 SQL 中使用到的某张表的列，未指定库名的表属于 DSN 中指定的数据库
+func requestColumns(meta common.Meta, database string, isDefault bool, table string) []string {
+	var cols []string
+	for name, d := range meta {
+		if name != database && !(name == "" && isDefault) {
+			continue
+		}
+		for _, tb := range d.Table {
+			if tb == nil || tb.TableName != table {
+				continue
+			}
+			for col := range tb.Column {
+				cols = append(cols, col)
+			}
+		}
+	}
+	return cols
+}
+
+func (db *Connector) snapshotTable(table string, cols []string) (*SnapshotTable, error) {
+	var err error
+	st := &SnapshotTable{Cardinality: make(map[string]float64)}
+	if st.CreateTable, err = db.showCreate("TABLE", table); err != nil {
+		return nil, err
+	}
+	if st.Status, err = db.ShowTableStatus(table); err != nil {
+		return nil, err
+	}
+	if st.Columns, err = db.ShowColumns(table); err != nil {
+		return nil, err
+	}
+	if st.Index, err = db.ShowIndex(table); err != nil {
+		return nil, err
+	}
+	if st.References, err = db.ShowReference(db.Database, table); err != nil {
+		return nil, err
+	}
+
+	// 视图不需要计算散粒度
+	if len(st.Status.Rows) > 0 && string(st.Status.Rows[0].Comment) == "VIEW" {
+		return st, nil
+	}
+	for _, idx := range st.Index.Rows {
+		cols = append(cols, idx.ColumnName)
+	}
+	for _, col := range cols {
+		if _, ok := st.Cardinality[col]; ok || col == "" {
+			continue
+		}
+		st.Cardinality[col] = db.ColumnCardinality(table, col)
+	}
+	return st, nil
+}
+
+// MarshalJSON []byte 类型默认序列化为 base64，快照中使用字符串保存便于人工审核采集的内容
+func (row tableStatusRow) MarshalJSON() ([]byte, error) {
+	m := make(map[string]*string)
+	v := reflect.ValueOf(row)
+	for i := 0; i < v.NumField(); i++ {
+		switch val := v.Field(i).Interface().(type) {
+		case string:
+			m[v.Type().Field(i).Name] = &val
+		case []byte:
+			if val != nil {
+				str := string(val)
+				m[v.Type().Field(i).Name] = &str
+			} else {
+				m[v.Type().Field(i).Name] = nil
+			}
+		}
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON 与 MarshalJSON 对应，null 还原为 nil
+func (row *tableStatusRow) UnmarshalJSON(buf []byte) error {
+	m := make(map[string]*string)
+	if err := json.Unmarshal(buf, &m); err != nil {
+		return err
+	}
+	v := reflect.ValueOf(row).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		val, ok := m[v.Type().Field(i).Name]
+		if !ok || val == nil {
+			continue
+		}
+		switch v.Field(i).Kind() {
+		case reflect.String:
+			v.Field(i).SetString(*val)
+		case reflect.Slice:
+			v.Field(i).SetBytes([]byte(*val))
+		}
+	}
+	return nil
+}
+
+// LoadSnapshot 从文件中加载快照
+func LoadSnapshot(file string) (*Snapshot, error) {
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	s := new(Snapshot)
+	if err = json.Unmarshal(buf, s); err != nil {
+		return nil, fmt.Errorf("load snapshot '%s' Error: %v", file, err)
+	}
+	if s.Databases == nil {
+		s.Databases = make(map[string]*SnapshotDB)
+	}
+	return s, nil
+}
+
+// Save 将快照保存到文件
+func (s *Snapshot) Save(file string) error {
+	buf, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, buf, 0644)
+}
+
+// table 查找快照中的表，表名大小写不敏感
+func (s *Snapshot) table(database, table string) (*SnapshotTable, error) {
+	if sdb, ok := s.Databases[database]; ok {
+		if st, ok := sdb.Tables[table]; ok {
+			return st, nil
+		}
+		for name, st := range sdb.Tables {
+			if strings.EqualFold(name, table) {
+				return st, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("table '%s.%s' doesn't exist in snapshot", database, table)
+}
+
+// showCreate 从快照中获取建库建表语句
+func (s *Snapshot) showCreate(database, createType, name string) (string, error) {
+	if strings.EqualFold(createType, "database") {
+		if sdb, ok := s.Databases[name]; ok {
+			return sdb.CreateDatabase, nil
+		}
+		return "", fmt.Errorf("database '%s' doesn't exist in snapshot", name)
+	}
+	st, err := s.table(database, name)
+	if err != nil {
+		return "", err
+	}
+	return st.CreateTable, nil
+}
+
+// showTables 获取快照中某个库的所有表
+func (s *Snapshot) showTables(database string) []string {
+	var tables []string
+	if sdb, ok := s.Databases[database]; ok {
+		for name := range sdb.Tables {
+			tables = append(tables, name)
+		}
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// findColumn 从快照中查找列的库表及类型信息
+func (s *Snapshot) findColumn(name, database string, tables ...string) []*common.Column {
+	var columns []*common.Column
+	var dbs []string
+	for d := range s.Databases {
+		if database == "" || d == database {
+			dbs = append(dbs, d)
+		}
+	}
+	sort.Strings(dbs)
+	for _, d := range dbs {
+		for _, tb := range s.showTables(d) {
+			if len(tables) > 0 && !containsTable(tables, tb) {
+				continue
+			}
+			st := s.Databases[d].Tables[tb]
+			if st.Columns == nil {
+				continue
+			}
+			for _, desc := range st.Columns.DescValues {
+				if !strings.EqualFold(desc.Field, name) {
+					continue
+				}
+				col := &common.Column{
+					Name:      name,
+					Table:     tb,
+					DB:        d,
+					DataType:  desc.Type,
+					Collation: string(desc.Collation),
+				}
+				if col.Collation == "" && st.Status != nil && len(st.Status.Rows) > 0 {
+					col.Collation = string(st.Status.Rows[0].Collation)
+				}
+				if col.Collation != "" {
+					col.Character = strings.Split(col.Collation, "_")[0]
+				}
+				columns = append(columns, col)
+			}
+		}
+	}
+	return columns
+}
+
+// showReference 从快照中获取外键关系
+func (s *Snapshot) showReference(database string, tables ...string) []ReferenceValue {
+	var refs []ReferenceValue
+	for _, tb := range s.showTables(database) {
+		if len(tables) > 0 && !containsTable(tables, tb) {
+			continue
+		}
+		refs = append(refs, s.Databases[database].Tables[tb].References...)
+	}
+	return refs
+}
+
+// isForeignKey 从快照中判断列是否是外键
+func (s *Snapshot) isForeignKey(database, table, column string) bool {
+	st, err := s.table(database, table)
+	if err != nil {
+		return false
+	}
+	for _, ref := range st.References {
+		for _, col := range ref.Columns {
+			if strings.EqualFold(col, column) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Cardinality 从快照中获取列的散粒度，快照中不存在该列时返回 false
+func (s *Snapshot) Cardinality(database, table, column string) (float64, bool) {
+	if s == nil {
+		return 0, false
+	}
+	st, err := s.table(database, table)
+	if err != nil {
+		return 0, false
+	}
+	c, ok := st.Cardinality[column]
+	return c, ok
+}
+
+// containsTable 表名大小写不敏感
+func containsTable(tables []string, table string) bool {
+	for _, tb := range tables {
+		if strings.EqualFold(tb, table) {
+			return true
+		}
+	}
+	return false
+}
+
+// DDL 快照中所有的建库建表语句，可以用于构建离线数据字典
+func (s *Snapshot) DDL() string {
+	var buf []string
+	var dbs []string
+	for name := range s.Databases {
+		dbs = append(dbs, name)
+	}
+	sort.Strings(dbs)
+	for _, name := range dbs {
+		buf = append(buf, s.Databases[name].CreateDatabase+";", fmt.Sprintf("USE `%s`;", name))
+		var views []string
+		for _, tb := range s.showTables(name) {
+			ddl := s.Databases[name].Tables[tb].CreateTable
+			// 视图依赖的表需要先创建
+			if strings.HasPrefix(ddl, "CREATE ALGORITHM") || strings.HasPrefix(ddl, "CREATE VIEW") ||
+				strings.HasPrefix(ddl, "CREATE DEFINER") {
+				views = append(views, ddl+";")
+				continue
+			}
+			buf = append(buf, ddl+";")
+		}
+		buf = append(buf, views...)
+	}
+	return strings.Join(buf, "\n")
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+func TestSnapshot(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	s, err := LoadSnapshot(filepath.Join("testdata", "snapshot.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := &Connector{Addr: s.Addr, Database: s.Database, Snapshot: s}
+
+	if v, _ := conn.Version(); v != 50725 {
+		t.Errorf("Version want 50725, got %d", v)
+	}
+	if _, err = conn.Query("select 1"); err != errSnapshotQuery {
+		t.Errorf("Query should return errSnapshotQuery, got %v", err)
+	}
+
+	tables, _ := conn.ShowTables()
+	if strings.Join(tables, ",") != "film,language" {
+		t.Errorf("ShowTables got %v", tables)
+	}
+
+	status, err := conn.ShowTableStatus("film")
+	if err != nil || string(status.Rows[0].Rows) != "4" || status.Rows[0].UpdateTime != nil {
+		t.Errorf("ShowTableStatus got %v, %v", status, err)
+	}
+
+	idx, err := conn.ShowIndex("film")
+	if err != nil || len(idx.Rows) != 2 || idx.Rows[1].KeyName != "idx_title" {
+		t.Errorf("ShowIndex got %v, %v", idx, err)
+	}
+
+	ddl, err := conn.ShowCreateTable("film")
+	if err != nil || strings.Contains(ddl, "CONSTRAINT") {
+		t.Errorf("ShowCreateTable should remove foreign key, got %s, %v", ddl, err)
+	}
+	if _, err = conn.ShowCreateTable("not_exist"); err == nil {
+		t.Error("ShowCreateTable not_exist table should return error")
+	}
+
+	cols, _ := conn.FindColumn("title", "test")
+	if len(cols) != 1 || cols[0].DataType != "varchar(255)" || cols[0].Character != "utf8mb4" {
+		t.Errorf("FindColumn got %v", cols)
+	}
+
+	if !conn.IsForeignKey("test", "film", "language_id") || !conn.IsForeignKey("test", "film", "Language_ID") || conn.IsForeignKey("test", "film", "title") {
+		t.Error("IsForeignKey film.language_id should be foreign key, film.title should not")
+	}
+	refs, _ := conn.ShowReference("test", "film")
+	if len(refs) != 1 || refs[0].ConstraintName != "fk_lang" {
+		t.Errorf("ShowReference got %v", refs)
+	}
+
+	if c := conn.ColumnCardinality("film", "rating"); c != 0.5 {
+		t.Errorf("ColumnCardinality film.rating want 0.5, got %f", c)
+	}
+	if c := conn.ColumnCardinality("film", "not_exist"); c != 1 {
+		t.Errorf("ColumnCardinality film.not_exist want 1, got %f", c)
+	}
+
+	if !strings.HasPrefix(s.DDL(), "CREATE DATABASE `test`") {
+		t.Errorf("DDL got %s", s.DDL())
+	}
+
+	// 保存后重新加载内容不变
+	file := filepath.Join(os.TempDir(), "soar_snapshot_test.json")
+	defer os.Remove(file)
+	if err = s.Save(file); err != nil {
+		t.Fatal(err)
+	}
+	saved, _ := ioutil.ReadFile(file)
+	orig, _ := ioutil.ReadFile(filepath.Join("testdata", "snapshot.json"))
+	if strings.TrimSpace(string(saved)) != strings.TrimSpace(string(orig)) {
+		t.Error("snapshot changed after Save")
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
@@ -0,0 +1,715 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+// SyntheticTable 合成数据时一张表的统计信息，全部来自线上环境的元数据，不读取表中的数据
+type SyntheticTable struct {
+	Database string
+	Name     string
+	Rows     int64 // 线上环境 SHOW TABLE STATUS 中的行数
+	Target   int64 // 需要生成的行数，不超过 -synthetic-max-rows
+	Columns  []*SyntheticColumn
+	Refs     []*SyntheticRef
+}
+
+// SyntheticColumn 一列的取值方式，第 k 个不同的值由 Value(k) 确定
+type SyntheticColumn struct {
+	Name          string
+	Type          string // 完整的数据类型，如 varchar(45), int(10) unsigned
+	Nullable      bool
+	AutoIncrement bool
+	Unique        bool    // 单列主键、唯一索引，每行取不同的值
+	Stride        int64   // 复合主键、唯一索引中的列，第 i 行取第 (i / Stride) % NDV 个值，使各行的组合不重复，0 表示不属于复合唯一键
+	NDV           int64   // 生成数据中不同值的个数
+	NullFrac      float64 // NULL 值的比例，来自直方图
+	Histogram     *ColumnHistogram
+}
+
+// SyntheticRef 外键，子表中的外键列从父表已生成的行中取值
+type SyntheticRef struct {
+	Parent  *SyntheticTable
+	Columns map[string]string // 子表列 -> 父表列
+}
+
+// ColumnHistogram MySQL 8.0 中 ANALYZE TABLE ... UPDATE HISTOGRAM 生成的直方图
+type ColumnHistogram struct {
+	Type       string  `json:"histogram-type"` // singleton, equi-height
+	DataType   string  `json:"data-type"`
+	NullValues float64 `json:"null-values"`
+	Buckets    []HistogramBucket
+}
+
+// HistogramBucket 直方图中的一个桶，singleton 的 Lower 与 Upper 相同，Frequency 为该桶的频率（非累计）
+type HistogramBucket struct {
+	Lower     string
+	Upper     string
+	Frequency float64
+	NDV       int64
+}
+
+// defaultSyntheticRepeat 没有索引散粒度及直方图的列假定每个值平均重复的次数
+const defaultSyntheticRepeat = 10
+
+// ParseHistogram 解析 information_schema.COLUMN_STATISTICS 中的 HISTOGRAM 列
+func ParseHistogram(text string) (*ColumnHistogram, error) {
+	var raw struct {
+		ColumnHistogram
+		Buckets [][]interface{} `json:"buckets"`
+	}
+	if err := json.Unmarshal([]byte(text), &raw); err != nil {
+		return nil, err
+	}
+	h := raw.ColumnHistogram
+	var cumulative float64
+	for _, b := range raw.Buckets {
+		var bucket HistogramBucket
+		switch {
+		case raw.Type == "singleton" && len(b) >= 2:
+			bucket.Lower = histogramValue(b[0])
+			bucket.Upper = bucket.Lower
+			bucket.Frequency = histogramNumber(b[1]) - cumulative
+			bucket.NDV = 1
+			cumulative = histogramNumber(b[1])
+		case len(b) >= 4:
+			bucket.Lower, bucket.Upper = histogramValue(b[0]), histogramValue(b[1])
+			bucket.Frequency = histogramNumber(b[2]) - cumulative
+			bucket.NDV = int64(histogramNumber(b[3]))
+			cumulative = histogramNumber(b[2])
+		default:
+			return nil, fmt.Errorf("invalid histogram bucket %v", b)
+		}
+		h.Buckets = append(h.Buckets, bucket)
+	}
+	return &h, nil
+}
+
+// histogramValue 直方图中的字符串以 base64:type254:xxx 的形式保存
+func histogramValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		if strings.HasPrefix(val, "base64:") {
+			parts := strings.SplitN(val, ":", 3)
+			if len(parts) == 3 {
+				if buf, err := base64.StdEncoding.DecodeString(parts[2]); err == nil {
+					return string(buf)
+				}
+			}
+		}
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// histogramNumber 直方图中的频率
+func histogramNumber(v interface{}) float64 {
+	f, _ := v.(float64)
+	return f
+}
+
+// NDV 直方图中不同值的个数
+func (h *ColumnHistogram) NDV() int64 {
+	var ndv int64
+	for _, b := range h.Buckets {
+		ndv += b.NDV
+	}
+	return ndv
+}
+
+// ShowHistograms 获取 MySQL 8.0 中表上各列的直方图，不支持直方图的版本返回空
+func (db *Connector) ShowHistograms(table string) (map[string]*ColumnHistogram, error) {
+	histograms := make(map[string]*ColumnHistogram)
+	if db.Snapshot != nil {
+		return histograms, nil
+	}
+	if version, err := db.Version(); err != nil || version < 80000 {
+		return histograms, err
+	}
+	res, err := db.Conn.Query("SELECT COLUMN_NAME, HISTOGRAM FROM information_schema.COLUMN_STATISTICS WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?",
+		db.Database, table)
+	if err != nil {
+		return histograms, err
+	}
+	defer res.Close()
+	for res.Next() {
+		var col, text string
+		if err = res.Scan(&col, &text); err != nil {
+			return histograms, err
+		}
+		h, err := ParseHistogram(text)
+		if err != nil {
+			common.Log.Warn("ShowHistograms %s.%s Error: %v", table, col, err)
+			continue
+		}
+		histograms[col] = h
+	}
+	return histograms, res.Err()
+}
+
+// SyntheticPlan 根据线上环境的行数、列定义、索引散粒度、直方图及外键生成合成数据的方案
+// parents 为已经生成方案的表，外键引用的父表不在其中时会按父表的元数据生成方案
+func (db *Connector) SyntheticPlan(table string, maxRows int64, parents map[string]*SyntheticTable) (*SyntheticTable, error) {
+	key := strings.ToLower(db.Database + "." + table)
+	if t, ok := parents[key]; ok {
+		return t, nil
+	}
+	t := &SyntheticTable{Database: db.Database, Name: table}
+	parents[key] = t
+
+	status, err := db.ShowTableStatus(table)
+	if err != nil {
+		return nil, err
+	}
+	if len(status.Rows) > 0 {
+		t.Rows, _ = strconv.ParseInt(string(status.Rows[0].Rows), 10, 64)
+	}
+	t.Target = t.Rows
+	if maxRows > 0 && t.Target > maxRows {
+		t.Target = maxRows
+	}
+
+	desc, err := db.ShowColumns(table)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range desc.DescValues {
+		col := &SyntheticColumn{
+			Name:          c.Field,
+			Type:          strings.ToLower(c.Type),
+			Nullable:      c.Null == "YES",
+			AutoIncrement: strings.Contains(strings.ToLower(c.Extra), "auto_increment"),
+		}
+		// 生成列不能写入，无法合成的类型使用表达式默认值
+		extra := strings.ToUpper(c.Extra)
+		if strings.Contains(extra, "VIRTUAL GENERATED") || strings.Contains(extra, "STORED GENERATED") ||
+			(strings.Contains(extra, "DEFAULT_GENERATED") && !col.writable()) {
+			continue
+		}
+		t.Columns = append(t.Columns, col)
+	}
+
+	// SHOW INDEX 中索引第一列的 Cardinality 即为该列不同值的个数
+	cardinality := make(map[string]int64)
+	index, err := db.ShowIndex(table)
+	if err != nil {
+		return nil, err
+	}
+	var uniqueKeys []string
+	uniques := make(map[string][]string)
+	for _, row := range index.Rows {
+		if row.SeqInIndex == 1 && int64(row.Cardinality) > cardinality[row.ColumnName] {
+			cardinality[row.ColumnName] = int64(row.Cardinality)
+		}
+		if row.NonUnique == 0 && row.ColumnName != "" {
+			if _, ok := uniques[row.KeyName]; !ok {
+				uniqueKeys = append(uniqueKeys, row.KeyName)
+			}
+			uniques[row.KeyName] = append(uniques[row.KeyName], row.ColumnName)
+		}
+	}
+
+	histograms, err := db.ShowHistograms(table)
+	common.LogIfWarn(err, "")
+
+	for _, col := range t.Columns {
+		for _, cols := range uniques {
+			if len(cols) == 1 && strings.EqualFold(cols[0], col.Name) {
+				col.Unique = true
+			}
+		}
+		col.Histogram = histograms[col.Name]
+		if col.Histogram != nil {
+			col.NullFrac = col.Histogram.NullValues
+		}
+
+		// 按线上环境的选择性等比例缩放不同值的个数
+		selectivity := -1.0
+		switch {
+		case col.Unique:
+			selectivity = 1
+		case cardinality[col.Name] > 0 && t.Rows > 0:
+			selectivity = float64(cardinality[col.Name]) / float64(t.Rows)
+		case db.Snapshot != nil:
+			if c, ok := db.Snapshot.Cardinality(db.Database, table, col.Name); ok {
+				selectivity = c
+			}
+		}
+		if selectivity < 0 && col.Histogram != nil && t.Rows > 0 && col.Histogram.Type == "singleton" {
+			col.NDV = col.Histogram.NDV()
+		} else if selectivity < 0 {
+			selectivity = 1.0 / defaultSyntheticRepeat
+			// equi-height 直方图按桶取值，没有直方图时散粒度只是假定值
+			if col.Histogram == nil {
+				recordGuessedColumn(t.Database, t.Name, col.Name)
+			}
+		}
+		if col.NDV == 0 {
+			col.NDV = int64(math.Ceil(math.Min(selectivity, 1) * float64(t.Target)))
+		}
+		if col.NDV < 1 {
+			col.NDV = 1
+		}
+		if max := col.maxNDV(); col.NDV > max {
+			col.NDV = max
+		}
+	}
+
+	for _, key := range uniqueKeys {
+		if cols := uniques[key]; len(cols) > 1 {
+			t.uniqueKey(key, cols)
+		}
+	}
+
+	// 外键引用的父表
+	refs, err := db.ShowReference(db.Database, table)
+	common.LogIfWarn(err, "")
+	for _, ref := range refs {
+		if len(ref.Columns) == 0 || len(ref.Columns) != len(ref.ReferencedColumns) {
+			continue
+		}
+		parentConn := *db
+		parentConn.Database = ref.ReferencedTableSchema
+		parent, err := parentConn.SyntheticPlan(ref.ReferencedTableName, maxRows, parents)
+		if err != nil {
+			common.Log.Warn("SyntheticPlan %s reference %s.%s Error: %v", table, ref.ReferencedTableSchema, ref.ReferencedTableName, err)
+			continue
+		}
+		r := &SyntheticRef{Parent: parent, Columns: make(map[string]string)}
+		for i, col := range ref.Columns {
+			r.Columns[col] = ref.ReferencedColumns[i]
+		}
+		t.Refs = append(t.Refs, r)
+	}
+	return t, nil
+}
+
+// uniqueKey 复合主键、唯一索引中各列按混合进制取值，使生成的各行在这些列上的组合不重复，同时保留每列的散粒度
+// 各列 NDV 的乘积不足生成的行数时增大最后一列的 NDV，一列属于多个复合唯一键时只按第一个键取值
+func (t *SyntheticTable) uniqueKey(key string, names []string) {
+	var cols []*SyntheticColumn
+	for _, name := range names {
+		col := t.column(name)
+		if col == nil {
+			// 生成列等不写入的列，无法保证组合不重复
+			common.Log.Debug("SyntheticPlan `%s`.`%s` unique key %s column %s is not generated", t.Database, t.Name, key, name)
+			return
+		}
+		if col.Unique || col.AutoIncrement {
+			// 已有每行取不同值的列，组合自然不重复
+			return
+		}
+		if col.Stride > 0 {
+			common.Log.Debug("SyntheticPlan `%s`.`%s` column %s belongs to more than one unique key, skip %s", t.Database, t.Name, name, key)
+			return
+		}
+		cols = append(cols, col)
+	}
+
+	others := int64(1)
+	for _, col := range cols[:len(cols)-1] {
+		others = syntheticMulCap(others, col.NDV, t.Target)
+	}
+	last := cols[len(cols)-1]
+	if syntheticMulCap(others, last.NDV, t.Target) < t.Target {
+		last.NDV = (t.Target + others - 1) / others
+		if max := last.maxNDV(); last.NDV > max {
+			last.NDV = max
+		}
+	}
+
+	// 最后一列变化最快，步长超过生成的行数后各行取值相同
+	stride := int64(1)
+	for i := len(cols) - 1; i >= 0; i-- {
+		cols[i].Stride = stride
+		stride = syntheticMulCap(stride, cols[i].NDV, t.Target)
+	}
+}
+
+// syntheticMulCap 计算 a * b，结果超过 limit 时返回 limit，避免溢出
+func syntheticMulCap(a, b, limit int64) int64 {
+	if b > 0 && a > limit/b {
+		return limit
+	}
+	return a * b
+}
+
+// column 按列名查找
+func (t *SyntheticTable) column(name string) *SyntheticColumn {
+	for _, col := range t.Columns {
+		if strings.EqualFold(col.Name, name) {
+			return col
+		}
+	}
+	return nil
+}
+
+// base 基础数据类型，如 varchar, int
+func (col *SyntheticColumn) base() string {
+	return common.GetDataTypeBase(col.Type)
+}
+
+// length 数据类型中的长度，如 varchar(45) 为 45，没有指定时返回 def
+func (col *SyntheticColumn) length(def int) int {
+	if l := common.GetDataTypeLength(col.Type); len(l) > 0 && l[0] > 0 {
+		return l[0]
+	}
+	return def
+}
+
+// syntheticEnumExp enum, set 中的可选值
+var syntheticEnumExp = regexp.MustCompile(`'((?:[^']|'')*)'`)
+
+// enums enum, set 类型的可选值
+func (col *SyntheticColumn) enums() []string {
+	var values []string
+	for _, m := range syntheticEnumExp.FindAllStringSubmatch(col.Type, -1) {
+		values = append(values, strings.Replace(m[1], "''", "'", -1))
+	}
+	return values
+}
+
+// intRange 整型的最小值及可以表示的不同值个数
+func (col *SyntheticColumn) intRange() (int64, int64) {
+	unsigned := strings.Contains(col.Type, "unsigned")
+	bits := map[string]uint{"tinyint": 8, "smallint": 16, "mediumint": 24, "int": 32, "integer": 32, "bigint": 63}[col.base()]
+	if bits == 0 {
+		bits = 63
+	}
+	if !unsigned && bits < 63 {
+		bits--
+	}
+	// 从 1 开始取值，与自增列保持一致
+	return 1, int64(1)<<bits - 1
+}
+
+// maxNDV 数据类型可以表示的不同值个数
+func (col *SyntheticColumn) maxNDV() int64 {
+	switch col.base() {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint":
+		_, n := col.intRange()
+		return n
+	case "decimal", "numeric":
+		l := common.GetDataTypeLength(col.Type)
+		precision, scale := 10, 0
+		if len(l) > 0 {
+			precision = l[0]
+		}
+		if len(l) > 1 {
+			scale = l[1]
+		}
+		return int64(math.Min(math.Pow10(precision-scale)-1, math.MaxInt64/2))
+	case "enum":
+		return int64(len(col.enums()))
+	case "set":
+		n := len(col.enums())
+		if n >= 62 {
+			return math.MaxInt64
+		}
+		return int64(1)<<uint(n) - 1
+	case "bit":
+		n := col.length(1)
+		if n >= 63 {
+			return math.MaxInt64
+		}
+		return int64(1) << uint(n)
+	case "year":
+		return 255
+	case "char", "varchar", "binary", "varbinary":
+		// 36 进制表示，长度不超过列的长度
+		n := col.length(1)
+		if n >= 12 {
+			return math.MaxInt64
+		}
+		return int64(math.Pow(36, float64(n)))
+	}
+	return math.MaxInt64
+}
+
+// writable 是否可以为该类型生成合法的值
+func (col *SyntheticColumn) writable() bool {
+	switch col.base() {
+	case "linestring", "polygon", "multipoint", "multilinestring", "multipolygon", "geometrycollection":
+		return false
+	}
+	return true
+}
+
+// syntheticBaseTime 日期时间类型的起始值
+var syntheticBaseTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Value 第 k 个不同值的 SQL 表示，k 从 0 开始
+func (col *SyntheticColumn) Value(k int64) string {
+	switch col.base() {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint":
+		min, _ := col.intRange()
+		return strconv.FormatInt(min+k, 10)
+	case "decimal", "numeric", "float", "double", "real":
+		return strconv.FormatInt(k+1, 10)
+	case "bit":
+		return strconv.FormatInt(k, 10)
+	case "year":
+		return strconv.FormatInt(1901+k%255, 10)
+	case "enum":
+		values := col.enums()
+		if len(values) == 0 {
+			return "NULL"
+		}
+		return "'" + Escape(values[k%int64(len(values))], false) + "'"
+	case "set":
+		values := col.enums()
+		var members []string
+		for i, v := range values {
+			if (k+1)&(int64(1)<<uint(i)) != 0 {
+				members = append(members, v)
+			}
+		}
+		return "'" + Escape(strings.Join(members, ","), false) + "'"
+	case "date":
+		return syntheticBaseTime.AddDate(0, 0, int(k)).Format("'2006-01-02'")
+	case "datetime", "timestamp":
+		return syntheticBaseTime.Add(time.Duration(k) * time.Minute).Format("'2006-01-02 15:04:05'")
+	case "time":
+		return fmt.Sprintf("'%02d:%02d:%02d'", k/3600%838, k/60%60, k%60)
+	case "json":
+		return fmt.Sprintf(`'{"id": %d}'`, k)
+	case "point", "geometry":
+		return fmt.Sprintf("ST_GeomFromText('POINT(%d %d)')", k%180, k/180%90)
+	case "linestring", "polygon", "multipoint", "multilinestring", "multipolygon", "geometrycollection":
+		return "NULL"
+	}
+
+	// 字符串类型使用 列名_k 的形式，列的长度不够时只使用 36 进制的 k
+	s := strconv.FormatInt(k, 36)
+	limit := col.length(255)
+	if prefix := col.Name + "_"; len(prefix)+len(s) <= limit {
+		s = prefix + s
+	}
+	if len(s) > limit {
+		s = s[len(s)-limit:]
+	}
+	return "'" + Escape(s, false) + "'"
+}
+
+// histogramValue 按直方图中各个桶的频率取值
+func (col *SyntheticColumn) histogramValue(r *rand.Rand) string {
+	h := col.Histogram
+	var total float64
+	for _, b := range h.Buckets {
+		total += b.Frequency
+	}
+	p := r.Float64() * total
+	bucket := h.Buckets[len(h.Buckets)-1]
+	for _, b := range h.Buckets {
+		if p < b.Frequency {
+			bucket = b
+			break
+		}
+		p -= b.Frequency
+	}
+
+	value := bucket.Lower
+	if bucket.Upper != bucket.Lower {
+		switch h.DataType {
+		case "int":
+			lower, err1 := strconv.ParseInt(bucket.Lower, 10, 64)
+			upper, err2 := strconv.ParseInt(bucket.Upper, 10, 64)
+			if err1 == nil && err2 == nil && upper > lower {
+				return strconv.FormatInt(lower+r.Int63n(upper-lower+1), 10)
+			}
+		case "double", "decimal":
+			lower, err1 := strconv.ParseFloat(bucket.Lower, 64)
+			upper, err2 := strconv.ParseFloat(bucket.Upper, 64)
+			if err1 == nil && err2 == nil {
+				return strconv.FormatFloat(lower+r.Float64()*(upper-lower), 'f', 2, 64)
+			}
+		}
+		if r.Intn(2) == 1 {
+			value = bucket.Upper
+		}
+	}
+	if h.DataType == "int" || h.DataType == "double" || h.DataType == "decimal" {
+		return value
+	}
+	return "'" + Escape(value, false) + "'"
+}
+
+// GenerateRows 生成第 [from, to) 行数据，每一行为各列的 SQL 表示，相同的 seed 生成相同的数据
+func (t *SyntheticTable) GenerateRows(from, to int64, seed int64) [][]string {
+	r := rand.New(rand.NewSource(samplingSeed(seed, t.Database, t.Name) + from))
+	refCols := make(map[string]bool)
+	for _, ref := range t.Refs {
+		for col := range ref.Columns {
+			refCols[col] = true
+		}
+	}
+
+	var rows [][]string
+	for i := from; i < to; i++ {
+		values := make(map[string]string)
+		// 复合外键的各列取自父表的同一行
+		for _, ref := range t.Refs {
+			if ref.Parent.Target <= 0 {
+				continue
+			}
+			k := r.Int63n(ref.Parent.Target)
+			for col, parentCol := range ref.Columns {
+				if c := ref.Parent.column(parentCol); c != nil {
+					values[col] = c.rowValue(k, r)
+				}
+			}
+		}
+
+		row := make([]string, len(t.Columns))
+		for j, col := range t.Columns {
+			if v, ok := values[col.Name]; ok && refCols[col.Name] {
+				row[j] = v
+				continue
+			}
+			row[j] = col.rowValue(i, r)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// rowValue 第 i 行中该列的值，唯一列每行取不同的值，复合唯一键中的列按步长取值，其他列按直方图或在 NDV 个值中随机取值
+func (col *SyntheticColumn) rowValue(i int64, r *rand.Rand) string {
+	if col.Unique || col.AutoIncrement {
+		return col.Value(i)
+	}
+	if col.Stride > 0 {
+		return col.Value((i / col.Stride) % col.NDV)
+	}
+	if col.Nullable && col.NullFrac > 0 && r.Float64() < col.NullFrac {
+		return "NULL"
+	}
+	if col.Histogram != nil && len(col.Histogram.Buckets) > 0 {
+		return col.histogramValue(r)
+	}
+	return col.Value(r.Int63n(col.NDV))
+}
+
+// SyntheticData 根据线上环境的统计信息在测试环境中生成数据，不读取线上环境中的数据
+func (db *Connector) SyntheticData(onlineConn *Connector, tables ...string) error {
+	if onlineConn.Snapshot == nil && onlineConn.Database == db.Database && onlineConn.Addr == db.Addr {
+		return fmt.Errorf("SyntheticData the same database, From: %s/%s, To: %s/%s", onlineConn.Addr, onlineConn.Database, db.Addr, db.Database)
+	}
+	seed := common.Config.SamplingSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	plans := make(map[string]*SyntheticTable)
+	var targets []*SyntheticTable
+	for _, table := range tables {
+		if onlineConn.IsView(table) {
+			continue
+		}
+		t, err := onlineConn.SyntheticPlan(table, common.Config.SyntheticMaxRows, plans)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, t)
+	}
+
+	// 使用同一个连接关闭外键检查，父表可能没有在测试环境中创建
+	ctx := context.Background()
+	conn, err := db.Conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err = conn.ExecContext(ctx, "SET SESSION FOREIGN_KEY_CHECKS = 0"); err != nil {
+		return err
+	}
+
+	batch := int64(200) // one time insert values count
+	for _, t := range targets {
+		common.Log.Debug("SyntheticData, table: %s, online rows: %d, generate rows: %d", t.Name, t.Rows, t.Target)
+		var ignored int64
+		var cols []string
+		for _, col := range t.Columns {
+			cols = append(cols, "`"+Escape(col.Name, false)+"`")
+		}
+		for from := int64(0); from < t.Target; from += batch {
+			to := from + batch
+			if to > t.Target {
+				to = t.Target
+			}
+			var values []string
+			for _, row := range t.GenerateRows(from, to, seed) {
+				values = append(values, "("+strings.Join(row, ",")+")")
+			}
+			// 超出范围或重复的值忽略，不影响其他行
+			query := fmt.Sprintf("INSERT IGNORE INTO `%s`.`%s` (%s) VALUES %s",
+				Escape(db.Database, false), Escape(t.Name, false), strings.Join(cols, ","), strings.Join(values, ","))
+			res, err := conn.ExecContext(ctx, query)
+			if err != nil {
+				return err
+			}
+			if affected, err := res.RowsAffected(); err == nil {
+				ignored += to - from - affected
+			}
+		}
+		if ignored > 0 {
+			common.Log.Warn("SyntheticData `%s`.`%s` %d of %d rows are ignored by INSERT IGNORE, duplicate or out of range values",
+				db.Database, t.Name, ignored, t.Target)
+		}
+	}
+	return nil
+}
+
+// guessedColumns 合成数据时没有索引散粒度、直方图及快照，按 defaultSyntheticRepeat 生成的列，db.table -> column
+var guessedColumns = struct {
+	sync.Mutex
+	m map[string]map[string]bool
+}{m: make(map[string]map[string]bool)}
+
+// recordGuessedColumn 记录散粒度为假定值的列
+func recordGuessedColumn(database, table, column string) {
+	guessedColumns.Lock()
+	defer guessedColumns.Unlock()
+	key := strings.ToLower(database + "." + table)
+	if guessedColumns.m[key] == nil {
+		guessedColumns.m[key] = make(map[string]bool)
+	}
+	guessedColumns.m[key][strings.ToLower(column)] = true
+}
+
+// SyntheticGuessed 线上环境中某一列合成数据的散粒度是否为假定值，索引建议不应采信这样的散粒度
+func SyntheticGuessed(database, table, column string) bool {
+	guessedColumns.Lock()
+	defer guessedColumns.Unlock()
+	return guessedColumns.m[strings.ToLower(database+"."+table)][strings.ToLower(column)]
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+func TestParseHistogram(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	singleton := `{"buckets": [[1, 0.25], [2, 0.75], [3, 0.9]], "data-type": "int", "null-values": 0.1,
+"histogram-type": "singleton", "number-of-buckets-specified": 100}`
+	h, err := ParseHistogram(singleton)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Type != "singleton" || h.NullValues != 0.1 || len(h.Buckets) != 3 || h.NDV() != 3 {
+		t.Errorf("singleton histogram: %+v", h)
+	}
+	if b := h.Buckets[1]; b.Lower != "2" || b.Upper != "2" || b.Frequency < 0.49 || b.Frequency > 0.51 {
+		t.Errorf("singleton bucket: %+v", b)
+	}
+
+	// "PG-13" 与 "R" 的 base64 编码
+	equiHeight := `{"buckets": [["base64:type254:UEctMTM=", "base64:type254:Ug==", 0.6, 2], ["base64:type254:Ug==", "base64:type254:Ug==", 1.0, 1]],
+"data-type": "string", "null-values": 0.0, "histogram-type": "equi-height"}`
+	h, err = ParseHistogram(equiHeight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := h.Buckets[0]; b.Lower != "PG-13" || b.Upper != "R" || b.NDV != 2 || b.Frequency != 0.6 {
+		t.Errorf("equi-height bucket: %+v", b)
+	}
+	if h.NDV() != 3 {
+		t.Errorf("equi-height NDV want 3, got %d", h.NDV())
+	}
+
+	if _, err = ParseHistogram(`{"buckets": [[1]], "histogram-type": "equi-height"}`); err == nil {
+		t.Error("invalid bucket should return error")
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestSyntheticValue(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	cases := []struct {
+		typ   string
+		k     int64
+		value string
+		ndv   int64
+	}{
+		{"int(11)", 0, "1", 1<<31 - 1},
+		{"tinyint(3) unsigned", 9, "10", 255},
+		{"decimal(5,2)", 4, "5", 999},
+		{"varchar(45)", 35, "'c_z'", 1<<63 - 1},
+		{"char(2)", 36, "'10'", 1296},
+		{"enum('G','PG','R')", 4, "'PG'", 3},
+		{"set('a','b','c')", 2, "'a,b'", 7},
+		{"date", 31, "'2020-02-01'", 1<<63 - 1},
+		{"datetime", 61, "'2020-01-01 01:01:00'", 1<<63 - 1},
+		{"year(4)", 0, "1901", 255},
+		{"bit(1)", 1, "1", 2},
+	}
+	for _, c := range cases {
+		col := &SyntheticColumn{Name: "c", Type: c.typ}
+		if v := col.Value(c.k); v != c.value {
+			t.Errorf("%s Value(%d) want %s, got %s", c.typ, c.k, c.value, v)
+		}
+		if n := col.maxNDV(); n != c.ndv {
+			t.Errorf("%s maxNDV want %d, got %d", c.typ, c.ndv, n)
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestSyntheticPlan(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	s, err := LoadSnapshot(filepath.Join("testdata", "snapshot.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 生成列不写入
+	desc := s.Databases["test"].Tables["film"].Columns
+	desc.DescValues = append(desc.DescValues,
+		TableDescValue{Field: "title_len", Type: "int(11)", Null: "YES", Extra: "VIRTUAL GENERATED"},
+		TableDescValue{Field: "area", Type: "polygon", Null: "NO", Extra: "DEFAULT_GENERATED"})
+	conn := &Connector{Addr: s.Addr, Database: s.Database, Snapshot: s}
+	plans := make(map[string]*SyntheticTable)
+	film, err := conn.SyntheticPlan("film", 100, plans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if film.Rows != 4 || film.Target != 4 || len(film.Columns) != 4 {
+		t.Fatalf("film plan: %+v", film)
+	}
+	// 没有散粒度信息的列散粒度为假定值
+	if !SyntheticGuessed("test", "film", "language_id") || SyntheticGuessed("test", "film", "rating") {
+		t.Error("only language_id cardinality should be guessed")
+	}
+	if c := film.column("film_id"); !c.Unique || c.NDV != 4 || c.Nullable {
+		t.Errorf("film_id: %+v", c)
+	}
+	// 快照中 rating 的散粒度为 0.5
+	if c := film.column("rating"); c.Unique || c.NDV != 2 || !c.Nullable {
+		t.Errorf("rating: %+v", c)
+	}
+	if len(film.Refs) != 1 || film.Refs[0].Parent.Name != "language" ||
+		!reflect.DeepEqual(film.Refs[0].Columns, map[string]string{"language_id": "language_id"}) {
+		t.Fatalf("film refs: %+v", film.Refs)
+	}
+	if plans["test.language"] != film.Refs[0].Parent {
+		t.Error("parent plan should be shared")
+	}
+
+	// 外键列取值于父表生成的行，相同的种子生成相同的数据
+	film.Refs[0].Parent.Target = 2
+	rows := film.GenerateRows(0, 4, 1)
+	if !reflect.DeepEqual(rows, film.GenerateRows(0, 4, 1)) {
+		t.Error("GenerateRows should be deterministic")
+	}
+	for i, row := range rows {
+		if row[0] != film.column("film_id").Value(int64(i)) {
+			t.Errorf("row %d film_id want %d, got %s", i, i+1, row[0])
+		}
+		if row[2] != "1" && row[2] != "2" {
+			t.Errorf("row %d language_id should reference language, got %s", i, row[2])
+		}
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestSyntheticUniqueKey(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	tb := &SyntheticTable{
+		Database: "test",
+		Name:     "rental",
+		Target:   10,
+		Columns: []*SyntheticColumn{
+			{Name: "store_id", Type: "tinyint(3) unsigned", NDV: 2},
+			{Name: "staff_id", Type: "int(11)", NDV: 3},
+			{Name: "note", Type: "varchar(45)", NDV: 1},
+		},
+	}
+	tb.uniqueKey("uk_store_staff", []string{"store_id", "staff_id"})
+
+	// 各列 NDV 的乘积不足行数时增大最后一列的 NDV，第一列的散粒度不变
+	store, staff := tb.column("store_id"), tb.column("staff_id")
+	if store.Unique || staff.Unique || store.NDV != 2 || staff.NDV != 5 || store.Stride != 5 || staff.Stride != 1 {
+		t.Fatalf("store_id: %+v, staff_id: %+v", store, staff)
+	}
+	seen := make(map[string]bool)
+	stores := make(map[string]bool)
+	for _, row := range tb.GenerateRows(0, tb.Target, 1) {
+		key := row[0] + "," + row[1]
+		if seen[key] {
+			t.Errorf("duplicate unique key %s", key)
+		}
+		seen[key] = true
+		stores[row[0]] = true
+	}
+	if len(stores) != 2 {
+		t.Errorf("store_id should keep 2 distinct values, got %d", len(stores))
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
@@ -0,0 +1,456 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TraceSelect 优化器对一个 select 的优化过程，来自 trace 中的 join_optimization
+type TraceSelect struct {
+	Select int
+	Tables []*TraceTable
+}
+
+// TraceTable 优化器对单表访问方式的分析
+type TraceTable struct {
+	Table     string
+	ScanRows  float64            // 全表扫描的估算行数，来自 rows_estimation 中的 table_scan
+	ScanCost  float64            // 全表扫描的代价
+	Ranges    []*TraceAccessPath // range_analysis 中分析过的索引
+	Paths     []*TraceAccessPath // considered_execution_plans 中比较过的访问路径
+	Chosen    *TraceAccessPath   // 最终选择的访问方式
+	RangeIdx  string             // range_analysis 中选出的索引，来自 chosen_range_access_summary
+	Attached  string             // attaching_conditions_to_tables 中附加在该表上的过滤条件
+	TableType string             // const, system 等在 rows_estimation 阶段就已确定的表
+}
+
+// TraceAccessPath 一种候选的访问方式
+type TraceAccessPath struct {
+	Index  string
+	Access string // ref, range, scan 等
+	Rows   float64
+	Cost   float64
+	Usable bool
+	Chosen bool
+	Cause  string // 未被选中或不可用的原因
+}
+
+// TraceCauses 优化器放弃某种访问方式的常见原因
+var TraceCauses = map[string]string{
+	"not_applicable":                 "查询条件无法使用该索引",
+	"cost":                           "代价更高",
+	"heuristic_index_cheaper":        "已有代价更低的索引，跳过",
+	"range_uses_more_keyparts":       "range 访问使用的索引列更多，优先于 ref",
+	"unknown":                        "未知",
+	"not_better_than_ref":            "不比 ref 访问更好",
+	"too_few_roworder_scans":         "可用于索引合并的索引过少",
+	"no_range_predicate":             "没有范围条件",
+	"index_merge_union_not_chosen":   "索引合并代价更高",
+	"covering_index_better_than_ref": "覆盖索引比 ref 访问更好",
+}
+
+var traceTableQuoteExp = regexp.MustCompile("`")
+
+// ParseTrace 解析 OPTIMIZER_TRACE 中的 JSON，提取每个 select 中各表的代价估算、候选索引及最终选择
+func ParseTrace(trace string) ([]*TraceSelect, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(trace), &v); err != nil {
+		return nil, err
+	}
+	var selects []*TraceSelect
+	walkTrace(v, func(key string, val interface{}) {
+		if key != "join_optimization" {
+			return
+		}
+		opt, ok := val.(map[string]interface{})
+		if !ok {
+			return
+		}
+		sel := &TraceSelect{Select: int(traceNumber(opt["select#"]))}
+		steps, _ := opt["steps"].([]interface{})
+		for _, step := range steps {
+			s, ok := step.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if items, ok := s["rows_estimation"].([]interface{}); ok {
+				sel.parseRowsEstimation(items)
+			}
+			if plans, ok := s["considered_execution_plans"].([]interface{}); ok {
+				sel.parseExecutionPlans(plans)
+			}
+			if attaching, ok := s["attaching_conditions_to_tables"].(map[string]interface{}); ok {
+				summary, _ := attaching["attached_conditions_summary"].([]interface{})
+				for _, item := range summary {
+					if cond, ok := item.(map[string]interface{}); ok {
+						attached, _ := cond["attached"].(string)
+						sel.table(cond["table"]).Attached = attached
+					}
+				}
+			}
+		}
+		for _, table := range sel.Tables {
+			table.choose()
+		}
+		if len(sel.Tables) > 0 {
+			selects = append(selects, sel)
+		}
+	})
+	// map 的遍历顺序不固定，按 select# 排序
+	sort.SliceStable(selects, func(i, j int) bool {
+		return selects[i].Select < selects[j].Select
+	})
+	return selects, nil
+}
+
+// walkTrace 先序遍历 JSON 中所有的 key，子查询的 join_optimization 会嵌套在外层查询中
+func walkTrace(v interface{}, fn func(key string, val interface{})) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			fn(k, child)
+			walkTrace(child, fn)
+		}
+	case []interface{}:
+		for _, child := range val {
+			walkTrace(child, fn)
+		}
+	}
+}
+
+// traceNumber trace 中的数值，MySQL 8.0 中部分较大的值可能是字符串
+func traceNumber(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case string:
+		f, _ := strconv.ParseFloat(n, 64)
+		return f
+	}
+	return 0
+}
+
+// table 按表名获取 TraceTable，不存在时添加，表名中的反引号会被去掉
+func (sel *TraceSelect) table(name interface{}) *TraceTable {
+	tb, _ := name.(string)
+	tb = traceTableQuoteExp.ReplaceAllString(tb, "")
+	for _, table := range sel.Tables {
+		if table.Table == tb {
+			return table
+		}
+	}
+	table := &TraceTable{Table: tb}
+	sel.Tables = append(sel.Tables, table)
+	return table
+}
+
+// parseRowsEstimation 全表扫描的代价以及 range_analysis 中各个索引是否可用、代价是多少
+func (sel *TraceSelect) parseRowsEstimation(items []interface{}) {
+	for _, item := range items {
+		est, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		table := sel.table(est["table"])
+		if tableType, ok := est["table_type"].(string); ok {
+			table.TableType = tableType
+		}
+		if scan, ok := est["table_scan"].(map[string]interface{}); ok {
+			table.ScanRows, table.ScanCost = traceNumber(scan["rows"]), traceNumber(scan["cost"])
+		}
+		ra, ok := est["range_analysis"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if scan, ok := ra["table_scan"].(map[string]interface{}); ok {
+			table.ScanRows, table.ScanCost = traceNumber(scan["rows"]), traceNumber(scan["cost"])
+		}
+		potential, _ := ra["potential_range_indexes"].([]interface{})
+		for _, p := range potential {
+			idx, ok := p.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			usable, _ := idx["usable"].(bool)
+			name, _ := idx["index"].(string)
+			cause, _ := idx["cause"].(string)
+			table.Ranges = append(table.Ranges, &TraceAccessPath{Index: name, Access: "range", Usable: usable, Cause: cause})
+		}
+		if summary, ok := ra["chosen_range_access_summary"].(map[string]interface{}); ok {
+			table.RangeIdx = jsonString(summary, "range_access_plan", "index")
+		}
+		alternatives, _ := ra["analyzing_range_alternatives"].(map[string]interface{})
+		scans, _ := alternatives["range_scan_alternatives"].([]interface{})
+		for _, s := range scans {
+			alt, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _ := alt["index"].(string)
+			path := table.rangePath(name)
+			path.Usable = true
+			path.Rows, path.Cost = traceNumber(alt["rows"]), traceNumber(alt["cost"])
+			path.Chosen, _ = alt["chosen"].(bool)
+			path.Cause, _ = alt["cause"].(string)
+		}
+	}
+}
+
+// rangePath 获取 range_analysis 中指定索引的分析结果，不存在时添加
+func (table *TraceTable) rangePath(index string) *TraceAccessPath {
+	for _, path := range table.Ranges {
+		if path.Index == index {
+			return path
+		}
+	}
+	path := &TraceAccessPath{Index: index, Access: "range"}
+	table.Ranges = append(table.Ranges, path)
+	return path
+}
+
+// parseExecutionPlans 连接顺序的每一种排列都会对表的访问方式重新比较，以最终被选中的执行计划为准
+// 每种排列是一条 rest_of_plan 链，只有完整的计划在最后一张表上标记 chosen，未标记的视为未选中，
+// 链上任意一层 chosen 为 false 时整条链都被放弃，后选中的计划代价更低，会覆盖之前选中的
+func (sel *TraceSelect) parseExecutionPlans(plans []interface{}) {
+	var chosenPlan []map[string]interface{}
+	var walk func(plans []interface{}, prefix []map[string]interface{})
+	walk = func(plans []interface{}, prefix []map[string]interface{}) {
+		for _, p := range plans {
+			plan, ok := p.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			sel.table(plan["table"])
+			chosen, ok := plan["chosen"].(bool)
+			if ok && !chosen {
+				continue
+			}
+			chain := append(append([]map[string]interface{}{}, prefix...), plan)
+			if rest, ok := plan["rest_of_plan"].([]interface{}); ok {
+				walk(rest, chain)
+				continue
+			}
+			if chosen {
+				chosenPlan = chain
+			}
+		}
+	}
+	walk(plans, nil)
+
+	for _, plan := range chosenPlan {
+		table := sel.table(plan["table"])
+		table.Paths = nil
+		best, _ := plan["best_access_path"].(map[string]interface{})
+		considered, _ := best["considered_access_paths"].([]interface{})
+		for _, c := range considered {
+			if path, ok := c.(map[string]interface{}); ok {
+				table.Paths = append(table.Paths, traceAccessPath(path))
+			}
+		}
+	}
+}
+
+// traceAccessPath considered_access_paths 中的一种访问方式，5.7 与 8.0 的字段略有不同
+func traceAccessPath(path map[string]interface{}) *TraceAccessPath {
+	ap := &TraceAccessPath{Usable: true}
+	ap.Access, _ = path["access_type"].(string)
+	ap.Index, _ = path["index"].(string)
+	if details, ok := path["range_details"].(map[string]interface{}); ok && ap.Index == "" {
+		ap.Index, _ = details["used_index"].(string)
+	}
+	ap.Rows = traceNumber(path["rows"])
+	if ap.Rows == 0 {
+		ap.Rows = traceNumber(path["rows_to_scan"])
+	}
+	ap.Cost = traceNumber(path["cost"])
+	ap.Chosen, _ = path["chosen"].(bool)
+	ap.Cause, _ = path["cause"].(string)
+	return ap
+}
+
+// choose 确定最终选择的访问方式
+func (table *TraceTable) choose() {
+	for _, path := range table.Paths {
+		if path.Chosen {
+			table.Chosen = path
+			return
+		}
+	}
+	if table.TableType != "" {
+		table.Chosen = &TraceAccessPath{Access: table.TableType, Usable: true, Chosen: true}
+	}
+}
+
+// Candidates 所有候选的访问方式，considered_execution_plans 中比较过的访问路径在前，
+// range_analysis 中分析过但没有进入访问路径比较的索引在后，没有全表扫描的访问路径时补充全表扫描
+func (table *TraceTable) Candidates() []*TraceAccessPath {
+	var candidates []*TraceAccessPath
+	seen := make(map[string]bool)
+	hasScan := false
+	for _, path := range table.Paths {
+		// 被启发式规则跳过的 range 访问没有代价，使用 range_analysis 中的估算
+		if path.Access == "range" && path.Cost == 0 {
+			for _, r := range table.Ranges {
+				if r.Index == path.Index {
+					path.Rows, path.Cost = r.Rows, r.Cost
+				}
+			}
+		}
+		candidates = append(candidates, path)
+		seen[path.Access+"."+path.Index] = true
+		if path.Access == "scan" {
+			hasScan = true
+		}
+	}
+	for _, path := range table.Ranges {
+		if !seen["range."+path.Index] {
+			candidates = append(candidates, path)
+		}
+	}
+	if !hasScan && table.ScanCost > 0 {
+		candidates = append(candidates, &TraceAccessPath{Access: "scan", Rows: table.ScanRows, Cost: table.ScanCost, Usable: true})
+	}
+	return candidates
+}
+
+// BestAlternative 除最终选择外代价最低的访问方式
+func (table *TraceTable) BestAlternative() *TraceAccessPath {
+	var best *TraceAccessPath
+	for _, path := range table.Candidates() {
+		if path == table.Chosen || path.Cost <= 0 || !path.Usable ||
+			table.Chosen != nil && path.Access == table.Chosen.Access && path.Index == table.Chosen.Index {
+			continue
+		}
+		if best == nil || path.Cost < best.Cost {
+			best = path
+		}
+	}
+	return best
+}
+
+// traceCause 翻译优化器给出的原因
+func traceCause(cause string) string {
+	if c, ok := TraceCauses[cause]; ok {
+		return c
+	}
+	return cause
+}
+
+// traceAccess 访问方式的文字描述
+func traceAccess(path *TraceAccessPath) string {
+	if path.Index == "" {
+		if path.Access == "scan" {
+			return "scan 全表扫描"
+		}
+		return path.Access
+	}
+	return fmt.Sprintf("%s 访问索引 %s", path.Access, path.Index)
+}
+
+// traceFloat 去掉多余的小数位，未知的值显示为 -
+func traceFloat(f float64) string {
+	if f <= 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// FormatTraceSelect 以 markdown 格式总结优化器对每张表访问方式的选择过程
+func FormatTraceSelect(sel *TraceSelect) string {
+	var buf []string
+	for _, table := range sel.Tables {
+		buf = append(buf, fmt.Sprintf("#### SELECT#%d 表 %s\n", sel.Select, table.Table))
+		if table.Chosen != nil {
+			summary := fmt.Sprintf("优化器最终选择 **%s**", traceAccess(table.Chosen))
+			if table.Chosen.Rows > 0 || table.Chosen.Cost > 0 {
+				summary += fmt.Sprintf("，估算 %s 行，代价 %s", traceFloat(table.Chosen.Rows), traceFloat(table.Chosen.Cost))
+			}
+			if table.TableType != "" && table.Chosen.Index == "" {
+				summary += "，该表在估算行数阶段即被确定为常量表"
+			}
+			summary += "。"
+			if alt := table.BestAlternative(); alt != nil {
+				summary += fmt.Sprintf("次优方案为 %s，代价 %s", traceAccess(alt), traceFloat(alt.Cost))
+				if table.Chosen.Cost > 0 {
+					summary += fmt.Sprintf("，是最终方案的 %.1f 倍", alt.Cost/table.Chosen.Cost)
+				}
+				summary += "。"
+			}
+			buf = append(buf, summary+"\n")
+		}
+
+		candidates := table.Candidates()
+		if len(candidates) > 0 {
+			buf = append(buf, "| 索引 | 访问方式 | 估算行数 | 代价 | 结果 |")
+			buf = append(buf, "|---|---|---|---|---|")
+			for _, path := range candidates {
+				var result string
+				switch {
+				case path == table.Chosen || path.Chosen && path.Access != "range":
+					result = "选中"
+				case !path.Usable:
+					result = "不可用: " + traceCause(path.Cause)
+				case path.Cause != "":
+					result = "未选中: " + traceCause(path.Cause)
+				case path.Access == "range" && path.Index == table.RangeIdx:
+					result = "范围分析中选中"
+				case path.Chosen:
+					result = "未选中: 范围分析中代价高于 " + table.RangeIdx
+				default:
+					result = "未选中"
+				}
+				buf = append(buf, fmt.Sprintf("| %s | %s | %s | %s | %s |",
+					path.Index, path.Access, traceFloat(path.Rows), traceFloat(path.Cost), result))
+			}
+			buf = append(buf, "")
+		}
+
+		if table.Attached != "" {
+			buf = append(buf, fmt.Sprintf("附加在该表上的过滤条件: `` %s ``\n", table.Attached))
+		}
+	}
+	return strings.Join(buf, "\n")
+}
+
+// FormatTraceSummary 以结构化的形式输出 Trace 信息，无法解析出表的访问方式时输出原始的 Trace
+func FormatTraceSummary(rows []TraceRow) string {
+	explainReg := regexp.MustCompile(`(?i)^explain\s+`)
+	str := []string{""}
+	for _, row := range rows {
+		str = append(str, "```sql")
+		str = append(str, explainReg.ReplaceAllString(row.Query, ""))
+		str = append(str, "```\n")
+
+		selects, err := ParseTrace(row.Trace)
+		if err != nil || len(selects) == 0 {
+			str = append(str, "```json")
+			str = append(str, row.Trace)
+			str = append(str, "```\n")
+			continue
+		}
+		for _, sel := range selects {
+			str = append(str, FormatTraceSelect(sel))
+		}
+	}
+	return strings.Join(str, "\n")
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+func TestParseTrace(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	buf, err := ioutil.ReadFile("testdata/trace_film.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	selects, err := ParseTrace(string(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selects) != 1 || selects[0].Select != 1 || len(selects[0].Tables) != 1 {
+		t.Fatalf("want 1 select with 1 table, got %v", selects)
+	}
+	table := selects[0].Tables[0]
+	if table.Table != "film" || table.ScanCost != 211.1 || table.ScanRows != 1000 {
+		t.Errorf("table scan: %s %v %v", table.Table, table.ScanRows, table.ScanCost)
+	}
+	if table.Chosen == nil || table.Chosen.Index != "idx_title" || table.Chosen.Access != "ref" {
+		t.Errorf("chosen: %v", table.Chosen)
+	}
+	if alt := table.BestAlternative(); alt == nil || alt.Index != "idx_title" || alt.Access != "range" || alt.Cost != 2.21 {
+		t.Errorf("best alternative: %v", alt)
+	}
+	if table.Attached != "((`film`.`language_id` = 1) and (`film`.`film_id` > 100))" {
+		t.Errorf("attached: %s", table.Attached)
+	}
+
+	if _, err = ParseTrace("{"); err == nil {
+		t.Error("want error for invalid trace")
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestParseTraceJoin(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	// a, b 两种连接顺序都被选中过，后选中的 b 全表扫描 -> a ref idx_a 代价更低，c 开头的计划被剪枝
+	buf, err := ioutil.ReadFile("testdata/trace_join.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	selects, err := ParseTrace(string(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selects) != 1 || len(selects[0].Tables) != 3 {
+		t.Fatalf("want 1 select with 3 tables, got %v", selects)
+	}
+	want := map[string]string{"a": "ref idx_a", "b": "scan ", "c": ""}
+	for _, table := range selects[0].Tables {
+		got := ""
+		if table.Chosen != nil {
+			got = table.Chosen.Access + " " + table.Chosen.Index
+		}
+		if got != want[table.Table] {
+			t.Errorf("%s chosen want %q, got %q", table.Table, want[table.Table], got)
+		}
+	}
+
+	// 没有标记 chosen 的计划视为未选中
+	selects, err = ParseTrace(`{"steps": [{"join_optimization": {"select#": 1, "steps": [{"considered_execution_plans": [
+  {"table": "t", "best_access_path": {"considered_access_paths": [{"access_type": "scan", "rows": 10, "cost": 3, "chosen": true}]}}
+]}]}}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selects) != 1 || selects[0].Tables[0].Chosen != nil {
+		t.Errorf("plan without chosen should be ignored, got %v", selects)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestFormatTraceSummary(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	buf, err := ioutil.ReadFile("testdata/trace_film.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := []TraceRow{
+		{
+			Query: "select film_id from film where title = 'ACE GOLDFINGER' and language_id = 1 and film_id > 100",
+			Trace: string(buf),
+		},
+		{
+			Query: "select 1",
+			Trace: `{"steps": [{"join_preparation": {"select#": 1, "steps": []}}]}`,
+		},
+	}
+	err = common.GoldenDiff(func() {
+		fmt.Println(FormatTraceSummary(rows))
+	}, t.Name(), update)
+	if err != nil {
+		t.Error(err)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
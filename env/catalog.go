@@ -0,0 +1,1268 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/XiaoMi/soar/ast"
+	"github.com/XiaoMi/soar/common"
+	"github.com/XiaoMi/soar/database"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/parser"
+	tidb "github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/charset"
+	"github.com/pingcap/parser/format"
+	tmysql "github.com/pingcap/parser/mysql"
+	"github.com/pingcap/parser/types"
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// Catalog 离线数据字典，通过解析建表语句或 mysqldump --no-data 导出的文件构建，不需要连接数据库
+// 测试环境不可用时 VirtualEnv 通过 Catalog 提供 ShowColumns, ShowIndex, FindColumn 等库表结构信息
+type Catalog struct {
+	Database string                // 未指定数据库的语句默认使用的数据库
+	DBs      map[string]*CatalogDB // 库名 -> 库结构
+
+	mu *sync.RWMutex
+}
+
+// CatalogDB 离线数据字典中的数据库
+type CatalogDB struct {
+	Name      string
+	Charset   string
+	Collation string
+	Tables    map[string]*CatalogTable
+}
+
+// CatalogTable 离线数据字典中的表或视图
+type CatalogTable struct {
+	Name        string
+	DB          string
+	Engine      string
+	Charset     string
+	Collation   string
+	Comment     string
+	View        string // 视图定义，不为空时说明是视图
+	Columns     []*CatalogColumn
+	Indexes     []*CatalogIndex
+	ForeignKeys []*CatalogForeignKey
+	options     string // 表属性，用于生成建表语句
+}
+
+// CatalogColumn 离线数据字典中的列
+type CatalogColumn struct {
+	Name      string
+	Type      string // 与 INFORMATION_SCHEMA.COLUMNS 中的 COLUMN_TYPE 一致，如：int(10) unsigned
+	Charset   string
+	Collation string
+	NotNull   bool
+	Default   []byte // nil 表示没有默认值或默认值为 NULL
+	Extra     string // auto_increment, on update CURRENT_TIMESTAMP 等
+	Comment   string
+	def       string // 去除索引、外键约束后的列定义，用于生成建表语句
+}
+
+// CatalogIndex 离线数据字典中的索引
+type CatalogIndex struct {
+	Name    string
+	Unique  bool
+	Type    string // BTREE, FULLTEXT, SPATIAL, HASH
+	Comment string
+	Columns []CatalogIndexColumn
+}
+
+// CatalogIndexColumn 索引中的列
+type CatalogIndexColumn struct {
+	Name    string // 列名，函数索引为空
+	SubPart int    // 前缀索引长度
+	Expr    string // 函数索引表达式
+}
+
+// CatalogForeignKey 离线数据字典中的外键
+type CatalogForeignKey struct {
+	Name       string
+	Columns    []string
+	RefDB      string
+	RefTable   string
+	RefColumns []string
+}
+
+// NewCatalog 初始化一个空的离线数据字典，database 为默认数据库
+func NewCatalog(database string) *Catalog {
+	c := &Catalog{
+		Database: database,
+		DBs:      make(map[string]*CatalogDB),
+		mu:       new(sync.RWMutex),
+	}
+	c.createDatabase(database, "", "")
+	return c
+}
+
+// LoadCatalog 从逗号分隔的文件或目录列表构建离线数据字典，目录中只读取 .sql 文件
+// database 为空时建表语句必须通过 USE 或 db.table 指定数据库，否则返回错误
+// 此时若文件中只定义了一个数据库，将其作为默认数据库
+func LoadCatalog(database, files string) (*Catalog, error) {
+	c := NewCatalog(database)
+	for _, file := range strings.Split(files, ",") {
+		file = strings.TrimSpace(file)
+		if file == "" {
+			continue
+		}
+		fi, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		paths := []string{file}
+		if fi.IsDir() {
+			paths, err = filepath.Glob(filepath.Join(file, "*.sql"))
+			if err != nil {
+				return nil, err
+			}
+			sort.Strings(paths)
+		}
+		for _, path := range paths {
+			buf, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			common.Log.Debug("LoadCatalog, load schema from: %s", path)
+			c.Load(string(buf))
+			if database == "" && len(c.DBs[""].Tables) > 0 {
+				return nil, fmt.Errorf("%s: no database selected, add USE statement or specify schema in -online-dsn, -test-dsn", path)
+			}
+		}
+	}
+	if database == "" {
+		delete(c.DBs, "")
+		if len(c.DBs) != 1 {
+			return nil, fmt.Errorf("no default database for -schema, specify schema in -online-dsn or -test-dsn")
+		}
+		for name := range c.DBs {
+			c.Database = name
+		}
+	}
+	return c, nil
+}
+
+// Load 依次执行 buf 中的 SQL 构建数据字典，无法解析或执行出错的语句会被跳过
+// 由于 DELIMITER 定义的存储过程、触发器等与表结构无关，直接忽略
+func (c *Catalog) Load(buf string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	database := c.Database
+	defer func() {
+		// 文件中的 USE 语句只影响文件内的后续语句
+		c.Database = database
+	}()
+
+	var lines []string
+	delimiter := ";"
+	for _, line := range strings.Split(buf, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.ToUpper(fields[0]) == "DELIMITER" {
+			delimiter = fields[1]
+			continue
+		}
+		if delimiter == ";" {
+			lines = append(lines, line)
+		}
+	}
+
+	rest := []byte(strings.Join(lines, "\n"))
+	for len(rest) > 0 {
+		_, sql, left := ast.SplitStatement(rest, []byte(";"))
+		if len(left) == len(rest) {
+			// 防止切分死循环
+			sql, left = string(rest), nil
+		}
+		rest = left
+		if strings.TrimSpace(sql) == "" {
+			continue
+		}
+		if err := c.execSQL(sql); err != nil {
+			common.Log.Warning("Catalog.Load, SQL: %s, Error: %v", sql, err)
+		}
+	}
+}
+
+// Exec 以 db 为默认数据库解析并在数据字典中执行 DDL 语句，非 DDL 语句直接忽略
+// 与在测试环境中执行 DDL 一致，重复建表、重复索引等错误以 *mysql.MySQLError 的形式返回
+func (c *Catalog) Exec(db, sql string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if db != "" {
+		defer func(database string) {
+			c.Database = database
+		}(c.Database)
+		c.Database = db
+	}
+	return c.execSQL(sql)
+}
+
+func (c *Catalog) execSQL(sql string) error {
+	// 优先使用原始 SQL 解析，保留 mysqldump 中 /*!50001 CREATE VIEW */ 及列字符集等信息
+	// 解析失败时再使用 TiParse 去除不兼容的语法后重试
+	stmts, _, err := parser.New().Parse(sql, "", "")
+	if err != nil {
+		stmts, err = ast.TiParse(sql, "", "")
+		if err != nil {
+			return err
+		}
+	}
+	for _, stmt := range stmts {
+		if err = c.exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Catalog) exec(stmt tidb.StmtNode) error {
+	switch s := stmt.(type) {
+	case *tidb.UseStmt:
+		c.createDatabase(s.DBName, "", "")
+		c.Database = s.DBName
+
+	case *tidb.CreateDatabaseStmt:
+		var cs, co string
+		for _, opt := range s.Options {
+			switch opt.Tp {
+			case tidb.DatabaseOptionCharset:
+				cs = opt.Value
+			case tidb.DatabaseOptionCollate:
+				co = opt.Value
+			}
+		}
+		if _, ok := c.DBs[s.Name]; ok && !s.IfNotExists {
+			return &mysql.MySQLError{Number: 1007, Message: fmt.Sprintf("Can't create database '%s'; database exists", s.Name)}
+		}
+		c.createDatabase(s.Name, cs, co)
+
+	case *tidb.DropDatabaseStmt:
+		delete(c.DBs, s.Name)
+
+	case *tidb.CreateTableStmt:
+		return c.createTable(s)
+
+	case *tidb.CreateViewStmt:
+		db := c.db(s.ViewName.Schema.O)
+		name := s.ViewName.Name.O
+		if _, ok := db.Tables[name]; ok && !s.OrReplace {
+			return errTableExists(name)
+		}
+		db.Tables[name] = &CatalogTable{Name: name, DB: db.Name, View: restore(s)}
+
+	case *tidb.DropTableStmt:
+		for _, tb := range s.Tables {
+			db := c.db(tb.Schema.O)
+			if _, ok := db.Tables[tb.Name.O]; !ok && !s.IfExists {
+				return &mysql.MySQLError{Number: 1051, Message: fmt.Sprintf("Unknown table '%s.%s'", db.Name, tb.Name.O)}
+			}
+			delete(db.Tables, tb.Name.O)
+		}
+
+	case *tidb.RenameTableStmt:
+		for _, t2t := range s.TableToTables {
+			tb, err := c.table(t2t.OldTable)
+			if err != nil {
+				return err
+			}
+			delete(c.DBs[tb.DB].Tables, tb.Name)
+			newDB := c.db(t2t.NewTable.Schema.O)
+			tb.Name, tb.DB = t2t.NewTable.Name.O, newDB.Name
+			newDB.Tables[tb.Name] = tb
+		}
+
+	case *tidb.AlterTableStmt:
+		tb, err := c.table(s.Table)
+		if err != nil {
+			return err
+		}
+		return c.alterTable(tb, s)
+
+	case *tidb.CreateIndexStmt:
+		tb, err := c.table(s.Table)
+		if err != nil {
+			return err
+		}
+		idx := &CatalogIndex{Name: s.IndexName, Type: "BTREE"}
+		switch s.KeyType {
+		case tidb.IndexKeyTypeUnique:
+			idx.Unique = true
+		case tidb.IndexKeyTypeFullText:
+			idx.Type = "FULLTEXT"
+		case tidb.IndexKeyTypeSpatial:
+			idx.Type = "SPATIAL"
+		}
+		return tb.addIndex(idx, s.IndexPartSpecifications, s.IndexOption, s.IfNotExists)
+
+	case *tidb.DropIndexStmt:
+		tb, err := c.table(s.Table)
+		if err != nil {
+			return err
+		}
+		return tb.dropIndex(s.IndexName, s.IfExists)
+	}
+	return nil
+}
+
+func (c *Catalog) createDatabase(name, cs, co string) {
+	db, ok := c.DBs[name]
+	if !ok {
+		db = &CatalogDB{Name: name, Tables: make(map[string]*CatalogTable)}
+		c.DBs[name] = db
+	}
+	if cs != "" || co != "" {
+		db.Charset, db.Collation = completeCharset(cs, co)
+	}
+}
+
+// db 获取语句中指定的数据库，未指定时使用默认数据库，不存在时创建
+func (c *Catalog) db(name string) *CatalogDB {
+	if name == "" {
+		name = c.Database
+	}
+	c.createDatabase(name, "", "")
+	return c.DBs[name]
+}
+
+func (c *Catalog) table(tb *tidb.TableName) (*CatalogTable, error) {
+	db := c.db(tb.Schema.O)
+	if t, ok := db.Tables[tb.Name.O]; ok {
+		return t, nil
+	}
+	return nil, &mysql.MySQLError{Number: 1146, Message: fmt.Sprintf("Table '%s.%s' doesn't exist", db.Name, tb.Name.O)}
+}
+
+func (c *Catalog) createTable(s *tidb.CreateTableStmt) error {
+	db := c.db(s.Table.Schema.O)
+	name := s.Table.Name.O
+	if _, ok := db.Tables[name]; ok {
+		if s.IfNotExists {
+			return nil
+		}
+		return errTableExists(name)
+	}
+
+	// CREATE TABLE ... LIKE
+	if s.ReferTable != nil {
+		refer, err := c.table(s.ReferTable)
+		if err != nil {
+			return err
+		}
+		tb := *refer
+		tb.Name, tb.DB = name, db.Name
+		tb.Columns, tb.Indexes, tb.ForeignKeys = nil, nil, nil
+		for _, col := range refer.Columns {
+			c := *col
+			tb.Columns = append(tb.Columns, &c)
+		}
+		for _, idx := range refer.Indexes {
+			i := *idx
+			i.Columns = append([]CatalogIndexColumn{}, idx.Columns...)
+			tb.Indexes = append(tb.Indexes, &i)
+		}
+		db.Tables[name] = &tb
+		return nil
+	}
+
+	tb := &CatalogTable{Name: name, DB: db.Name, Charset: db.Charset, Collation: db.Collation}
+	var opts []string
+	for _, opt := range s.Options {
+		tb.setOption(opt)
+		opts = append(opts, restore(opt))
+	}
+	if tb.Charset != db.Charset || tb.Collation != db.Collation {
+		tb.Charset, tb.Collation = completeCharset(tb.Charset, tb.Collation)
+	}
+	tb.options = strings.Join(opts, " ")
+
+	for _, col := range s.Cols {
+		if err := tb.addColumn(col, nil); err != nil {
+			return err
+		}
+	}
+	for _, cons := range s.Constraints {
+		if err := tb.addConstraint(cons, db.Name); err != nil {
+			return err
+		}
+	}
+	db.Tables[name] = tb
+	return nil
+}
+
+func (c *Catalog) alterTable(tb *CatalogTable, s *tidb.AlterTableStmt) error {
+	db := c.db(s.Table.Schema.O)
+	for _, spec := range s.Specs {
+		var err error
+		switch spec.Tp {
+		case tidb.AlterTableOption:
+			for _, opt := range spec.Options {
+				tb.setOption(opt)
+			}
+		case tidb.AlterTableAddColumns:
+			for _, col := range spec.NewColumns {
+				if spec.IfNotExists && tb.column(col.Name.Name.O) != nil {
+					continue
+				}
+				if err = tb.addColumn(col, spec.Position); err != nil {
+					return err
+				}
+			}
+			for _, cons := range spec.NewConstraints {
+				if err = tb.addConstraint(cons, db.Name); err != nil {
+					return err
+				}
+			}
+		case tidb.AlterTableAddConstraint:
+			err = tb.addConstraint(spec.Constraint, db.Name)
+		case tidb.AlterTableDropColumn:
+			err = tb.dropColumn(spec.OldColumnName.Name.O, spec.IfExists)
+		case tidb.AlterTableModifyColumn, tidb.AlterTableChangeColumn:
+			old := spec.NewColumns[0].Name.Name.O
+			if spec.OldColumnName != nil {
+				old = spec.OldColumnName.Name.O
+			}
+			err = tb.changeColumn(old, spec.NewColumns[0], spec.Position)
+		case tidb.AlterTableRenameColumn:
+			col := tb.column(spec.OldColumnName.Name.O)
+			if col == nil {
+				return errUnknownColumn(spec.OldColumnName.Name.O, tb.Name)
+			}
+			tb.renameIndexColumn(col.Name, spec.NewColumnName.Name.O)
+			col.def = strings.Replace(col.def, quote(col.Name), quote(spec.NewColumnName.Name.O), 1)
+			col.Name = spec.NewColumnName.Name.O
+		case tidb.AlterTableDropPrimaryKey:
+			err = tb.dropIndex("PRIMARY", spec.IfExists)
+		case tidb.AlterTableDropIndex:
+			err = tb.dropIndex(spec.Name, spec.IfExists)
+		case tidb.AlterTableDropForeignKey:
+			for i, fk := range tb.ForeignKeys {
+				if strings.EqualFold(fk.Name, spec.Name) {
+					tb.ForeignKeys = append(tb.ForeignKeys[:i], tb.ForeignKeys[i+1:]...)
+					break
+				}
+			}
+		case tidb.AlterTableRenameIndex:
+			idx := tb.index(spec.FromKey.O)
+			if idx == nil {
+				return errCantDrop(spec.FromKey.O)
+			}
+			if tb.index(spec.ToKey.O) != nil {
+				return errDupKey(spec.ToKey.O)
+			}
+			idx.Name = spec.ToKey.O
+		case tidb.AlterTableRenameTable:
+			delete(db.Tables, tb.Name)
+			newDB := c.db(spec.NewTable.Schema.O)
+			tb.Name, tb.DB = spec.NewTable.Name.O, newDB.Name
+			newDB.Tables[tb.Name] = tb
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tb *CatalogTable) setOption(opt *tidb.TableOption) {
+	switch opt.Tp {
+	case tidb.TableOptionEngine:
+		tb.Engine = opt.StrValue
+	case tidb.TableOptionCharset:
+		tb.Charset = opt.StrValue
+	case tidb.TableOptionCollate:
+		tb.Collation = opt.StrValue
+	case tidb.TableOptionComment:
+		tb.Comment = opt.StrValue
+	}
+}
+
+func (tb *CatalogTable) column(name string) *CatalogColumn {
+	for _, col := range tb.Columns {
+		if strings.EqualFold(col.Name, name) {
+			return col
+		}
+	}
+	return nil
+}
+
+func (tb *CatalogTable) index(name string) *CatalogIndex {
+	for _, idx := range tb.Indexes {
+		if strings.EqualFold(idx.Name, name) {
+			return idx
+		}
+	}
+	return nil
+}
+
+// newColumn 根据列定义生成列信息，列定义中的主键、唯一键、外键约束以 Constraint 的形式返回
+func (tb *CatalogTable) newColumn(def *tidb.ColumnDef) (*CatalogColumn, []*tidb.Constraint) {
+	col := &CatalogColumn{
+		Name: def.Name.Name.O,
+		Type: def.Tp.InfoSchemaStr(),
+	}
+	key := []*tidb.IndexPartSpecification{{Column: def.Name}}
+	var cons []*tidb.Constraint
+	var options []*tidb.ColumnOption
+	for _, opt := range def.Options {
+		switch opt.Tp {
+		case tidb.ColumnOptionPrimaryKey:
+			cons = append(cons, &tidb.Constraint{Tp: tidb.ConstraintPrimaryKey, Keys: key})
+			continue
+		case tidb.ColumnOptionUniqKey:
+			cons = append(cons, &tidb.Constraint{Tp: tidb.ConstraintUniq, Keys: key})
+			continue
+		case tidb.ColumnOptionReference:
+			cons = append(cons, &tidb.Constraint{Tp: tidb.ConstraintForeignKey, Keys: key, Refer: opt.Refer})
+			continue
+		case tidb.ColumnOptionNotNull:
+			col.NotNull = true
+		case tidb.ColumnOptionNull:
+			col.NotNull = false
+		case tidb.ColumnOptionAutoIncrement:
+			col.Extra = "auto_increment"
+		case tidb.ColumnOptionDefaultValue:
+			col.Default = exprValue(opt.Expr)
+		case tidb.ColumnOptionOnUpdate:
+			col.Extra = "on update " + string(exprValue(opt.Expr))
+		case tidb.ColumnOptionComment:
+			col.Comment = string(exprValue(opt.Expr))
+		case tidb.ColumnOptionCollate:
+			col.Collation = opt.StrValue
+		case tidb.ColumnOptionGenerated:
+			if opt.Stored {
+				col.Extra = "STORED GENERATED"
+			} else {
+				col.Extra = "VIRTUAL GENERATED"
+			}
+		}
+		options = append(options, opt)
+	}
+
+	// 只有字符类型的列才有字符集，未指定时与表一致
+	if (types.IsTypeChar(def.Tp.Tp) || types.IsTypeBlob(def.Tp.Tp) || def.Tp.Tp == tmysql.TypeVarString ||
+		def.Tp.Tp == tmysql.TypeEnum || def.Tp.Tp == tmysql.TypeSet) &&
+		def.Tp.Charset != charset.CharsetBin {
+		if col.Collation == "" {
+			col.Collation = def.Tp.Collate
+		}
+		col.Charset = def.Tp.Charset
+		if col.Charset == "" && col.Collation == "" {
+			col.Charset, col.Collation = tb.Charset, tb.Collation
+		}
+		col.Charset, col.Collation = completeCharset(col.Charset, col.Collation)
+	}
+
+	col.def = restore(&tidb.ColumnDef{Name: def.Name, Tp: def.Tp, Options: options})
+	return col, cons
+}
+
+func (tb *CatalogTable) addColumn(def *tidb.ColumnDef, pos *tidb.ColumnPosition) error {
+	col, cons := tb.newColumn(def)
+	if tb.column(col.Name) != nil {
+		return &mysql.MySQLError{Number: 1060, Message: fmt.Sprintf("Duplicate column name '%s'", col.Name)}
+	}
+	tb.insertColumn(col, pos)
+	for _, c := range cons {
+		if err := tb.addConstraint(c, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tb *CatalogTable) insertColumn(col *CatalogColumn, pos *tidb.ColumnPosition) {
+	i := len(tb.Columns)
+	if pos != nil {
+		switch pos.Tp {
+		case tidb.ColumnPositionFirst:
+			i = 0
+		case tidb.ColumnPositionAfter:
+			for j, c := range tb.Columns {
+				if strings.EqualFold(c.Name, pos.RelativeColumn.Name.O) {
+					i = j + 1
+				}
+			}
+		}
+	}
+	tb.Columns = append(tb.Columns, nil)
+	copy(tb.Columns[i+1:], tb.Columns[i:])
+	tb.Columns[i] = col
+}
+
+func (tb *CatalogTable) changeColumn(old string, def *tidb.ColumnDef, pos *tidb.ColumnPosition) error {
+	for i, col := range tb.Columns {
+		if !strings.EqualFold(col.Name, old) {
+			continue
+		}
+		newCol, cons := tb.newColumn(def)
+		if !strings.EqualFold(old, newCol.Name) && tb.column(newCol.Name) != nil {
+			return &mysql.MySQLError{Number: 1060, Message: fmt.Sprintf("Duplicate column name '%s'", newCol.Name)}
+		}
+		tb.renameIndexColumn(col.Name, newCol.Name)
+		if pos == nil || pos.Tp == tidb.ColumnPositionNone {
+			tb.Columns[i] = newCol
+		} else {
+			tb.Columns = append(tb.Columns[:i], tb.Columns[i+1:]...)
+			tb.insertColumn(newCol, pos)
+		}
+		for _, c := range cons {
+			if err := tb.addConstraint(c, ""); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errUnknownColumn(old, tb.Name)
+}
+
+func (tb *CatalogTable) dropColumn(name string, ifExists bool) error {
+	for i, col := range tb.Columns {
+		if !strings.EqualFold(col.Name, name) {
+			continue
+		}
+		tb.Columns = append(tb.Columns[:i], tb.Columns[i+1:]...)
+		// 删除列的同时从索引中删除该列，索引中不再包含任何列时删除索引
+		var indexes []*CatalogIndex
+		for _, idx := range tb.Indexes {
+			var cols []CatalogIndexColumn
+			for _, c := range idx.Columns {
+				if !strings.EqualFold(c.Name, name) {
+					cols = append(cols, c)
+				}
+			}
+			if len(cols) > 0 {
+				idx.Columns = cols
+				indexes = append(indexes, idx)
+			}
+		}
+		tb.Indexes = indexes
+		return nil
+	}
+	if ifExists {
+		return nil
+	}
+	return errCantDrop(name)
+}
+
+func (tb *CatalogTable) renameIndexColumn(old, name string) {
+	for _, idx := range tb.Indexes {
+		for i := range idx.Columns {
+			if strings.EqualFold(idx.Columns[i].Name, old) {
+				idx.Columns[i].Name = name
+			}
+		}
+	}
+}
+
+func (tb *CatalogTable) addConstraint(cons *tidb.Constraint, db string) error {
+	idx := &CatalogIndex{Name: cons.Name, Type: "BTREE"}
+	switch cons.Tp {
+	case tidb.ConstraintPrimaryKey:
+		idx.Name, idx.Unique = "PRIMARY", true
+		if tb.index("PRIMARY") != nil {
+			return &mysql.MySQLError{Number: 1068, Message: "Multiple primary key defined"}
+		}
+		// 主键列隐含 NOT NULL
+		for _, key := range cons.Keys {
+			if key.Column != nil {
+				if col := tb.column(key.Column.Name.O); col != nil {
+					col.NotNull = true
+				}
+			}
+		}
+	case tidb.ConstraintKey, tidb.ConstraintIndex:
+	case tidb.ConstraintUniq, tidb.ConstraintUniqKey, tidb.ConstraintUniqIndex:
+		idx.Unique = true
+	case tidb.ConstraintFulltext:
+		idx.Type = "FULLTEXT"
+	case tidb.ConstraintForeignKey:
+		fk := &CatalogForeignKey{Name: cons.Name, RefDB: db}
+		if fk.Name == "" {
+			fk.Name = fmt.Sprintf("%s_ibfk_%d", tb.Name, len(tb.ForeignKeys)+1)
+		}
+		for _, key := range cons.Keys {
+			fk.Columns = append(fk.Columns, key.Column.Name.O)
+		}
+		if cons.Refer != nil {
+			if cons.Refer.Table.Schema.O != "" {
+				fk.RefDB = cons.Refer.Table.Schema.O
+			}
+			fk.RefTable = cons.Refer.Table.Name.O
+			for _, key := range cons.Refer.IndexPartSpecifications {
+				if key.Column != nil {
+					fk.RefColumns = append(fk.RefColumns, key.Column.Name.O)
+				}
+			}
+		}
+		tb.ForeignKeys = append(tb.ForeignKeys, fk)
+		// 外键列上没有索引时 MySQL 会自动添加索引
+		if len(fk.Columns) > 0 && !tb.hasIndexPrefix(fk.Columns) {
+			idx.Name = cons.Name
+			return tb.addIndex(idx, cons.Keys, nil, false)
+		}
+		return nil
+	default:
+		// CHECK 等约束与索引无关
+		return nil
+	}
+	return tb.addIndex(idx, cons.Keys, cons.Option, cons.IfNotExists)
+}
+
+// hasIndexPrefix 判断是否已经存在以 cols 为前缀的索引
+func (tb *CatalogTable) hasIndexPrefix(cols []string) bool {
+	for _, idx := range tb.Indexes {
+		if len(idx.Columns) < len(cols) {
+			continue
+		}
+		match := true
+		for i, col := range cols {
+			if !strings.EqualFold(idx.Columns[i].Name, col) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+func (tb *CatalogTable) addIndex(idx *CatalogIndex, keys []*tidb.IndexPartSpecification, opt *tidb.IndexOption, ifNotExists bool) error {
+	for _, key := range keys {
+		col := CatalogIndexColumn{SubPart: key.Length}
+		if key.Expr != nil {
+			col.Expr = restore(key.Expr)
+		} else {
+			col.Name = key.Column.Name.O
+			if tb.column(col.Name) == nil {
+				return &mysql.MySQLError{Number: 1072, Message: fmt.Sprintf("Key column '%s' doesn't exist in table", col.Name)}
+			}
+		}
+		idx.Columns = append(idx.Columns, col)
+	}
+	if opt != nil {
+		idx.Comment = opt.Comment
+		if opt.Tp != 0 {
+			idx.Type = strings.ToUpper(opt.Tp.String())
+		}
+	}
+
+	// 未指定索引名称时与 MySQL 一致使用第一列的列名，重名时添加 _2, _3 后缀
+	if idx.Name == "" {
+		base := "functional_index"
+		if len(idx.Columns) > 0 && idx.Columns[0].Name != "" {
+			base = idx.Columns[0].Name
+		}
+		idx.Name = base
+		for i := 2; tb.index(idx.Name) != nil; i++ {
+			idx.Name = fmt.Sprintf("%s_%d", base, i)
+		}
+	}
+
+	if tb.index(idx.Name) != nil {
+		if ifNotExists {
+			return nil
+		}
+		return errDupKey(idx.Name)
+	}
+
+	// 主键排在所有索引之前
+	if idx.Name == "PRIMARY" {
+		tb.Indexes = append([]*CatalogIndex{idx}, tb.Indexes...)
+	} else {
+		tb.Indexes = append(tb.Indexes, idx)
+	}
+	return nil
+}
+
+func (tb *CatalogTable) dropIndex(name string, ifExists bool) error {
+	for i, idx := range tb.Indexes {
+		if strings.EqualFold(idx.Name, name) {
+			tb.Indexes = append(tb.Indexes[:i], tb.Indexes[i+1:]...)
+			return nil
+		}
+	}
+	if ifExists {
+		return nil
+	}
+	return errCantDrop(name)
+}
+
+// lookup 获取库表结构，db 为空时使用默认数据库
+// 在指定库中找不到该表时，如果其他库中只存在唯一的同名表则返回该表
+func (c *Catalog) lookup(db, name string) *CatalogTable {
+	if db == "" {
+		db = c.Database
+	}
+	if d, ok := c.DBs[db]; ok {
+		if tb, ok := d.Tables[name]; ok {
+			return tb
+		}
+	}
+	var found *CatalogTable
+	for _, d := range c.DBs {
+		if tb, ok := d.Tables[name]; ok {
+			if found != nil {
+				return nil
+			}
+			found = tb
+		}
+	}
+	return found
+}
+
+// showTable 获取库表结构，表不存在时返回与 MySQL 一致的错误
+func (c *Catalog) showTable(db, name string) (*CatalogTable, error) {
+	tb := c.lookup(db, name)
+	if tb == nil {
+		return nil, &mysql.MySQLError{Number: 1146, Message: fmt.Sprintf("Table '%s.%s' doesn't exist", db, name)}
+	}
+	return tb, nil
+}
+
+// ShowTables 获取数据库中所有的表名，与 show tables 一致包含视图
+func (c *Catalog) ShowTables(db string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if db == "" {
+		db = c.Database
+	}
+	var tables []string
+	if d, ok := c.DBs[db]; ok {
+		tables = common.SortedKey(d.Tables)
+	}
+	return tables
+}
+
+// IsView 判断表是否是视图
+func (c *Catalog) IsView(db, name string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	tb := c.lookup(db, name)
+	return tb != nil && tb.View != ""
+}
+
+// ShowColumns 与 show full columns 的输出一致
+func (c *Catalog) ShowColumns(db, name string) (*database.TableDesc, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	tb, err := c.showTable(db, name)
+	if err != nil {
+		return nil, err
+	}
+
+	desc := database.NewTableDesc(tb.Name)
+	for _, col := range tb.Columns {
+		value := database.TableDescValue{
+			Field:      col.Name,
+			Type:       col.Type,
+			Null:       "YES",
+			Key:        tb.columnKey(col.Name),
+			Default:    col.Default,
+			Extra:      col.Extra,
+			Privileges: "select,insert,update,references",
+			Comment:    col.Comment,
+		}
+		if col.Collation != "" {
+			value.Collation = []byte(col.Collation)
+		}
+		if col.NotNull {
+			value.Null = "NO"
+		}
+		desc.DescValues = append(desc.DescValues, value)
+	}
+	return desc, nil
+}
+
+// columnKey 获取 show columns 中 Key 字段的值：PRI, UNI, MUL
+func (tb *CatalogTable) columnKey(name string) string {
+	key := ""
+	for _, idx := range tb.Indexes {
+		for i, col := range idx.Columns {
+			if !strings.EqualFold(col.Name, name) {
+				continue
+			}
+			switch {
+			case idx.Name == "PRIMARY":
+				return "PRI"
+			case i > 0:
+			case idx.Unique && len(idx.Columns) == 1:
+				key = "UNI"
+			case key == "":
+				key = "MUL"
+			}
+		}
+	}
+	return key
+}
+
+// ShowIndex 与 show index 的输出一致，离线数据字典中没有数据，Cardinality 均为 0
+func (c *Catalog) ShowIndex(db, name string) (*database.TableIndexInfo, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	tb, err := c.showTable(db, name)
+	if err != nil {
+		return nil, err
+	}
+
+	info := database.NewTableIndexInfo(tb.Name)
+	for _, idx := range tb.Indexes {
+		for i, col := range idx.Columns {
+			row := database.TableIndexRow{
+				Table:        tb.Name,
+				NonUnique:    1,
+				KeyName:      idx.Name,
+				SeqInIndex:   i + 1,
+				ColumnName:   col.Name,
+				Collation:    "A",
+				SubPart:      col.SubPart,
+				IndexType:    idx.Type,
+				IndexComment: idx.Comment,
+				Visible:      "YES",
+			}
+			if idx.Unique {
+				row.NonUnique = 0
+			}
+			if col.Expr != "" {
+				row.Expression = []byte(col.Expr)
+			}
+			if column := tb.column(col.Name); column != nil && !column.NotNull {
+				row.Null = "YES"
+			}
+			info.Rows = append(info.Rows, row)
+		}
+	}
+	return info, nil
+}
+
+// ShowCreateTable 生成建表语句，与 Connector.ShowCreateTable 一致不包含外键约束
+func (c *Catalog) ShowCreateTable(db, name string) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	tb, err := c.showTable(db, name)
+	if err != nil {
+		return "", err
+	}
+	if tb.View != "" {
+		return tb.View, nil
+	}
+
+	var defs []string
+	for _, col := range tb.Columns {
+		defs = append(defs, "  "+col.def)
+	}
+	for _, idx := range tb.Indexes {
+		var cols []string
+		for _, part := range idx.Columns {
+			col := quote(part.Name)
+			if part.Expr != "" {
+				col = "(" + part.Expr + ")"
+			}
+			if part.SubPart > 0 {
+				col += fmt.Sprintf("(%d)", part.SubPart)
+			}
+			cols = append(cols, col)
+		}
+		var def string
+		switch {
+		case idx.Name == "PRIMARY":
+			def = "PRIMARY KEY"
+		case idx.Unique:
+			def = "UNIQUE KEY " + quote(idx.Name)
+		case idx.Type == "FULLTEXT", idx.Type == "SPATIAL":
+			def = idx.Type + " KEY " + quote(idx.Name)
+		default:
+			def = "KEY " + quote(idx.Name)
+		}
+		def += " (" + strings.Join(cols, ",") + ")"
+		if idx.Comment != "" {
+			def += fmt.Sprintf(" COMMENT '%s'", database.Escape(idx.Comment, false))
+		}
+		defs = append(defs, "  "+def)
+	}
+	ddl := fmt.Sprintf("CREATE TABLE %s (\n%s\n)", quote(tb.Name), strings.Join(defs, ",\n"))
+	if tb.options != "" {
+		ddl += " " + tb.options
+	}
+	return ddl, nil
+}
+
+// FindColumn 与 Connector.FindColumn 一致，查找指定库表中名为 name 的列，db 为空时查找所有库
+func (c *Catalog) FindColumn(name, db string, tables ...string) []*common.Column {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var candidates []*CatalogTable
+	if len(tables) > 0 {
+		for _, tb := range tables {
+			if t := c.lookup(db, tb); t != nil {
+				candidates = append(candidates, t)
+			}
+		}
+	} else {
+		for _, dbName := range common.SortedKey(c.DBs) {
+			if db != "" && db != dbName {
+				continue
+			}
+			for _, tb := range common.SortedKey(c.DBs[dbName].Tables) {
+				candidates = append(candidates, c.DBs[dbName].Tables[tb])
+			}
+		}
+	}
+
+	var columns []*common.Column
+	for _, tb := range candidates {
+		if col := tb.column(name); col != nil {
+			columns = append(columns, &common.Column{
+				Name:      name,
+				Table:     tb.Name,
+				DB:        tb.DB,
+				DataType:  col.Type,
+				Character: col.Charset,
+				Collation: col.Collation,
+			})
+		}
+	}
+	return columns
+}
+
+// IsForeignKey 判断列是否是外键
+func (c *Catalog) IsForeignKey(db, name, column string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	tb := c.lookup(db, name)
+	if tb == nil {
+		return false
+	}
+	for _, fk := range tb.ForeignKeys {
+		for _, col := range fk.Columns {
+			if strings.EqualFold(col, column) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ShowReference 查找所有的外键信息
+func (c *Catalog) ShowReference(db string, tables ...string) []database.ReferenceValue {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if db == "" {
+		db = c.Database
+	}
+	d, ok := c.DBs[db]
+	if !ok {
+		return nil
+	}
+	if len(tables) == 0 {
+		tables = common.SortedKey(d.Tables)
+	}
+	var references []database.ReferenceValue
+	for _, name := range tables {
+		tb, ok := d.Tables[name]
+		if !ok {
+			continue
+		}
+		for _, fk := range tb.ForeignKeys {
+			references = append(references, database.ReferenceValue{
+				ReferencedTableSchema: fk.RefDB,
+				ReferencedTableName:   fk.RefTable,
+				TableSchema:           db,
+				TableName:             tb.Name,
+				ConstraintName:        fk.Name,
+				Columns:               fk.Columns,
+				ReferencedColumns:     fk.RefColumns,
+			})
+		}
+	}
+	return references
+}
+
+// completeCharset 根据字符集补全默认排序规则，根据排序规则补全字符集
+func completeCharset(cs, co string) (string, string) {
+	if co == "" && cs != "" {
+		co, _ = charset.GetDefaultCollation(strings.ToLower(cs))
+	}
+	if cs == "" && co != "" {
+		// 与 FindColumn 一致，按照 MySQL 中 collation 的命名规则截取 character
+		cs = strings.Split(co, "_")[0]
+	}
+	return cs, co
+}
+
+// exprValue 获取默认值等表达式的值，NULL 返回 nil
+func exprValue(expr tidb.ExprNode) []byte {
+	switch e := expr.(type) {
+	case tidb.ValueExpr:
+		if e.GetValue() == nil {
+			return nil
+		}
+		return []byte(fmt.Sprint(e.GetValue()))
+	case *tidb.FuncCallExpr:
+		// CURRENT_TIMESTAMP
+		if len(e.Args) == 0 {
+			return []byte(strings.ToUpper(e.FnName.O))
+		}
+	}
+	return []byte(restore(expr))
+}
+
+// restore 将 TiDB 语法树还原为 SQL
+func restore(node interface {
+	Restore(ctx *format.RestoreCtx) error
+}) string {
+	var sb strings.Builder
+	if err := node.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, &sb)); err != nil {
+		common.Log.Warning("restore error: %v", err)
+	}
+	return sb.String()
+}
+
+func quote(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+func errTableExists(name string) error {
+	return &mysql.MySQLError{Number: 1050, Message: fmt.Sprintf("Table '%s' already exists", name)}
+}
+
+func errDupKey(name string) error {
+	return &mysql.MySQLError{Number: 1061, Message: fmt.Sprintf("Duplicate key name '%s'", name)}
+}
+
+func errCantDrop(name string) error {
+	return &mysql.MySQLError{Number: 1091, Message: fmt.Sprintf("Can't DROP '%s'; check that column/key exists", name)}
+}
+
+func errUnknownColumn(col, table string) error {
+	return &mysql.MySQLError{Number: 1054, Message: fmt.Sprintf("Unknown column '%s' in '%s'", col, table)}
+}
+
+// Offline 是否使用离线数据字典代替测试环境
+func (vEnv *VirtualEnv) Offline() bool {
+	return vEnv != nil && vEnv.Catalog != nil
+}
+
+// buildCatalog 使用离线数据字典时 DDL 在数据字典中执行，其他语句不需要准备环境
+func (vEnv *VirtualEnv) buildCatalog(rEnv *database.Connector, SQLs ...string) bool {
+	for _, sql := range SQLs {
+		stmt, err := sqlparser.Parse(sql)
+		if err == nil {
+			if use, ok := stmt.(*sqlparser.Use); ok {
+				rEnv.Database = use.DBName.String()
+				return true
+			}
+		}
+		err = vEnv.Catalog.Exec(vEnv.Database, sql)
+		if err != nil {
+			if _, ok := err.(*mysql.MySQLError); ok {
+				// 重复建表、重复索引等错误反馈到上一层输出建议
+				vEnv.Error = err
+				return true
+			}
+			common.Log.Warning("BuildVirtualEnv Catalog Exec Error : %v", err)
+		}
+	}
+	return true
+}
+
+// ShowColumns 获取表中所有的列，使用离线数据字典时从数据字典中获取
+func (vEnv *VirtualEnv) ShowColumns(tableName string) (*database.TableDesc, error) {
+	if vEnv.Offline() {
+		return vEnv.Catalog.ShowColumns(vEnv.Database, tableName)
+	}
+	return vEnv.Connector.ShowColumns(tableName)
+}
+
+// ShowIndex 获取表中所有的索引，使用离线数据字典时从数据字典中获取
+func (vEnv *VirtualEnv) ShowIndex(tableName string) (*database.TableIndexInfo, error) {
+	if vEnv.Offline() {
+		return vEnv.Catalog.ShowIndex(vEnv.Database, tableName)
+	}
+	return vEnv.Connector.ShowIndex(tableName)
+}
+
+// ShowCreateTable 获取建表语句，使用离线数据字典时从数据字典中生成
+func (vEnv *VirtualEnv) ShowCreateTable(tableName string) (string, error) {
+	if vEnv.Offline() {
+		return vEnv.Catalog.ShowCreateTable(vEnv.Database, tableName)
+	}
+	return vEnv.Connector.ShowCreateTable(tableName)
+}
+
+// ShowTables 获取当前数据库中所有的表，使用离线数据字典时从数据字典中获取
+func (vEnv *VirtualEnv) ShowTables() ([]string, error) {
+	if vEnv.Offline() {
+		return vEnv.Catalog.ShowTables(vEnv.Database), nil
+	}
+	return vEnv.Connector.ShowTables()
+}
+
+// FindColumn 查找列的库表及类型信息，使用离线数据字典时从数据字典中获取
+func (vEnv *VirtualEnv) FindColumn(name, dbName string, tables ...string) ([]*common.Column, error) {
+	if vEnv.Offline() {
+		return vEnv.Catalog.FindColumn(name, dbName, tables...), nil
+	}
+	return vEnv.Connector.FindColumn(name, dbName, tables...)
+}
+
+// IsView 判断表是否是视图，使用离线数据字典时从数据字典中获取
+func (vEnv *VirtualEnv) IsView(tbName string) bool {
+	if vEnv.Offline() {
+		return vEnv.Catalog.IsView(vEnv.Database, tbName)
+	}
+	return vEnv.Connector.IsView(tbName)
+}
+
+// IsForeignKey 判断列是否是外键，使用离线数据字典时从数据字典中获取
+func (vEnv *VirtualEnv) IsForeignKey(dbName, tbName, column string) bool {
+	if vEnv.Offline() {
+		return vEnv.Catalog.IsForeignKey(dbName, tbName, column)
+	}
+	return vEnv.Connector.IsForeignKey(dbName, tbName, column)
+}
+
+// ShowReference 查找所有的外键信息，使用离线数据字典时从数据字典中获取
+func (vEnv *VirtualEnv) ShowReference(dbName string, tbName ...string) ([]database.ReferenceValue, error) {
+	if vEnv.Offline() {
+		return vEnv.Catalog.ShowReference(dbName, tbName...), nil
+	}
+	return vEnv.Connector.ShowReference(dbName, tbName...)
+}
+
+// ColumnCardinality 粒度计算，优先使用线上环境快照中的散粒度
+// 离线数据字典中没有数据，与空表一致散粒度为 1
+func (vEnv *VirtualEnv) ColumnCardinality(tb, col string) float64 {
+	if c, ok := vEnv.OnlineSnapshot.Cardinality(vEnv.RealDB(vEnv.Database), tb, col); ok {
+		return c
+	}
+	if vEnv.Offline() {
+		return 1
+	}
+	return vEnv.Connector.ColumnCardinality(tb, col)
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const catalogDump = `
+-- MySQL dump 10.13
+/*!40101 SET NAMES utf8mb4 */;
+CREATE DATABASE /*!32312 IF NOT EXISTS*/ ` + "`sakila`" + ` /*!40100 DEFAULT CHARACTER SET utf8mb4 */;
+USE ` + "`sakila`" + `;
+DROP TABLE IF EXISTS ` + "`language`" + `;
+CREATE TABLE ` + "`language`" + ` (
+  ` + "`language_id`" + ` tinyint(3) unsigned NOT NULL AUTO_INCREMENT,
+  ` + "`name`" + ` char(20) NOT NULL,
+  PRIMARY KEY (` + "`language_id`" + `)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE TABLE ` + "`film`" + ` (
+  ` + "`film_id`" + ` smallint(5) unsigned NOT NULL AUTO_INCREMENT,
+  ` + "`title`" + ` varchar(255) NOT NULL,
+  ` + "`description`" + ` text,
+  ` + "`language_id`" + ` tinyint(3) unsigned NOT NULL,
+  PRIMARY KEY (` + "`film_id`" + `),
+  KEY ` + "`idx_title`" + ` (` + "`title`" + `),
+  CONSTRAINT ` + "`fk_film_language`" + ` FOREIGN KEY (` + "`language_id`" + `) REFERENCES ` + "`language`" + ` (` + "`language_id`" + `)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+DELIMITER ;;
+/*!50003 CREATE*/ /*!50003 TRIGGER ` + "`ins_film`" + ` AFTER INSERT ON ` + "`film`" + ` FOR EACH ROW BEGIN
+    INSERT INTO film_text (film_id, title) VALUES (new.film_id, new.title);
+  END */;;
+DELIMITER ;
+/*!50001 CREATE VIEW ` + "`film_list`" + ` AS select ` + "`film`.`film_id`" + ` AS ` + "`FID`" + ` from ` + "`film`" + ` */;
+`
+
+func TestCatalogLoad(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	c := NewCatalog("test")
+	c.Load(catalogDump)
+
+	tables := c.ShowTables("sakila")
+	if strings.Join(tables, ",") != "film,film_list,language" {
+		t.Errorf("ShowTables want film,film_list,language, got %v", tables)
+	}
+	if !c.IsView("sakila", "film_list") || c.IsView("sakila", "film") {
+		t.Error("IsView film_list should be view, film should not")
+	}
+	if !c.IsForeignKey("sakila", "film", "language_id") || c.IsForeignKey("sakila", "film", "title") {
+		t.Error("IsForeignKey film.language_id should be foreign key, film.title should not")
+	}
+
+	desc, err := c.ShowColumns("sakila", "film")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make(map[string]string)
+	for _, col := range desc.DescValues {
+		keys[col.Field] = col.Type + " " + col.Null + " " + col.Key
+	}
+	for col, want := range map[string]string{
+		"film_id":     "smallint(5) unsigned NO PRI",
+		"title":       "varchar(255) NO MUL",
+		"description": "text YES ",
+		"language_id": "tinyint(3) unsigned NO MUL",
+	} {
+		if keys[col] != want {
+			t.Errorf("ShowColumns film.%s want %q, got %q", col, want, keys[col])
+		}
+	}
+
+	idx, err := c.ShowIndex("sakila", "film")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, row := range idx.Rows {
+		names = append(names, row.KeyName)
+	}
+	if strings.Join(names, ",") != "PRIMARY,idx_title,fk_film_language" {
+		t.Errorf("ShowIndex film got %v", names)
+	}
+
+	cols := c.FindColumn("title", "sakila", "film")
+	if len(cols) != 1 || cols[0].DataType != "varchar(255)" {
+		t.Errorf("FindColumn film.title got %v", cols)
+	}
+
+	create, err := c.ShowCreateTable("sakila", "language")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(create, "CREATE TABLE `language` (") || !strings.Contains(create, "PRIMARY KEY (`language_id`)") {
+		t.Errorf("ShowCreateTable language got %s", create)
+	}
+
+	if _, err = c.ShowColumns("sakila", "not_exist"); err == nil {
+		t.Error("ShowColumns not_exist table should return error")
+	}
+}
+
+func TestCatalogExec(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	c := NewCatalog("test")
+	c.Load(catalogDump)
+
+	cases := []struct {
+		sql    string
+		number uint16 // 0 表示执行成功
+	}{
+		{"alter table film add index idx_title(title)", 1061},
+		{"alter table film add column c1 int, add index (c1)", 0},
+		{"alter table film drop column c1", 0},
+		{"alter table film drop index c1", 1091},
+		{"create table language(id int)", 1050},
+		{"create index idx_name on language(name(10))", 0},
+		{"alter table not_exist add column c1 int", 1146},
+	}
+	for _, tc := range cases {
+		err := c.Exec("sakila", tc.sql)
+		switch e := err.(type) {
+		case nil:
+			if tc.number != 0 {
+				t.Errorf("%s want error %d, got nil", tc.sql, tc.number)
+			}
+		case *mysql.MySQLError:
+			if e.Number != tc.number {
+				t.Errorf("%s want error %d, got %v", tc.sql, tc.number, e)
+			}
+		default:
+			t.Errorf("%s got unexpected error %v", tc.sql, err)
+		}
+	}
+
+	idx, err := c.ShowIndex("sakila", "language")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Rows) != 2 || idx.Rows[1].KeyName != "idx_name" || idx.Rows[1].SubPart != 10 {
+		t.Errorf("ShowIndex language got %v", idx.Rows)
+	}
+	if len(c.FindColumn("c1", "sakila", "film")) != 0 {
+		t.Error("film.c1 should be dropped")
+	}
+}
+
+func TestLoadCatalog(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	file := filepath.Join("testdata", "schema", "film.sql")
+	// 未包含 USE 语句的建表语句使用指定的默认数据库
+	c, err := LoadCatalog("sakila", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tables := c.ShowTables("sakila"); strings.Join(tables, ",") != "film" {
+		t.Errorf("ShowTables sakila want film, got %v", tables)
+	}
+	if len(c.ShowTables("information_schema")) != 0 {
+		t.Error("film should not be created in information_schema")
+	}
+
+	// 未指定默认数据库时返回错误
+	if _, err = LoadCatalog("", file); err == nil {
+		t.Error("LoadCatalog without database should return error")
+	}
+
+	orgOnline, orgTest := common.Config.OnlineDSN, common.Config.TestDSN
+	common.Config.OnlineDSN = &common.Dsn{Schema: "information_schema"}
+	common.Config.TestDSN = &common.Dsn{Schema: "sakila"}
+	if db := catalogDatabase(); db != "sakila" {
+		t.Errorf("catalogDatabase want sakila, got %s", db)
+	}
+	common.Config.TestDSN = &common.Dsn{Schema: "information_schema"}
+	if db := catalogDatabase(); db != "" {
+		t.Errorf("catalogDatabase want empty, got %s", db)
+	}
+	common.Config.OnlineDSN, common.Config.TestDSN = orgOnline, orgTest
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
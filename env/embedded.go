@@ -0,0 +1,104 @@
+//go:build embedded
+// +build embedded
+
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/XiaoMi/soar/common"
+
+	"github.com/pingcap/tidb/config"
+	"github.com/pingcap/tidb/server"
+	"github.com/pingcap/tidb/session"
+	"github.com/pingcap/tidb/store/mockstore"
+	"github.com/pingcap/tidb/util/logutil"
+)
+
+var embedded struct {
+	once sync.Once
+	addr string
+	err  error
+}
+
+// startEmbedded 在进程内启动基于 mockstore 的 TiDB 作为测试环境，不依赖外部 MySQL
+// 启动成功后将监听地址等连接信息回填到 dsn 中，同一进程中只启动一次
+func startEmbedded(dsn *common.Dsn) error {
+	embedded.once.Do(func() {
+		embedded.addr, embedded.err = runEmbedded()
+	})
+	if embedded.err != nil {
+		return embedded.err
+	}
+	dsn.Net = "tcp"
+	dsn.Addr = embedded.addr
+	dsn.User = "root"
+	dsn.Password = ""
+	return nil
+}
+
+func runEmbedded() (string, error) {
+	// TiDB 不支持监听 0 端口，先申请一个空闲端口
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	if err = l.Close(); err != nil {
+		return "", err
+	}
+
+	cfg := config.NewConfig()
+	cfg.Host = "127.0.0.1"
+	cfg.Port = uint(port)
+	cfg.Socket = ""
+	cfg.Status.ReportStatus = false
+	cfg.Log.Level = "fatal"
+	config.StoreGlobalConfig(cfg)
+	// TiDB 日志与 SOAR 日志分开，只保留致命错误
+	err = logutil.InitLogger(logutil.NewLogConfig(cfg.Log.Level, cfg.Log.Format, "", cfg.Log.File, false))
+	if err != nil {
+		return "", err
+	}
+
+	store, err := mockstore.NewMockStore()
+	if err != nil {
+		return "", err
+	}
+	session.SetSchemaLease(0)
+	session.SetStatsLease(0)
+	dom, err := session.BootstrapSession(store)
+	if err != nil {
+		return "", err
+	}
+	svr, err := server.NewServer(cfg, server.NewTiDBDriver(store))
+	if err != nil {
+		return "", err
+	}
+	svr.SetDomain(dom)
+	go func() {
+		common.LogIfError(svr.Run(), "embedded TiDB server")
+	}()
+
+	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	common.Log.Info("embedded TiDB server is running on %s", addr)
+	return addr, nil
+}
@@ -0,0 +1,31 @@
+//go:build !embedded
+// +build !embedded
+
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"errors"
+
+	"github.com/XiaoMi/soar/common"
+)
+
+// startEmbedded 未使用 embedded 编译标签时不包含 TiDB 服务端代码，需通过 make build-embedded 编译
+func startEmbedded(dsn *common.Dsn) error {
+	return errors.New("embedded TiDB is not supported in this build, rebuild soar with `make build-embedded`")
+}
@@ -19,6 +19,7 @@ package env
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/XiaoMi/soar/ast"
@@ -26,6 +27,7 @@ import (
 	"github.com/XiaoMi/soar/database"
 
 	"github.com/dchest/uniuri"
+	tidb "github.com/pingcap/parser/ast"
 	"vitess.io/vitess/go/vt/sqlparser"
 )
 
@@ -41,6 +43,21 @@ type VirtualEnv struct {
 	TableMap map[string]map[string]string
 	// 错误
 	Error error
+	// 离线数据字典，测试环境不可用时由 -schema 指定的建表语句或 -online-snapshot 指定的快照构建
+	Catalog *Catalog
+	// 线上环境快照，测试环境中没有线上数据，散粒度优先从快照中获取
+	OnlineSnapshot *database.Snapshot
+	// -fixture-dump 文件中各表 INSERT 语句的索引，构建环境时扫描一次
+	FixtureDumps *FixtureDumps
+	fixtureErr   error
+
+	// 已创建表结构但尚未完成采样的表，db.table -> 采样完成后关闭的 channel，Clone 出的环境共享
+	pending map[string]chan struct{}
+	// 本次构建环境用到的、由其他 worker 正在采样的表，构建完成前需要等待
+	waits []chan struct{}
+
+	// 保护上述映射关系，Clone 出的环境共享同一把锁
+	mu *sync.RWMutex
 }
 
 // NewVirtualEnv 初始化一个新的测试环境
@@ -50,13 +67,32 @@ func NewVirtualEnv(vEnv *database.Connector) *VirtualEnv {
 		DBRef:     make(map[string]string),
 		Hash2DB:   make(map[string]string),
 		TableMap:  make(map[string]map[string]string),
+		pending:   make(map[string]chan struct{}),
+		mu:        new(sync.RWMutex),
 	}
 }
 
+// Clone 复制测试环境，用于并发评审时每个 worker 独立使用
+// 复制出的环境使用独立的连接池，Database、Error 等状态互不影响，库表映射关系与原环境共享
+func (vEnv *VirtualEnv) Clone() *VirtualEnv {
+	c := *vEnv
+	c.Connector = vEnv.Connector.Clone()
+	c.Error = nil
+	c.waits = nil
+	return &c
+}
+
 // BuildEnv 测试环境初始化&连接线上环境检查
 // @output *VirtualEnv	测试环境
 // @output *database.Connector 线上环境连接句柄
 func BuildEnv() (*VirtualEnv, *database.Connector) {
+	// test-dsn 配置为 embedded:// 时先启动内嵌 TiDB，再按普通测试环境连接
+	if common.Config.TestDSN.Embedded && !common.Config.TestDSN.Disable {
+		if err := startEmbedded(common.Config.TestDSN); err != nil {
+			common.Log.Error("BuildEnv start embedded TiDB Error: %v", err)
+			common.Config.TestDSN.Disable = true
+		}
+	}
 	connTest, err := database.NewConnector(common.Config.TestDSN)
 	common.LogIfError(err, "")
 	// 生成测试环境
@@ -71,15 +107,29 @@ func BuildEnv() (*VirtualEnv, *database.Connector) {
 		common.Config.TestDSN.Disable = true
 	}
 
+	// 使用 -online-snapshot 指定的快照代替线上环境
+	if common.Config.OnlineSnapshot != "" {
+		vEnv.OnlineSnapshot, err = database.LoadSnapshot(common.Config.OnlineSnapshot)
+		if err != nil {
+			common.Log.Error("BuildEnv load online snapshot '%s' Error: %v", common.Config.OnlineSnapshot, err)
+		}
+	}
+
 	// 连接线上环境
 	// 如果未配置线上环境线测试环境配置为线上环境
-	if common.Config.OnlineDSN.User == "" {
+	if common.Config.OnlineDSN.User == "" && vEnv.OnlineSnapshot == nil {
 		common.Log.Warn("BuildEnv AllowOnlineAsTest: OnlineDSN not config, use TestDSN： %s:********@%s/%s as OnlineDSN",
 			vEnv.User, vEnv.Addr, vEnv.Database)
 		common.Config.OnlineDSN = common.Config.TestDSN
 	}
 	connOnline, err := database.NewConnector(common.Config.OnlineDSN)
 	common.LogIfError(err, "")
+	if vEnv.OnlineSnapshot != nil {
+		connOnline.Snapshot = vEnv.OnlineSnapshot
+		connOnline.Addr = vEnv.OnlineSnapshot.Addr
+		connOnline.Database = vEnv.OnlineSnapshot.Database
+		common.Config.OnlineDSN.Disable = false
+	}
 
 	// 检查线上环境可用性版本
 	rEnvVersion, err := connOnline.Version()
@@ -90,9 +140,9 @@ func BuildEnv() (*VirtualEnv, *database.Connector) {
 		common.Config.TestDSN.Disable = true
 	}
 
-	// 检查是否允许 Online 和 Test 一致，防止误操作
+	// 检查是否允许 Online 和 Test 一致，防止误操作，内嵌 TiDB 及线上环境快照不需要检查
 	if common.FormatDSN(common.Config.OnlineDSN) == common.FormatDSN(common.Config.TestDSN) &&
-		!common.Config.AllowOnlineAsTest {
+		!common.Config.AllowOnlineAsTest && !common.Config.TestDSN.Embedded && vEnv.OnlineSnapshot == nil {
 		common.Log.Warn("BuildEnv AllowOnlineAsTest: %s:********@%s/%s OnlineDSN can't config as TestDSN",
 			vEnv.User, vEnv.Addr, vEnv.Database)
 		common.Config.TestDSN.Disable = true
@@ -105,11 +155,46 @@ func BuildEnv() (*VirtualEnv, *database.Connector) {
 		common.Config.TestDSN.Disable = true
 	}
 
+	// 测试环境不可用时，使用 -schema 指定的建表语句或快照中的建表语句构建离线数据字典代替测试环境
+	if common.Config.Schema != "" && common.Config.TestDSN.Disable {
+		vEnv.Catalog, err = LoadCatalog(catalogDatabase(), common.Config.Schema)
+		if err != nil {
+			common.Log.Error("BuildEnv load schema '%s' Error: %v", common.Config.Schema, err)
+		} else {
+			// 未指定库名的 SQL 在离线数据字典的默认数据库中评审
+			vEnv.Database = vEnv.Catalog.Database
+			if vEnv.OnlineSnapshot == nil {
+				connOnline.Database = vEnv.Catalog.Database
+			}
+		}
+	} else if vEnv.OnlineSnapshot != nil && common.Config.TestDSN.Disable {
+		vEnv.Catalog = NewCatalog(connOnline.Database)
+		vEnv.Catalog.Load(vEnv.OnlineSnapshot.DDL())
+	}
+
+	// 测试数据在建表时按表导入，mysqldump 文件只在这里扫描一次
+	if files := fixtureDumpFiles(); len(files) > 0 && !vEnv.Offline() {
+		vEnv.FixtureDumps, vEnv.fixtureErr = LoadFixtureDumps(files...)
+	}
+
 	return vEnv, connOnline
 }
 
+// catalogDatabase 离线数据字典的默认数据库，依次取 -online-dsn, -test-dsn 中指定的库名
+// information_schema 为未指定库名时的默认值，不能作为建表语句的默认数据库，都未指定时返回空
+func catalogDatabase() string {
+	for _, dsn := range []*common.Dsn{common.Config.OnlineDSN, common.Config.TestDSN} {
+		if dsn != nil && dsn.Schema != "" && !strings.EqualFold(dsn.Schema, "information_schema") {
+			return dsn.Schema
+		}
+	}
+	return ""
+}
+
 // RealDB 从测试环境中获取通过 hash 后的 DB
 func (vEnv *VirtualEnv) RealDB(hash string) string {
+	vEnv.mu.RLock()
+	defer vEnv.mu.RUnlock()
 	if _, ok := vEnv.Hash2DB[hash]; ok {
 		return vEnv.Hash2DB[hash]
 	}
@@ -122,14 +207,33 @@ func (vEnv *VirtualEnv) RealDB(hash string) string {
 
 // DBHash 从测试环境中根据 DB 找到对应的 hash 值
 func (vEnv *VirtualEnv) DBHash(db string) string {
+	vEnv.mu.RLock()
+	defer vEnv.mu.RUnlock()
+	return vEnv.dbHash(db)
+}
+
+// dbHash 与 DBHash 相同，调用方需已持有锁。RWMutex 不可重入，已持有读锁时再次加读锁，若中间有写锁在等待会死锁
+func (vEnv *VirtualEnv) dbHash(db string) string {
 	if _, ok := vEnv.DBRef[db]; ok {
 		return vEnv.DBRef[db]
 	}
 	return db
 }
 
+// AddTableMap 记录已经在测试环境中创建的表，防止重复创建
+func (vEnv *VirtualEnv) AddTableMap(db, table string) {
+	vEnv.mu.Lock()
+	defer vEnv.mu.Unlock()
+	if _, ok := vEnv.TableMap[db]; !ok {
+		vEnv.TableMap[db] = make(map[string]string)
+	}
+	vEnv.TableMap[db][table] = table
+}
+
 // CleanUp 环境清理
 func (vEnv *VirtualEnv) CleanUp() bool {
+	vEnv.mu.Lock()
+	defer vEnv.mu.Unlock()
 	if !common.Config.TestDSN.Disable && common.Config.DropTestTemporary {
 		common.Log.Debug("CleanUp ...")
 		for db := range vEnv.Hash2DB {
@@ -229,14 +333,29 @@ func CurrentDB(sql, db string) string {
 
 // BuildVirtualEnv rEnv 为 SQL 源环境，DB 使用的信息从接口获取
 // 注意：如果是 USE, DDL 等语句，执行完第一条就会返回，后面的 SQL 不会执行
+// 并发评审时只在建库建表、修改映射关系时持有写锁，数据采样在锁外进行，多个 worker 可以同时采样
+// 用到其他 worker 正在采样的表时，等待其采样完成后再返回
 func (vEnv *VirtualEnv) BuildVirtualEnv(rEnv *database.Connector, SQLs ...string) bool {
+	vEnv.waits = nil
+	ok := vEnv.buildVirtualEnv(rEnv, SQLs...)
+	for _, wait := range vEnv.waits {
+		<-wait
+	}
+	vEnv.waits = nil
+	return ok
+}
+
+func (vEnv *VirtualEnv) buildVirtualEnv(rEnv *database.Connector, SQLs ...string) bool {
 	var stmt sqlparser.Statement
 	var err error
 
 	// 置空错误信息
 	vEnv.Error = nil
+	if vEnv.Offline() {
+		return vEnv.buildCatalog(rEnv, SQLs...)
+	}
 	// 检测是否已经创建初始数据库，如果未创建则创建一个名称 hash 过的映射数据库
-	err = vEnv.createDatabase(rEnv)
+	err = vEnv.lockCreateDatabase(rEnv)
 	common.LogIfWarn(err, "")
 
 	// 测试环境检测
@@ -257,8 +376,16 @@ func (vEnv *VirtualEnv) BuildVirtualEnv(rEnv *database.Connector, SQLs ...string
 		common.Log.Debug("BuildVirtualEnv Database&TableName Mapping, SQL: %s", sql)
 		stmt, err = sqlparser.Parse(sql)
 		if err != nil {
-			common.Log.Error("BuildVirtualEnv Error : %v", err)
-			return false
+			// Vitess 无法解析的查询（CTE，窗口函数等）从 TiDB AST 中获取使用到的库表
+			tiStmt, tiErr := ast.TiParse(sql, "", "")
+			if tiErr != nil || len(tiStmt) != 1 || !isTiQuery(tiStmt[0]) {
+				common.Log.Error("BuildVirtualEnv Error : %v", err)
+				return false
+			}
+			if !vEnv.buildTables(rEnv, ast.TiGetMeta(tiStmt[0], nil)) {
+				return false
+			}
+			continue
 		}
 
 		// 语句类型判断
@@ -271,14 +398,14 @@ func (vEnv *VirtualEnv) BuildVirtualEnv(rEnv *database.Connector, SQLs ...string
 				rEnv.Database = stmt.DBName.String()
 
 				// use DB 后检查 DB是否已经创建，如果没有创建则创建DB
-				err = vEnv.createDatabase(rEnv)
+				err = vEnv.lockCreateDatabase(rEnv)
 				common.LogIfWarn(err, "")
 			}
 			return true
 		case *sqlparser.DDL:
 			// 如果是DDL，则先获取DDL对应的表结构，然后直接在测试环境接执行SQL
 			// 为不影响其他SQL操作，复制一个Connector对象，将数据库切换到对应的DB上直接执行
-			vEnv.Database = vEnv.DBRef[rEnv.Database]
+			vEnv.Database = vEnv.DBHash(rEnv.Database)
 
 			// 为了支持并发，需要将DB进行映射，但 db.table 这种形式无法保证 DB 的映射是正确的
 			// TODO：暂不支持 create db.tableName (id int) 形式的建表语句
@@ -329,60 +456,101 @@ func (vEnv *VirtualEnv) BuildVirtualEnv(rEnv *database.Connector, SQLs ...string
 			return true
 		}
 
-		meta := ast.GetMeta(stmt, nil)
+		if !vEnv.buildTables(rEnv, ast.GetMeta(stmt, nil)) {
+			return false
+		}
+	}
+	// 库表可能已经由其他 worker 或之前的 SQL 创建，显式切换到当前 SQL 对应的测试库
+	vEnv.Database = vEnv.DBHash(rEnv.Database)
+	return true
+}
 
-		// 由于 DB 环境可能是变的，所以需要每一次都单独的提取库表结构，整体随着 rEnv 的变动而发生变化
-		for db, table := range meta {
-			if db == "" {
-				db = rEnv.Database
+// buildTables 在测试环境中创建 SQL 使用到的库表并泵取数据
+func (vEnv *VirtualEnv) buildTables(rEnv *database.Connector, meta common.Meta) bool {
+	// 无论采样是否成功，都要通知等待这些表的其他 worker
+	var created []string
+	defer func() {
+		vEnv.tablesReady(created...)
+	}()
+
+	// 由于 DB 环境可能是变的，所以需要每一次都单独的提取库表结构，整体随着 rEnv 的变动而发生变化
+	for db, table := range meta {
+		if db == "" {
+			db = rEnv.Database
+		}
+		rEnv.Database = db
+
+		// 创建数据库环境，新建的表在表结构全部创建后一起采样
+		var tables []string
+		for _, tb := range table.Table {
+			if tb.TableName == "" {
+				continue
 			}
-			rEnv.Database = db
 
-			// 创建数据库环境
-			for _, tb := range table.Table {
-				if tb.TableName == "" {
-					continue
-				}
+			// 视图检查
+			common.Log.Debug("BuildVirtualEnv Checking view -- %s.%s", rEnv.Database, tb.TableName)
+			tbStatus, err := rEnv.ShowTableStatus(tb.TableName)
+			if err != nil {
+				common.Log.Error("BuildVirtualEnv ShowTableStatus Error : %v", err)
+				return false
+			}
 
-				// 视图检查
-				common.Log.Debug("BuildVirtualEnv Checking view -- %s.%s", rEnv.Database, tb.TableName)
-				tbStatus, err := rEnv.ShowTableStatus(tb.TableName)
+			// 如果是视图，解析语句
+			if len(tbStatus.Rows) > 0 && string(tbStatus.Rows[0].Comment) == "VIEW" {
+				var viewDDL string
+				viewDDL, err = rEnv.ShowCreateTable(tb.TableName)
 				if err != nil {
-					common.Log.Error("BuildVirtualEnv ShowTableStatus Error : %v", err)
+					common.Log.Error("BuildVirtualEnv create view failed: %v", err)
 					return false
 				}
 
-				// 如果是视图，解析语句
-				if len(tbStatus.Rows) > 0 && string(tbStatus.Rows[0].Comment) == "VIEW" {
-					var viewDDL string
-					viewDDL, err = rEnv.ShowCreateTable(tb.TableName)
-					if err != nil {
-						common.Log.Error("BuildVirtualEnv create view failed: %v", err)
-						return false
-					}
-
-					startIdx := strings.Index(viewDDL, "AS")
-					if startIdx < 0 || viewDDL == "" {
-						common.Log.Error("BuildVirtualEnv '%s' got '%s', Index: %d", tb.TableName, viewDDL, startIdx)
-						return false
-					}
-					viewDDL = viewDDL[startIdx+2:]
-					if !vEnv.BuildVirtualEnv(rEnv, viewDDL) {
-						return false
-					}
+				startIdx := strings.Index(viewDDL, "AS")
+				if startIdx < 0 || viewDDL == "" {
+					common.Log.Error("BuildVirtualEnv '%s' got '%s', Index: %d", tb.TableName, viewDDL, startIdx)
+					return false
 				}
-
-				err = vEnv.createTable(rEnv, tb.TableName)
-				if err != nil {
-					common.Log.Error("BuildVirtualEnv %s.%s Error : %v", rEnv.Database, tb.TableName, err)
+				viewDDL = viewDDL[startIdx+2:]
+				if !vEnv.buildVirtualEnv(rEnv, viewDDL) {
 					return false
 				}
 			}
+
+			ok, err := vEnv.createTableSchema(rEnv, tb.TableName)
+			if err != nil {
+				common.Log.Error("BuildVirtualEnv %s.%s Error : %v", rEnv.Database, tb.TableName, err)
+				return false
+			}
+			if ok {
+				tables = append(tables, tb.TableName)
+				created = append(created, pendingKey(rEnv.Database, tb.TableName))
+			}
+		}
+		err := vEnv.samplingTables(rEnv, tables...)
+		if err != nil {
+			common.Log.Error("BuildVirtualEnv %s.%v Error : %v", rEnv.Database, tables, err)
+			return false
 		}
 	}
 	return true
 }
 
+// isTiQuery 判断 TiDB 解析出的语句是否为需要准备库表的查询语句
+func isTiQuery(stmt tidb.StmtNode) bool {
+	switch stmt.(type) {
+	case *tidb.SelectStmt, *tidb.SetOprStmt, *tidb.UpdateStmt, *tidb.DeleteStmt, *tidb.InsertStmt:
+		return true
+	}
+	return false
+}
+
+// lockCreateDatabase 持有写锁创建数据库
+func (vEnv *VirtualEnv) lockCreateDatabase(rEnv *database.Connector) error {
+	vEnv.mu.Lock()
+	defer vEnv.mu.Unlock()
+	return vEnv.createDatabase(rEnv)
+}
+
+// createDatabase 调用方需已持有写锁
 func (vEnv *VirtualEnv) createDatabase(rEnv *database.Connector) error {
 	// 生成映射关系
 	if _, ok := vEnv.DBRef[rEnv.Database]; ok {
@@ -440,12 +608,28 @@ func (vEnv *VirtualEnv) createDatabase(rEnv *database.Connector) error {
 		的数据库环境来实现的。
 */
 func (vEnv *VirtualEnv) createTable(rEnv *database.Connector, tbName string) error {
+	created, err := vEnv.createTableSchema(rEnv, tbName)
+	if err != nil || !created {
+		return err
+	}
+	defer vEnv.tablesReady(pendingKey(rEnv.Database, tbName))
+
+	// 泵取数据
+	return vEnv.samplingTables(rEnv, tbName)
+}
+
+// createTableSchema 只创建表结构不泵取数据，表已经存在或不需要创建时 created 为 false
+// 新建的表在采样完成前记录在 pending 中，调用方采样后需调用 tablesReady；表由其他 worker 创建且仍在采样时记录到 waits 中
+func (vEnv *VirtualEnv) createTableSchema(rEnv *database.Connector, tbName string) (created bool, err error) {
+	vEnv.mu.Lock()
+	defer vEnv.mu.Unlock()
+
 	// 判断数据库是否已经创建
 	if vEnv.DBRef[rEnv.Database] == "" {
 		// 若没创建，则创建数据库
-		err := vEnv.createDatabase(rEnv)
+		err = vEnv.createDatabase(rEnv)
 		if err != nil {
-			return err
+			return false, err
 		}
 	}
 
@@ -455,12 +639,15 @@ func (vEnv *VirtualEnv) createTable(rEnv *database.Connector, tbName string) err
 
 	if strings.ToLower(tbName) == "dual" {
 		common.Log.Debug("createTable, %s no need create", tbName)
-		return nil
+		return false, nil
 	}
 
 	if vEnv.TableMap[rEnv.Database][tbName] != "" {
 		common.Log.Debug("createTable, `%s`.`%s` has created, mapping from `%s`.`%s`", vEnv.DBRef[rEnv.Database], tbName, rEnv.Database, tbName)
-		return nil
+		if wait, ok := vEnv.pending[pendingKey(rEnv.Database, tbName)]; ok {
+			vEnv.waits = append(vEnv.waits, wait)
+		}
+		return false, nil
 	}
 
 	common.Log.Debug("createTable, Database: %s, TableName: %s", vEnv.DBRef[rEnv.Database], tbName)
@@ -476,7 +663,7 @@ func (vEnv *VirtualEnv) createTable(rEnv *database.Connector, tbName string) err
 	if err != nil {
 		// 有可能是用户新建表，因此线上环境查不到
 		common.Log.Error("createTable, %s DDL Error : %v", tbName, err)
-		return err
+		return false, err
 	}
 
 	// 改变数据环境
@@ -485,17 +672,110 @@ func (vEnv *VirtualEnv) createTable(rEnv *database.Connector, tbName string) err
 	if err != nil {
 		// 有可能是用户新建表，因此线上环境查不到
 		common.Log.Error("createTable: %s Error : %v", tbName, err)
-		return err
+		return false, err
 	}
 	err = res.Rows.Close()
 	common.LogIfWarn(err, "")
+	vEnv.pending[pendingKey(rEnv.Database, tbName)] = make(chan struct{})
+	return true, nil
+}
 
-	// 泵取数据
+// pendingKey pending 中表的名称
+func pendingKey(db, table string) string {
+	return db + "." + table
+}
+
+// tablesReady 表的采样已经完成，通知等待这些表的其他 worker
+func (vEnv *VirtualEnv) tablesReady(keys ...string) {
+	vEnv.mu.Lock()
+	defer vEnv.mu.Unlock()
+	for _, key := range keys {
+		if wait, ok := vEnv.pending[key]; ok {
+			close(wait)
+			delete(vEnv.pending, key)
+		}
+	}
+}
+
+// samplingTables 从线上环境泵取数据，多张表会并发采样
+// 配置了 -fixture-dir, -fixture-dump 的表优先导入测试数据，
+// 未开启采样但开启了 -synthetic 时按线上环境的统计信息合成数据
+func (vEnv *VirtualEnv) samplingTables(rEnv *database.Connector, tables ...string) error {
+	tables, err := vEnv.loadFixtures(rEnv, tables...)
+	if err != nil {
+		return err
+	}
+	if (!common.Config.Sampling && !common.Config.Synthetic) || len(tables) == 0 {
+		return nil
+	}
+	vEnv.Database = vEnv.DBHash(rEnv.Database)
 	if common.Config.Sampling {
-		common.Log.Debug("createTable, Start Sampling data from %s.%s to %s.%s ...", rEnv.Database, tbName, vEnv.DBRef[rEnv.Database], tbName)
-		err = vEnv.SamplingData(rEnv, tbName)
+		common.Log.Debug("createTable, Start Sampling data from %s.%v to %s ...", rEnv.Database, tables, vEnv.Database)
+		return vEnv.SamplingData(rEnv, tables...)
+	}
+	common.Log.Debug("createTable, Start Synthetic data from %s.%v to %s ...", rEnv.Database, tables, vEnv.Database)
+	return vEnv.SyntheticData(rEnv, tables...)
+}
+
+// Explain 在测试环境中 EXPLAIN，SQL 中指定的库名在获取索引定义时映射为测试环境中的 optimizer_xxx
+// EXPLAIN 期间持有读锁，不会看到 HypotheticalExplain 添加的临时索引
+func (vEnv *VirtualEnv) Explain(sql string, explainType int, formatType int) (*database.ExplainInfo, error) {
+	vEnv.mu.RLock()
+	defer vEnv.mu.RUnlock()
+	return vEnv.explain(sql, explainType, formatType)
+}
+
+// explain 调用方需已持有锁，库名映射使用不加锁的 dbHash
+func (vEnv *VirtualEnv) explain(sql string, explainType int, formatType int) (*database.ExplainInfo, error) {
+	conn := *vEnv.Connector
+	conn.DBHash = vEnv.dbHash
+	return conn.Explain(sql, explainType, formatType)
+}
+
+// ProfilingReport 在测试环境中执行 Profiling，期间持有读锁，不会看到 HypotheticalExplain 添加的临时索引
+func (vEnv *VirtualEnv) ProfilingReport(query string) (*database.PSProfile, string, error) {
+	vEnv.mu.RLock()
+	defer vEnv.mu.RUnlock()
+	return vEnv.Connector.ProfilingReport(query)
+}
+
+// Trace 在测试环境中执行 OPTIMIZER TRACE，期间持有读锁，不会看到 HypotheticalExplain 添加的临时索引
+func (vEnv *VirtualEnv) Trace(sql string, params ...interface{}) ([]database.TraceRow, error) {
+	vEnv.mu.RLock()
+	defer vEnv.mu.RUnlock()
+	return vEnv.Connector.Trace(sql, params...)
+}
+
+// HypotheticalExplain 在测试环境中执行 ddl 临时添加索引前后分别 EXPLAIN，完成后执行 rollback 删除该索引
+// 从添加前的 EXPLAIN 到删除索引期间一直持有测试环境的写锁，Explain 需要读锁，因此其他 EXPLAIN 不会受临时索引影响
+func (vEnv *VirtualEnv) HypotheticalExplain(sql, ddl, rollback string) (before, after *database.ExplainInfo, err error) {
+	vEnv.mu.Lock()
+	defer vEnv.mu.Unlock()
+
+	before, err = vEnv.explain(sql, database.TraditionalExplainType, database.TraditionalFormatExplain)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, err := vEnv.Query(ddl)
+	if err != nil {
+		return nil, nil, err
+	}
+	common.LogIfWarn(res.Rows.Close(), "")
+	defer func() {
+		res, err := vEnv.Query(rollback)
+		if err != nil {
+			common.Log.Error("HypotheticalExplain rollback '%s' Error: %v", rollback, err)
+			return
+		}
+		common.LogIfWarn(res.Rows.Close(), "")
+	}()
+
+	after, err = vEnv.explain(sql, database.TraditionalExplainType, database.TraditionalFormatExplain)
+	if err != nil {
+		return nil, nil, err
 	}
-	return err
+	return before, after, nil
 }
 
 // GenTableColumns 为 Rewrite 提供的结构体初始化
@@ -507,7 +787,7 @@ func (vEnv *VirtualEnv) GenTableColumns(meta common.Meta) common.TableColumns {
 			if tb == nil {
 				break
 			}
-			td, err := vEnv.Connector.ShowColumns(tb.TableName)
+			td, err := vEnv.ShowColumns(tb.TableName)
 			if err != nil {
 				common.Log.Warn("GenTableColumns, ShowColumns Error: " + err.Error())
 				break
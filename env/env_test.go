@@ -296,3 +296,31 @@ func TestCreateDatabase(t *testing.T) {
 	rEnv.Database = orgREnvDatabase
 	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
 }
+
+func TestTablesReady(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	vEnv := NewVirtualEnv(&database.Connector{})
+	key := pendingKey("sakila", "film")
+	vEnv.pending[key] = make(chan struct{})
+
+	// 其他 worker 使用正在采样的表时需要等待采样完成
+	worker := vEnv.Clone()
+	worker.waits = append(worker.waits, worker.pending[key])
+	done := make(chan struct{})
+	go func() {
+		for _, wait := range worker.waits {
+			<-wait
+		}
+		close(done)
+	}()
+
+	vEnv.tablesReady(key, pendingKey("sakila", "actor"))
+	<-done
+	if _, ok := worker.pending[key]; ok {
+		t.Errorf("%s should be removed from pending", key)
+	}
+	if worker.Clone().waits != nil {
+		t.Error("Clone should not share waits")
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
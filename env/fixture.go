@@ -0,0 +1,366 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/XiaoMi/soar/ast"
+	"github.com/XiaoMi/soar/common"
+	"github.com/XiaoMi/soar/database"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// fixtureBatch CSV 文件每条 INSERT 语句包含的行数
+const fixtureBatch = 200
+
+// fixtureNull CSV 文件中表示 NULL 的值，与 mysqldump --tab 及 SELECT ... INTO OUTFILE 一致
+const fixtureNull = `\N`
+
+// FixtureEnabled 是否配置了 -fixture-dir 或 -fixture-dump
+func FixtureEnabled() bool {
+	return common.Config.FixtureDir != "" || len(fixtureDumpFiles()) > 0
+}
+
+// CheckFixture 使用离线数据字典时没有测试环境，无法导入 -fixture-dir, -fixture-dump 中的测试数据
+// 构建环境时 -fixture-dump 文件扫描失败也在这里返回
+func (vEnv *VirtualEnv) CheckFixture() error {
+	if vEnv.Offline() && FixtureEnabled() {
+		return fmt.Errorf("fixture-dir, fixture-dump need an available test-dsn to load data, can't be used with offline schema")
+	}
+	return vEnv.fixtureErr
+}
+
+// fixtureDumpFiles -fixture-dump 中配置的文件，忽略空的配置项
+func fixtureDumpFiles() []string {
+	var files []string
+	for _, f := range common.Config.FixtureDump {
+		if f = strings.TrimSpace(f); f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// fixtureStatement mysqldump 文件中一条 INSERT, REPLACE 语句的位置
+type fixtureStatement struct {
+	file   string
+	offset int64
+	length int
+}
+
+// FixtureDumps -fixture-dump 文件中各表 INSERT, REPLACE 语句的索引，db.table -> 语句在文件中的位置
+// 构建环境时扫描一次文件，只记录语句的位置，导入某张表时再读取并解析该表的语句
+// 没有指定数据库且文件中没有 USE 语句时 db 为空，可以导入到任意数据库的同名表中
+type FixtureDumps struct {
+	stmts map[string][]fixtureStatement
+}
+
+// fixtureUseExp, fixtureInsertExp 从语句开头识别 USE 的库名及 INSERT, REPLACE 的表名，不需要解析整条语句
+var (
+	fixtureIdent     = "(`(?:[^`]|``)+`|[0-9a-zA-Z_$]+)"
+	fixtureUseExp    = regexp.MustCompile(`(?is)^USE\s+` + fixtureIdent)
+	fixtureInsertExp = regexp.MustCompile(`(?is)^(?:INSERT|REPLACE)(?:\s+(?:LOW_PRIORITY|DELAYED|HIGH_PRIORITY|IGNORE))*(?:\s+INTO)?\s+` +
+		fixtureIdent + `(?:\s*\.\s*` + fixtureIdent + `)?`)
+)
+
+// fixtureHeadLength 识别语句类型时读取的语句开头长度
+const fixtureHeadLength = 1024
+
+// LoadFixtureDumps 扫描 mysqldump 文件，建立各表 INSERT, REPLACE 语句的索引
+func LoadFixtureDumps(files ...string) (*FixtureDumps, error) {
+	d := &FixtureDumps{stmts: make(map[string][]fixtureStatement)}
+	for _, file := range files {
+		fd, err := os.Open(file)
+		if err == nil {
+			err = d.index(fd, file)
+			fd.Close()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("fixture-dump %s: %s", file, err.Error())
+		}
+	}
+	return d, nil
+}
+
+// index 逐条扫描语句，mysqldump 中每条语句以行尾的分号结束，只有引号没有闭合时才继续读取下一行
+func (d *FixtureDumps) index(r io.Reader, file string) error {
+	reader := bufio.NewReader(r)
+	var db string
+	var buf []byte
+	var offset int64 // buf 在文件中的起始位置
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		eof := err == io.EOF
+		buf = append(buf, line...)
+		if !eof && !bytes.HasSuffix(bytes.TrimSpace(line), []byte(";")) {
+			continue
+		}
+
+		for len(buf) > 0 {
+			_, _, left := ast.SplitStatement(buf, []byte(";"))
+			if len(left) == len(buf) {
+				break
+			}
+			n := len(buf) - len(left)
+			db = d.add(buf[:n], db, file, offset)
+			buf, offset = left, offset+int64(n)
+		}
+
+		// 没有切分出语句时说明引号没有闭合，如字符串中包含行尾的分号，继续读取
+		if rest := strings.TrimSpace(string(buf)); eof && rest != "" {
+			if len(rest) > 100 {
+				rest = rest[:100] + "..."
+			}
+			return fmt.Errorf("incomplete statement: %s", rest)
+		}
+		if eof {
+			return nil
+		}
+		if strings.TrimSpace(string(buf)) == "" {
+			offset += int64(len(buf))
+			buf = buf[:0]
+		}
+	}
+}
+
+// add 按语句开头记录 INSERT, REPLACE 语句的位置，返回 USE 语句指定的当前数据库
+func (d *FixtureDumps) add(stmt []byte, db, file string, offset int64) string {
+	head := stmt
+	if len(head) > fixtureHeadLength {
+		head = head[:fixtureHeadLength]
+	}
+	sql := strings.TrimSpace(database.RemoveSQLComments(string(head)))
+	if m := fixtureUseExp.FindStringSubmatch(sql); m != nil {
+		return fixtureUnquote(m[1])
+	}
+	// CREATE TABLE, LOCK TABLES, SET 等语句不需要执行，表结构来自线上环境
+	m := fixtureInsertExp.FindStringSubmatch(sql)
+	if m == nil {
+		return db
+	}
+	schema, table := db, fixtureUnquote(m[1])
+	if m[2] != "" {
+		schema, table = table, fixtureUnquote(m[2])
+	}
+	key := strings.ToLower(schema + "." + table)
+	d.stmts[key] = append(d.stmts[key], fixtureStatement{file: file, offset: offset, length: len(stmt)})
+	return db
+}
+
+// fixtureUnquote 去掉标识符两边的反引号
+func fixtureUnquote(ident string) string {
+	if strings.HasPrefix(ident, "`") && strings.HasSuffix(ident, "`") && len(ident) > 1 {
+		return strings.Replace(ident[1:len(ident)-1], "``", "`", -1)
+	}
+	return ident
+}
+
+// Inserts 线上环境中某张表的 INSERT 语句，db.table 优先，没有时使用未指定数据库的同名表
+// 只读取并解析该表的语句，其他表中无法解析的语句不影响导入
+func (d *FixtureDumps) Inserts(db, table string) ([]*sqlparser.Insert, error) {
+	if d == nil {
+		return nil, nil
+	}
+	stmts, ok := d.stmts[strings.ToLower(db+"."+table)]
+	if !ok {
+		stmts = d.stmts[strings.ToLower("."+table)]
+	}
+
+	var inserts []*sqlparser.Insert
+	files := make(map[string]*os.File)
+	defer func() {
+		for _, fd := range files {
+			fd.Close()
+		}
+	}()
+	for _, s := range stmts {
+		fd, ok := files[s.file]
+		if !ok {
+			var err error
+			if fd, err = os.Open(s.file); err != nil {
+				return nil, err
+			}
+			files[s.file] = fd
+		}
+		buf := make([]byte, s.length)
+		if _, err := fd.ReadAt(buf, s.offset); err != nil {
+			return nil, fmt.Errorf("fixture-dump %s: %s", s.file, err.Error())
+		}
+		sql := strings.TrimSpace(database.RemoveSQLComments(string(buf)))
+		stmt, err := sqlparser.Parse(sql)
+		if err != nil {
+			if len(sql) > 100 {
+				sql = sql[:100] + "..."
+			}
+			return nil, fmt.Errorf("fixture-dump %s: %s: %s", s.file, err.Error(), sql)
+		}
+		if insert, ok := stmt.(*sqlparser.Insert); ok {
+			inserts = append(inserts, insert)
+		}
+	}
+	return inserts, nil
+}
+
+// fixtureCSVFile 线上环境中某张表在 -fixture-dir 中对应的 CSV 文件，db.table.csv 优先，不存在时返回空
+func fixtureCSVFile(dir, db, table string) string {
+	if dir == "" {
+		return ""
+	}
+	for _, name := range []string{db + "." + table + ".csv", table + ".csv"} {
+		file := filepath.Join(dir, name)
+		if _, err := os.Stat(file); err == nil {
+			return file
+		}
+	}
+	return ""
+}
+
+// FixtureCSVInserts 将 CSV 文件转换为导入 dbHash.table 的 INSERT 语句，第一行为列名
+func FixtureCSVInserts(r io.Reader, dbHash, table string) ([]string, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	var cols []string
+	for _, col := range header {
+		cols = append(cols, "`"+database.Escape(strings.TrimSpace(col), false)+"`")
+	}
+	prefix := fmt.Sprintf("INSERT INTO `%s`.`%s` (%s) VALUES ",
+		database.Escape(dbHash, false), database.Escape(table, false), strings.Join(cols, ","))
+
+	var inserts, values []string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := make([]string, len(record))
+		for i, val := range record {
+			if val == fixtureNull {
+				row[i] = "NULL"
+			} else {
+				row[i] = "'" + database.Escape(val, false) + "'"
+			}
+		}
+		values = append(values, "("+strings.Join(row, ",")+")")
+		if len(values) == fixtureBatch {
+			inserts = append(inserts, prefix+strings.Join(values, ","))
+			values = nil
+		}
+	}
+	if len(values) > 0 {
+		inserts = append(inserts, prefix+strings.Join(values, ","))
+	}
+	return inserts, nil
+}
+
+// fixtureInserts 线上环境中某张表的测试数据，转换为导入测试环境的 SQL，CSV 文件优先，没有测试数据时返回空
+func (vEnv *VirtualEnv) fixtureInserts(db, table string) ([]string, error) {
+	dbHash := vEnv.DBHash(db)
+	if file := fixtureCSVFile(common.Config.FixtureDir, db, table); file != "" {
+		fd, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer fd.Close()
+		inserts, err := FixtureCSVInserts(fd, dbHash, table)
+		if err != nil {
+			return nil, fmt.Errorf("fixture-dir %s: %s", file, err.Error())
+		}
+		return inserts, nil
+	}
+
+	stmts, err := vEnv.FixtureDumps.Inserts(db, table)
+	if err != nil {
+		return nil, err
+	}
+	var inserts []string
+	for _, stmt := range stmts {
+		// 库名映射为测试环境中的 optimizer_xxx
+		insert := *stmt
+		insert.Table.Qualifier = sqlparser.NewTableIdent(dbHash)
+		inserts = append(inserts, sqlparser.String(&insert))
+	}
+	return inserts, nil
+}
+
+// loadFixtures 将 -fixture-dir, -fixture-dump 中的测试数据导入测试环境，返回没有测试数据的表
+func (vEnv *VirtualEnv) loadFixtures(rEnv *database.Connector, tables ...string) ([]string, error) {
+	if !FixtureEnabled() || len(tables) == 0 {
+		return tables, nil
+	}
+	if vEnv.fixtureErr != nil {
+		return nil, vEnv.fixtureErr
+	}
+
+	var left []string
+	loads := make(map[string][]string)
+	for _, table := range tables {
+		inserts, err := vEnv.fixtureInserts(rEnv.Database, table)
+		if err != nil {
+			return nil, err
+		}
+		if len(inserts) == 0 {
+			left = append(left, table)
+			continue
+		}
+		loads[table] = inserts
+	}
+	if len(loads) == 0 {
+		return left, nil
+	}
+
+	// 测试数据中的表按任意顺序导入，使用同一个连接关闭外键检查
+	ctx := context.Background()
+	conn, err := vEnv.Conn.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err = conn.ExecContext(ctx, "SET SESSION FOREIGN_KEY_CHECKS = 0"); err != nil {
+		return nil, err
+	}
+	for _, table := range tables {
+		for _, insert := range loads[table] {
+			if _, err = conn.ExecContext(ctx, insert); err != nil {
+				return nil, fmt.Errorf("load fixture %s.%s Error: %s", rEnv.Database, table, err.Error())
+			}
+		}
+		if len(loads[table]) > 0 {
+			common.Log.Debug("loadFixtures, %d statements loaded into %s.%s", len(loads[table]), vEnv.DBHash(rEnv.Database), table)
+		}
+	}
+	return left, nil
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright 2018 Xiaomi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/XiaoMi/soar/common"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+func TestLoadFixtureDumps(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	d, err := LoadFixtureDumps(filepath.Join("testdata", "fixture", "sakila.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.stmts) != 3 {
+		t.Fatalf("want 3 tables, got %d: %v", len(d.stmts), d.stmts)
+	}
+	// 分号在字符串中不影响切分
+	language, err := d.Inserts("sakila", "language")
+	if err != nil || len(language) != 1 ||
+		!strings.Contains(sqlparser.String(language[0]), "'Japanese; Mandarin'") {
+		t.Errorf("sakila.language: %v, %v", language, err)
+	}
+	film, err := d.Inserts("test", "film")
+	if err != nil || len(film) != 1 || film[0].Action != sqlparser.ReplaceStr {
+		t.Errorf("test.film: %v, %v", film, err)
+	}
+	if film, _ = d.Inserts("sakila", "film"); len(film) != 1 || film[0].Action != sqlparser.InsertStr {
+		t.Errorf("sakila.film: %v", film)
+	}
+
+	// 其他表中无法解析的语句不影响导入，行尾的分号在跨行的字符串中时继续读取
+	file := filepath.Join(os.TempDir(), "soar_fixture_test.sql")
+	dump := "USE `sakila`;\n" +
+		"INSERT INTO `film` VALUES (1,'a') AS new ON DUPLICATE KEY UPDATE title = new.title;\n" +
+		"INSERT INTO `actor` VALUES (1,'a;\nb');\n" +
+		"INSERT IGNORE INTO test.actor VALUES (2,'c');\n"
+	if err = ioutil.WriteFile(file, []byte(dump), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file)
+	if d, err = LoadFixtureDumps(file); err != nil {
+		t.Fatal(err)
+	}
+	actor, err := d.Inserts("sakila", "actor")
+	if err != nil || len(actor) != 1 || !strings.Contains(sqlparser.String(actor[0]), "'a;\\nb'") {
+		t.Errorf("sakila.actor: %v, %v", actor, err)
+	}
+	if actor, err = d.Inserts("test", "actor"); err != nil || len(actor) != 1 {
+		t.Errorf("test.actor: %v, %v", actor, err)
+	}
+	if _, err = d.Inserts("sakila", "film"); err == nil {
+		t.Error("film can't be parsed, should return error")
+	}
+
+	if err = ioutil.WriteFile(file, []byte("INSERT INTO t VALUES (1,'a;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadFixtureDumps(file); err == nil {
+		t.Error("incomplete statement should return error")
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestFixtureCSVInserts(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	dir := filepath.Join("testdata", "fixture")
+	file := fixtureCSVFile(dir, "sakila", "actor")
+	if file != filepath.Join(dir, "sakila.actor.csv") {
+		t.Errorf("db.table.csv should be preferred, got %s", file)
+	}
+	if file := fixtureCSVFile(dir, "test", "actor"); file != filepath.Join(dir, "actor.csv") {
+		t.Errorf("table.csv want, got %s", file)
+	}
+	if file := fixtureCSVFile(dir, "sakila", "film"); file != "" {
+		t.Errorf("film has no CSV file, got %s", file)
+	}
+
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inserts, err := FixtureCSVInserts(strings.NewReader(string(buf)), "optimizer_xxx", "actor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "INSERT INTO `optimizer_xxx`.`actor` (`actor_id`,`first_name`,`last_name`) VALUES " +
+		`('1','PENELOPE','GUINESS'),('2','NICK, JR',NULL),('3','ED','O\'BRIEN')`
+	if len(inserts) != 1 || inserts[0] != want {
+		t.Errorf("want: %s\ngot: %v", want, inserts)
+	}
+
+	// 超过 fixtureBatch 行时拆分为多条 INSERT
+	csv := "id\n" + strings.Repeat("1\n", fixtureBatch+1)
+	inserts, err = FixtureCSVInserts(strings.NewReader(csv), "optimizer_xxx", "t")
+	if err != nil || len(inserts) != 2 {
+		t.Errorf("want 2 inserts, got %d, err: %v", len(inserts), err)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
+
+func TestCheckFixture(t *testing.T) {
+	common.Log.Debug("Entering function: %s", common.GetFunctionName())
+	orgFixtureDir := common.Config.FixtureDir
+	common.Config.FixtureDir = filepath.Join("testdata", "fixture")
+	defer func() {
+		common.Config.FixtureDir = orgFixtureDir
+	}()
+
+	offline := &VirtualEnv{Catalog: NewCatalog("sakila")}
+	if err := offline.CheckFixture(); err == nil {
+		t.Error("fixture should not be used with offline schema")
+	}
+	if err := (&VirtualEnv{}).CheckFixture(); err != nil {
+		t.Error(err)
+	}
+	common.Config.FixtureDir = ""
+	if err := offline.CheckFixture(); err != nil {
+		t.Error(err)
+	}
+	common.Log.Debug("Exiting function: %s", common.GetFunctionName())
+}
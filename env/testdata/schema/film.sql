@@ -0,0 +1,6 @@
+-- 未包含 USE 语句的建表语句
+CREATE TABLE `film` (
+  `film_id` smallint(5) unsigned NOT NULL AUTO_INCREMENT,
+  `title` varchar(255) NOT NULL,
+  PRIMARY KEY (`film_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;